@@ -26,6 +26,10 @@ var (
 	//go:embed bases/kwok.x-k8s.io_stages.yaml
 	Stage []byte
 
+	// StageTemplate is the custom resource definition for stage templates.
+	//go:embed bases/kwok.x-k8s.io_stagetemplates.yaml
+	StageTemplate []byte
+
 	// Attach is the custom resource definition for attaches.
 	//go:embed bases/kwok.x-k8s.io_attaches.yaml
 	Attach []byte
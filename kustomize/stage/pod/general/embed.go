@@ -0,0 +1,60 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package general contains the general pod for kwok.
+package general
+
+import (
+	_ "embed"
+)
+
+var (
+	// DefaultPodCreate is the default pod create yaml.
+	//go:embed pod-create.yaml
+	DefaultPodCreate string
+
+	// DefaultPodInitContainerRunning is the default pod init container running yaml.
+	//go:embed pod-init-container-running.yaml
+	DefaultPodInitContainerRunning string
+
+	// DefaultPodInitContainerCompleted is the default pod init container completed yaml.
+	//go:embed pod-init-container-completed.yaml
+	DefaultPodInitContainerCompleted string
+
+	// DefaultPodInitialized is the default pod initialized yaml.
+	//go:embed pod-initialized.yaml
+	DefaultPodInitialized string
+
+	// DefaultPodReady is the default pod ready yaml.
+	//go:embed pod-ready.yaml
+	DefaultPodReady string
+
+	// DefaultPodComplete is the default pod complete yaml.
+	//go:embed pod-complete.yaml
+	DefaultPodComplete string
+
+	// DefaultPodSidecarContainerTerminated is the default pod sidecar container terminated yaml.
+	//go:embed pod-sidecar-container-terminated.yaml
+	DefaultPodSidecarContainerTerminated string
+
+	// DefaultPodRemoveFinalizer is the default pod remove finalizer yaml.
+	//go:embed pod-remove-finalizer.yaml
+	DefaultPodRemoveFinalizer string
+
+	// DefaultPodDelete is the default pod delete yaml.
+	//go:embed pod-delete.yaml
+	DefaultPodDelete string
+)
@@ -206,6 +206,13 @@ func (in *KwokConfigurationOptions) DeepCopyInto(out *KwokConfigurationOptions)
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.StageForRefs != nil {
+		in, out := &in.StageForRefs, &out.StageForRefs
+		*out = make([]StageForRef, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.ManageAllNodes != nil {
 		in, out := &in.ManageAllNodes, &out.ManageAllNodes
 		*out = new(bool)
@@ -420,6 +427,27 @@ func (in *Port) DeepCopy() *Port {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StageForRef) DeepCopyInto(out *StageForRef) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StageForRef.
+func (in *StageForRef) DeepCopy() *StageForRef {
+	if in == nil {
+		return nil
+	}
+	out := new(StageForRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Volume) DeepCopyInto(out *Volume) {
 	*out = *in
@@ -344,3 +344,25 @@ func ConvertToInternalMetric(in *v1alpha1.Metric) (*Metric, error) {
 	}
 	return &out, nil
 }
+
+// ConvertToV1Alpha1StageTemplate converts an internal version StageTemplate to a v1alpha1.StageTemplate.
+func ConvertToV1Alpha1StageTemplate(in *StageTemplate) (*v1alpha1.StageTemplate, error) {
+	var out v1alpha1.StageTemplate
+	out.APIVersion = v1alpha1.GroupVersion.String()
+	out.Kind = v1alpha1.StageTemplateKind
+	err := Convert_internalversion_StageTemplate_To_v1alpha1_StageTemplate(in, &out, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ConvertToInternalStageTemplate converts a v1alpha1.StageTemplate to an internal version.
+func ConvertToInternalStageTemplate(in *v1alpha1.StageTemplate) (*StageTemplate, error) {
+	var out StageTemplate
+	err := Convert_v1alpha1_StageTemplate_To_internalversion_StageTemplate(in, &out, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
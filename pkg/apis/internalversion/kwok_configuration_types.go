@@ -35,8 +35,14 @@ type KwokConfigurationOptions struct {
 	EnableCRDs []string
 
 	// EnableStageForRefs is a list of refs to enable stage for.
+	// It only applies to the stages from the --config flag,
+	// the refs of the Stage CRD objects are watched as soon as the stages appear.
 	EnableStageForRefs []string
 
+	// StageForRefs is a list of refs to enable stage for, with the options of their stage controllers.
+	// The refs listed here are enabled in addition to the ones in EnableStageForRefs.
+	StageForRefs []StageForRef
+
 	// The default IP assigned to the Pod on maintained Nodes.
 	CIDR string
 
@@ -100,4 +106,52 @@ type KwokConfigurationOptions struct {
 
 	// NodeLeaseParallelism is the number of NodeLeases that are allowed to be processed in parallel.
 	NodeLeaseParallelism uint
+
+	// TimeScale is the scale of the simulated time to the real time,
+	// e.g. 10 makes the delays of the stages and the renew of the node leases 10 times as fast,
+	// and the time used by the templates and the CEL expressions runs 10 times as fast from the start.
+	// If it is 0 or 1, the real time is used.
+	TimeScale float64
+
+	// RandomSeed is the seed of the random sources used to choose the stages and compute the delays.
+	// Each resource has its own random source derived from the seed and its UID,
+	// so the path of a resource through the stages is reproducible.
+	// If it is 0, the randomness is not reproducible.
+	RandomSeed int64
+
+	// EnableStageHistoryAnnotation records the recent stage transitions of the resources
+	// in the kwok.x-k8s.io/stage-history annotation, it costs an extra patch for each transition.
+	// The transitions are always available at /debug/stages/{kind}/{namespace}/{name} of the server.
+	EnableStageHistoryAnnotation bool
+
+	// EnablePodAdmission rejects the pods bound to the nodes like the kubelet,
+	// the pods whose requests do not fit the allocatable of the node, or whose node affinity does not match the node,
+	// are moved to Failed with the reason of the kubelet, e.g. OutOfcpu, OutOfmemory, OutOfpods or NodeAffinity.
+	EnablePodAdmission bool
+
+	// EnableNodePressureEviction evicts the pods from the nodes under pressure like the kubelet,
+	// when a node has the MemoryPressure or DiskPressure condition, it is tainted,
+	// and its pods are moved to Failed with the reason Evicted one at a time,
+	// the BestEffort pods first, then the Burstable pods over their requests, then the others, each by priority.
+	EnableNodePressureEviction bool
+
+	// EnableProbeSimulation simulates the startup, readiness and liveness probes of the containers of the running pods,
+	// the results of the probes are scripted by the kwok.x-k8s.io/probe-results annotation of the pods, and succeed by default.
+	EnableProbeSimulation bool
+}
+
+// StageForRef holds the options of the stage controller of a ref.
+type StageForRef struct {
+	// Ref is the ref to enable stage for, in the same format as EnableStageForRefs.
+	Ref string
+	// Parallelism is the number of stages of the ref that are allowed to be played in parallel.
+	// If it is 0, the stages are played one by one.
+	Parallelism uint
+	// LabelSelector only watches the resources that match the label selector.
+	LabelSelector string
+	// FieldSelector only watches the resources that match the field selector.
+	FieldSelector string
+	// Namespaces only watches the resources in the namespaces, it is only valid for namespaced resources.
+	// If it is empty, the resources in all namespaces are watched.
+	Namespaces []string
 }
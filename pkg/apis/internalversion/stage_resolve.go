@@ -0,0 +1,253 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internalversion
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// includeRegexp matches the `include "<name>"` in the templates.
+	includeRegexp = regexp.MustCompile(`\binclude\s+"([^"]+)"`)
+	// defineRegexp matches the `define "<name>"` in the templates.
+	defineRegexp = regexp.MustCompile(`\bdefine\s+"([^"]+)"`)
+)
+
+// ResolveStages returns copies of the stages with the extends and the included templates resolved.
+// The stages that failed to be resolved are skipped and the errors are returned together.
+func ResolveStages(stages []*Stage, templates []*StageTemplate) ([]*Stage, error) {
+	out, resolveErrs := ResolveStagesWithErrors(stages, templates)
+	var errs []error
+	for _, stage := range stages {
+		if err, ok := resolveErrs[stage.Name]; ok {
+			errs = append(errs, fmt.Errorf("stage %q: %w", stage.Name, err))
+		}
+	}
+	return out, errors.Join(errs...)
+}
+
+// ResolveStagesWithErrors is like ResolveStages, but returns the error of each stage that cannot be resolved by its name.
+func ResolveStagesWithErrors(stages []*Stage, templates []*StageTemplate) ([]*Stage, map[string]error) {
+	r := &stageResolver{
+		stages:    map[string]*Stage{},
+		resolved:  map[string]*Stage{},
+		resolving: map[string]bool{},
+		templates: map[string]string{},
+	}
+	for _, stage := range stages {
+		r.stages[stage.Name] = stage
+	}
+	for _, template := range templates {
+		r.templates[template.Name] = template.Spec.Template
+	}
+
+	errs := map[string]error{}
+	out := make([]*Stage, 0, len(stages))
+	for _, stage := range stages {
+		spec, err := r.resolveExtends(stage.Name)
+		if err != nil {
+			errs[stage.Name] = err
+			continue
+		}
+		err = r.resolveIncludes(&spec.Spec.Next)
+		if err != nil {
+			errs[stage.Name] = err
+			continue
+		}
+		out = append(out, spec)
+	}
+	return out, errs
+}
+
+type stageResolver struct {
+	stages    map[string]*Stage
+	resolved  map[string]*Stage
+	resolving map[string]bool
+	templates map[string]string
+}
+
+// resolveExtends returns a copy of the named stage merged with the stages it extends.
+func (r *stageResolver) resolveExtends(name string) (*Stage, error) {
+	if stage, ok := r.resolved[name]; ok {
+		return stage.DeepCopy(), nil
+	}
+	stage, ok := r.stages[name]
+	if !ok {
+		return nil, fmt.Errorf("extends stage %q not found", name)
+	}
+	if r.resolving[name] {
+		return nil, fmt.Errorf("circular extends of stage %q", name)
+	}
+
+	out := stage.DeepCopy()
+	if out.Spec.Extends != "" {
+		r.resolving[name] = true
+		parent, err := r.resolveExtends(out.Spec.Extends)
+		delete(r.resolving, name)
+		if err != nil {
+			return nil, err
+		}
+		mergeStageSpec(&out.Spec, &parent.Spec)
+	}
+	out.Spec.Extends = ""
+
+	r.resolved[name] = out
+	return out.DeepCopy(), nil
+}
+
+// mergeStageSpec fills the unset fields of spec with the fields of parent.
+// A field is unset if it is the zero value, so a bool like ImmediateNextStage or Next.Delete
+// set to true in the parent can't be overridden to false in spec.
+func mergeStageSpec(spec *StageSpec, parent *StageSpec) {
+	if spec.ResourceRef.Kind == "" {
+		spec.ResourceRef = parent.ResourceRef
+	}
+	if spec.Selector == nil {
+		spec.Selector = parent.Selector
+	}
+	if spec.Weight == 0 {
+		spec.Weight = parent.Weight
+	}
+	if spec.Priority == 0 {
+		spec.Priority = parent.Priority
+	}
+	if spec.Group == "" {
+		spec.Group = parent.Group
+	}
+	if spec.Delay == nil {
+		spec.Delay = parent.Delay
+	}
+	if spec.Repeat == nil {
+		spec.Repeat = parent.Repeat
+	}
+	if !spec.ImmediateNextStage {
+		spec.ImmediateNextStage = parent.ImmediateNextStage
+	}
+
+	next, parentNext := &spec.Next, &parent.Next
+	if next.Event == nil {
+		next.Event = parentNext.Event
+	}
+	if next.Finalizers == nil {
+		next.Finalizers = parentNext.Finalizers
+	}
+	if !next.Delete {
+		next.Delete = parentNext.Delete
+	}
+	if next.StatusTemplate == "" {
+		next.StatusTemplate = parentNext.StatusTemplate
+	}
+	if next.Patches == nil {
+		next.Patches = parentNext.Patches
+	}
+	if next.Create == nil {
+		next.Create = parentNext.Create
+	}
+	if next.Webhook == nil {
+		next.Webhook = parentNext.Webhook
+	}
+	if next.Drain == nil {
+		next.Drain = parentNext.Drain
+	}
+}
+
+// resolveIncludes prepends the definitions of the included templates to the templates of next.
+func (r *stageResolver) resolveIncludes(next *StageNext) error {
+	var err error
+	next.StatusTemplate, err = r.withIncludes(next.StatusTemplate)
+	if err != nil {
+		return err
+	}
+	for i := range next.Patches {
+		next.Patches[i].Template, err = r.withIncludes(next.Patches[i].Template)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range next.Create {
+		next.Create[i].Template, err = r.withIncludes(next.Create[i].Template)
+		if err != nil {
+			return err
+		}
+		next.Create[i].IdempotencyKey, err = r.withIncludes(next.Create[i].IdempotencyKey)
+		if err != nil {
+			return err
+		}
+	}
+	if next.Event != nil {
+		next.Event.Reason, err = r.withIncludes(next.Event.Reason)
+		if err != nil {
+			return err
+		}
+		next.Event.Message, err = r.withIncludes(next.Event.Message)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withIncludes returns the text with the definitions of the templates it includes, directly or indirectly.
+// The templates already defined in the text are kept as is, so that the resolving is idempotent.
+func (r *stageResolver) withIncludes(text string) (string, error) {
+	defined := map[string]struct{}{}
+	for _, match := range defineRegexp.FindAllStringSubmatch(text, -1) {
+		defined[match[1]] = struct{}{}
+	}
+
+	names := map[string]struct{}{}
+	pending := []string{text}
+	for len(pending) != 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, match := range includeRegexp.FindAllStringSubmatch(current, -1) {
+			name := match[1]
+			if _, ok := defined[name]; ok {
+				continue
+			}
+			if _, ok := names[name]; ok {
+				continue
+			}
+			template, ok := r.templates[name]
+			if !ok {
+				return "", fmt.Errorf("included template %q not found", name)
+			}
+			names[name] = struct{}{}
+			pending = append(pending, template)
+		}
+	}
+	if len(names) == 0 {
+		return text, nil
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var buf strings.Builder
+	for _, name := range sorted {
+		fmt.Fprintf(&buf, "{{- define %q }}%s{{ end -}}\n", name, r.templates[name])
+	}
+	buf.WriteString(text)
+	return buf.String(), nil
+}
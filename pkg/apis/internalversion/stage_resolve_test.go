@@ -0,0 +1,307 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internalversion
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/kwok/pkg/utils/format"
+)
+
+func TestResolveStages(t *testing.T) {
+	podRef := StageResourceRef{APIGroup: "v1", Kind: "Pod"}
+	selector := &StageSelector{MatchLabels: map[string]string{"app": "foo"}}
+	delay := &StageDelay{DurationMilliseconds: format.Ptr[int64](1000)}
+
+	tests := []struct {
+		name      string
+		stages    []*Stage
+		templates []*StageTemplate
+		want      []*Stage
+		wantErr   bool
+	}{
+		{
+			name: "extends",
+			stages: []*Stage{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "base"},
+					Spec: StageSpec{
+						ResourceRef: podRef,
+						Selector:    selector,
+						Delay:       delay,
+						Next: StageNext{
+							StatusTemplate: "phase: Running",
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "child"},
+					Spec: StageSpec{
+						Extends: "base",
+						Weight:  2,
+						Next: StageNext{
+							Delete: true,
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "grandchild"},
+					Spec: StageSpec{
+						Extends: "child",
+						Next: StageNext{
+							StatusTemplate: "phase: Failed",
+						},
+					},
+				},
+			},
+			want: []*Stage{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "base"},
+					Spec: StageSpec{
+						ResourceRef: podRef,
+						Selector:    selector,
+						Delay:       delay,
+						Next: StageNext{
+							StatusTemplate: "phase: Running",
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "child"},
+					Spec: StageSpec{
+						ResourceRef: podRef,
+						Selector:    selector,
+						Weight:      2,
+						Delay:       delay,
+						Next: StageNext{
+							Delete:         true,
+							StatusTemplate: "phase: Running",
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "grandchild"},
+					Spec: StageSpec{
+						ResourceRef: podRef,
+						Selector:    selector,
+						Weight:      2,
+						Delay:       delay,
+						Next: StageNext{
+							Delete:         true,
+							StatusTemplate: "phase: Failed",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "extends can't override bools to false",
+			stages: []*Stage{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "base"},
+					Spec: StageSpec{
+						ResourceRef:        podRef,
+						ImmediateNextStage: true,
+						Next: StageNext{
+							Delete: true,
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "child"},
+					Spec: StageSpec{
+						Extends:            "base",
+						ImmediateNextStage: false,
+						Next: StageNext{
+							Delete: false,
+						},
+					},
+				},
+			},
+			want: []*Stage{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "base"},
+					Spec: StageSpec{
+						ResourceRef:        podRef,
+						ImmediateNextStage: true,
+						Next: StageNext{
+							Delete: true,
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "child"},
+					Spec: StageSpec{
+						ResourceRef:        podRef,
+						ImmediateNextStage: true,
+						Next: StageNext{
+							Delete: true,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "extends missing and circular",
+			stages: []*Stage{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "missing"},
+					Spec: StageSpec{
+						Extends: "not-found",
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "a"},
+					Spec: StageSpec{
+						Extends: "b",
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "b"},
+					Spec: StageSpec{
+						Extends: "a",
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "ok"},
+					Spec: StageSpec{
+						ResourceRef: podRef,
+					},
+				},
+			},
+			want: []*Stage{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "ok"},
+					Spec: StageSpec{
+						ResourceRef: podRef,
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "include",
+			stages: []*Stage{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "include"},
+					Spec: StageSpec{
+						ResourceRef: podRef,
+						Next: StageNext{
+							StatusTemplate: `{{ include "status" . }}`,
+							Patches: []StagePatch{
+								{
+									Template: `foo: bar`,
+								},
+							},
+							Event: &StageEvent{
+								Type:    "Normal",
+								Reason:  "Started",
+								Message: `Started with {{ include "phase" . }}`,
+							},
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "include-missing"},
+					Spec: StageSpec{
+						ResourceRef: podRef,
+						Next: StageNext{
+							StatusTemplate: `{{ include "not-found" . }}`,
+						},
+					},
+				},
+			},
+			templates: []*StageTemplate{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "status"},
+					Spec: StageTemplateSpec{
+						Template: `phase: {{ include "phase" . }}`,
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "phase"},
+					Spec: StageTemplateSpec{
+						Template: `Running`,
+					},
+				},
+			},
+			want: []*Stage{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "include"},
+					Spec: StageSpec{
+						ResourceRef: podRef,
+						Next: StageNext{
+							StatusTemplate: `{{- define "phase" }}Running{{ end -}}` + "\n" +
+								`{{- define "status" }}phase: {{ include "phase" . }}{{ end -}}` + "\n" +
+								`{{ include "status" . }}`,
+							Patches: []StagePatch{
+								{
+									Template: `foo: bar`,
+								},
+							},
+							Event: &StageEvent{
+								Type:    "Normal",
+								Reason:  "Started",
+								Message: `{{- define "phase" }}Running{{ end -}}` + "\n" + `Started with {{ include "phase" . }}`,
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "include already resolved",
+			stages: []*Stage{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "resolved"},
+					Spec: StageSpec{
+						ResourceRef: podRef,
+						Next: StageNext{
+							StatusTemplate: `{{- define "status" }}phase: Running{{ end -}}` + "\n" + `{{ include "status" . }}`,
+						},
+					},
+				},
+			},
+			want: []*Stage{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "resolved"},
+					Spec: StageSpec{
+						ResourceRef: podRef,
+						Next: StageNext{
+							StatusTemplate: `{{- define "status" }}phase: Running{{ end -}}` + "\n" + `{{ include "status" . }}`,
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveStages(tt.stages, tt.templates)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveStages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ResolveStages() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -31,6 +31,11 @@ type Stage struct {
 
 // StageSpec defines the specification for Stage.
 type StageSpec struct {
+	// Extends is the name of the stage to inherit from,
+	// the fields set in this stage override the fields of the inherited stage.
+	// The fields left to their zero values, like false or 0, are inherited,
+	// so a field of the inherited stage can't be overridden to its zero value, e.g. immediateNextStage or next.delete to false.
+	Extends string
 	// ResourceRef specifies the Kind and version of the resource.
 	ResourceRef StageResourceRef
 	// Selector specifies the stags will be applied to the selected resource.
@@ -38,8 +43,17 @@ type StageSpec struct {
 	// Weight means the current stage, in case of multiple stages,
 	// a random stage will be matched as the next stage based on the weight.
 	Weight int
+	// Priority means the current stage, in case of multiple stages,
+	// only the matched stages with the highest priority are chosen between by the weight.
+	Priority int
+	// Group means the stages in different groups are applied to the same resource independently,
+	// e.g. one group for the status and another for the labels.
+	// At most one stage of each group is played at a time, the stages without a group are in the same group.
+	Group string
 	// Delay means there is a delay in this stage.
 	Delay *StageDelay
+	// Repeat means the stage can be played repeatedly on the same resource, with a growing delay.
+	Repeat *StageRepeat
 	// Next indicates that this stage will be moved to.
 	Next StageNext
 	// ImmediateNextStage means that the next stage of matching is performed immediately, without waiting for the Apiserver to push.
@@ -71,6 +85,69 @@ type StageDelay struct {
 	// If it is a time.Time type, getting the value will be minus time.Now() to get JitterDurationMilliseconds
 	// If it is a string type, the value get will be parsed by time.ParseDuration.
 	JitterDurationFrom *ExpressionFromSource
+	// Distribution is the distribution which the delay is sampled from.
+	// It is exclusive with the other fields.
+	Distribution *StageDelayDistribution
+}
+
+// StageDelayDistribution describes the distribution which the delay is sampled from.
+type StageDelayDistribution struct {
+	// Type is the type of the distribution.
+	Type StageDelayDistributionType
+	// MeanMilliseconds is the mean of the normal and exponential distributions.
+	MeanMilliseconds *int64
+	// StdDevMilliseconds is the standard deviation of the normal distribution.
+	StdDevMilliseconds *int64
+	// MedianMilliseconds is the median of the log-normal distribution.
+	MedianMilliseconds *int64
+	// Sigma is the standard deviation of the logarithm of the log-normal distribution.
+	Sigma *float64
+	// ScaleMilliseconds is the minimum value of the Pareto distribution.
+	ScaleMilliseconds *int64
+	// Shape is the tail index of the Pareto distribution, the smaller the longer the tail.
+	Shape *float64
+	// Percentiles is the histogram of the empirical distribution,
+	// the delay is interpolated linearly between the percentiles.
+	Percentiles []StageDelayPercentile
+	// MinMilliseconds is the lower bound of the sampled delay.
+	MinMilliseconds *int64
+	// MaxMilliseconds is the upper bound of the sampled delay.
+	MaxMilliseconds *int64
+}
+
+// StageDelayDistributionType is the type of the distribution.
+type StageDelayDistributionType string
+
+const (
+	// StageDelayDistributionTypeNormal is the normal distribution.
+	StageDelayDistributionTypeNormal StageDelayDistributionType = "normal"
+	// StageDelayDistributionTypeLogNormal is the log-normal distribution.
+	StageDelayDistributionTypeLogNormal StageDelayDistributionType = "logNormal"
+	// StageDelayDistributionTypeExponential is the exponential distribution.
+	StageDelayDistributionTypeExponential StageDelayDistributionType = "exponential"
+	// StageDelayDistributionTypePareto is the Pareto distribution.
+	StageDelayDistributionTypePareto StageDelayDistributionType = "pareto"
+	// StageDelayDistributionTypeEmpirical is the empirical distribution.
+	StageDelayDistributionTypeEmpirical StageDelayDistributionType = "empirical"
+)
+
+// StageDelayPercentile is a point of the empirical distribution.
+type StageDelayPercentile struct {
+	// Percentile is the percentile of the point, between 0 and 100.
+	Percentile float64
+	// DurationMilliseconds is the delay at the percentile.
+	DurationMilliseconds int64
+}
+
+// StageRepeat describes how the stage is played repeatedly on the same resource.
+type StageRepeat struct {
+	// MaxCount is the max number of times the stage is played on the same resource,
+	// the stage does not match the resource anymore after that. 0 means no limit.
+	MaxCount int64
+	// BackoffMultiplier is the factor the delay is multiplied by after each attempt.
+	BackoffMultiplier *float64
+	// MaxDelayMilliseconds is the upper bound of the delay after the backoff.
+	MaxDelayMilliseconds *int64
 }
 
 // StageNext describes a stage will be moved to.
@@ -83,8 +160,95 @@ type StageNext struct {
 	Delete bool
 	// StatusTemplate indicates the template for modifying the status of the resource in the next.
 	StatusTemplate string
+	// Patches means that the resource will be patched, they are applied in order.
+	Patches []StagePatch
+	// Create means that the resources will be created, they are created in order.
+	Create []StageCreate
+	// Webhook means that the next of the resource is computed by the webhook,
+	// the patches, events and delete in the response are applied after the others.
+	Webhook *StageWebhook
+	// Drain means that the node will be cordoned and its pods will be evicted,
+	// it is only valid for nodes.
+	Drain *StageDrain
+}
+
+// StageDrain describes the drain of a node.
+type StageDrain struct {
+	// TimeoutMilliseconds is the time to retry the evictions blocked by the PodDisruptionBudgets,
+	// the pods that are not evicted in time are left on the node.
+	// If it is not set, the evictions are retried for 5 minutes.
+	TimeoutMilliseconds *int64
+	// GracePeriodSeconds overrides the termination grace period of the evicted pods.
+	GracePeriodSeconds *int64
+	// DeleteEmptyDirData means the pods using emptyDir volumes are evicted as well,
+	// otherwise they are left on the node.
+	DeleteEmptyDirData bool
+}
+
+// StageCreate describes a resource to be created.
+type StageCreate struct {
+	// Template indicates the template for the manifest of the resource, the namespace defaults to the namespace of the resource.
+	Template string
+	// OwnerReference means the resource is owned by the resource which the stage is played on,
+	// so it is garbage collected along with it.
+	OwnerReference bool
+	// IdempotencyKey indicates the template for the key which identifies the created resource,
+	// it is used to name the resource if the manifest has no name,
+	// so playing the stage again does not create a duplicate.
+	IdempotencyKey string
+}
+
+// StagePatch describes the patch for the resource.
+type StagePatch struct {
+	// Subresource indicates the name of the subresource that will be patched.
+	// Such as "status" or "scale", empty means the resource itself.
+	Subresource string
+	// Root indicates the root of the template calculated by the patch.
+	// Such as "metadata" or "spec", empty means the template is the whole patch.
+	// It is not allowed for json patch.
+	Root string
+	// Template indicates the template for modifying the resource in the next.
+	Template string
+	// Type indicates the type of the patch.
+	Type *StagePatchType
+}
+
+// StagePatchType is the type of the patch.
+type StagePatchType string
+
+const (
+	// StagePatchTypeJSONPatch is the JSON patch type.
+	StagePatchTypeJSONPatch StagePatchType = "json"
+	// StagePatchTypeMergePatch is the merge patch type.
+	StagePatchTypeMergePatch StagePatchType = "merge"
+	// StagePatchTypeStrategicMergePatch is the strategic merge patch type.
+	StagePatchTypeStrategicMergePatch StagePatchType = "strategic"
+)
+
+// StageWebhook describes the webhook which computes the next of the resource.
+type StageWebhook struct {
+	// URL is the URL of the webhook, the resource, the stage name and the attempt are POSTed to it.
+	URL string
+	// TimeoutMilliseconds is the timeout of the request to the webhook,
+	// the worker which plays the stage plays no other stage while it waits for the webhook, so it should be short.
+	TimeoutMilliseconds *int64
+	// CABundle is the PEM encoded CA bundle which is used to verify the certificate of the webhook.
+	CABundle []byte
+	// FailurePolicy defines how the failures of the webhook are handled,
+	// Fail means the stage fails, Ignore means the stage is played without the response of the webhook.
+	FailurePolicy *StageWebhookFailurePolicy
 }
 
+// StageWebhookFailurePolicy is the failure policy of the webhook.
+type StageWebhookFailurePolicy string
+
+const (
+	// StageWebhookFailurePolicyFail means the stage fails if the webhook fails.
+	StageWebhookFailurePolicyFail StageWebhookFailurePolicy = "Fail"
+	// StageWebhookFailurePolicyIgnore means the stage is played without the webhook if the webhook fails.
+	StageWebhookFailurePolicyIgnore StageWebhookFailurePolicy = "Ignore"
+)
+
 // StageFinalizers describes the modifications in the finalizers of a resource.
 type StageFinalizers struct {
 	// Add means that the Finalizers will be added to the resource.
@@ -106,9 +270,44 @@ type StageEvent struct {
 	// Type is the type of this event (Normal, Warning), It is machine-readable.
 	Type string
 	// Reason is why the action was taken. It is human-readable.
+	// It is rendered as a template with the resource, like the statusTemplate.
 	Reason string
 	// Message is a human-readable description of the status of this operation.
+	// It is rendered as a template with the resource, like the statusTemplate.
 	Message string
+	// SampleRate is the fraction of the plays of the stage which record the event, between 0 and 1.
+	// If it is not set, the event is recorded on every play.
+	SampleRate *float64
+	// RateLimit limits the rate of the events recorded by the stage across all resources,
+	// the events over the limit are dropped.
+	RateLimit *StageEventRateLimit
+	// Correlator configures the aggregation and the spam filter of the events recorded by the stage,
+	// the defaults of the Kubernetes event correlator are used if it is not set.
+	Correlator *StageEventCorrelator
+}
+
+// StageEventRateLimit is a token bucket limiting the rate of the events.
+type StageEventRateLimit struct {
+	// QPS is the average number of events per second.
+	QPS float64
+	// Burst is the max number of events recorded at once.
+	Burst int
+}
+
+// StageEventCorrelator configures the correlator of the events, 0 means the default of the field.
+type StageEventCorrelator struct {
+	// MaxEvents is the number of similar events of a resource before they are aggregated into one.
+	// The default is 10.
+	MaxEvents int
+	// MaxIntervalSeconds is the time after the last similar event before an event is not aggregated anymore.
+	// The default is 600.
+	MaxIntervalSeconds int
+	// BurstSize is the burst of the spam filter of the events of a resource.
+	// The default is 25.
+	BurstSize int
+	// QPS is the refill rate of the spam filter of the events of a resource.
+	// The default is 1/300.
+	QPS float64
 }
 
 // StageSelector is a resource selector. the result of matchLabels and matchAnnotations and
@@ -125,6 +324,9 @@ type StageSelector struct {
 	MatchAnnotations map[string]string
 	// MatchExpressions is a list of label selector requirements. The requirements are ANDed.
 	MatchExpressions []SelectorRequirement
+	// MatchCEL is a list of CEL expressions which must evaluate to true, the resource is available as `self`.
+	// The requirements are ANDed.
+	MatchCEL []string
 }
 
 // SelectorRequirement is a resource selector requirement is a selector that contains values, a key,
@@ -159,4 +361,7 @@ const (
 type ExpressionFromSource struct {
 	// ExpressionFrom is the expression used to get the value.
 	ExpressionFrom string
+	// CEL is the CEL expression used to get the value, the resource is available as `self`.
+	// It is exclusive with ExpressionFrom.
+	CEL string
 }
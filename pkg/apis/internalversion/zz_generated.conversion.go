@@ -499,6 +499,16 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*StageCreate)(nil), (*v1alpha1.StageCreate)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_internalversion_StageCreate_To_v1alpha1_StageCreate(a.(*StageCreate), b.(*v1alpha1.StageCreate), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*v1alpha1.StageCreate)(nil), (*StageCreate)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_StageCreate_To_internalversion_StageCreate(a.(*v1alpha1.StageCreate), b.(*StageCreate), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*StageDelay)(nil), (*v1alpha1.StageDelay)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_internalversion_StageDelay_To_v1alpha1_StageDelay(a.(*StageDelay), b.(*v1alpha1.StageDelay), scope)
 	}); err != nil {
@@ -509,6 +519,36 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*StageDelayDistribution)(nil), (*v1alpha1.StageDelayDistribution)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_internalversion_StageDelayDistribution_To_v1alpha1_StageDelayDistribution(a.(*StageDelayDistribution), b.(*v1alpha1.StageDelayDistribution), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*v1alpha1.StageDelayDistribution)(nil), (*StageDelayDistribution)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_StageDelayDistribution_To_internalversion_StageDelayDistribution(a.(*v1alpha1.StageDelayDistribution), b.(*StageDelayDistribution), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*StageDelayPercentile)(nil), (*v1alpha1.StageDelayPercentile)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_internalversion_StageDelayPercentile_To_v1alpha1_StageDelayPercentile(a.(*StageDelayPercentile), b.(*v1alpha1.StageDelayPercentile), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*v1alpha1.StageDelayPercentile)(nil), (*StageDelayPercentile)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_StageDelayPercentile_To_internalversion_StageDelayPercentile(a.(*v1alpha1.StageDelayPercentile), b.(*StageDelayPercentile), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*StageDrain)(nil), (*v1alpha1.StageDrain)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_internalversion_StageDrain_To_v1alpha1_StageDrain(a.(*StageDrain), b.(*v1alpha1.StageDrain), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*v1alpha1.StageDrain)(nil), (*StageDrain)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_StageDrain_To_internalversion_StageDrain(a.(*v1alpha1.StageDrain), b.(*StageDrain), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*StageEvent)(nil), (*v1alpha1.StageEvent)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_internalversion_StageEvent_To_v1alpha1_StageEvent(a.(*StageEvent), b.(*v1alpha1.StageEvent), scope)
 	}); err != nil {
@@ -519,6 +559,26 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*StageEventCorrelator)(nil), (*v1alpha1.StageEventCorrelator)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_internalversion_StageEventCorrelator_To_v1alpha1_StageEventCorrelator(a.(*StageEventCorrelator), b.(*v1alpha1.StageEventCorrelator), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*v1alpha1.StageEventCorrelator)(nil), (*StageEventCorrelator)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_StageEventCorrelator_To_internalversion_StageEventCorrelator(a.(*v1alpha1.StageEventCorrelator), b.(*StageEventCorrelator), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*StageEventRateLimit)(nil), (*v1alpha1.StageEventRateLimit)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_internalversion_StageEventRateLimit_To_v1alpha1_StageEventRateLimit(a.(*StageEventRateLimit), b.(*v1alpha1.StageEventRateLimit), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*v1alpha1.StageEventRateLimit)(nil), (*StageEventRateLimit)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_StageEventRateLimit_To_internalversion_StageEventRateLimit(a.(*v1alpha1.StageEventRateLimit), b.(*StageEventRateLimit), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*StageFinalizers)(nil), (*v1alpha1.StageFinalizers)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_internalversion_StageFinalizers_To_v1alpha1_StageFinalizers(a.(*StageFinalizers), b.(*v1alpha1.StageFinalizers), scope)
 	}); err != nil {
@@ -529,6 +589,16 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*StageForRef)(nil), (*configv1alpha1.StageForRef)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_internalversion_StageForRef_To_v1alpha1_StageForRef(a.(*StageForRef), b.(*configv1alpha1.StageForRef), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*configv1alpha1.StageForRef)(nil), (*StageForRef)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_StageForRef_To_internalversion_StageForRef(a.(*configv1alpha1.StageForRef), b.(*StageForRef), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*StageNext)(nil), (*v1alpha1.StageNext)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_internalversion_StageNext_To_v1alpha1_StageNext(a.(*StageNext), b.(*v1alpha1.StageNext), scope)
 	}); err != nil {
@@ -539,6 +609,26 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*StagePatch)(nil), (*v1alpha1.StagePatch)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_internalversion_StagePatch_To_v1alpha1_StagePatch(a.(*StagePatch), b.(*v1alpha1.StagePatch), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*v1alpha1.StagePatch)(nil), (*StagePatch)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_StagePatch_To_internalversion_StagePatch(a.(*v1alpha1.StagePatch), b.(*StagePatch), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*StageRepeat)(nil), (*v1alpha1.StageRepeat)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_internalversion_StageRepeat_To_v1alpha1_StageRepeat(a.(*StageRepeat), b.(*v1alpha1.StageRepeat), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*v1alpha1.StageRepeat)(nil), (*StageRepeat)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_StageRepeat_To_internalversion_StageRepeat(a.(*v1alpha1.StageRepeat), b.(*StageRepeat), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*StageResourceRef)(nil), (*v1alpha1.StageResourceRef)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_internalversion_StageResourceRef_To_v1alpha1_StageResourceRef(a.(*StageResourceRef), b.(*v1alpha1.StageResourceRef), scope)
 	}); err != nil {
@@ -569,6 +659,36 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*StageTemplate)(nil), (*v1alpha1.StageTemplate)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_internalversion_StageTemplate_To_v1alpha1_StageTemplate(a.(*StageTemplate), b.(*v1alpha1.StageTemplate), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*v1alpha1.StageTemplate)(nil), (*StageTemplate)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_StageTemplate_To_internalversion_StageTemplate(a.(*v1alpha1.StageTemplate), b.(*StageTemplate), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*StageTemplateSpec)(nil), (*v1alpha1.StageTemplateSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_internalversion_StageTemplateSpec_To_v1alpha1_StageTemplateSpec(a.(*StageTemplateSpec), b.(*v1alpha1.StageTemplateSpec), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*v1alpha1.StageTemplateSpec)(nil), (*StageTemplateSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_StageTemplateSpec_To_internalversion_StageTemplateSpec(a.(*v1alpha1.StageTemplateSpec), b.(*StageTemplateSpec), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*StageWebhook)(nil), (*v1alpha1.StageWebhook)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_internalversion_StageWebhook_To_v1alpha1_StageWebhook(a.(*StageWebhook), b.(*v1alpha1.StageWebhook), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*v1alpha1.StageWebhook)(nil), (*StageWebhook)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_StageWebhook_To_internalversion_StageWebhook(a.(*v1alpha1.StageWebhook), b.(*StageWebhook), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*Volume)(nil), (*configv1alpha1.Volume)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_internalversion_Volume_To_v1alpha1_Volume(a.(*Volume), b.(*configv1alpha1.Volume), scope)
 	}); err != nil {
@@ -1198,6 +1318,7 @@ func Convert_v1alpha1_ExecTargetLocal_To_internalversion_ExecTargetLocal(in *v1a
 
 func autoConvert_internalversion_ExpressionFromSource_To_v1alpha1_ExpressionFromSource(in *ExpressionFromSource, out *v1alpha1.ExpressionFromSource, s conversion.Scope) error {
 	out.ExpressionFrom = in.ExpressionFrom
+	out.CEL = in.CEL
 	return nil
 }
 
@@ -1208,6 +1329,7 @@ func Convert_internalversion_ExpressionFromSource_To_v1alpha1_ExpressionFromSour
 
 func autoConvert_v1alpha1_ExpressionFromSource_To_internalversion_ExpressionFromSource(in *v1alpha1.ExpressionFromSource, out *ExpressionFromSource, s conversion.Scope) error {
 	out.ExpressionFrom = in.ExpressionFrom
+	out.CEL = in.CEL
 	return nil
 }
 
@@ -1334,6 +1456,7 @@ func Convert_v1alpha1_KwokConfiguration_To_internalversion_KwokConfiguration(in
 func autoConvert_internalversion_KwokConfigurationOptions_To_v1alpha1_KwokConfigurationOptions(in *KwokConfigurationOptions, out *configv1alpha1.KwokConfigurationOptions, s conversion.Scope) error {
 	out.EnableCRDs = *(*[]string)(unsafe.Pointer(&in.EnableCRDs))
 	out.EnableStageForRefs = *(*[]string)(unsafe.Pointer(&in.EnableStageForRefs))
+	out.StageForRefs = *(*[]configv1alpha1.StageForRef)(unsafe.Pointer(&in.StageForRefs))
 	out.CIDR = in.CIDR
 	out.NodeIP = in.NodeIP
 	out.NodeName = in.NodeName
@@ -1365,6 +1488,12 @@ func autoConvert_internalversion_KwokConfigurationOptions_To_v1alpha1_KwokConfig
 	out.NodePlayStageParallelism = in.NodePlayStageParallelism
 	out.NodeLeaseDurationSeconds = in.NodeLeaseDurationSeconds
 	out.NodeLeaseParallelism = in.NodeLeaseParallelism
+	out.TimeScale = in.TimeScale
+	out.RandomSeed = in.RandomSeed
+	out.EnableStageHistoryAnnotation = in.EnableStageHistoryAnnotation
+	out.EnablePodAdmission = in.EnablePodAdmission
+	out.EnableNodePressureEviction = in.EnableNodePressureEviction
+	out.EnableProbeSimulation = in.EnableProbeSimulation
 	return nil
 }
 
@@ -1376,6 +1505,7 @@ func Convert_internalversion_KwokConfigurationOptions_To_v1alpha1_KwokConfigurat
 func autoConvert_v1alpha1_KwokConfigurationOptions_To_internalversion_KwokConfigurationOptions(in *configv1alpha1.KwokConfigurationOptions, out *KwokConfigurationOptions, s conversion.Scope) error {
 	out.EnableCRDs = *(*[]string)(unsafe.Pointer(&in.EnableCRDs))
 	out.EnableStageForRefs = *(*[]string)(unsafe.Pointer(&in.EnableStageForRefs))
+	out.StageForRefs = *(*[]StageForRef)(unsafe.Pointer(&in.StageForRefs))
 	out.CIDR = in.CIDR
 	out.NodeIP = in.NodeIP
 	out.NodeName = in.NodeName
@@ -1407,6 +1537,12 @@ func autoConvert_v1alpha1_KwokConfigurationOptions_To_internalversion_KwokConfig
 	out.NodePlayStageParallelism = in.NodePlayStageParallelism
 	out.NodeLeaseDurationSeconds = in.NodeLeaseDurationSeconds
 	out.NodeLeaseParallelism = in.NodeLeaseParallelism
+	out.TimeScale = in.TimeScale
+	out.RandomSeed = in.RandomSeed
+	out.EnableStageHistoryAnnotation = in.EnableStageHistoryAnnotation
+	out.EnablePodAdmission = in.EnablePodAdmission
+	out.EnableNodePressureEviction = in.EnableNodePressureEviction
+	out.EnableProbeSimulation = in.EnableProbeSimulation
 	return nil
 }
 
@@ -2125,11 +2261,36 @@ func Convert_v1alpha1_Stage_To_internalversion_Stage(in *v1alpha1.Stage, out *St
 	return autoConvert_v1alpha1_Stage_To_internalversion_Stage(in, out, s)
 }
 
+func autoConvert_internalversion_StageCreate_To_v1alpha1_StageCreate(in *StageCreate, out *v1alpha1.StageCreate, s conversion.Scope) error {
+	out.Template = in.Template
+	out.OwnerReference = in.OwnerReference
+	out.IdempotencyKey = in.IdempotencyKey
+	return nil
+}
+
+// Convert_internalversion_StageCreate_To_v1alpha1_StageCreate is an autogenerated conversion function.
+func Convert_internalversion_StageCreate_To_v1alpha1_StageCreate(in *StageCreate, out *v1alpha1.StageCreate, s conversion.Scope) error {
+	return autoConvert_internalversion_StageCreate_To_v1alpha1_StageCreate(in, out, s)
+}
+
+func autoConvert_v1alpha1_StageCreate_To_internalversion_StageCreate(in *v1alpha1.StageCreate, out *StageCreate, s conversion.Scope) error {
+	out.Template = in.Template
+	out.OwnerReference = in.OwnerReference
+	out.IdempotencyKey = in.IdempotencyKey
+	return nil
+}
+
+// Convert_v1alpha1_StageCreate_To_internalversion_StageCreate is an autogenerated conversion function.
+func Convert_v1alpha1_StageCreate_To_internalversion_StageCreate(in *v1alpha1.StageCreate, out *StageCreate, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StageCreate_To_internalversion_StageCreate(in, out, s)
+}
+
 func autoConvert_internalversion_StageDelay_To_v1alpha1_StageDelay(in *StageDelay, out *v1alpha1.StageDelay, s conversion.Scope) error {
 	out.DurationMilliseconds = (*int64)(unsafe.Pointer(in.DurationMilliseconds))
 	out.DurationFrom = (*v1alpha1.ExpressionFromSource)(unsafe.Pointer(in.DurationFrom))
 	out.JitterDurationMilliseconds = (*int64)(unsafe.Pointer(in.JitterDurationMilliseconds))
 	out.JitterDurationFrom = (*v1alpha1.ExpressionFromSource)(unsafe.Pointer(in.JitterDurationFrom))
+	out.Distribution = (*v1alpha1.StageDelayDistribution)(unsafe.Pointer(in.Distribution))
 	return nil
 }
 
@@ -2143,6 +2304,7 @@ func autoConvert_v1alpha1_StageDelay_To_internalversion_StageDelay(in *v1alpha1.
 	out.DurationFrom = (*ExpressionFromSource)(unsafe.Pointer(in.DurationFrom))
 	out.JitterDurationMilliseconds = (*int64)(unsafe.Pointer(in.JitterDurationMilliseconds))
 	out.JitterDurationFrom = (*ExpressionFromSource)(unsafe.Pointer(in.JitterDurationFrom))
+	out.Distribution = (*StageDelayDistribution)(unsafe.Pointer(in.Distribution))
 	return nil
 }
 
@@ -2151,10 +2313,97 @@ func Convert_v1alpha1_StageDelay_To_internalversion_StageDelay(in *v1alpha1.Stag
 	return autoConvert_v1alpha1_StageDelay_To_internalversion_StageDelay(in, out, s)
 }
 
+func autoConvert_internalversion_StageDelayDistribution_To_v1alpha1_StageDelayDistribution(in *StageDelayDistribution, out *v1alpha1.StageDelayDistribution, s conversion.Scope) error {
+	out.Type = v1alpha1.StageDelayDistributionType(in.Type)
+	out.MeanMilliseconds = (*int64)(unsafe.Pointer(in.MeanMilliseconds))
+	out.StdDevMilliseconds = (*int64)(unsafe.Pointer(in.StdDevMilliseconds))
+	out.MedianMilliseconds = (*int64)(unsafe.Pointer(in.MedianMilliseconds))
+	out.Sigma = (*float64)(unsafe.Pointer(in.Sigma))
+	out.ScaleMilliseconds = (*int64)(unsafe.Pointer(in.ScaleMilliseconds))
+	out.Shape = (*float64)(unsafe.Pointer(in.Shape))
+	out.Percentiles = *(*[]v1alpha1.StageDelayPercentile)(unsafe.Pointer(&in.Percentiles))
+	out.MinMilliseconds = (*int64)(unsafe.Pointer(in.MinMilliseconds))
+	out.MaxMilliseconds = (*int64)(unsafe.Pointer(in.MaxMilliseconds))
+	return nil
+}
+
+// Convert_internalversion_StageDelayDistribution_To_v1alpha1_StageDelayDistribution is an autogenerated conversion function.
+func Convert_internalversion_StageDelayDistribution_To_v1alpha1_StageDelayDistribution(in *StageDelayDistribution, out *v1alpha1.StageDelayDistribution, s conversion.Scope) error {
+	return autoConvert_internalversion_StageDelayDistribution_To_v1alpha1_StageDelayDistribution(in, out, s)
+}
+
+func autoConvert_v1alpha1_StageDelayDistribution_To_internalversion_StageDelayDistribution(in *v1alpha1.StageDelayDistribution, out *StageDelayDistribution, s conversion.Scope) error {
+	out.Type = StageDelayDistributionType(in.Type)
+	out.MeanMilliseconds = (*int64)(unsafe.Pointer(in.MeanMilliseconds))
+	out.StdDevMilliseconds = (*int64)(unsafe.Pointer(in.StdDevMilliseconds))
+	out.MedianMilliseconds = (*int64)(unsafe.Pointer(in.MedianMilliseconds))
+	out.Sigma = (*float64)(unsafe.Pointer(in.Sigma))
+	out.ScaleMilliseconds = (*int64)(unsafe.Pointer(in.ScaleMilliseconds))
+	out.Shape = (*float64)(unsafe.Pointer(in.Shape))
+	out.Percentiles = *(*[]StageDelayPercentile)(unsafe.Pointer(&in.Percentiles))
+	out.MinMilliseconds = (*int64)(unsafe.Pointer(in.MinMilliseconds))
+	out.MaxMilliseconds = (*int64)(unsafe.Pointer(in.MaxMilliseconds))
+	return nil
+}
+
+// Convert_v1alpha1_StageDelayDistribution_To_internalversion_StageDelayDistribution is an autogenerated conversion function.
+func Convert_v1alpha1_StageDelayDistribution_To_internalversion_StageDelayDistribution(in *v1alpha1.StageDelayDistribution, out *StageDelayDistribution, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StageDelayDistribution_To_internalversion_StageDelayDistribution(in, out, s)
+}
+
+func autoConvert_internalversion_StageDelayPercentile_To_v1alpha1_StageDelayPercentile(in *StageDelayPercentile, out *v1alpha1.StageDelayPercentile, s conversion.Scope) error {
+	out.Percentile = in.Percentile
+	out.DurationMilliseconds = in.DurationMilliseconds
+	return nil
+}
+
+// Convert_internalversion_StageDelayPercentile_To_v1alpha1_StageDelayPercentile is an autogenerated conversion function.
+func Convert_internalversion_StageDelayPercentile_To_v1alpha1_StageDelayPercentile(in *StageDelayPercentile, out *v1alpha1.StageDelayPercentile, s conversion.Scope) error {
+	return autoConvert_internalversion_StageDelayPercentile_To_v1alpha1_StageDelayPercentile(in, out, s)
+}
+
+func autoConvert_v1alpha1_StageDelayPercentile_To_internalversion_StageDelayPercentile(in *v1alpha1.StageDelayPercentile, out *StageDelayPercentile, s conversion.Scope) error {
+	out.Percentile = in.Percentile
+	out.DurationMilliseconds = in.DurationMilliseconds
+	return nil
+}
+
+// Convert_v1alpha1_StageDelayPercentile_To_internalversion_StageDelayPercentile is an autogenerated conversion function.
+func Convert_v1alpha1_StageDelayPercentile_To_internalversion_StageDelayPercentile(in *v1alpha1.StageDelayPercentile, out *StageDelayPercentile, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StageDelayPercentile_To_internalversion_StageDelayPercentile(in, out, s)
+}
+
+func autoConvert_internalversion_StageDrain_To_v1alpha1_StageDrain(in *StageDrain, out *v1alpha1.StageDrain, s conversion.Scope) error {
+	out.TimeoutMilliseconds = (*int64)(unsafe.Pointer(in.TimeoutMilliseconds))
+	out.GracePeriodSeconds = (*int64)(unsafe.Pointer(in.GracePeriodSeconds))
+	out.DeleteEmptyDirData = in.DeleteEmptyDirData
+	return nil
+}
+
+// Convert_internalversion_StageDrain_To_v1alpha1_StageDrain is an autogenerated conversion function.
+func Convert_internalversion_StageDrain_To_v1alpha1_StageDrain(in *StageDrain, out *v1alpha1.StageDrain, s conversion.Scope) error {
+	return autoConvert_internalversion_StageDrain_To_v1alpha1_StageDrain(in, out, s)
+}
+
+func autoConvert_v1alpha1_StageDrain_To_internalversion_StageDrain(in *v1alpha1.StageDrain, out *StageDrain, s conversion.Scope) error {
+	out.TimeoutMilliseconds = (*int64)(unsafe.Pointer(in.TimeoutMilliseconds))
+	out.GracePeriodSeconds = (*int64)(unsafe.Pointer(in.GracePeriodSeconds))
+	out.DeleteEmptyDirData = in.DeleteEmptyDirData
+	return nil
+}
+
+// Convert_v1alpha1_StageDrain_To_internalversion_StageDrain is an autogenerated conversion function.
+func Convert_v1alpha1_StageDrain_To_internalversion_StageDrain(in *v1alpha1.StageDrain, out *StageDrain, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StageDrain_To_internalversion_StageDrain(in, out, s)
+}
+
 func autoConvert_internalversion_StageEvent_To_v1alpha1_StageEvent(in *StageEvent, out *v1alpha1.StageEvent, s conversion.Scope) error {
 	out.Type = in.Type
 	out.Reason = in.Reason
 	out.Message = in.Message
+	out.SampleRate = (*float64)(unsafe.Pointer(in.SampleRate))
+	out.RateLimit = (*v1alpha1.StageEventRateLimit)(unsafe.Pointer(in.RateLimit))
+	out.Correlator = (*v1alpha1.StageEventCorrelator)(unsafe.Pointer(in.Correlator))
 	return nil
 }
 
@@ -2167,6 +2416,9 @@ func autoConvert_v1alpha1_StageEvent_To_internalversion_StageEvent(in *v1alpha1.
 	out.Type = in.Type
 	out.Reason = in.Reason
 	out.Message = in.Message
+	out.SampleRate = (*float64)(unsafe.Pointer(in.SampleRate))
+	out.RateLimit = (*StageEventRateLimit)(unsafe.Pointer(in.RateLimit))
+	out.Correlator = (*StageEventCorrelator)(unsafe.Pointer(in.Correlator))
 	return nil
 }
 
@@ -2175,6 +2427,54 @@ func Convert_v1alpha1_StageEvent_To_internalversion_StageEvent(in *v1alpha1.Stag
 	return autoConvert_v1alpha1_StageEvent_To_internalversion_StageEvent(in, out, s)
 }
 
+func autoConvert_internalversion_StageEventCorrelator_To_v1alpha1_StageEventCorrelator(in *StageEventCorrelator, out *v1alpha1.StageEventCorrelator, s conversion.Scope) error {
+	out.MaxEvents = in.MaxEvents
+	out.MaxIntervalSeconds = in.MaxIntervalSeconds
+	out.BurstSize = in.BurstSize
+	out.QPS = in.QPS
+	return nil
+}
+
+// Convert_internalversion_StageEventCorrelator_To_v1alpha1_StageEventCorrelator is an autogenerated conversion function.
+func Convert_internalversion_StageEventCorrelator_To_v1alpha1_StageEventCorrelator(in *StageEventCorrelator, out *v1alpha1.StageEventCorrelator, s conversion.Scope) error {
+	return autoConvert_internalversion_StageEventCorrelator_To_v1alpha1_StageEventCorrelator(in, out, s)
+}
+
+func autoConvert_v1alpha1_StageEventCorrelator_To_internalversion_StageEventCorrelator(in *v1alpha1.StageEventCorrelator, out *StageEventCorrelator, s conversion.Scope) error {
+	out.MaxEvents = in.MaxEvents
+	out.MaxIntervalSeconds = in.MaxIntervalSeconds
+	out.BurstSize = in.BurstSize
+	out.QPS = in.QPS
+	return nil
+}
+
+// Convert_v1alpha1_StageEventCorrelator_To_internalversion_StageEventCorrelator is an autogenerated conversion function.
+func Convert_v1alpha1_StageEventCorrelator_To_internalversion_StageEventCorrelator(in *v1alpha1.StageEventCorrelator, out *StageEventCorrelator, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StageEventCorrelator_To_internalversion_StageEventCorrelator(in, out, s)
+}
+
+func autoConvert_internalversion_StageEventRateLimit_To_v1alpha1_StageEventRateLimit(in *StageEventRateLimit, out *v1alpha1.StageEventRateLimit, s conversion.Scope) error {
+	out.QPS = in.QPS
+	out.Burst = in.Burst
+	return nil
+}
+
+// Convert_internalversion_StageEventRateLimit_To_v1alpha1_StageEventRateLimit is an autogenerated conversion function.
+func Convert_internalversion_StageEventRateLimit_To_v1alpha1_StageEventRateLimit(in *StageEventRateLimit, out *v1alpha1.StageEventRateLimit, s conversion.Scope) error {
+	return autoConvert_internalversion_StageEventRateLimit_To_v1alpha1_StageEventRateLimit(in, out, s)
+}
+
+func autoConvert_v1alpha1_StageEventRateLimit_To_internalversion_StageEventRateLimit(in *v1alpha1.StageEventRateLimit, out *StageEventRateLimit, s conversion.Scope) error {
+	out.QPS = in.QPS
+	out.Burst = in.Burst
+	return nil
+}
+
+// Convert_v1alpha1_StageEventRateLimit_To_internalversion_StageEventRateLimit is an autogenerated conversion function.
+func Convert_v1alpha1_StageEventRateLimit_To_internalversion_StageEventRateLimit(in *v1alpha1.StageEventRateLimit, out *StageEventRateLimit, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StageEventRateLimit_To_internalversion_StageEventRateLimit(in, out, s)
+}
+
 func autoConvert_internalversion_StageFinalizers_To_v1alpha1_StageFinalizers(in *StageFinalizers, out *v1alpha1.StageFinalizers, s conversion.Scope) error {
 	out.Add = *(*[]v1alpha1.FinalizerItem)(unsafe.Pointer(&in.Add))
 	out.Remove = *(*[]v1alpha1.FinalizerItem)(unsafe.Pointer(&in.Remove))
@@ -2199,11 +2499,43 @@ func Convert_v1alpha1_StageFinalizers_To_internalversion_StageFinalizers(in *v1a
 	return autoConvert_v1alpha1_StageFinalizers_To_internalversion_StageFinalizers(in, out, s)
 }
 
+func autoConvert_internalversion_StageForRef_To_v1alpha1_StageForRef(in *StageForRef, out *configv1alpha1.StageForRef, s conversion.Scope) error {
+	out.Ref = in.Ref
+	out.Parallelism = in.Parallelism
+	out.LabelSelector = in.LabelSelector
+	out.FieldSelector = in.FieldSelector
+	out.Namespaces = *(*[]string)(unsafe.Pointer(&in.Namespaces))
+	return nil
+}
+
+// Convert_internalversion_StageForRef_To_v1alpha1_StageForRef is an autogenerated conversion function.
+func Convert_internalversion_StageForRef_To_v1alpha1_StageForRef(in *StageForRef, out *configv1alpha1.StageForRef, s conversion.Scope) error {
+	return autoConvert_internalversion_StageForRef_To_v1alpha1_StageForRef(in, out, s)
+}
+
+func autoConvert_v1alpha1_StageForRef_To_internalversion_StageForRef(in *configv1alpha1.StageForRef, out *StageForRef, s conversion.Scope) error {
+	out.Ref = in.Ref
+	out.Parallelism = in.Parallelism
+	out.LabelSelector = in.LabelSelector
+	out.FieldSelector = in.FieldSelector
+	out.Namespaces = *(*[]string)(unsafe.Pointer(&in.Namespaces))
+	return nil
+}
+
+// Convert_v1alpha1_StageForRef_To_internalversion_StageForRef is an autogenerated conversion function.
+func Convert_v1alpha1_StageForRef_To_internalversion_StageForRef(in *configv1alpha1.StageForRef, out *StageForRef, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StageForRef_To_internalversion_StageForRef(in, out, s)
+}
+
 func autoConvert_internalversion_StageNext_To_v1alpha1_StageNext(in *StageNext, out *v1alpha1.StageNext, s conversion.Scope) error {
 	out.Event = (*v1alpha1.StageEvent)(unsafe.Pointer(in.Event))
 	out.Finalizers = (*v1alpha1.StageFinalizers)(unsafe.Pointer(in.Finalizers))
 	out.Delete = in.Delete
 	out.StatusTemplate = in.StatusTemplate
+	out.Patches = *(*[]v1alpha1.StagePatch)(unsafe.Pointer(&in.Patches))
+	out.Create = *(*[]v1alpha1.StageCreate)(unsafe.Pointer(&in.Create))
+	out.Webhook = (*v1alpha1.StageWebhook)(unsafe.Pointer(in.Webhook))
+	out.Drain = (*v1alpha1.StageDrain)(unsafe.Pointer(in.Drain))
 	return nil
 }
 
@@ -2217,6 +2549,10 @@ func autoConvert_v1alpha1_StageNext_To_internalversion_StageNext(in *v1alpha1.St
 	out.Finalizers = (*StageFinalizers)(unsafe.Pointer(in.Finalizers))
 	out.Delete = in.Delete
 	out.StatusTemplate = in.StatusTemplate
+	out.Patches = *(*[]StagePatch)(unsafe.Pointer(&in.Patches))
+	out.Create = *(*[]StageCreate)(unsafe.Pointer(&in.Create))
+	out.Webhook = (*StageWebhook)(unsafe.Pointer(in.Webhook))
+	out.Drain = (*StageDrain)(unsafe.Pointer(in.Drain))
 	return nil
 }
 
@@ -2225,6 +2561,56 @@ func Convert_v1alpha1_StageNext_To_internalversion_StageNext(in *v1alpha1.StageN
 	return autoConvert_v1alpha1_StageNext_To_internalversion_StageNext(in, out, s)
 }
 
+func autoConvert_internalversion_StagePatch_To_v1alpha1_StagePatch(in *StagePatch, out *v1alpha1.StagePatch, s conversion.Scope) error {
+	out.Subresource = in.Subresource
+	out.Root = in.Root
+	out.Template = in.Template
+	out.Type = (*v1alpha1.StagePatchType)(unsafe.Pointer(in.Type))
+	return nil
+}
+
+// Convert_internalversion_StagePatch_To_v1alpha1_StagePatch is an autogenerated conversion function.
+func Convert_internalversion_StagePatch_To_v1alpha1_StagePatch(in *StagePatch, out *v1alpha1.StagePatch, s conversion.Scope) error {
+	return autoConvert_internalversion_StagePatch_To_v1alpha1_StagePatch(in, out, s)
+}
+
+func autoConvert_v1alpha1_StagePatch_To_internalversion_StagePatch(in *v1alpha1.StagePatch, out *StagePatch, s conversion.Scope) error {
+	out.Subresource = in.Subresource
+	out.Root = in.Root
+	out.Template = in.Template
+	out.Type = (*StagePatchType)(unsafe.Pointer(in.Type))
+	return nil
+}
+
+// Convert_v1alpha1_StagePatch_To_internalversion_StagePatch is an autogenerated conversion function.
+func Convert_v1alpha1_StagePatch_To_internalversion_StagePatch(in *v1alpha1.StagePatch, out *StagePatch, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StagePatch_To_internalversion_StagePatch(in, out, s)
+}
+
+func autoConvert_internalversion_StageRepeat_To_v1alpha1_StageRepeat(in *StageRepeat, out *v1alpha1.StageRepeat, s conversion.Scope) error {
+	out.MaxCount = in.MaxCount
+	out.BackoffMultiplier = (*float64)(unsafe.Pointer(in.BackoffMultiplier))
+	out.MaxDelayMilliseconds = (*int64)(unsafe.Pointer(in.MaxDelayMilliseconds))
+	return nil
+}
+
+// Convert_internalversion_StageRepeat_To_v1alpha1_StageRepeat is an autogenerated conversion function.
+func Convert_internalversion_StageRepeat_To_v1alpha1_StageRepeat(in *StageRepeat, out *v1alpha1.StageRepeat, s conversion.Scope) error {
+	return autoConvert_internalversion_StageRepeat_To_v1alpha1_StageRepeat(in, out, s)
+}
+
+func autoConvert_v1alpha1_StageRepeat_To_internalversion_StageRepeat(in *v1alpha1.StageRepeat, out *StageRepeat, s conversion.Scope) error {
+	out.MaxCount = in.MaxCount
+	out.BackoffMultiplier = (*float64)(unsafe.Pointer(in.BackoffMultiplier))
+	out.MaxDelayMilliseconds = (*int64)(unsafe.Pointer(in.MaxDelayMilliseconds))
+	return nil
+}
+
+// Convert_v1alpha1_StageRepeat_To_internalversion_StageRepeat is an autogenerated conversion function.
+func Convert_v1alpha1_StageRepeat_To_internalversion_StageRepeat(in *v1alpha1.StageRepeat, out *StageRepeat, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StageRepeat_To_internalversion_StageRepeat(in, out, s)
+}
+
 func autoConvert_internalversion_StageResourceRef_To_v1alpha1_StageResourceRef(in *StageResourceRef, out *v1alpha1.StageResourceRef, s conversion.Scope) error {
 	out.APIGroup = in.APIGroup
 	out.Kind = in.Kind
@@ -2251,6 +2637,7 @@ func autoConvert_internalversion_StageSelector_To_v1alpha1_StageSelector(in *Sta
 	out.MatchLabels = *(*map[string]string)(unsafe.Pointer(&in.MatchLabels))
 	out.MatchAnnotations = *(*map[string]string)(unsafe.Pointer(&in.MatchAnnotations))
 	out.MatchExpressions = *(*[]v1alpha1.SelectorRequirement)(unsafe.Pointer(&in.MatchExpressions))
+	out.MatchCEL = *(*[]string)(unsafe.Pointer(&in.MatchCEL))
 	return nil
 }
 
@@ -2263,6 +2650,7 @@ func autoConvert_v1alpha1_StageSelector_To_internalversion_StageSelector(in *v1a
 	out.MatchLabels = *(*map[string]string)(unsafe.Pointer(&in.MatchLabels))
 	out.MatchAnnotations = *(*map[string]string)(unsafe.Pointer(&in.MatchAnnotations))
 	out.MatchExpressions = *(*[]SelectorRequirement)(unsafe.Pointer(&in.MatchExpressions))
+	out.MatchCEL = *(*[]string)(unsafe.Pointer(&in.MatchCEL))
 	return nil
 }
 
@@ -2272,12 +2660,16 @@ func Convert_v1alpha1_StageSelector_To_internalversion_StageSelector(in *v1alpha
 }
 
 func autoConvert_internalversion_StageSpec_To_v1alpha1_StageSpec(in *StageSpec, out *v1alpha1.StageSpec, s conversion.Scope) error {
+	out.Extends = in.Extends
 	if err := Convert_internalversion_StageResourceRef_To_v1alpha1_StageResourceRef(&in.ResourceRef, &out.ResourceRef, s); err != nil {
 		return err
 	}
 	out.Selector = (*v1alpha1.StageSelector)(unsafe.Pointer(in.Selector))
 	out.Weight = in.Weight
+	out.Priority = in.Priority
+	out.Group = in.Group
 	out.Delay = (*v1alpha1.StageDelay)(unsafe.Pointer(in.Delay))
+	out.Repeat = (*v1alpha1.StageRepeat)(unsafe.Pointer(in.Repeat))
 	if err := Convert_internalversion_StageNext_To_v1alpha1_StageNext(&in.Next, &out.Next, s); err != nil {
 		return err
 	}
@@ -2293,12 +2685,16 @@ func Convert_internalversion_StageSpec_To_v1alpha1_StageSpec(in *StageSpec, out
 }
 
 func autoConvert_v1alpha1_StageSpec_To_internalversion_StageSpec(in *v1alpha1.StageSpec, out *StageSpec, s conversion.Scope) error {
+	out.Extends = in.Extends
 	if err := Convert_v1alpha1_StageResourceRef_To_internalversion_StageResourceRef(&in.ResourceRef, &out.ResourceRef, s); err != nil {
 		return err
 	}
 	out.Selector = (*StageSelector)(unsafe.Pointer(in.Selector))
 	out.Weight = in.Weight
+	out.Priority = in.Priority
+	out.Group = in.Group
 	out.Delay = (*StageDelay)(unsafe.Pointer(in.Delay))
+	out.Repeat = (*StageRepeat)(unsafe.Pointer(in.Repeat))
 	if err := Convert_v1alpha1_StageNext_To_internalversion_StageNext(&in.Next, &out.Next, s); err != nil {
 		return err
 	}
@@ -2313,6 +2709,80 @@ func Convert_v1alpha1_StageSpec_To_internalversion_StageSpec(in *v1alpha1.StageS
 	return autoConvert_v1alpha1_StageSpec_To_internalversion_StageSpec(in, out, s)
 }
 
+func autoConvert_internalversion_StageTemplate_To_v1alpha1_StageTemplate(in *StageTemplate, out *v1alpha1.StageTemplate, s conversion.Scope) error {
+	out.ObjectMeta = in.ObjectMeta
+	if err := Convert_internalversion_StageTemplateSpec_To_v1alpha1_StageTemplateSpec(&in.Spec, &out.Spec, s); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Convert_internalversion_StageTemplate_To_v1alpha1_StageTemplate is an autogenerated conversion function.
+func Convert_internalversion_StageTemplate_To_v1alpha1_StageTemplate(in *StageTemplate, out *v1alpha1.StageTemplate, s conversion.Scope) error {
+	return autoConvert_internalversion_StageTemplate_To_v1alpha1_StageTemplate(in, out, s)
+}
+
+func autoConvert_v1alpha1_StageTemplate_To_internalversion_StageTemplate(in *v1alpha1.StageTemplate, out *StageTemplate, s conversion.Scope) error {
+	// INFO: in.TypeMeta opted out of conversion generation
+	out.ObjectMeta = in.ObjectMeta
+	if err := Convert_v1alpha1_StageTemplateSpec_To_internalversion_StageTemplateSpec(&in.Spec, &out.Spec, s); err != nil {
+		return err
+	}
+	// INFO: in.Status opted out of conversion generation
+	return nil
+}
+
+// Convert_v1alpha1_StageTemplate_To_internalversion_StageTemplate is an autogenerated conversion function.
+func Convert_v1alpha1_StageTemplate_To_internalversion_StageTemplate(in *v1alpha1.StageTemplate, out *StageTemplate, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StageTemplate_To_internalversion_StageTemplate(in, out, s)
+}
+
+func autoConvert_internalversion_StageTemplateSpec_To_v1alpha1_StageTemplateSpec(in *StageTemplateSpec, out *v1alpha1.StageTemplateSpec, s conversion.Scope) error {
+	out.Template = in.Template
+	return nil
+}
+
+// Convert_internalversion_StageTemplateSpec_To_v1alpha1_StageTemplateSpec is an autogenerated conversion function.
+func Convert_internalversion_StageTemplateSpec_To_v1alpha1_StageTemplateSpec(in *StageTemplateSpec, out *v1alpha1.StageTemplateSpec, s conversion.Scope) error {
+	return autoConvert_internalversion_StageTemplateSpec_To_v1alpha1_StageTemplateSpec(in, out, s)
+}
+
+func autoConvert_v1alpha1_StageTemplateSpec_To_internalversion_StageTemplateSpec(in *v1alpha1.StageTemplateSpec, out *StageTemplateSpec, s conversion.Scope) error {
+	out.Template = in.Template
+	return nil
+}
+
+// Convert_v1alpha1_StageTemplateSpec_To_internalversion_StageTemplateSpec is an autogenerated conversion function.
+func Convert_v1alpha1_StageTemplateSpec_To_internalversion_StageTemplateSpec(in *v1alpha1.StageTemplateSpec, out *StageTemplateSpec, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StageTemplateSpec_To_internalversion_StageTemplateSpec(in, out, s)
+}
+
+func autoConvert_internalversion_StageWebhook_To_v1alpha1_StageWebhook(in *StageWebhook, out *v1alpha1.StageWebhook, s conversion.Scope) error {
+	out.URL = in.URL
+	out.TimeoutMilliseconds = (*int64)(unsafe.Pointer(in.TimeoutMilliseconds))
+	out.CABundle = *(*[]byte)(unsafe.Pointer(&in.CABundle))
+	out.FailurePolicy = (*v1alpha1.StageWebhookFailurePolicy)(unsafe.Pointer(in.FailurePolicy))
+	return nil
+}
+
+// Convert_internalversion_StageWebhook_To_v1alpha1_StageWebhook is an autogenerated conversion function.
+func Convert_internalversion_StageWebhook_To_v1alpha1_StageWebhook(in *StageWebhook, out *v1alpha1.StageWebhook, s conversion.Scope) error {
+	return autoConvert_internalversion_StageWebhook_To_v1alpha1_StageWebhook(in, out, s)
+}
+
+func autoConvert_v1alpha1_StageWebhook_To_internalversion_StageWebhook(in *v1alpha1.StageWebhook, out *StageWebhook, s conversion.Scope) error {
+	out.URL = in.URL
+	out.TimeoutMilliseconds = (*int64)(unsafe.Pointer(in.TimeoutMilliseconds))
+	out.CABundle = *(*[]byte)(unsafe.Pointer(&in.CABundle))
+	out.FailurePolicy = (*StageWebhookFailurePolicy)(unsafe.Pointer(in.FailurePolicy))
+	return nil
+}
+
+// Convert_v1alpha1_StageWebhook_To_internalversion_StageWebhook is an autogenerated conversion function.
+func Convert_v1alpha1_StageWebhook_To_internalversion_StageWebhook(in *v1alpha1.StageWebhook, out *StageWebhook, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StageWebhook_To_internalversion_StageWebhook(in, out, s)
+}
+
 func autoConvert_internalversion_Volume_To_v1alpha1_Volume(in *Volume, out *configv1alpha1.Volume, s conversion.Scope) error {
 	out.Name = in.Name
 	if err := v1.Convert_bool_To_Pointer_bool(&in.ReadOnly, &out.ReadOnly, s); err != nil {
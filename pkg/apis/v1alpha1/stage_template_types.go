@@ -0,0 +1,80 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// StageTemplateKind is the kind of the StageTemplate resource.
+	StageTemplateKind = "StageTemplate"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +genclient
+// +genclient:nonNamespaced
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:rbac:groups=kwok.x-k8s.io,resources=stagetemplates,verbs=create;delete;get;list;patch;update;watch
+// +kubebuilder:rbac:groups=kwok.x-k8s.io,resources=stagetemplates/status,verbs=patch;update
+
+// StageTemplate is an API that describes a named template fragment,
+// which can be included in the templates of the stages.
+type StageTemplate struct {
+	//+k8s:conversion-gen=false
+	metav1.TypeMeta `json:",inline"`
+	// Standard list metadata.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Spec holds information about the template fragment.
+	Spec StageTemplateSpec `json:"spec"`
+	// Status holds status for the StageTemplate
+	//+k8s:conversion-gen=false
+	Status StageTemplateStatus `json:"status,omitempty"`
+}
+
+// StageTemplateStatus holds status for the StageTemplate
+type StageTemplateStatus struct {
+	// Conditions holds conditions for the StageTemplate.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// StageTemplateSpec defines the specification for StageTemplate.
+type StageTemplateSpec struct {
+	// Template is the template fragment,
+	// it is included in the templates of the stages by `{{ include "<name>" . }}`.
+	Template string `json:"template"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+
+// StageTemplateList contains a list of StageTemplate
+type StageTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []StageTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&StageTemplate{}, &StageTemplateList{})
+}
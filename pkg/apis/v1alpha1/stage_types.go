@@ -23,6 +23,9 @@ import (
 const (
 	// StageKind is the kind of the Stage resource.
 	StageKind = "Stage"
+
+	// StageConditionValid is the condition type of whether the stage can be compiled.
+	StageConditionValid = "Valid"
 )
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -31,6 +34,11 @@ const (
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Cluster
 // +kubebuilder:rbac:groups=kwok.x-k8s.io,resources=stages,verbs=create;delete;get;list;patch;update;watch
+// +kubebuilder:rbac:groups=kwok.x-k8s.io,resources=stages/status,verbs=patch;update
+// +kubebuilder:printcolumn:name="Valid",type=string,JSONPath=`.status.conditions[?(@.type=="Valid")].status`
+// +kubebuilder:printcolumn:name="Applied",type=integer,JSONPath=`.status.applied`
+// +kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failed`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Stage is an API that describes the staged change of a resource
 type Stage struct {
@@ -54,10 +62,19 @@ type StageStatus struct {
 	// +listType=map
 	// +listMapKey=type
 	Conditions []Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+	// Applied is the number of times the stage has been applied to resources.
+	Applied int64 `json:"applied,omitempty"`
+	// Failed is the number of times the stage has failed to be applied to resources.
+	Failed int64 `json:"failed,omitempty"`
 }
 
 // StageSpec defines the specification for Stage.
 type StageSpec struct {
+	// Extends is the name of the stage to inherit from,
+	// the fields set in this stage override the fields of the inherited stage.
+	// The fields left to their zero values, like false or 0, are inherited,
+	// so a field of the inherited stage can't be overridden to its zero value, e.g. immediateNextStage or next.delete to false.
+	Extends string `json:"extends,omitempty"`
 	// ResourceRef specifies the Kind and version of the resource.
 	ResourceRef StageResourceRef `json:"resourceRef"`
 	// Selector specifies the stags will be applied to the selected resource.
@@ -68,8 +85,19 @@ type StageSpec struct {
 	// +kubebuilder:default=0
 	// +kubebuilder:validation:Minimum=0
 	Weight int `json:"weight,omitempty"`
+	// Priority means the current stage, in case of multiple stages,
+	// only the matched stages with the highest priority are chosen between by the weight.
+	// +default=0
+	// +kubebuilder:default=0
+	Priority int `json:"priority,omitempty"`
+	// Group means the stages in different groups are applied to the same resource independently,
+	// e.g. one group for the status and another for the labels.
+	// At most one stage of each group is played at a time, the stages without a group are in the same group.
+	Group string `json:"group,omitempty"`
 	// Delay means there is a delay in this stage.
 	Delay *StageDelay `json:"delay,omitempty"`
+	// Repeat means the stage can be played repeatedly on the same resource, with a growing delay.
+	Repeat *StageRepeat `json:"repeat,omitempty"`
 	// Next indicates that this stage will be moved to.
 	Next StageNext `json:"next"`
 	// ImmediateNextStage means that the next stage of matching is performed immediately, without waiting for the Apiserver to push.
@@ -105,6 +133,85 @@ type StageDelay struct {
 	// If it is a time.Time type, getting the value will be minus time.Now() to get JitterDurationMilliseconds
 	// If it is a string type, the value get will be parsed by time.ParseDuration.
 	JitterDurationFrom *ExpressionFromSource `json:"jitterDurationFrom,omitempty"`
+	// Distribution is the distribution which the delay is sampled from.
+	// It is exclusive with the other fields.
+	Distribution *StageDelayDistribution `json:"distribution,omitempty"`
+}
+
+// StageDelayDistribution describes the distribution which the delay is sampled from.
+type StageDelayDistribution struct {
+	// Type is the type of the distribution.
+	// +kubebuilder:validation:Enum=normal;logNormal;exponential;pareto;empirical
+	Type StageDelayDistributionType `json:"type"`
+	// MeanMilliseconds is the mean of the normal and exponential distributions.
+	// +kubebuilder:validation:Minimum=0
+	MeanMilliseconds *int64 `json:"meanMilliseconds,omitempty"`
+	// StdDevMilliseconds is the standard deviation of the normal distribution.
+	// +kubebuilder:validation:Minimum=0
+	StdDevMilliseconds *int64 `json:"stdDevMilliseconds,omitempty"`
+	// MedianMilliseconds is the median of the log-normal distribution.
+	// +kubebuilder:validation:Minimum=0
+	MedianMilliseconds *int64 `json:"medianMilliseconds,omitempty"`
+	// Sigma is the standard deviation of the logarithm of the log-normal distribution.
+	// +kubebuilder:validation:Minimum=0
+	Sigma *float64 `json:"sigma,omitempty"`
+	// ScaleMilliseconds is the minimum value of the Pareto distribution.
+	// +kubebuilder:validation:Minimum=0
+	ScaleMilliseconds *int64 `json:"scaleMilliseconds,omitempty"`
+	// Shape is the tail index of the Pareto distribution, the smaller the longer the tail.
+	// +kubebuilder:validation:Minimum=0
+	Shape *float64 `json:"shape,omitempty"`
+	// Percentiles is the histogram of the empirical distribution,
+	// the delay is interpolated linearly between the percentiles.
+	Percentiles []StageDelayPercentile `json:"percentiles,omitempty"`
+	// MinMilliseconds is the lower bound of the sampled delay.
+	// +kubebuilder:validation:Minimum=0
+	MinMilliseconds *int64 `json:"minMilliseconds,omitempty"`
+	// MaxMilliseconds is the upper bound of the sampled delay.
+	// +kubebuilder:validation:Minimum=0
+	MaxMilliseconds *int64 `json:"maxMilliseconds,omitempty"`
+}
+
+// StageDelayDistributionType is the type of the distribution.
+// +enum
+type StageDelayDistributionType string
+
+const (
+	// StageDelayDistributionTypeNormal is the normal distribution.
+	StageDelayDistributionTypeNormal StageDelayDistributionType = "normal"
+	// StageDelayDistributionTypeLogNormal is the log-normal distribution.
+	StageDelayDistributionTypeLogNormal StageDelayDistributionType = "logNormal"
+	// StageDelayDistributionTypeExponential is the exponential distribution.
+	StageDelayDistributionTypeExponential StageDelayDistributionType = "exponential"
+	// StageDelayDistributionTypePareto is the Pareto distribution.
+	StageDelayDistributionTypePareto StageDelayDistributionType = "pareto"
+	// StageDelayDistributionTypeEmpirical is the empirical distribution.
+	StageDelayDistributionTypeEmpirical StageDelayDistributionType = "empirical"
+)
+
+// StageDelayPercentile is a point of the empirical distribution.
+type StageDelayPercentile struct {
+	// Percentile is the percentile of the point, between 0 and 100.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Percentile float64 `json:"percentile"`
+	// DurationMilliseconds is the delay at the percentile.
+	// +kubebuilder:validation:Minimum=0
+	DurationMilliseconds int64 `json:"durationMilliseconds"`
+}
+
+// StageRepeat describes how the stage is played repeatedly on the same resource.
+type StageRepeat struct {
+	// MaxCount is the max number of times the stage is played on the same resource,
+	// the stage does not match the resource anymore after that. 0 means no limit.
+	// +kubebuilder:validation:Minimum=0
+	MaxCount int64 `json:"maxCount,omitempty"`
+	// BackoffMultiplier is the factor the delay is multiplied by after each attempt.
+	// +kubebuilder:validation:Minimum=1
+	BackoffMultiplier *float64 `json:"backoffMultiplier,omitempty"`
+	// MaxDelayMilliseconds is the upper bound of the delay after the backoff.
+	// +kubebuilder:validation:Minimum=0
+	MaxDelayMilliseconds *int64 `json:"maxDelayMilliseconds,omitempty"`
 }
 
 // StageNext describes a stage will be moved to.
@@ -117,8 +224,105 @@ type StageNext struct {
 	Delete bool `json:"delete,omitempty"`
 	// StatusTemplate indicates the template for modifying the status of the resource in the next.
 	StatusTemplate string `json:"statusTemplate,omitempty"`
+	// Patches means that the resource will be patched, they are applied in order.
+	Patches []StagePatch `json:"patches,omitempty"`
+	// Create means that the resources will be created, they are created in order.
+	Create []StageCreate `json:"create,omitempty"`
+	// Webhook means that the next of the resource is computed by the webhook,
+	// the patches, events and delete in the response are applied after the others.
+	Webhook *StageWebhook `json:"webhook,omitempty"`
+	// Drain means that the node will be cordoned and its pods will be evicted,
+	// it is only valid for nodes.
+	Drain *StageDrain `json:"drain,omitempty"`
 }
 
+// StageDrain describes the drain of a node.
+type StageDrain struct {
+	// TimeoutMilliseconds is the time to retry the evictions blocked by the PodDisruptionBudgets,
+	// the pods that are not evicted in time are left on the node.
+	// If it is not set, the evictions are retried for 5 minutes.
+	// +kubebuilder:default=300000
+	// +kubebuilder:validation:Minimum=0
+	TimeoutMilliseconds *int64 `json:"timeoutMilliseconds,omitempty"`
+	// GracePeriodSeconds overrides the termination grace period of the evicted pods.
+	GracePeriodSeconds *int64 `json:"gracePeriodSeconds,omitempty"`
+	// DeleteEmptyDirData means the pods using emptyDir volumes are evicted as well,
+	// otherwise they are left on the node.
+	DeleteEmptyDirData bool `json:"deleteEmptyDirData,omitempty"`
+}
+
+// StageCreate describes a resource to be created.
+type StageCreate struct {
+	// Template indicates the template for the manifest of the resource, the namespace defaults to the namespace of the resource.
+	Template string `json:"template"`
+	// OwnerReference means the resource is owned by the resource which the stage is played on,
+	// so it is garbage collected along with it.
+	OwnerReference bool `json:"ownerReference,omitempty"`
+	// IdempotencyKey indicates the template for the key which identifies the created resource,
+	// it is used to name the resource if the manifest has no name,
+	// so playing the stage again does not create a duplicate.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+}
+
+// StagePatch describes the patch for the resource.
+type StagePatch struct {
+	// Subresource indicates the name of the subresource that will be patched.
+	// Such as "status" or "scale", empty means the resource itself.
+	Subresource string `json:"subresource,omitempty"`
+	// Root indicates the root of the template calculated by the patch.
+	// Such as "metadata" or "spec", empty means the template is the whole patch.
+	// It is not allowed for json patch.
+	Root string `json:"root,omitempty"`
+	// Template indicates the template for modifying the resource in the next.
+	Template string `json:"template,omitempty"`
+	// Type indicates the type of the patch.
+	// +kubebuilder:default="merge"
+	// +kubebuilder:validation:Enum=json;merge;strategic
+	Type *StagePatchType `json:"type,omitempty"`
+}
+
+// StagePatchType is the type of the patch.
+// +enum
+type StagePatchType string
+
+const (
+	// StagePatchTypeJSONPatch is the JSON patch type.
+	StagePatchTypeJSONPatch StagePatchType = "json"
+	// StagePatchTypeMergePatch is the merge patch type.
+	StagePatchTypeMergePatch StagePatchType = "merge"
+	// StagePatchTypeStrategicMergePatch is the strategic merge patch type.
+	StagePatchTypeStrategicMergePatch StagePatchType = "strategic"
+)
+
+// StageWebhook describes the webhook which computes the next of the resource.
+type StageWebhook struct {
+	// URL is the URL of the webhook, the resource, the stage name and the attempt are POSTed to it.
+	URL string `json:"url"`
+	// TimeoutMilliseconds is the timeout of the request to the webhook,
+	// the worker which plays the stage plays no other stage while it waits for the webhook, so it should be short.
+	// +kubebuilder:default=10000
+	// +kubebuilder:validation:Minimum=1
+	TimeoutMilliseconds *int64 `json:"timeoutMilliseconds,omitempty"`
+	// CABundle is the PEM encoded CA bundle which is used to verify the certificate of the webhook.
+	CABundle []byte `json:"caBundle,omitempty"`
+	// FailurePolicy defines how the failures of the webhook are handled,
+	// Fail means the stage fails, Ignore means the stage is played without the response of the webhook.
+	// +kubebuilder:default="Fail"
+	// +kubebuilder:validation:Enum=Fail;Ignore
+	FailurePolicy *StageWebhookFailurePolicy `json:"failurePolicy,omitempty"`
+}
+
+// StageWebhookFailurePolicy is the failure policy of the webhook.
+// +enum
+type StageWebhookFailurePolicy string
+
+const (
+	// StageWebhookFailurePolicyFail means the stage fails if the webhook fails.
+	StageWebhookFailurePolicyFail StageWebhookFailurePolicy = "Fail"
+	// StageWebhookFailurePolicyIgnore means the stage is played without the webhook if the webhook fails.
+	StageWebhookFailurePolicyIgnore StageWebhookFailurePolicy = "Ignore"
+)
+
 // StageFinalizers describes the modifications in the finalizers of a resource.
 type StageFinalizers struct {
 	// Add means that the Finalizers will be added to the resource.
@@ -140,9 +344,48 @@ type StageEvent struct {
 	// Type is the type of this event (Normal, Warning), It is machine-readable.
 	Type string `json:"type,omitempty"`
 	// Reason is why the action was taken. It is human-readable.
+	// It is rendered as a template with the resource, like the statusTemplate.
 	Reason string `json:"reason,omitempty"`
 	// Message is a human-readable description of the status of this operation.
+	// It is rendered as a template with the resource, like the statusTemplate.
 	Message string `json:"message,omitempty"`
+	// SampleRate is the fraction of the plays of the stage which record the event, between 0 and 1.
+	// If it is not set, the event is recorded on every play.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=1
+	SampleRate *float64 `json:"sampleRate,omitempty"`
+	// RateLimit limits the rate of the events recorded by the stage across all resources,
+	// the events over the limit are dropped.
+	RateLimit *StageEventRateLimit `json:"rateLimit,omitempty"`
+	// Correlator configures the aggregation and the spam filter of the events recorded by the stage,
+	// the defaults of the Kubernetes event correlator are used if it is not set.
+	Correlator *StageEventCorrelator `json:"correlator,omitempty"`
+}
+
+// StageEventRateLimit is a token bucket limiting the rate of the events.
+type StageEventRateLimit struct {
+	// QPS is the average number of events per second.
+	// +kubebuilder:validation:Minimum=0
+	QPS float64 `json:"qps"`
+	// Burst is the max number of events recorded at once.
+	// +kubebuilder:validation:Minimum=1
+	Burst int `json:"burst"`
+}
+
+// StageEventCorrelator configures the correlator of the events, 0 means the default of the field.
+type StageEventCorrelator struct {
+	// MaxEvents is the number of similar events of a resource before they are aggregated into one.
+	// The default is 10.
+	MaxEvents int `json:"maxEvents,omitempty"`
+	// MaxIntervalSeconds is the time after the last similar event before an event is not aggregated anymore.
+	// The default is 600.
+	MaxIntervalSeconds int `json:"maxIntervalSeconds,omitempty"`
+	// BurstSize is the burst of the spam filter of the events of a resource.
+	// The default is 25.
+	BurstSize int `json:"burstSize,omitempty"`
+	// QPS is the refill rate of the spam filter of the events of a resource.
+	// The default is 1/300.
+	QPS float64 `json:"qps,omitempty"`
 }
 
 // StageSelector is a resource selector. the result of matchLabels and matchAnnotations and
@@ -159,6 +402,9 @@ type StageSelector struct {
 	MatchAnnotations map[string]string `json:"matchAnnotations,omitempty"`
 	// MatchExpressions is a list of label selector requirements. The requirements are ANDed.
 	MatchExpressions []SelectorRequirement `json:"matchExpressions,omitempty"`
+	// MatchCEL is a list of CEL expressions which must evaluate to true, the resource is available as `self`.
+	// The requirements are ANDed.
+	MatchCEL []string `json:"matchCEL,omitempty"`
 }
 
 // SelectorRequirement is a resource selector requirement is a selector that contains values, a key,
@@ -194,6 +440,9 @@ const (
 type ExpressionFromSource struct {
 	// ExpressionFrom is the expression used to get the value.
 	ExpressionFrom string `json:"expressionFrom,omitempty"`
+	// CEL is the CEL expression used to get the value, the resource is available as `self`.
+	// It is exclusive with ExpressionFrom.
+	CEL string `json:"cel,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -1388,6 +1388,22 @@ func (in *Stage) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StageCreate) DeepCopyInto(out *StageCreate) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StageCreate.
+func (in *StageCreate) DeepCopy() *StageCreate {
+	if in == nil {
+		return nil
+	}
+	out := new(StageCreate)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StageDelay) DeepCopyInto(out *StageDelay) {
 	*out = *in
@@ -1411,6 +1427,11 @@ func (in *StageDelay) DeepCopyInto(out *StageDelay) {
 		*out = new(ExpressionFromSource)
 		**out = **in
 	}
+	if in.Distribution != nil {
+		in, out := &in.Distribution, &out.Distribution
+		*out = new(StageDelayDistribution)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -1424,9 +1445,127 @@ func (in *StageDelay) DeepCopy() *StageDelay {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StageDelayDistribution) DeepCopyInto(out *StageDelayDistribution) {
+	*out = *in
+	if in.MeanMilliseconds != nil {
+		in, out := &in.MeanMilliseconds, &out.MeanMilliseconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.StdDevMilliseconds != nil {
+		in, out := &in.StdDevMilliseconds, &out.StdDevMilliseconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MedianMilliseconds != nil {
+		in, out := &in.MedianMilliseconds, &out.MedianMilliseconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Sigma != nil {
+		in, out := &in.Sigma, &out.Sigma
+		*out = new(float64)
+		**out = **in
+	}
+	if in.ScaleMilliseconds != nil {
+		in, out := &in.ScaleMilliseconds, &out.ScaleMilliseconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Shape != nil {
+		in, out := &in.Shape, &out.Shape
+		*out = new(float64)
+		**out = **in
+	}
+	if in.Percentiles != nil {
+		in, out := &in.Percentiles, &out.Percentiles
+		*out = make([]StageDelayPercentile, len(*in))
+		copy(*out, *in)
+	}
+	if in.MinMilliseconds != nil {
+		in, out := &in.MinMilliseconds, &out.MinMilliseconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MaxMilliseconds != nil {
+		in, out := &in.MaxMilliseconds, &out.MaxMilliseconds
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StageDelayDistribution.
+func (in *StageDelayDistribution) DeepCopy() *StageDelayDistribution {
+	if in == nil {
+		return nil
+	}
+	out := new(StageDelayDistribution)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StageDelayPercentile) DeepCopyInto(out *StageDelayPercentile) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StageDelayPercentile.
+func (in *StageDelayPercentile) DeepCopy() *StageDelayPercentile {
+	if in == nil {
+		return nil
+	}
+	out := new(StageDelayPercentile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StageDrain) DeepCopyInto(out *StageDrain) {
+	*out = *in
+	if in.TimeoutMilliseconds != nil {
+		in, out := &in.TimeoutMilliseconds, &out.TimeoutMilliseconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.GracePeriodSeconds != nil {
+		in, out := &in.GracePeriodSeconds, &out.GracePeriodSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StageDrain.
+func (in *StageDrain) DeepCopy() *StageDrain {
+	if in == nil {
+		return nil
+	}
+	out := new(StageDrain)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StageEvent) DeepCopyInto(out *StageEvent) {
 	*out = *in
+	if in.SampleRate != nil {
+		in, out := &in.SampleRate, &out.SampleRate
+		*out = new(float64)
+		**out = **in
+	}
+	if in.RateLimit != nil {
+		in, out := &in.RateLimit, &out.RateLimit
+		*out = new(StageEventRateLimit)
+		**out = **in
+	}
+	if in.Correlator != nil {
+		in, out := &in.Correlator, &out.Correlator
+		*out = new(StageEventCorrelator)
+		**out = **in
+	}
 	return
 }
 
@@ -1440,6 +1579,38 @@ func (in *StageEvent) DeepCopy() *StageEvent {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StageEventCorrelator) DeepCopyInto(out *StageEventCorrelator) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StageEventCorrelator.
+func (in *StageEventCorrelator) DeepCopy() *StageEventCorrelator {
+	if in == nil {
+		return nil
+	}
+	out := new(StageEventCorrelator)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StageEventRateLimit) DeepCopyInto(out *StageEventRateLimit) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StageEventRateLimit.
+func (in *StageEventRateLimit) DeepCopy() *StageEventRateLimit {
+	if in == nil {
+		return nil
+	}
+	out := new(StageEventRateLimit)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StageFinalizers) DeepCopyInto(out *StageFinalizers) {
 	*out = *in
@@ -1505,13 +1676,35 @@ func (in *StageNext) DeepCopyInto(out *StageNext) {
 	if in.Event != nil {
 		in, out := &in.Event, &out.Event
 		*out = new(StageEvent)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.Finalizers != nil {
 		in, out := &in.Finalizers, &out.Finalizers
 		*out = new(StageFinalizers)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Patches != nil {
+		in, out := &in.Patches, &out.Patches
+		*out = make([]StagePatch, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Create != nil {
+		in, out := &in.Create, &out.Create
+		*out = make([]StageCreate, len(*in))
+		copy(*out, *in)
+	}
+	if in.Webhook != nil {
+		in, out := &in.Webhook, &out.Webhook
+		*out = new(StageWebhook)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Drain != nil {
+		in, out := &in.Drain, &out.Drain
+		*out = new(StageDrain)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -1525,6 +1718,53 @@ func (in *StageNext) DeepCopy() *StageNext {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StagePatch) DeepCopyInto(out *StagePatch) {
+	*out = *in
+	if in.Type != nil {
+		in, out := &in.Type, &out.Type
+		*out = new(StagePatchType)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StagePatch.
+func (in *StagePatch) DeepCopy() *StagePatch {
+	if in == nil {
+		return nil
+	}
+	out := new(StagePatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StageRepeat) DeepCopyInto(out *StageRepeat) {
+	*out = *in
+	if in.BackoffMultiplier != nil {
+		in, out := &in.BackoffMultiplier, &out.BackoffMultiplier
+		*out = new(float64)
+		**out = **in
+	}
+	if in.MaxDelayMilliseconds != nil {
+		in, out := &in.MaxDelayMilliseconds, &out.MaxDelayMilliseconds
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StageRepeat.
+func (in *StageRepeat) DeepCopy() *StageRepeat {
+	if in == nil {
+		return nil
+	}
+	out := new(StageRepeat)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StageResourceRef) DeepCopyInto(out *StageResourceRef) {
 	*out = *in
@@ -1565,6 +1805,11 @@ func (in *StageSelector) DeepCopyInto(out *StageSelector) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.MatchCEL != nil {
+		in, out := &in.MatchCEL, &out.MatchCEL
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -1592,6 +1837,11 @@ func (in *StageSpec) DeepCopyInto(out *StageSpec) {
 		*out = new(StageDelay)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Repeat != nil {
+		in, out := &in.Repeat, &out.Repeat
+		*out = new(StageRepeat)
+		(*in).DeepCopyInto(*out)
+	}
 	in.Next.DeepCopyInto(&out.Next)
 	if in.ImmediateNextStage != nil {
 		in, out := &in.ImmediateNextStage, &out.ImmediateNextStage
@@ -1633,3 +1883,134 @@ func (in *StageStatus) DeepCopy() *StageStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StageTemplate) DeepCopyInto(out *StageTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StageTemplate.
+func (in *StageTemplate) DeepCopy() *StageTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(StageTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *StageTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StageTemplateList) DeepCopyInto(out *StageTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]StageTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StageTemplateList.
+func (in *StageTemplateList) DeepCopy() *StageTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(StageTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *StageTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StageTemplateSpec) DeepCopyInto(out *StageTemplateSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StageTemplateSpec.
+func (in *StageTemplateSpec) DeepCopy() *StageTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(StageTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StageTemplateStatus) DeepCopyInto(out *StageTemplateStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StageTemplateStatus.
+func (in *StageTemplateStatus) DeepCopy() *StageTemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StageTemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StageWebhook) DeepCopyInto(out *StageWebhook) {
+	*out = *in
+	if in.TimeoutMilliseconds != nil {
+		in, out := &in.TimeoutMilliseconds, &out.TimeoutMilliseconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.FailurePolicy != nil {
+		in, out := &in.FailurePolicy, &out.FailurePolicy
+		*out = new(StageWebhookFailurePolicy)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StageWebhook.
+func (in *StageWebhook) DeepCopy() *StageWebhook {
+	if in == nil {
+		return nil
+	}
+	out := new(StageWebhook)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -59,6 +59,9 @@ func SetObjectDefaults_Stage(in *Stage) {
 	if in.Spec.Weight == 0 {
 		in.Spec.Weight = 0
 	}
+	if in.Spec.Priority == 0 {
+		in.Spec.Priority = 0
+	}
 }
 
 func SetObjectDefaults_StageList(in *StageList) {
@@ -38,6 +38,7 @@ type KwokV1alpha1Interface interface {
 	MetricsGetter
 	PortForwardsGetter
 	StagesGetter
+	StageTemplatesGetter
 }
 
 // KwokV1alpha1Client is used to interact with features provided by the kwok.x-k8s.io group.
@@ -85,6 +86,10 @@ func (c *KwokV1alpha1Client) Stages() StageInterface {
 	return newStages(c)
 }
 
+func (c *KwokV1alpha1Client) StageTemplates() StageTemplateInterface {
+	return newStageTemplates(c)
+}
+
 // NewForConfig creates a new KwokV1alpha1Client for the given config.
 // NewForConfig is equivalent to NewForConfigAndClient(c, httpClient),
 // where httpClient was generated with rest.HTTPClientFor(c).
@@ -68,6 +68,10 @@ func (c *FakeKwokV1alpha1) Stages() v1alpha1.StageInterface {
 	return &FakeStages{c}
 }
 
+func (c *FakeKwokV1alpha1) StageTemplates() v1alpha1.StageTemplateInterface {
+	return &FakeStageTemplates{c}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeKwokV1alpha1) RESTClient() rest.Interface {
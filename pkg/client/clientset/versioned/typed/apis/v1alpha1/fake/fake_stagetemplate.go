@@ -0,0 +1,132 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+	v1alpha1 "sigs.k8s.io/kwok/pkg/apis/v1alpha1"
+)
+
+// FakeStageTemplates implements StageTemplateInterface
+type FakeStageTemplates struct {
+	Fake *FakeKwokV1alpha1
+}
+
+var stagetemplatesResource = v1alpha1.SchemeGroupVersion.WithResource("stagetemplates")
+
+var stagetemplatesKind = v1alpha1.SchemeGroupVersion.WithKind("StageTemplate")
+
+// Get takes name of the stageTemplate, and returns the corresponding stageTemplate object, and an error if there is any.
+func (c *FakeStageTemplates) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.StageTemplate, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootGetAction(stagetemplatesResource, name), &v1alpha1.StageTemplate{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.StageTemplate), err
+}
+
+// List takes label and field selectors, and returns the list of StageTemplates that match those selectors.
+func (c *FakeStageTemplates) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.StageTemplateList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootListAction(stagetemplatesResource, stagetemplatesKind, opts), &v1alpha1.StageTemplateList{})
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.StageTemplateList{ListMeta: obj.(*v1alpha1.StageTemplateList).ListMeta}
+	for _, item := range obj.(*v1alpha1.StageTemplateList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested stageTemplates.
+func (c *FakeStageTemplates) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewRootWatchAction(stagetemplatesResource, opts))
+}
+
+// Create takes the representation of a stageTemplate and creates it.  Returns the server's representation of the stageTemplate, and an error, if there is any.
+func (c *FakeStageTemplates) Create(ctx context.Context, stageTemplate *v1alpha1.StageTemplate, opts v1.CreateOptions) (result *v1alpha1.StageTemplate, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootCreateAction(stagetemplatesResource, stageTemplate), &v1alpha1.StageTemplate{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.StageTemplate), err
+}
+
+// Update takes the representation of a stageTemplate and updates it. Returns the server's representation of the stageTemplate, and an error, if there is any.
+func (c *FakeStageTemplates) Update(ctx context.Context, stageTemplate *v1alpha1.StageTemplate, opts v1.UpdateOptions) (result *v1alpha1.StageTemplate, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateAction(stagetemplatesResource, stageTemplate), &v1alpha1.StageTemplate{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.StageTemplate), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeStageTemplates) UpdateStatus(ctx context.Context, stageTemplate *v1alpha1.StageTemplate, opts v1.UpdateOptions) (*v1alpha1.StageTemplate, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateSubresourceAction(stagetemplatesResource, "status", stageTemplate), &v1alpha1.StageTemplate{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.StageTemplate), err
+}
+
+// Delete takes name of the stageTemplate and deletes it. Returns an error if one occurs.
+func (c *FakeStageTemplates) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewRootDeleteActionWithOptions(stagetemplatesResource, name, opts), &v1alpha1.StageTemplate{})
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeStageTemplates) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewRootDeleteCollectionAction(stagetemplatesResource, listOpts)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.StageTemplateList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched stageTemplate.
+func (c *FakeStageTemplates) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.StageTemplate, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootPatchSubresourceAction(stagetemplatesResource, name, pt, data, subresources...), &v1alpha1.StageTemplate{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.StageTemplate), err
+}
@@ -37,3 +37,5 @@ type MetricExpansion interface{}
 type PortForwardExpansion interface{}
 
 type StageExpansion interface{}
+
+type StageTemplateExpansion interface{}
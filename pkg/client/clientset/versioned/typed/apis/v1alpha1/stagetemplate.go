@@ -0,0 +1,184 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+	v1alpha1 "sigs.k8s.io/kwok/pkg/apis/v1alpha1"
+	scheme "sigs.k8s.io/kwok/pkg/client/clientset/versioned/scheme"
+)
+
+// StageTemplatesGetter has a method to return a StageTemplateInterface.
+// A group's client should implement this interface.
+type StageTemplatesGetter interface {
+	StageTemplates() StageTemplateInterface
+}
+
+// StageTemplateInterface has methods to work with StageTemplate resources.
+type StageTemplateInterface interface {
+	Create(ctx context.Context, stageTemplate *v1alpha1.StageTemplate, opts v1.CreateOptions) (*v1alpha1.StageTemplate, error)
+	Update(ctx context.Context, stageTemplate *v1alpha1.StageTemplate, opts v1.UpdateOptions) (*v1alpha1.StageTemplate, error)
+	UpdateStatus(ctx context.Context, stageTemplate *v1alpha1.StageTemplate, opts v1.UpdateOptions) (*v1alpha1.StageTemplate, error)
+	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
+	Get(ctx context.Context, name string, opts v1.GetOptions) (*v1alpha1.StageTemplate, error)
+	List(ctx context.Context, opts v1.ListOptions) (*v1alpha1.StageTemplateList, error)
+	Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.StageTemplate, err error)
+	StageTemplateExpansion
+}
+
+// stageTemplates implements StageTemplateInterface
+type stageTemplates struct {
+	client rest.Interface
+}
+
+// newStageTemplates returns a StageTemplates
+func newStageTemplates(c *KwokV1alpha1Client) *stageTemplates {
+	return &stageTemplates{
+		client: c.RESTClient(),
+	}
+}
+
+// Get takes name of the stageTemplate, and returns the corresponding stageTemplate object, and an error if there is any.
+func (c *stageTemplates) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.StageTemplate, err error) {
+	result = &v1alpha1.StageTemplate{}
+	err = c.client.Get().
+		Resource("stagetemplates").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of StageTemplates that match those selectors.
+func (c *stageTemplates) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.StageTemplateList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1alpha1.StageTemplateList{}
+	err = c.client.Get().
+		Resource("stagetemplates").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested stageTemplates.
+func (c *stageTemplates) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Resource("stagetemplates").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a stageTemplate and creates it.  Returns the server's representation of the stageTemplate, and an error, if there is any.
+func (c *stageTemplates) Create(ctx context.Context, stageTemplate *v1alpha1.StageTemplate, opts v1.CreateOptions) (result *v1alpha1.StageTemplate, err error) {
+	result = &v1alpha1.StageTemplate{}
+	err = c.client.Post().
+		Resource("stagetemplates").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(stageTemplate).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a stageTemplate and updates it. Returns the server's representation of the stageTemplate, and an error, if there is any.
+func (c *stageTemplates) Update(ctx context.Context, stageTemplate *v1alpha1.StageTemplate, opts v1.UpdateOptions) (result *v1alpha1.StageTemplate, err error) {
+	result = &v1alpha1.StageTemplate{}
+	err = c.client.Put().
+		Resource("stagetemplates").
+		Name(stageTemplate.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(stageTemplate).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *stageTemplates) UpdateStatus(ctx context.Context, stageTemplate *v1alpha1.StageTemplate, opts v1.UpdateOptions) (result *v1alpha1.StageTemplate, err error) {
+	result = &v1alpha1.StageTemplate{}
+	err = c.client.Put().
+		Resource("stagetemplates").
+		Name(stageTemplate.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(stageTemplate).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the stageTemplate and deletes it. Returns an error if one occurs.
+func (c *stageTemplates) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	return c.client.Delete().
+		Resource("stagetemplates").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *stageTemplates) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Resource("stagetemplates").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched stageTemplate.
+func (c *stageTemplates) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.StageTemplate, err error) {
+	result = &v1alpha1.StageTemplate{}
+	err = c.client.Patch(pt).
+		Resource("stagetemplates").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
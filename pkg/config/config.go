@@ -113,6 +113,12 @@ var configHandlers = map[string]configHandler{
 		MutateToInternal: mutateToInternalConfig(convertToInternalStage),
 		MutateToVersiond: mutateToVersiondConfig(internalversion.ConvertToV1alpha1Stage),
 	},
+	v1alpha1.StageTemplateKind: {
+		Unmarshal:        unmarshalConfig[*v1alpha1.StageTemplate],
+		Marshal:          marshalConfig,
+		MutateToInternal: mutateToInternalConfig(internalversion.ConvertToInternalStageTemplate),
+		MutateToVersiond: mutateToVersiondConfig(internalversion.ConvertToV1Alpha1StageTemplate),
+	},
 	v1alpha1.PortForwardKind: {
 		Unmarshal:        unmarshalConfig[*v1alpha1.PortForward],
 		Marshal:          marshalConfig,
@@ -334,9 +340,38 @@ func Load(ctx context.Context, src ...string) ([]InternalObject, error) {
 		objs = append(objs, internalObjs...)
 	}
 
+	objs, err = resolveStages(objs)
+	if err != nil {
+		return nil, err
+	}
+
 	return objs, nil
 }
 
+// resolveStages resolves the extends and the included templates of the stages in objs.
+func resolveStages(objs []InternalObject) ([]InternalObject, error) {
+	stages := FilterWithType[*internalversion.Stage](objs)
+	if len(stages) == 0 {
+		return objs, nil
+	}
+	templates := FilterWithType[*internalversion.StageTemplate](objs)
+	resolved, err := internalversion.ResolveStages(stages, templates)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]InternalObject, 0, len(objs))
+	for _, obj := range objs {
+		if _, ok := obj.(*internalversion.Stage); ok {
+			out = append(out, resolved[0])
+			resolved = resolved[1:]
+			continue
+		}
+		out = append(out, obj)
+	}
+	return out, nil
+}
+
 // Save saves the given objects to the given path.
 func Save(ctx context.Context, dist string, objs []InternalObject) error {
 	dist = path.Clean(dist)
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
@@ -153,3 +154,60 @@ kind: KwokctlConfiguration
 		})
 	}
 }
+
+func TestLoadResolveStages(t *testing.T) {
+	ctx := context.Background()
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(config, []byte(`
+kind: StageTemplate
+apiVersion: kwok.x-k8s.io/v1alpha1
+metadata:
+  name: phase
+spec:
+  template: Running
+---
+kind: Stage
+apiVersion: kwok.x-k8s.io/v1alpha1
+metadata:
+  name: base
+spec:
+  resourceRef:
+    apiGroup: v1
+    kind: Pod
+  next:
+    statusTemplate: 'phase: {{ include "phase" . }}'
+---
+kind: Stage
+apiVersion: kwok.x-k8s.io/v1alpha1
+metadata:
+  name: child
+spec:
+  extends: base
+  weight: 2
+`), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objs, err := Load(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stages := FilterWithType[*internalversion.Stage](objs)
+	if len(stages) != 2 {
+		t.Fatalf("want 2 stages, got %d", len(stages))
+	}
+	child := stages[1]
+	if child.Name != "child" || child.Spec.Extends != "" || child.Spec.Weight != 2 ||
+		child.Spec.ResourceRef != (internalversion.StageResourceRef{APIGroup: "v1", Kind: "Pod"}) {
+		t.Fatalf("unexpected resolved stage %#v", child.Spec)
+	}
+	wantTemplate := `{{- define "phase" }}Running{{ end -}}` + "\n" + `phase: {{ include "phase" . }}`
+	if child.Spec.Next.StatusTemplate != wantTemplate {
+		t.Fatalf("want status template %q, got %q", wantTemplate, child.Spec.Next.StatusTemplate)
+	}
+	if len(FilterWithType[*internalversion.StageTemplate](objs)) != 1 {
+		t.Fatalf("want the stage template kept")
+	}
+}
@@ -25,12 +25,14 @@ import (
 type configCtx int
 
 type configValue struct {
+	Paths   []string
 	Objects []InternalObject
 }
 
-// setupContext sets the given objects in the context.
-func setupContext(ctx context.Context, objs []InternalObject) context.Context {
+// setupContext sets the given paths and the objects loaded from them in the context.
+func setupContext(ctx context.Context, paths []string, objs []InternalObject) context.Context {
 	val := &configValue{
+		Paths:   paths,
 		Objects: objs,
 	}
 	return context.WithValue(ctx, configCtx(0), val)
@@ -61,3 +63,16 @@ func GetFromContext(ctx context.Context) []InternalObject {
 
 	return val.Objects
 }
+
+// GetPathsFromContext returns the paths of the objects from the context.
+func GetPathsFromContext(ctx context.Context) []string {
+	v := ctx.Value(configCtx(0))
+	val, ok := v.(*configValue)
+	if !ok {
+		logger := log.FromContext(ctx)
+		logger.Warn("Unable to get from context")
+		return nil
+	}
+
+	return val.Paths
+}
@@ -26,7 +26,7 @@ import (
 
 func TestContext(t *testing.T) {
 	ctx := context.Background()
-	ctx = setupContext(ctx, []InternalObject{
+	ctx = setupContext(ctx, []string{"kwok.yaml"}, []InternalObject{
 		&metav1.ObjectMeta{
 			Name: "first",
 		},
@@ -53,4 +53,8 @@ func TestContext(t *testing.T) {
 	if diff := cmp.Diff(want, objs); diff != "" {
 		t.Errorf("unexpected objects (-want +got):\n%s", diff)
 	}
+
+	if diff := cmp.Diff([]string{"kwok.yaml"}, GetPathsFromContext(ctx)); diff != "" {
+		t.Errorf("unexpected paths (-want +got):\n%s", diff)
+	}
 }
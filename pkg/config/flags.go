@@ -74,7 +74,7 @@ func InitFlags(ctx context.Context, flags *pflag.FlagSet) (context.Context, erro
 		)
 	}
 
-	return setupContext(ctx, objs), nil
+	return setupContext(ctx, configPaths, objs), nil
 }
 
 // loadConfig loads the config paths.
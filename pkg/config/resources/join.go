@@ -0,0 +1,36 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+type joinGetter[O any, A any, B any] struct {
+	a        Getter[A]
+	b        Getter[B]
+	joinFunc func(A, B) O
+}
+
+// NewJoin returns a new Getter that joins the data of the two given getters.
+func NewJoin[O any, A any, B any](a Getter[A], b Getter[B], joinFunc func(A, B) O) Getter[O] {
+	return withCache[O](&joinGetter[O, A, B]{a: a, b: b, joinFunc: joinFunc})
+}
+
+func (j *joinGetter[O, A, B]) Get() O {
+	return j.joinFunc(j.a.Get(), j.b.Get())
+}
+
+func (j *joinGetter[O, A, B]) Version() string {
+	return j.a.Version() + "/" + j.b.Version()
+}
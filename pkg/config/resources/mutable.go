@@ -0,0 +1,52 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"strconv"
+	"sync"
+)
+
+type mutableGetter[T any] struct {
+	data    T
+	version uint64
+	mut     sync.RWMutex
+}
+
+// NewMutableGetter returns a new MutableGetter that returns the given data until it is replaced.
+func NewMutableGetter[T any](data T) MutableGetter[T] {
+	return &mutableGetter[T]{data: data}
+}
+
+func (m *mutableGetter[T]) Get() T {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	return m.data
+}
+
+func (m *mutableGetter[T]) Version() string {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	return strconv.FormatUint(m.version, 10)
+}
+
+func (m *mutableGetter[T]) Set(data T) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.data = data
+	m.version++
+}
@@ -38,6 +38,12 @@ type Starter interface {
 	Start(ctx context.Context) error
 }
 
+// MutableGetter is an interface for getting resources that can be replaced.
+type MutableGetter[O any] interface {
+	Getter[O]
+	Set(data O)
+}
+
 // CacheGetter is an interface for getting resources that are cached.
 type CacheGetter[O any] interface {
 	Getter[O]
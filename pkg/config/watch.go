@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"sigs.k8s.io/kwok/pkg/log"
+	"sigs.k8s.io/kwok/pkg/utils/slices"
+)
+
+// watchDebounce is the duration to wait for the changes to settle before reloading,
+// as editors usually write a file with several events.
+var watchDebounce = time.Second
+
+var configReloadsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "kwok_config_reloads_total",
+		Help: "Total number of reloads of the config files by result.",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(configReloadsTotal)
+}
+
+// ReloadFunc applies the objects reloaded from the config files,
+// it returns an error to keep the previous objects in effect.
+type ReloadFunc func(ctx context.Context, objs []InternalObject) error
+
+// Watch watches the config files in src, and calls reload with the objects loaded from them when they change.
+// Each reload is logged and counted by the kwok_config_reloads_total metric.
+func Watch(ctx context.Context, src []string, reload ReloadFunc) error {
+	logger := log.FromContext(ctx)
+	if len(src) == 0 {
+		return nil
+	}
+	if slices.Contains(src, "-") {
+		logger.Warn("Config from stdin can not be watched")
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create fsnotify watcher: %w", err)
+	}
+
+	// Watch the directories rather than the files,
+	// so that the files replaced by renaming and the symlinks of a mounted ConfigMap are followed.
+	dirs := map[string]struct{}{}
+	for _, p := range src {
+		dir := filepath.Dir(p)
+		if _, ok := dirs[dir]; ok {
+			continue
+		}
+		dirs[dir] = struct{}{}
+		err = watcher.Add(dir)
+		if err != nil {
+			_ = watcher.Close()
+			return fmt.Errorf("failed to watch %q: %w", dir, err)
+		}
+	}
+
+	sum, err := checksumFiles(src)
+	if err != nil {
+		_ = watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer func() {
+			_ = watcher.Close()
+		}()
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				logger.Debug("Config directory changed", "event", event)
+				debounce = time.After(watchDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Error("Failed to watch config", err)
+			case <-debounce:
+				debounce = nil
+				newSum, err := checksumFiles(src)
+				if err != nil {
+					logger.Debug("Skip reloading config", "err", err)
+					continue
+				}
+				if newSum == sum {
+					continue
+				}
+				sum = newSum
+
+				err = reloadConfig(ctx, src, reload)
+				if err != nil {
+					configReloadsTotal.WithLabelValues("failure").Inc()
+					logger.Error("Failed to reload config, keep the previous one", err, "path", src)
+					continue
+				}
+				configReloadsTotal.WithLabelValues("success").Inc()
+				logger.Info("Reloaded config", "path", src)
+			}
+		}
+	}()
+	return nil
+}
+
+func reloadConfig(ctx context.Context, src []string, reload ReloadFunc) error {
+	objs, err := Load(ctx, src...)
+	if err != nil {
+		return err
+	}
+	return reload(ctx, objs)
+}
+
+// checksumFiles returns the checksum of the contents of the files.
+func checksumFiles(src []string) (string, error) {
+	h := sha256.New()
+	for _, p := range src {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return "", err
+		}
+		_, _ = h.Write(data)
+		_, _ = h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
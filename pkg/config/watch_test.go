@@ -0,0 +1,106 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+)
+
+func TestWatch(t *testing.T) {
+	watchDebounce = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	stage := func(name string) []byte {
+		return []byte(`
+kind: Stage
+apiVersion: kwok.x-k8s.io/v1alpha1
+metadata:
+  name: ` + name + `
+spec:
+  resourceRef:
+    apiGroup: v1
+    kind: Pod
+`)
+	}
+	err := os.WriteFile(config, stage("first"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan string, 1)
+	err = Watch(ctx, []string{config}, func(ctx context.Context, objs []InternalObject) error {
+		stages := FilterWithType[*internalversion.Stage](objs)
+		if len(stages) != 1 {
+			return fmt.Errorf("want only one stage, got %d", len(stages))
+		}
+		reloaded <- stages[0].Name
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	success := testutil.ToFloat64(configReloadsTotal.WithLabelValues("success"))
+	failure := testutil.ToFloat64(configReloadsTotal.WithLabelValues("failure"))
+
+	err = os.WriteFile(config, stage("second"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case name := <-reloaded:
+		if name != "second" {
+			t.Fatalf("want reloaded stage second, got %s", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for reload")
+	}
+	waitForReloads(t, "success", success+1)
+
+	err = os.WriteFile(config, append(stage("third"), append([]byte("---"), stage("fourth")...)...), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForReloads(t, "failure", failure+1)
+	select {
+	case name := <-reloaded:
+		t.Fatalf("unexpected reload of %s", name)
+	default:
+	}
+}
+
+func waitForReloads(t *testing.T, result string, want float64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(configReloadsTotal.WithLabelValues(result)) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %v reloads with result %s", want, result)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
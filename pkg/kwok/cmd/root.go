@@ -21,6 +21,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -42,6 +43,7 @@ import (
 	"sigs.k8s.io/kwok/pkg/kwok/server"
 	"sigs.k8s.io/kwok/pkg/log"
 	"sigs.k8s.io/kwok/pkg/utils/client"
+	utilsclock "sigs.k8s.io/kwok/pkg/utils/clock"
 	"sigs.k8s.io/kwok/pkg/utils/envs"
 	"sigs.k8s.io/kwok/pkg/utils/format"
 	"sigs.k8s.io/kwok/pkg/utils/kubeconfig"
@@ -95,6 +97,12 @@ func NewCommand(ctx context.Context) *cobra.Command {
 	cmd.Flags().UintVar(&flags.Options.NodeLeaseDurationSeconds, "node-lease-duration-seconds", flags.Options.NodeLeaseDurationSeconds, "Duration of node lease seconds")
 	cmd.Flags().StringSliceVar(&flags.Options.EnableCRDs, "enable-crds", flags.Options.EnableCRDs, "List of CRDs to enable")
 	cmd.Flags().StringSliceVar(&flags.Options.EnableStageForRefs, "enable-stage-for-refs", flags.Options.EnableStageForRefs, "List of refs to enable stage for")
+	cmd.Flags().Float64Var(&flags.Options.TimeScale, "time-scale", flags.Options.TimeScale, "Scale of the simulated time to the real time, e.g. 10 makes the stages and the node leases 10 times as fast")
+	cmd.Flags().Int64Var(&flags.Options.RandomSeed, "random-seed", flags.Options.RandomSeed, "Seed of the random sources for choosing stages and delays, 0 means not reproducible")
+	cmd.Flags().BoolVar(&flags.Options.EnableStageHistoryAnnotation, "enable-stage-history-annotation", flags.Options.EnableStageHistoryAnnotation, "Record the recent stage transitions of the resources in an annotation")
+	cmd.Flags().BoolVar(&flags.Options.EnablePodAdmission, "enable-pod-admission", flags.Options.EnablePodAdmission, "Reject the pods that do not fit the node like the kubelet, e.g. OutOfcpu, OutOfmemory, OutOfpods or NodeAffinity")
+	cmd.Flags().BoolVar(&flags.Options.EnableNodePressureEviction, "enable-node-pressure-eviction", flags.Options.EnableNodePressureEviction, "Evict the pods from the nodes with the MemoryPressure or DiskPressure condition like the kubelet")
+	cmd.Flags().BoolVar(&flags.Options.EnableProbeSimulation, "enable-probe-simulation", flags.Options.EnableProbeSimulation, "Simulate the startup, readiness and liveness probes of the containers, scripted by the kwok.x-k8s.io/probe-results annotation")
 
 	cmd.Flags().BoolVar(&flags.Options.EnableCNI, "experimental-enable-cni", flags.Options.EnableCNI, "Experimental support for getting pod ip from CNI, for CNI-related components, Only works with Linux")
 	if config.GOOS != "linux" {
@@ -105,6 +113,7 @@ func NewCommand(ctx context.Context) *cobra.Command {
 
 var crdDefines = map[string]struct{}{
 	v1alpha1.StageKind:              {},
+	v1alpha1.StageTemplateKind:      {},
 	v1alpha1.AttachKind:             {},
 	v1alpha1.ClusterAttachKind:      {},
 	v1alpha1.ExecKind:               {},
@@ -144,29 +153,18 @@ func runE(ctx context.Context, flags *flagpole) error {
 		return err
 	}
 
+	stageTemplates := config.FilterWithTypeFromContext[*internalversion.StageTemplate](ctx)
+	err = checkConfigOrCRD(flags.Options.EnableCRDs, v1alpha1.StageTemplateKind, stageTemplates)
+	if err != nil {
+		return err
+	}
+
 	var groupStages map[internalversion.StageResourceRef][]*internalversion.Stage
 
 	if !slices.Contains(flags.Options.EnableCRDs, v1alpha1.StageKind) {
-		groupStages = slices.GroupBy(stagesData, func(stage *internalversion.Stage) internalversion.StageResourceRef {
-			return stage.Spec.ResourceRef
-		})
-
-		nodeRef := internalversion.StageResourceRef{APIGroup: "v1", Kind: "Node"}
-		podRef := internalversion.StageResourceRef{APIGroup: "v1", Kind: "Pod"}
-
-		if len(groupStages[nodeRef]) == 0 {
-			logger.Warn("No node stages found, using default node stages")
-			groupStages[nodeRef], err = getDefaultNodeStages(flags.Options.NodeLeaseDurationSeconds == 0)
-			if err != nil {
-				return err
-			}
-		}
-
-		if len(groupStages[podRef]) == 0 {
-			groupStages[podRef], err = getDefaultPodStages()
-			if err != nil {
-				return err
-			}
+		groupStages, err = groupLocalStages(ctx, flags, stagesData)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -247,10 +245,51 @@ func runE(ctx context.Context, flags *flagpole) error {
 		}
 	})
 
+	stageRefOptions := map[internalversion.StageResourceRef]controllers.StageRefOption{}
+	for _, stageForRef := range flags.Options.StageForRefs {
+		m, err := client.MappingFor(restMapper, stageForRef.Ref)
+		if err != nil {
+			return err
+		}
+		// The pods and the nodes are played by their own controllers, not by the stage controllers.
+		if gvk := m.GroupVersionKind; gvk.Group == "" && (gvk.Kind == "Pod" || gvk.Kind == "Node") {
+			return fmt.Errorf("stage for ref %q is not supported, use the %sPlayStageParallelism option for %ss instead",
+				stageForRef.Ref, strings.ToLower(gvk.Kind), strings.ToLower(gvk.Kind))
+		}
+		if len(stageForRef.Namespaces) != 0 && m.Scope.Name() != meta.RESTScopeNameNamespace {
+			return fmt.Errorf("namespaces of stage for ref %q is only valid for namespaced resources", stageForRef.Ref)
+		}
+		ref := internalversion.StageResourceRef{
+			APIGroup: m.GroupVersionKind.GroupVersion().String(),
+			Kind:     m.GroupVersionKind.Kind,
+		}
+		if _, ok := stageRefOptions[ref]; ok {
+			return fmt.Errorf("duplicate stage for ref %q", stageForRef.Ref)
+		}
+		stageRefOptions[ref] = controllers.StageRefOption{
+			PlayStageParallelism: stageForRef.Parallelism,
+			LabelSelector:        stageForRef.LabelSelector,
+			FieldSelector:        stageForRef.FieldSelector,
+			Namespaces:           stageForRef.Namespaces,
+		}
+		if !slices.Contains(stageWithRefs, ref) {
+			stageWithRefs = append(stageWithRefs, ref)
+		}
+	}
+
+	var clk clock.Clock = clock.RealClock{}
+	if flags.Options.TimeScale != 0 && flags.Options.TimeScale != 1 {
+		if flags.Options.TimeScale < 0 {
+			return fmt.Errorf("time-scale must be greater than 0")
+		}
+		clk = utilsclock.NewScaledClock(clk, flags.Options.TimeScale)
+		logger.Info("Simulated time is scaled", "timeScale", flags.Options.TimeScale)
+	}
+
 	metrics := config.FilterWithTypeFromContext[*internalversion.Metric](ctx)
 	enableMetrics := len(metrics) != 0 || slices.Contains(flags.Options.EnableCRDs, v1alpha1.MetricKind)
 	ctr, err := controllers.NewController(controllers.Config{
-		Clock:                                 clock.RealClock{},
+		Clock:                                 clk,
 		DynamicClient:                         dynamicClient,
 		RESTClient:                            restClient,
 		RESTMapper:                            restMapper,
@@ -272,9 +311,17 @@ func runE(ctx context.Context, flags *flagpole) error {
 		PodPlayStageParallelism:               flags.Options.PodPlayStageParallelism,
 		NodePlayStageParallelism:              flags.Options.NodePlayStageParallelism,
 		StageWithRefs:                         stageWithRefs,
+		StageRefOptions:                       stageRefOptions,
 		LocalStages:                           groupStages,
+		LocalStageTemplates:                   stageTemplates,
+		EnableCRDs:                            flags.Options.EnableCRDs,
 		NodeLeaseParallelism:                  flags.Options.NodeLeaseParallelism,
 		NodeLeaseDurationSeconds:              flags.Options.NodeLeaseDurationSeconds,
+		RandomSeed:                            flags.Options.RandomSeed,
+		EnableStageHistoryAnnotation:          flags.Options.EnableStageHistoryAnnotation,
+		EnablePodAdmission:                    flags.Options.EnablePodAdmission,
+		EnableNodePressureEviction:            flags.Options.EnableNodePressureEviction,
+		EnableProbeSimulation:                 flags.Options.EnableProbeSimulation,
 		ID:                                    id,
 	})
 	if err != nil {
@@ -286,7 +333,20 @@ func runE(ctx context.Context, flags *flagpole) error {
 		return err
 	}
 
-	err = startServer(ctx, flags, ctr, typedKwokClient)
+	if groupStages != nil {
+		err = config.Watch(ctx, config.GetPathsFromContext(ctx), func(ctx context.Context, objs []config.InternalObject) error {
+			stages, err := groupLocalStages(ctx, flags, config.FilterWithType[*internalversion.Stage](objs))
+			if err != nil {
+				return err
+			}
+			return ctr.ReloadLocalStages(ctx, stages)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = startServer(ctx, flags, ctr, typedKwokClient, clk)
 	if err != nil {
 		return err
 	}
@@ -295,7 +355,7 @@ func runE(ctx context.Context, flags *flagpole) error {
 	return nil
 }
 
-func startServer(ctx context.Context, flags *flagpole, ctr *controllers.Controller, typedKwokClient versioned.Interface) (err error) {
+func startServer(ctx context.Context, flags *flagpole, ctr *controllers.Controller, typedKwokClient versioned.Interface, clk clock.Clock) (err error) {
 	logger := log.FromContext(ctx)
 
 	serverAddress := flags.Options.ServerAddress
@@ -359,6 +419,7 @@ func startServer(ctx context.Context, flags *flagpole, ctr *controllers.Controll
 		}
 
 		conf := server.Config{
+			Clock:               clk,
 			TypedKwokClient:     typedKwokClient,
 			EnableCRDs:          flags.Options.EnableCRDs,
 			ClusterPortForwards: clusterPortForwards,
@@ -419,6 +480,35 @@ func startServer(ctx context.Context, flags *flagpole, ctr *controllers.Controll
 	return nil
 }
 
+// groupLocalStages groups the stages from --config by the resource ref,
+// and uses the default stages for the nodes and the pods if there are none.
+func groupLocalStages(ctx context.Context, flags *flagpole, stages []*internalversion.Stage) (map[internalversion.StageResourceRef][]*internalversion.Stage, error) {
+	logger := log.FromContext(ctx)
+	groupStages := slices.GroupBy(stages, func(stage *internalversion.Stage) internalversion.StageResourceRef {
+		return stage.Spec.ResourceRef
+	})
+
+	nodeRef := internalversion.StageResourceRef{APIGroup: "v1", Kind: "Node"}
+	podRef := internalversion.StageResourceRef{APIGroup: "v1", Kind: "Pod"}
+
+	var err error
+	if len(groupStages[nodeRef]) == 0 {
+		logger.Warn("No node stages found, using default node stages")
+		groupStages[nodeRef], err = getDefaultNodeStages(flags.Options.NodeLeaseDurationSeconds == 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(groupStages[podRef]) == 0 {
+		groupStages[podRef], err = getDefaultPodStages()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return groupStages, nil
+}
+
 func checkConfigOrCRD[T metav1.Object](crds []string, kind string, crs []T) error {
 	if slices.Contains(crds, kind) && len(crs) != 0 {
 		return fmt.Errorf("%s already exists in --config, so please remove it, or remove %s from --enable-crd", kind, kind)
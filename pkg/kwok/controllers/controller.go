@@ -49,6 +49,7 @@ import (
 	"sigs.k8s.io/kwok/pkg/log"
 	"sigs.k8s.io/kwok/pkg/utils/gotpl"
 	"sigs.k8s.io/kwok/pkg/utils/informer"
+	"sigs.k8s.io/kwok/pkg/utils/maps"
 	"sigs.k8s.io/kwok/pkg/utils/patch"
 	"sigs.k8s.io/kwok/pkg/utils/queue"
 	"sigs.k8s.io/kwok/pkg/utils/slices"
@@ -108,6 +109,10 @@ type Controller struct {
 	broadcaster record.EventBroadcaster
 	recorder    record.EventRecorder
 
+	// correlatedRecorders are the recorders of the stage events with a correlator,
+	// they are shared by the stages with the same correlator.
+	correlatedRecorders maps.SyncMap[internalversion.StageEventCorrelator, record.EventRecorder]
+
 	nodeCacheGetter informer.Getter[*corev1.Node]
 	podCacheGetter  informer.Getter[*corev1.Pod]
 
@@ -132,7 +137,19 @@ type Controller struct {
 	nodeLifecycleGetter resources.Getter[Lifecycle]
 	podLifecycleGetter  resources.Getter[Lifecycle]
 
-	stageGetter resources.DynamicGetter[[]*internalversion.Stage]
+	localLifecycles resources.MutableGetter[map[internalversion.StageResourceRef]Lifecycle]
+
+	stageGetter         resources.DynamicGetter[[]*internalversion.Stage]
+	resolvedStageGetter resources.Getter[[]*internalversion.Stage]
+
+	stageStatus       *StageStatusController
+	stagePatchMeta    *patch.PatchMetaFromOpenAPI3
+	onStagePlayedFunc func(stageName string, err error)
+	stageHistory      *StageHistory
+
+	funcMap         gotpl.FuncMap
+	lifecycleStages *lifecycleStageCache
+	related         *relatedObjectGetter
 
 	podOnNodeManageQueue queue.Queue[string]
 	nodeManageQueue      queue.Queue[string]
@@ -140,6 +157,8 @@ type Controller struct {
 
 // Config is the configuration for the controller
 type Config struct {
+	// Clock is the clock of the simulated lifecycle, such as the delays of the stages,
+	// the housekeeping, such as the status of the stages, always follows the real clock.
 	Clock                                 clock.Clock
 	EnableCNI                             bool
 	DynamicClient                         dynamic.Interface
@@ -158,7 +177,10 @@ type Config struct {
 	NodeName                              string
 	NodePort                              int
 	StageWithRefs                         []internalversion.StageResourceRef
+	StageRefOptions                       map[internalversion.StageResourceRef]StageRefOption
 	LocalStages                           map[internalversion.StageResourceRef][]*internalversion.Stage
+	LocalStageTemplates                   []*internalversion.StageTemplate
+	EnableCRDs                            []string
 	PodPlayStageParallelism               uint
 	NodePlayStageParallelism              uint
 	NodeLeaseDurationSeconds              uint
@@ -166,6 +188,19 @@ type Config struct {
 	ID                                    string
 	EnableMetrics                         bool
 	EnablePodCache                        bool
+	RandomSeed                            int64
+	EnableStageHistoryAnnotation          bool
+	EnablePodAdmission                    bool
+	EnableNodePressureEviction            bool
+	EnableProbeSimulation                 bool
+}
+
+// StageRefOption holds the options of the stage controller of a resource ref.
+type StageRefOption struct {
+	PlayStageParallelism uint
+	LabelSelector        string
+	FieldSelector        string
+	Namespaces           []string
 }
 
 func (c Config) validate() error {
@@ -195,8 +230,25 @@ func NewController(conf Config) (*Controller, error) {
 		return nil, err
 	}
 
+	if conf.Clock == nil {
+		conf.Clock = clock.RealClock{}
+	}
+
+	related := &relatedObjectGetter{
+		clock:         clock.RealClock{},
+		dynamicClient: conf.DynamicClient,
+		restMapper:    conf.RESTMapper,
+	}
 	c := &Controller{
 		conf: conf,
+		funcMap: maps.Merge(defaultFuncMap, related.funcMap(), gotpl.FuncMap{
+			"Now": func() string {
+				return conf.Clock.Now().Format(time.RFC3339Nano)
+			},
+		}),
+		lifecycleStages: newLifecycleStageCache(newCELEnvironment(conf.Clock)),
+		related:         related,
+		stageHistory:    newStageHistory(clock.RealClock{}, stageHistoryTTL),
 	}
 
 	return c, nil
@@ -253,6 +305,9 @@ func (c *Controller) init(ctx context.Context) (err error) {
 		return fmt.Errorf("failed to watch pods: %w", err)
 	}
 
+	c.related.nodeCacheGetter = c.nodeCacheGetter
+	c.related.podCacheGetter = c.podCacheGetter
+
 	if c.conf.NodeLeaseDurationSeconds != 0 {
 		c.nodeLeasesChan = make(chan informer.Event[*coordinationv1.Lease], 1)
 		nodeLeasesCli := c.conf.TypedClient.CoordinationV1().Leases(corev1.NamespaceNodeLease)
@@ -367,18 +422,13 @@ var nodeRef = internalversion.StageResourceRef{APIGroup: "v1", Kind: "Node"}
 
 func (c *Controller) initLifecycle(ctx context.Context) error {
 	if len(c.conf.LocalStages) != 0 {
-		lifecycle, err := NewLifecycle(c.conf.LocalStages[podRef])
+		lifecycles, err := c.newLocalLifecycles(c.conf.LocalStages)
 		if err != nil {
-			return fmt.Errorf("failed to create pod lifecycle: %w", err)
-		}
-		c.podLifecycleGetter = resources.NewStaticGetter(lifecycle)
-
-		lifecycle, err = NewLifecycle(c.conf.LocalStages[nodeRef])
-		if err != nil {
-			return fmt.Errorf("failed to create node lifecycle: %w", err)
+			return err
 		}
-		c.nodeLifecycleGetter = resources.NewStaticGetter(lifecycle)
-
+		c.localLifecycles = resources.NewMutableGetter(lifecycles)
+		c.podLifecycleGetter = c.localLifecycleGetter(podRef)
+		c.nodeLifecycleGetter = c.localLifecycleGetter(nodeRef)
 		return nil
 	}
 
@@ -402,13 +452,49 @@ func (c *Controller) initLifecycle(ctx context.Context) error {
 		},
 	)
 
-	c.nodeLifecycleGetter = resources.NewFilter[Lifecycle, []*internalversion.Stage](c.stageGetter, func(stages []*internalversion.Stage) Lifecycle {
+	var stageTemplateGetter resources.Getter[[]*internalversion.StageTemplate]
+	if slices.Contains(c.conf.EnableCRDs, v1alpha1.StageTemplateKind) {
+		dynamicStageTemplateGetter := resources.NewDynamicGetter[
+			[]*internalversion.StageTemplate,
+			*v1alpha1.StageTemplate,
+			*v1alpha1.StageTemplateList,
+		](
+			c.conf.TypedKwokClient.KwokV1alpha1().StageTemplates(),
+			func(objs []*v1alpha1.StageTemplate) []*internalversion.StageTemplate {
+				return slices.FilterAndMap(objs, func(obj *v1alpha1.StageTemplate) (*internalversion.StageTemplate, bool) {
+					r, err := internalversion.ConvertToInternalStageTemplate(obj)
+					if err != nil {
+						logger.Error("failed to convert to internal stage template", err, "obj", obj)
+						return nil, false
+					}
+					return r, true
+				})
+			},
+		)
+		err := dynamicStageTemplateGetter.Start(ctx)
+		if err != nil {
+			return err
+		}
+		stageTemplateGetter = dynamicStageTemplateGetter
+	} else {
+		stageTemplateGetter = resources.NewStaticGetter(c.conf.LocalStageTemplates)
+	}
+
+	c.resolvedStageGetter = resources.NewJoin(c.stageGetter, stageTemplateGetter, func(stages []*internalversion.Stage, templates []*internalversion.StageTemplate) []*internalversion.Stage {
+		resolved, err := internalversion.ResolveStages(stages, templates)
+		if err != nil {
+			logger.Error("failed to resolve stages", err)
+		}
+		return resolved
+	})
+
+	c.nodeLifecycleGetter = resources.NewFilter[Lifecycle, []*internalversion.Stage](c.resolvedStageGetter, func(stages []*internalversion.Stage) Lifecycle {
 		lifecycle := slices.FilterAndMap(stages, func(stage *internalversion.Stage) (*LifecycleStage, bool) {
 			if stage.Spec.ResourceRef.Kind != "Node" {
 				return nil, false
 			}
 
-			lifecycleStage, err := NewLifecycleStage(stage)
+			lifecycleStage, err := c.lifecycleStages.stage(stage)
 			if err != nil {
 				logger.Error("failed to create node lifecycle stage", err, "stage", stage)
 				return nil, false
@@ -418,13 +504,13 @@ func (c *Controller) initLifecycle(ctx context.Context) error {
 		return lifecycle
 	})
 
-	c.podLifecycleGetter = resources.NewFilter[Lifecycle, []*internalversion.Stage](c.stageGetter, func(stages []*internalversion.Stage) Lifecycle {
+	c.podLifecycleGetter = resources.NewFilter[Lifecycle, []*internalversion.Stage](c.resolvedStageGetter, func(stages []*internalversion.Stage) Lifecycle {
 		lifecycle := slices.FilterAndMap(stages, func(stage *internalversion.Stage) (*LifecycleStage, bool) {
 			if stage.Spec.ResourceRef.Kind != "Pod" {
 				return nil, false
 			}
 
-			lifecycleStage, err := NewLifecycleStage(stage)
+			lifecycleStage, err := c.lifecycleStages.stage(stage)
 			if err != nil {
 				logger.Error("failed to create node lifecycle stage", err, "stage", stage)
 				return nil, false
@@ -439,6 +525,22 @@ func (c *Controller) initLifecycle(ctx context.Context) error {
 		return err
 	}
 
+	c.stageStatus, err = NewStageStatusController(StageStatusControllerConfig{
+		Clock:               clock.RealClock{},
+		TypedKwokClient:     c.conf.TypedKwokClient,
+		StageGetter:         c.stageGetter,
+		StageTemplateGetter: stageTemplateGetter,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stage status controller: %w", err)
+	}
+	c.onStagePlayedFunc = c.stageStatus.Record
+
+	err = c.stageStatus.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start stage status controller: %w", err)
+	}
+
 	return nil
 }
 
@@ -446,7 +548,10 @@ func (c *Controller) initNodeController(ctx context.Context) (err error) {
 	c.nodes, err = NewNodeController(NodeControllerConfig{
 		Clock:                                 c.conf.Clock,
 		TypedClient:                           c.conf.TypedClient,
+		DynamicClient:                         c.conf.DynamicClient,
+		RESTMapper:                            c.conf.RESTMapper,
 		NodeCacheGetter:                       c.nodeCacheGetter,
+		PodCacheGetter:                        c.podCacheGetter,
 		NodeIP:                                c.conf.NodeIP,
 		NodeName:                              c.conf.NodeName,
 		NodePort:                              c.conf.NodePort,
@@ -455,12 +560,18 @@ func (c *Controller) initNodeController(ctx context.Context) (err error) {
 		OnNodeManagedFunc: func(nodeName string) {
 			c.onNodeManagedFunc(nodeName)
 		},
-		Lifecycle:            c.nodeLifecycleGetter,
-		PlayStageParallelism: c.conf.NodePlayStageParallelism,
-		FuncMap:              defaultFuncMap,
-		Recorder:             c.recorder,
-		ReadOnlyFunc:         c.readOnlyFunc,
-		EnableMetrics:        c.conf.EnableMetrics,
+		Lifecycle:                    c.nodeLifecycleGetter,
+		PlayStageParallelism:         c.conf.NodePlayStageParallelism,
+		FuncMap:                      c.funcMap,
+		Recorder:                     c.recorder,
+		EventRecorderFor:             c.eventRecorderFor,
+		ReadOnlyFunc:                 c.readOnlyFunc,
+		EnableMetrics:                c.conf.EnableMetrics,
+		OnStagePlayedFunc:            c.onStagePlayedFunc,
+		RandomSeed:                   c.conf.RandomSeed,
+		StageHistory:                 c.stageHistory,
+		EnableStageHistoryAnnotation: c.conf.EnableStageHistoryAnnotation,
+		EnableNodePressureEviction:   c.conf.EnableNodePressureEviction,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create nodes controller: %w", err)
@@ -477,6 +588,8 @@ func (c *Controller) initPodController(ctx context.Context) (err error) {
 		Clock:                                 c.conf.Clock,
 		EnableCNI:                             c.conf.EnableCNI,
 		TypedClient:                           c.conf.TypedClient,
+		DynamicClient:                         c.conf.DynamicClient,
+		RESTMapper:                            c.conf.RESTMapper,
 		NodeCacheGetter:                       c.nodeCacheGetter,
 		NodeIP:                                c.conf.NodeIP,
 		CIDR:                                  c.conf.CIDR,
@@ -485,10 +598,17 @@ func (c *Controller) initPodController(ctx context.Context) (err error) {
 		Lifecycle:                             c.podLifecycleGetter,
 		PlayStageParallelism:                  c.conf.PodPlayStageParallelism,
 		NodeGetFunc:                           c.nodes.Get,
-		FuncMap:                               defaultFuncMap,
+		FuncMap:                               c.funcMap,
 		Recorder:                              c.recorder,
+		EventRecorderFor:                      c.eventRecorderFor,
 		ReadOnlyFunc:                          c.readOnlyFunc,
 		EnableMetrics:                         c.conf.EnableMetrics,
+		OnStagePlayedFunc:                     c.onStagePlayedFunc,
+		RandomSeed:                            c.conf.RandomSeed,
+		StageHistory:                          c.stageHistory,
+		EnableStageHistoryAnnotation:          c.conf.EnableStageHistoryAnnotation,
+		EnablePodAdmission:                    c.conf.EnablePodAdmission,
+		EnableProbeSimulation:                 c.conf.EnableProbeSimulation,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create pods controller: %w", err)
@@ -503,103 +623,297 @@ func (c *Controller) initPodController(ctx context.Context) (err error) {
 }
 
 func (c *Controller) initStageController(ctx context.Context) error {
-	logger := log.FromContext(ctx)
+	c.stagePatchMeta = patch.NewPatchMetaFromOpenAPI3(c.conf.RESTClient)
+
+	if len(c.conf.LocalStages) == 0 {
+		go c.stageControllerSyncWorker(ctx)
+		return nil
+	}
 
 	stageWithRefs := slices.Filter(c.conf.StageWithRefs, func(ref internalversion.StageResourceRef) bool {
 		return ref != nodeRef && ref != podRef
 	})
+	for _, ref := range stageWithRefs {
+		gvr, err := c.resourceFor(ref)
+		if err != nil {
+			return err
+		}
 
-	resourcesLifecycleGetter := map[schema.GroupVersionResource]resources.Getter[Lifecycle]{}
+		err = c.startStageController(ctx, ref, gvr, c.localLifecycleGetter(ref))
+		if err != nil {
+			return err
+		}
+	}
 
-	if len(c.conf.LocalStages) == 0 {
-		for _, ref := range stageWithRefs {
-			gv, err := schema.ParseGroupVersion(ref.APIGroup)
-			if err != nil {
-				return fmt.Errorf("failed to parse group version: %w", err)
-			}
+	return nil
+}
 
-			resourceRef := ref
-			gvr, err := c.conf.RESTMapper.ResourceFor(gv.WithResource(ref.Kind))
-			if err != nil {
-				return fmt.Errorf("failed to get gvk for gvr: %w", err)
-			}
+// newLocalLifecycles creates the lifecycles of the resource refs served with the local stages.
+func (c *Controller) newLocalLifecycles(stages map[internalversion.StageResourceRef][]*internalversion.Stage) (map[internalversion.StageResourceRef]Lifecycle, error) {
+	lifecycles := map[internalversion.StageResourceRef]Lifecycle{}
 
-			resourcesLifecycleGetter[gvr] = resources.NewFilter[Lifecycle, []*internalversion.Stage](c.stageGetter, func(stages []*internalversion.Stage) Lifecycle {
-				lifecycle := slices.FilterAndMap(stages, func(stage *internalversion.Stage) (*LifecycleStage, bool) {
-					if stage.Spec.ResourceRef != resourceRef {
-						return nil, false
-					}
+	lifecycle, err := c.lifecycleStages.lifecycle(stages[podRef])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pod lifecycle: %w", err)
+	}
+	lifecycles[podRef] = lifecycle
 
-					lifecycleStage, err := NewLifecycleStage(stage)
-					if err != nil {
-						logger.Error("failed to create node lifecycle stage", err, "stage", stage)
-						return nil, false
-					}
-					return lifecycleStage, true
-				})
-				return lifecycle
-			})
+	lifecycle, err = c.lifecycleStages.lifecycle(stages[nodeRef])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create node lifecycle: %w", err)
+	}
+	lifecycles[nodeRef] = lifecycle
+
+	for _, ref := range c.conf.StageWithRefs {
+		if ref == nodeRef || ref == podRef {
+			continue
 		}
-	} else {
-		for _, ref := range stageWithRefs {
-			stages := c.conf.LocalStages[ref]
-			gv, err := schema.ParseGroupVersion(ref.APIGroup)
-			if err != nil {
-				return fmt.Errorf("failed to parse group version: %w", err)
-			}
+		lifecycle, err = c.lifecycleStages.lifecycle(stages[ref])
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s lifecycle: %w", ref.Kind, err)
+		}
+		lifecycles[ref] = lifecycle
+	}
+	return lifecycles, nil
+}
 
-			gvr, err := c.conf.RESTMapper.ResourceFor(gv.WithResource(ref.Kind))
-			if err != nil {
-				return fmt.Errorf("failed to get gvk for gvr: %w", err)
-			}
+// localLifecycleGetter returns the getter of the lifecycle of the resource ref served with the local stages.
+func (c *Controller) localLifecycleGetter(ref internalversion.StageResourceRef) resources.Getter[Lifecycle] {
+	return resources.NewFilter[Lifecycle, map[internalversion.StageResourceRef]Lifecycle](c.localLifecycles, func(lifecycles map[internalversion.StageResourceRef]Lifecycle) Lifecycle {
+		return lifecycles[ref]
+	})
+}
 
-			lifecycle, err := NewLifecycle(stages)
-			if err != nil {
-				return fmt.Errorf("failed to create node lifecycle: %w", err)
-			}
-			resourcesLifecycleGetter[gvr] = resources.NewStaticGetter(lifecycle)
+// ReloadLocalStages replaces the local stages of all resource refs at once,
+// the previous stages are kept if any of the new ones fails to be created.
+// The stage controllers are not started or stopped by the reload,
+// so the stages of a resource ref without a stage controller are ignored until kwok is restarted with it enabled.
+func (c *Controller) ReloadLocalStages(ctx context.Context, stages map[internalversion.StageResourceRef][]*internalversion.Stage) error {
+	if c.localLifecycles == nil {
+		return fmt.Errorf("local stages are not enabled")
+	}
+	logger := log.FromContext(ctx)
+	for ref := range stages {
+		if ref == nodeRef || ref == podRef || slices.Contains(c.conf.StageWithRefs, ref) {
+			continue
+		}
+		logger.Warn("Ignore the reloaded stages of the resource without a stage controller, restart kwok with the resource enabled by enableStageForRefs or stageForRefs",
+			"apiGroup", ref.APIGroup,
+			"kind", ref.Kind,
+		)
+	}
+	lifecycles, err := c.newLocalLifecycles(stages)
+	if err != nil {
+		return err
+	}
+	c.localLifecycles.Set(lifecycles)
+	return nil
+}
+
+// stageControllerSyncWorker starts the stage controller when the first stage of a resource ref appears,
+// and stops it when the last one is deleted.
+func (c *Controller) stageControllerSyncWorker(ctx context.Context) {
+	var syncCh <-chan struct{}
+	if synced, ok := c.stageGetter.(resources.Synced); ok {
+		syncCh = synced.Sync()
+	}
+
+	logger := log.FromContext(ctx)
+	running := map[internalversion.StageResourceRef]context.CancelFunc{}
+	for {
+		c.syncStageControllers(ctx, running)
+
+		select {
+		case <-ctx.Done():
+			logger.Debug("Stop stage controller sync worker")
+			return
+		case <-syncCh:
+		// Retry the refs that are not served yet, such as the CRDs installed later.
+		case <-time.After(10 * time.Second):
 		}
 	}
+}
 
-	patchMeta := patch.NewPatchMetaFromOpenAPI3(c.conf.RESTClient)
-	for gvr, lifecycle := range resourcesLifecycleGetter {
-		logger.Info("watching stages", "gvr", gvr)
-		stageInformer := informer.NewInformer[*unstructured.Unstructured, *unstructured.UnstructuredList](c.conf.DynamicClient.Resource(gvr))
-		stageChan := make(chan informer.Event[*unstructured.Unstructured], 1)
-		err := stageInformer.Watch(ctx, informer.Option{}, stageChan)
-		if err != nil {
-			return fmt.Errorf("failed to watch stages: %w", err)
+func (c *Controller) syncStageControllers(ctx context.Context, running map[internalversion.StageResourceRef]context.CancelFunc) {
+	logger := log.FromContext(ctx)
+
+	refs := map[internalversion.StageResourceRef]struct{}{}
+	for _, stage := range c.resolvedStageGetter.Get() {
+		ref := stage.Spec.ResourceRef
+		if ref == nodeRef || ref == podRef {
+			continue
+		}
+		refs[ref] = struct{}{}
+	}
+
+	for ref, cancel := range running {
+		if _, ok := refs[ref]; ok {
+			continue
+		}
+		logger.Info("Stop stage controller",
+			"apiGroup", ref.APIGroup,
+			"kind", ref.Kind,
+		)
+		cancel()
+		delete(running, ref)
+	}
+
+	for ref := range refs {
+		if _, ok := running[ref]; ok {
+			continue
 		}
 
-		schema, err := patchMeta.Lookup(gvr)
+		gvr, err := c.resourceFor(ref)
 		if err != nil {
-			return err
+			logger.Warn("Failed to get resource of stage, will retry later",
+				"apiGroup", ref.APIGroup,
+				"kind", ref.Kind,
+				"err", err,
+			)
+			continue
 		}
-		stage, err := NewStageController(StageControllerConfig{
-			Clock:                                 c.conf.Clock,
-			DynamicClient:                         c.conf.DynamicClient,
-			Schema:                                schema,
-			GVR:                                   gvr,
-			DisregardStatusWithAnnotationSelector: c.conf.DisregardStatusWithAnnotationSelector,
-			DisregardStatusWithLabelSelector:      c.conf.DisregardStatusWithLabelSelector,
-			Lifecycle:                             lifecycle,
-			PlayStageParallelism:                  1,
-			FuncMap:                               defaultFuncMap,
-			Recorder:                              c.recorder,
+
+		resourceRef := ref
+		lifecycle := resources.NewFilter[Lifecycle, []*internalversion.Stage](c.resolvedStageGetter, func(stages []*internalversion.Stage) Lifecycle {
+			lifecycle := slices.FilterAndMap(stages, func(stage *internalversion.Stage) (*LifecycleStage, bool) {
+				if stage.Spec.ResourceRef != resourceRef {
+					return nil, false
+				}
+
+				lifecycleStage, err := c.lifecycleStages.stage(stage)
+				if err != nil {
+					logger.Error("failed to create node lifecycle stage", err, "stage", stage)
+					return nil, false
+				}
+				return lifecycleStage, true
+			})
+			return lifecycle
 		})
+
+		stageCtx, cancel := context.WithCancel(ctx)
+		err = c.startStageController(stageCtx, ref, gvr, lifecycle)
 		if err != nil {
-			return fmt.Errorf("failed to create stage controller: %w", err)
+			cancel()
+			logger.Warn("Failed to start stage controller, will retry later",
+				"gvr", gvr,
+				"err", err,
+			)
+			continue
 		}
+		running[ref] = cancel
+	}
+}
+
+func (c *Controller) resourceFor(ref internalversion.StageResourceRef) (schema.GroupVersionResource, error) {
+	gv, err := schema.ParseGroupVersion(ref.APIGroup)
+	if err != nil {
+		return schema.GroupVersionResource{}, fmt.Errorf("failed to parse group version: %w", err)
+	}
+
+	gvr, err := c.conf.RESTMapper.ResourceFor(gv.WithResource(ref.Kind))
+	if err != nil {
+		return schema.GroupVersionResource{}, fmt.Errorf("failed to get gvk for gvr: %w", err)
+	}
+	return gvr, nil
+}
+
+func (c *Controller) startStageController(ctx context.Context, ref internalversion.StageResourceRef, gvr schema.GroupVersionResource, lifecycle resources.Getter[Lifecycle]) error {
+	schema, err := c.stagePatchMeta.Lookup(gvr)
+	if err != nil {
+		return err
+	}
+
+	opt := c.stageRefOption(ref)
+	stageChan := make(chan informer.Event[*unstructured.Unstructured], 1)
+	err = c.watchStageResources(ctx, gvr, opt, stageChan)
+	if err != nil {
+		return err
+	}
+
+	stage, err := NewStageController(StageControllerConfig{
+		Clock:                                 c.conf.Clock,
+		DynamicClient:                         c.conf.DynamicClient,
+		RESTMapper:                            c.conf.RESTMapper,
+		Schema:                                schema,
+		GVR:                                   gvr,
+		DisregardStatusWithAnnotationSelector: c.conf.DisregardStatusWithAnnotationSelector,
+		DisregardStatusWithLabelSelector:      c.conf.DisregardStatusWithLabelSelector,
+		Lifecycle:                             lifecycle,
+		PlayStageParallelism:                  opt.PlayStageParallelism,
+		FuncMap:                               c.funcMap,
+		Recorder:                              c.recorder,
+		EventRecorderFor:                      c.eventRecorderFor,
+		OnStagePlayedFunc:                     c.onStagePlayedFunc,
+		RandomSeed:                            c.conf.RandomSeed,
+		StageHistory:                          c.stageHistory,
+		EnableStageHistoryAnnotation:          c.conf.EnableStageHistoryAnnotation,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stage controller: %w", err)
+	}
+
+	err = stage.Start(ctx, stageChan)
+	if err != nil {
+		return fmt.Errorf("failed to start stage controller: %w", err)
+	}
+	return nil
+}
+
+// stageRefOption returns the options of the stage controller of the ref, the stages are played one by one by default
+func (c *Controller) stageRefOption(ref internalversion.StageResourceRef) StageRefOption {
+	opt := c.conf.StageRefOptions[ref]
+	if opt.PlayStageParallelism == 0 {
+		opt.PlayStageParallelism = 1
+	}
+	return opt
+}
+
+// watchStageResources watches the resources of the stage controller with the selectors, in each of the namespaces if any
+func (c *Controller) watchStageResources(ctx context.Context, gvr schema.GroupVersionResource, opt StageRefOption, events chan<- informer.Event[*unstructured.Unstructured]) error {
+	logger := log.FromContext(ctx)
 
-		err = stage.Start(ctx, stageChan)
+	stageOpt := informer.Option{
+		LabelSelector: opt.LabelSelector,
+		FieldSelector: opt.FieldSelector,
+	}
+	if len(opt.Namespaces) == 0 {
+		logger.Info("watching stages", "gvr", gvr)
+		stageInformer := informer.NewInformer[*unstructured.Unstructured, *unstructured.UnstructuredList](c.conf.DynamicClient.Resource(gvr))
+		err := stageInformer.Watch(ctx, stageOpt, events)
+		if err != nil {
+			return fmt.Errorf("failed to watch stages: %w", err)
+		}
+		return nil
+	}
+	for _, ns := range opt.Namespaces {
+		logger.Info("watching stages", "gvr", gvr, "namespace", ns)
+		stageInformer := informer.NewInformer[*unstructured.Unstructured, *unstructured.UnstructuredList](c.conf.DynamicClient.Resource(gvr).Namespace(ns))
+		err := stageInformer.Watch(ctx, stageOpt, events)
 		if err != nil {
-			return fmt.Errorf("failed to start stage controller: %w", err)
+			return fmt.Errorf("failed to watch stages in namespace %q: %w", ns, err)
 		}
 	}
-
 	return nil
 }
 
+// eventRecorderFor returns the recorder of the stage events with the correlator
+func (c *Controller) eventRecorderFor(correlator internalversion.StageEventCorrelator) record.EventRecorder {
+	recorder, ok := c.correlatedRecorders.Load(correlator)
+	if ok {
+		return recorder
+	}
+
+	broadcaster := record.NewBroadcasterWithCorrelatorOptions(correlatorOptions(correlator))
+	recorder = broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "kwok_controller"})
+	recorder, loaded := c.correlatedRecorders.LoadOrStore(correlator, recorder)
+	if loaded {
+		broadcaster.Shutdown()
+		return recorder
+	}
+	broadcaster.StartRecordingToSink(&clientcorev1.EventSinkImpl{Interface: c.conf.TypedClient.CoreV1().Events("")})
+	return recorder
+}
+
 // Start starts the controller
 func (c *Controller) Start(ctx context.Context) error {
 	err := c.init(ctx)
@@ -679,6 +993,11 @@ func (c *Controller) StartedContainersTotal(nodeName string) int64 {
 	return nodeInfo.StartedContainer.Load()
 }
 
+// StageTransitions returns the recent stage transitions of the resource
+func (c *Controller) StageTransitions(kind, namespace, name string) ([]StageTransition, bool) {
+	return c.stageHistory.Get(kind, namespace, name)
+}
+
 // Identity returns a unique identifier for this controller
 func Identity() (string, error) {
 	hostname, err := os.Hostname()
@@ -20,19 +20,26 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"reflect"
+	"sort"
 	"testing"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
 
 	nodefast "sigs.k8s.io/kwok/kustomize/stage/node/fast"
 	podfast "sigs.k8s.io/kwok/kustomize/stage/pod/fast"
 	"sigs.k8s.io/kwok/pkg/apis/internalversion"
 	"sigs.k8s.io/kwok/pkg/config"
 	"sigs.k8s.io/kwok/pkg/log"
+	"sigs.k8s.io/kwok/pkg/utils/informer"
 	"sigs.k8s.io/kwok/pkg/utils/slices"
 	"sigs.k8s.io/kwok/pkg/utils/wait"
 )
@@ -193,3 +200,140 @@ func TestController(t *testing.T) {
 		})
 	}
 }
+
+func TestControllerStageRefOptions(t *testing.T) {
+	jobRef := internalversion.StageResourceRef{APIGroup: "batch/v1", Kind: "Job"}
+	cronJobRef := internalversion.StageResourceRef{APIGroup: "batch/v1", Kind: "CronJob"}
+	gvr := schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}
+
+	newJob := func(namespace, name string, labels map[string]string) runtime.Object {
+		job := &unstructured.Unstructured{}
+		job.SetAPIVersion("batch/v1")
+		job.SetKind("Job")
+		job.SetNamespace(namespace)
+		job.SetName(name)
+		job.SetLabels(labels)
+		return job
+	}
+	simulated := map[string]string{"app": "simulated"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			gvr: "JobList",
+		},
+		newJob("team-a", "job-0", simulated),
+		newJob("team-a", "job-1", nil),
+		newJob("team-b", "job-2", simulated),
+		newJob("team-c", "job-3", simulated),
+	)
+
+	c := &Controller{
+		conf: Config{
+			DynamicClient: dynamicClient,
+			StageRefOptions: map[internalversion.StageResourceRef]StageRefOption{
+				jobRef: {
+					PlayStageParallelism: 8,
+					LabelSelector:        "app=simulated",
+					FieldSelector:        "metadata.name!=ignored",
+					Namespaces:           []string{"team-a", "team-b"},
+				},
+			},
+		},
+	}
+
+	if got := c.stageRefOption(jobRef).PlayStageParallelism; got != 8 {
+		t.Errorf("want parallelism 8 of %v, got %d", jobRef, got)
+	}
+	if got := c.stageRefOption(cronJobRef).PlayStageParallelism; got != 1 {
+		t.Errorf("want default parallelism 1 of %v, got %d", cronJobRef, got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events := make(chan informer.Event[*unstructured.Unstructured], 10)
+	err := c.watchStageResources(ctx, gvr, c.stageRefOption(jobRef), events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for len(got) != 2 {
+		select {
+		case event := <-events:
+			got = append(got, log.KObj(event.Object).String())
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timeout waiting for the events, got %v", got)
+		}
+	}
+	sort.Strings(got)
+	if want := []string{"team-a/job-0", "team-b/job-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want watched %v, got %v", want, got)
+	}
+
+	var namespaces []string
+	for _, action := range dynamicClient.Actions() {
+		list, ok := action.(clienttesting.ListAction)
+		if !ok {
+			continue
+		}
+		namespaces = append(namespaces, list.GetNamespace())
+		restrictions := list.GetListRestrictions()
+		if restrictions.Labels.String() != "app=simulated" || restrictions.Fields.String() != "metadata.name!=ignored" {
+			t.Errorf("want list with the selectors, got labels %q and fields %q", restrictions.Labels, restrictions.Fields)
+		}
+	}
+	sort.Strings(namespaces)
+	if want := []string{"team-a", "team-b"}; !reflect.DeepEqual(namespaces, want) {
+		t.Errorf("want list in namespaces %v, got %v", want, namespaces)
+	}
+}
+
+func TestControllerReloadLocalStages(t *testing.T) {
+	jobRef := internalversion.StageResourceRef{APIGroup: "batch/v1", Kind: "Job"}
+	cronJobRef := internalversion.StageResourceRef{APIGroup: "batch/v1", Kind: "CronJob"}
+	newStage := func(name string, ref internalversion.StageResourceRef) *internalversion.Stage {
+		return &internalversion.Stage{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Spec: internalversion.StageSpec{
+				ResourceRef: ref,
+				Selector:    &internalversion.StageSelector{},
+			},
+		}
+	}
+
+	c := &Controller{
+		conf: Config{
+			StageWithRefs: []internalversion.StageResourceRef{jobRef},
+			LocalStages: map[internalversion.StageResourceRef][]*internalversion.Stage{
+				jobRef: {newStage("job-0", jobRef)},
+			},
+		},
+		lifecycleStages: newLifecycleStageCache(realCELEnvironment),
+	}
+	ctx := context.Background()
+	err := c.initLifecycle(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobLifecycle := c.localLifecycleGetter(jobRef)
+
+	err = c.ReloadLocalStages(ctx, map[internalversion.StageResourceRef][]*internalversion.Stage{
+		jobRef:     {newStage("job-1", jobRef)},
+		cronJobRef: {newStage("cronjob-0", cronJobRef)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := slices.Map(jobLifecycle.Get(), func(stage *LifecycleStage) string {
+		return stage.Name()
+	})
+	if want := []string{"job-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want reloaded job stages %v, got %v", want, got)
+	}
+	if _, ok := c.localLifecycles.Get()[cronJobRef]; ok {
+		t.Errorf("want the stages of %v without a stage controller ignored", cronJobRef)
+	}
+}
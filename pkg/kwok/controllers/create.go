@@ -0,0 +1,178 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/log"
+	"sigs.k8s.io/kwok/pkg/utils/gotpl"
+)
+
+// idempotencyKeyAnnotation is the annotation of the idempotency key on the created resources
+const idempotencyKeyAnnotation = "kwok.x-k8s.io/idempotency-key"
+
+// stageResourceCreator creates the resources in the next of the stages through the dynamic client
+type stageResourceCreator struct {
+	dynamicClient dynamic.Interface
+	restMapper    meta.RESTMapper
+	renderer      gotpl.Renderer
+}
+
+// newStageResourceCreator returns a new stageResourceCreator, it returns nil if the dynamic client is not set
+func newStageResourceCreator(dynamicClient dynamic.Interface, restMapper meta.RESTMapper, renderer gotpl.Renderer) *stageResourceCreator {
+	if dynamicClient == nil || restMapper == nil {
+		return nil
+	}
+	return &stageResourceCreator{
+		dynamicClient: dynamicClient,
+		restMapper:    restMapper,
+		renderer:      renderer,
+	}
+}
+
+// Create renders and creates the resources in order, the owner is the resource which the stage is played on,
+// the resources which already exist are skipped.
+func (c *stageResourceCreator) Create(ctx context.Context, owner metav1.OwnerReference, namespace string, data stageTemplateData, creates []internalversion.StageCreate) error {
+	if c == nil {
+		return fmt.Errorf("creating resources requires the dynamic client")
+	}
+	logger := log.FromContext(ctx)
+
+	for i := range creates {
+		obj, mapping, err := renderStageCreate(c.renderer, c.restMapper, owner, namespace, data, &creates[i])
+		if err != nil {
+			return fmt.Errorf("create %d: %w", i, err)
+		}
+
+		gvk := obj.GroupVersionKind()
+		var ri dynamic.ResourceInterface
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			ri = c.dynamicClient.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+		} else {
+			ri = c.dynamicClient.Resource(mapping.Resource)
+		}
+
+		created, err := ri.Create(ctx, obj, metav1.CreateOptions{})
+		if err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				logger.Debug("Skip create resource",
+					"reason", "already exists",
+					"resource", log.KObj(obj),
+					"kind", gvk.Kind,
+				)
+				continue
+			}
+			return fmt.Errorf("create %d: %w", i, err)
+		}
+		logger.Info("Create resource",
+			"resource", log.KObj(created),
+			"kind", gvk.Kind,
+		)
+	}
+	return nil
+}
+
+// renderStageCreate renders the manifest of the resource to create, the namespace is the namespace of the owner.
+// The scope of the resource is looked up by the restMapper, which is skipped if it is nil.
+func renderStageCreate(renderer gotpl.Renderer, restMapper meta.RESTMapper, owner metav1.OwnerReference, namespace string, data stageTemplateData, create *internalversion.StageCreate) (*unstructured.Unstructured, *meta.RESTMapping, error) {
+	manifest, err := renderer.ToJSON(create.Template, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	obj := &unstructured.Unstructured{}
+	err = obj.UnmarshalJSON(manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(namespace)
+	}
+
+	var mapping *meta.RESTMapping
+	if restMapper != nil {
+		gvk := obj.GroupVersionKind()
+		mapping, err = restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, nil, err
+		}
+		if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			obj.SetNamespace("")
+		}
+	}
+
+	if create.IdempotencyKey != "" {
+		key, err := renderer.ToText(create.IdempotencyKey, data)
+		if err != nil {
+			return nil, nil, err
+		}
+		key = bytes.TrimSpace(key)
+		if len(key) == 0 {
+			return nil, nil, fmt.Errorf("idempotency key is empty")
+		}
+
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[idempotencyKeyAnnotation] = string(key)
+		obj.SetAnnotations(annotations)
+
+		// The name is derived from the owner and the key, so the creation fails with AlreadyExists when it is replayed.
+		if obj.GetName() == "" {
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(owner.UID))
+			_, _ = h.Write(key)
+			prefix := obj.GetGenerateName()
+			if prefix == "" {
+				prefix = owner.Name + "-"
+			}
+			obj.SetName(prefix + strconv.FormatUint(h.Sum64(), 36))
+			obj.SetGenerateName("")
+		}
+	}
+
+	if create.OwnerReference {
+		// The garbage collector deletes the resource whose owner cannot be found,
+		// a namespaced owner can only own the resources in the same namespace.
+		if mapping != nil && namespace != "" {
+			if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+				return nil, nil, fmt.Errorf("cluster-scoped %s %s cannot be owned by the namespaced %s %s/%s",
+					obj.GetKind(), obj.GetName(), owner.Kind, namespace, owner.Name)
+			}
+			if obj.GetNamespace() != namespace {
+				return nil, nil, fmt.Errorf("%s %s/%s cannot be owned by the %s %s/%s in a different namespace",
+					obj.GetKind(), obj.GetNamespace(), obj.GetName(), owner.Kind, namespace, owner.Name)
+			}
+		}
+		obj.SetOwnerReferences(append(obj.GetOwnerReferences(), owner))
+	}
+	return obj, mapping, nil
+}
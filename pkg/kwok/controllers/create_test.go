@@ -0,0 +1,214 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/utils/gotpl"
+)
+
+func TestStageResourceCreator(t *testing.T) {
+	scheme := runtime.NewScheme()
+	err := corev1.AddToScheme(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme)
+
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(corev1.SchemeGroupVersion.WithKind("PersistentVolume"), meta.RESTScopeRoot)
+	restMapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+
+	creator := newStageResourceCreator(dynamicClient, restMapper, gotpl.NewRenderer(defaultFuncMap))
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pvc0",
+			Namespace: "default",
+			UID:       "pvc0-uid",
+		},
+	}
+	owner := metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "PersistentVolumeClaim",
+		Name:       pvc.Name,
+		UID:        pvc.UID,
+	}
+	creates := []internalversion.StageCreate{
+		{
+			Template: `
+apiVersion: v1
+kind: PersistentVolume
+metadata:
+  generateName: pv-
+spec:
+  claimRef:
+    name: {{ .metadata.name }}
+    namespace: {{ .metadata.namespace }}
+`,
+			IdempotencyKey: `{{ .metadata.uid }}`,
+		},
+		{
+			Template: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .metadata.name }}-attempt
+data:
+  attempt: {{ .Attempt | Quote }}
+`,
+			OwnerReference: true,
+		},
+	}
+
+	// Play the stage twice, the resources are not created again.
+	for i := 0; i != 2; i++ {
+		err = creator.Create(context.Background(), owner, pvc.Namespace, stageTemplateData{resource: pvc, attempt: 1}, creates)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pvs, err := dynamicClient.Resource(corev1.SchemeGroupVersion.WithResource("persistentvolumes")).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pvs.Items) != 1 {
+		t.Fatalf("want 1 pv, got %d", len(pvs.Items))
+	}
+	pv := pvs.Items[0]
+	if pv.GetNamespace() != "" {
+		t.Errorf("want cluster scoped pv, got namespace %q", pv.GetNamespace())
+	}
+	if got := pv.GetAnnotations()[idempotencyKeyAnnotation]; got != string(pvc.UID) {
+		t.Errorf("want idempotency key %q, got %q", pvc.UID, got)
+	}
+	if claim, _, _ := unstructured.NestedString(pv.Object, "spec", "claimRef", "name"); claim != pvc.Name {
+		t.Errorf("want claim %q, got %q", pvc.Name, claim)
+	}
+
+	cm, err := dynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).Namespace("default").Get(context.Background(), "pvc0-attempt", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := cm.GetOwnerReferences(); len(refs) != 1 || refs[0].UID != pvc.UID {
+		t.Errorf("want owner reference to %q, got %v", pvc.UID, refs)
+	}
+	if attempt, _, _ := unstructured.NestedString(cm.Object, "data", "attempt"); attempt != "1" {
+		t.Errorf("want attempt 1, got %q", attempt)
+	}
+}
+
+func Test_renderStageCreateOwner(t *testing.T) {
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(corev1.SchemeGroupVersion.WithKind("PersistentVolume"), meta.RESTScopeRoot)
+	restMapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	renderer := gotpl.NewRenderer(defaultFuncMap)
+
+	pv := `
+apiVersion: v1
+kind: PersistentVolume
+metadata:
+  name: pv0
+`
+	cm := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm0
+`
+	cmInOther := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm0
+  namespace: other
+`
+	tests := []struct {
+		name          string
+		owner         metav1.OwnerReference
+		namespace     string
+		template      string
+		wantNamespace string
+		wantErr       bool
+	}{
+		{
+			name:      "cluster-scoped owned by namespaced",
+			owner:     metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: "pod0", UID: "pod0-uid"},
+			namespace: "default",
+			template:  pv,
+			wantErr:   true,
+		},
+		{
+			name:      "namespaced owned by namespaced in other namespace",
+			owner:     metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: "pod0", UID: "pod0-uid"},
+			namespace: "default",
+			template:  cmInOther,
+			wantErr:   true,
+		},
+		{
+			name:          "namespaced owned by namespaced",
+			owner:         metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: "pod0", UID: "pod0-uid"},
+			namespace:     "default",
+			template:      cm,
+			wantNamespace: "default",
+		},
+		{
+			name:          "namespaced owned by cluster-scoped",
+			owner:         metav1.OwnerReference{APIVersion: "v1", Kind: "Node", Name: "node0", UID: "node0-uid"},
+			template:      cmInOther,
+			wantNamespace: "other",
+		},
+		{
+			name:     "cluster-scoped owned by cluster-scoped",
+			owner:    metav1.OwnerReference{APIVersion: "v1", Kind: "Node", Name: "node0", UID: "node0-uid"},
+			template: pv,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			create := &internalversion.StageCreate{
+				Template:       tt.template,
+				OwnerReference: true,
+			}
+			obj, _, err := renderStageCreate(renderer, restMapper, tt.owner, tt.namespace, stageTemplateData{resource: map[string]interface{}{}}, create)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderStageCreate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if obj.GetNamespace() != tt.wantNamespace {
+				t.Errorf("want namespace %q, got %q", tt.wantNamespace, obj.GetNamespace())
+			}
+			if refs := obj.GetOwnerReferences(); len(refs) != 1 || refs[0].UID != tt.owner.UID {
+				t.Errorf("want owner reference to %q, got %v", tt.owner.UID, refs)
+			}
+		})
+	}
+}
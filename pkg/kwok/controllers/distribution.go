@@ -0,0 +1,172 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/utils/format"
+)
+
+// delayDistribution samples the delay from a distribution
+type delayDistribution struct {
+	// sample returns a delay in milliseconds
+	sample func(rnd *rand.Rand) float64
+	min    *time.Duration
+	max    *time.Duration
+}
+
+func newDelayDistribution(d *internalversion.StageDelayDistribution) (*delayDistribution, error) {
+	dist := &delayDistribution{}
+	if d.MinMilliseconds != nil {
+		dist.min = format.Ptr(time.Duration(*d.MinMilliseconds) * time.Millisecond)
+	}
+	if d.MaxMilliseconds != nil {
+		dist.max = format.Ptr(time.Duration(*d.MaxMilliseconds) * time.Millisecond)
+	}
+	if dist.min != nil && dist.max != nil && *dist.min > *dist.max {
+		return nil, fmt.Errorf("distribution minMilliseconds %d is greater than maxMilliseconds %d", *d.MinMilliseconds, *d.MaxMilliseconds)
+	}
+
+	switch d.Type {
+	case internalversion.StageDelayDistributionTypeNormal:
+		if d.MeanMilliseconds == nil || d.StdDevMilliseconds == nil {
+			return nil, fmt.Errorf("distribution %s requires meanMilliseconds and stdDevMilliseconds", d.Type)
+		}
+		mean, stdDev := float64(*d.MeanMilliseconds), float64(*d.StdDevMilliseconds)
+		dist.sample = func(rnd *rand.Rand) float64 {
+			return mean + stdDev*randNormFloat64(rnd)
+		}
+	case internalversion.StageDelayDistributionTypeLogNormal:
+		if d.MedianMilliseconds == nil || d.Sigma == nil {
+			return nil, fmt.Errorf("distribution %s requires medianMilliseconds and sigma", d.Type)
+		}
+		median, sigma := float64(*d.MedianMilliseconds), *d.Sigma
+		dist.sample = func(rnd *rand.Rand) float64 {
+			return median * math.Exp(sigma*randNormFloat64(rnd))
+		}
+	case internalversion.StageDelayDistributionTypeExponential:
+		if d.MeanMilliseconds == nil {
+			return nil, fmt.Errorf("distribution %s requires meanMilliseconds", d.Type)
+		}
+		mean := float64(*d.MeanMilliseconds)
+		dist.sample = func(rnd *rand.Rand) float64 {
+			return mean * randExpFloat64(rnd)
+		}
+	case internalversion.StageDelayDistributionTypePareto:
+		if d.ScaleMilliseconds == nil || d.Shape == nil || *d.Shape <= 0 {
+			return nil, fmt.Errorf("distribution %s requires scaleMilliseconds and a positive shape", d.Type)
+		}
+		scale, shape := float64(*d.ScaleMilliseconds), *d.Shape
+		dist.sample = func(rnd *rand.Rand) float64 {
+			// The uniform value is in (0, 1], so the sample is never infinite.
+			return scale / math.Pow(1-randFloat64(rnd), 1/shape)
+		}
+	case internalversion.StageDelayDistributionTypeEmpirical:
+		sample, err := newEmpiricalSample(d.Percentiles)
+		if err != nil {
+			return nil, err
+		}
+		dist.sample = sample
+	default:
+		return nil, fmt.Errorf("unsupported distribution type %q", d.Type)
+	}
+	return dist, nil
+}
+
+func newEmpiricalSample(percentiles []internalversion.StageDelayPercentile) (func(rnd *rand.Rand) float64, error) {
+	if len(percentiles) == 0 {
+		return nil, fmt.Errorf("distribution %s requires percentiles", internalversion.StageDelayDistributionTypeEmpirical)
+	}
+	points := make([]internalversion.StageDelayPercentile, len(percentiles))
+	copy(points, percentiles)
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Percentile < points[j].Percentile
+	})
+	for i, point := range points {
+		if point.Percentile < 0 || point.Percentile > 100 {
+			return nil, fmt.Errorf("percentile %v is out of range [0, 100]", point.Percentile)
+		}
+		if i > 0 && point.DurationMilliseconds < points[i-1].DurationMilliseconds {
+			return nil, fmt.Errorf("percentile %v has a smaller duration than percentile %v", point.Percentile, points[i-1].Percentile)
+		}
+	}
+
+	return func(rnd *rand.Rand) float64 {
+		p := randFloat64(rnd) * 100
+		i := sort.Search(len(points), func(i int) bool {
+			return points[i].Percentile > p
+		})
+		if i == 0 {
+			return float64(points[0].DurationMilliseconds)
+		}
+		if i == len(points) {
+			return float64(points[len(points)-1].DurationMilliseconds)
+		}
+		lower, upper := points[i-1], points[i]
+		ratio := (p - lower.Percentile) / (upper.Percentile - lower.Percentile)
+		return float64(lower.DurationMilliseconds) + ratio*float64(upper.DurationMilliseconds-lower.DurationMilliseconds)
+	}, nil
+}
+
+// Sample returns a delay sampled from the distribution, the global source is used if rnd is nil.
+func (d *delayDistribution) Sample(rnd *rand.Rand) time.Duration {
+	ms := d.sample(rnd)
+	if ms < 0 || math.IsNaN(ms) {
+		ms = 0
+	}
+	// Avoid overflowing the time.Duration
+	ms = math.Min(ms, float64(math.MaxInt64/int64(time.Millisecond)))
+
+	delay := time.Duration(ms * float64(time.Millisecond))
+	if d.min != nil && delay < *d.min {
+		delay = *d.min
+	}
+	if d.max != nil && delay > *d.max {
+		delay = *d.max
+	}
+	return delay
+}
+
+func randFloat64(rnd *rand.Rand) float64 {
+	if rnd == nil {
+		//nolint:gosec
+		return rand.Float64()
+	}
+	return rnd.Float64()
+}
+
+func randNormFloat64(rnd *rand.Rand) float64 {
+	if rnd == nil {
+		//nolint:gosec
+		return rand.NormFloat64()
+	}
+	return rnd.NormFloat64()
+}
+
+func randExpFloat64(rnd *rand.Rand) float64 {
+	if rnd == nil {
+		//nolint:gosec
+		return rand.ExpFloat64()
+	}
+	return rnd.ExpFloat64()
+}
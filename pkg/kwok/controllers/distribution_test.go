@@ -0,0 +1,179 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/utils/format"
+)
+
+func TestDelayDistribution(t *testing.T) {
+	tests := []struct {
+		name         string
+		distribution internalversion.StageDelayDistribution
+		wantMedian   time.Duration
+		wantMin      time.Duration
+		wantMax      time.Duration
+		wantErr      bool
+	}{
+		{
+			name: "normal",
+			distribution: internalversion.StageDelayDistribution{
+				Type:               internalversion.StageDelayDistributionTypeNormal,
+				MeanMilliseconds:   format.Ptr[int64](1000),
+				StdDevMilliseconds: format.Ptr[int64](100),
+			},
+			wantMedian: time.Second,
+		},
+		{
+			name: "normal with min",
+			distribution: internalversion.StageDelayDistribution{
+				Type:               internalversion.StageDelayDistributionTypeNormal,
+				MeanMilliseconds:   format.Ptr[int64](1000),
+				StdDevMilliseconds: format.Ptr[int64](1000),
+				MinMilliseconds:    format.Ptr[int64](500),
+			},
+			wantMedian: time.Second,
+			wantMin:    500 * time.Millisecond,
+		},
+		{
+			name: "log-normal",
+			distribution: internalversion.StageDelayDistribution{
+				Type:               internalversion.StageDelayDistributionTypeLogNormal,
+				MedianMilliseconds: format.Ptr[int64](2000),
+				Sigma:              format.Ptr(0.5),
+			},
+			wantMedian: 2 * time.Second,
+		},
+		{
+			name: "exponential with max",
+			distribution: internalversion.StageDelayDistribution{
+				Type:             internalversion.StageDelayDistributionTypeExponential,
+				MeanMilliseconds: format.Ptr[int64](1000),
+				MaxMilliseconds:  format.Ptr[int64](3000),
+			},
+			// The median of the exponential distribution is mean * ln(2)
+			wantMedian: 693 * time.Millisecond,
+			wantMax:    3 * time.Second,
+		},
+		{
+			name: "pareto",
+			distribution: internalversion.StageDelayDistribution{
+				Type:              internalversion.StageDelayDistributionTypePareto,
+				ScaleMilliseconds: format.Ptr[int64](1000),
+				Shape:             format.Ptr(1.0),
+			},
+			// The median of the Pareto distribution is scale * 2^(1/shape)
+			wantMedian: 2 * time.Second,
+			wantMin:    time.Second,
+		},
+		{
+			name: "empirical",
+			distribution: internalversion.StageDelayDistribution{
+				Type: internalversion.StageDelayDistributionTypeEmpirical,
+				Percentiles: []internalversion.StageDelayPercentile{
+					{Percentile: 100, DurationMilliseconds: 10000},
+					{Percentile: 0, DurationMilliseconds: 1000},
+					{Percentile: 50, DurationMilliseconds: 2000},
+					{Percentile: 90, DurationMilliseconds: 3000},
+				},
+			},
+			wantMedian: 2 * time.Second,
+			wantMin:    time.Second,
+			wantMax:    10 * time.Second,
+		},
+		{
+			name: "empirical without percentiles",
+			distribution: internalversion.StageDelayDistribution{
+				Type: internalversion.StageDelayDistributionTypeEmpirical,
+			},
+			wantErr: true,
+		},
+		{
+			name: "empirical with decreasing durations",
+			distribution: internalversion.StageDelayDistribution{
+				Type: internalversion.StageDelayDistributionTypeEmpirical,
+				Percentiles: []internalversion.StageDelayPercentile{
+					{Percentile: 50, DurationMilliseconds: 2000},
+					{Percentile: 90, DurationMilliseconds: 1000},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "min greater than max",
+			distribution: internalversion.StageDelayDistribution{
+				Type:             internalversion.StageDelayDistributionTypeExponential,
+				MeanMilliseconds: format.Ptr[int64](1000),
+				MinMilliseconds:  format.Ptr[int64](2000),
+				MaxMilliseconds:  format.Ptr[int64](1000),
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing parameters",
+			distribution: internalversion.StageDelayDistribution{
+				Type: internalversion.StageDelayDistributionTypeNormal,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown type",
+			distribution: internalversion.StageDelayDistribution{
+				Type: "unknown",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dist, err := newDelayDistribution(&tt.distribution)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newDelayDistribution() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			//nolint:gosec
+			rnd := rand.New(rand.NewSource(0))
+			samples := make([]time.Duration, 10000)
+			for i := range samples {
+				samples[i] = dist.Sample(rnd)
+			}
+			sort.Slice(samples, func(i, j int) bool {
+				return samples[i] < samples[j]
+			})
+
+			median := samples[len(samples)/2]
+			if diff := median - tt.wantMedian; diff < -tt.wantMedian/10 || diff > tt.wantMedian/10 {
+				t.Errorf("want median about %v, got %v", tt.wantMedian, median)
+			}
+			if samples[0] < tt.wantMin {
+				t.Errorf("want min %v, got %v", tt.wantMin, samples[0])
+			}
+			if tt.wantMax != 0 && samples[len(samples)-1] > tt.wantMax {
+				t.Errorf("want max %v, got %v", tt.wantMax, samples[len(samples)-1])
+			}
+		})
+	}
+}
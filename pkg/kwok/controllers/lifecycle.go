@@ -19,21 +19,66 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"math"
 	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
 	"time"
 
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/utils/clock"
 
 	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/kwok/metrics/cel"
+	"sigs.k8s.io/kwok/pkg/log"
 	"sigs.k8s.io/kwok/pkg/utils/expression"
 	"sigs.k8s.io/kwok/pkg/utils/format"
+	"sigs.k8s.io/kwok/pkg/utils/maps"
+	"sigs.k8s.io/kwok/pkg/utils/slices"
 )
 
-// NewLifecycle returns a new Lifecycle.
-func NewLifecycle(stages []*internalversion.Stage) (Lifecycle, error) {
+// NextStageAnnotation is the annotation to play the named stage next on the resource,
+// it takes priority over the selectors and the weights, and is removed after the stage is played.
+const NextStageAnnotation = "kwok.x-k8s.io/next-stage"
+
+// removeNextStageAnnotationPatch is the merge patch to remove the NextStageAnnotation
+var removeNextStageAnnotationPatch = []byte(`{"metadata":{"annotations":{"` + NextStageAnnotation + `":null}}}`)
+
+// unresolvedNextStageReason is the reason of the warning event when the stage named by the NextStageAnnotation can't be resolved
+const unresolvedNextStageReason = "UnresolvedNextStage"
+
+// NewLifecycle returns a new Lifecycle,
+// the Now() of the CEL expressions of the stages follows the clock, or the real clock if it is nil.
+func NewLifecycle(stages []*internalversion.Stage, clk clock.PassiveClock) (Lifecycle, error) {
+	return newLifecycleStageCache(newCELEnvironment(clk)).lifecycle(stages)
+}
+
+// lifecycleStageCache reuses the lifecycle stage of a stage whose spec is unchanged,
+// so that the state of the stage, like the event limiter and the due time of the queued jobs,
+// survives the updates which do not change the spec, like the updates of the status.
+type lifecycleStageCache struct {
+	celEnv celEnvironmentGetter
+	stages maps.SyncMap[string, cachedLifecycleStage]
+}
+
+type cachedLifecycleStage struct {
+	spec  internalversion.StageSpec
+	stage *LifecycleStage
+}
+
+func newLifecycleStageCache(celEnv celEnvironmentGetter) *lifecycleStageCache {
+	return &lifecycleStageCache{
+		celEnv: celEnv,
+	}
+}
+
+// lifecycle returns the lifecycle of the stages.
+func (c *lifecycleStageCache) lifecycle(stages []*internalversion.Stage) (Lifecycle, error) {
 	lcs := Lifecycle{}
 	for _, stage := range stages {
-		lc, err := NewLifecycleStage(stage)
+		lc, err := c.stage(stage)
 		if err != nil {
 			return nil, fmt.Errorf("lifecycle stage: %w", err)
 		}
@@ -45,64 +90,167 @@ func NewLifecycle(stages []*internalversion.Stage) (Lifecycle, error) {
 	return lcs, nil
 }
 
+// stage returns the lifecycle stage of the stage, it is created again only if the spec is changed.
+func (c *lifecycleStageCache) stage(s *internalversion.Stage) (*LifecycleStage, error) {
+	if cached, ok := c.stages.Load(s.Name); ok && reflect.DeepEqual(cached.spec, s.Spec) {
+		return cached.stage, nil
+	}
+	stage, err := newLifecycleStage(s, c.celEnv)
+	if err != nil {
+		return nil, err
+	}
+	if stage != nil {
+		c.stages.Store(s.Name, cachedLifecycleStage{
+			spec:  *s.Spec.DeepCopy(),
+			stage: stage,
+		})
+	}
+	return stage, nil
+}
+
 // Lifecycle is a list of lifecycle stage.
 type Lifecycle []*LifecycleStage
 
-func (s Lifecycle) match(label, annotation labels.Set, data interface{}) ([]*LifecycleStage, error) {
-	out := []*LifecycleStage{}
-	for _, stage := range s {
-		ok, err := stage.match(label, annotation, data)
-		if err != nil {
-			return nil, err
+// Available returns the stages which can still be played on the resource,
+// the attempts returns the number of times the stage has been played on the resource.
+func (s Lifecycle) Available(attempts func(stageName string) int64) Lifecycle {
+	for i, stage := range s {
+		if stage.maxCount == 0 || attempts(stage.name) < stage.maxCount {
+			continue
 		}
-		if ok {
-			out = append(out, stage)
+		// Copy only if there is an exhausted stage
+		out := make(Lifecycle, i, len(s)-1)
+		copy(out, s[:i])
+		for _, stage := range s[i+1:] {
+			if stage.maxCount == 0 || attempts(stage.name) < stage.maxCount {
+				out = append(out, stage)
+			}
 		}
+		return out
 	}
-	return out, nil
+	return s
 }
 
-// Match returns matched stage.
-func (s Lifecycle) Match(label, annotation labels.Set, data interface{}) (*LifecycleStage, error) {
+// UnresolvedNextStage returns the name of the stage named by the NextStageAnnotation if it is not in the lifecycle,
+// i.e. the stage doesn't exist, is not for the resource, or has been played as many times as it can be.
+func (s Lifecycle) UnresolvedNextStage(annotation labels.Set) (string, bool) {
+	name := annotation[NextStageAnnotation]
+	if name == "" {
+		return "", false
+	}
+	for _, stage := range s {
+		if stage.name == name {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// Match returns the matched stages, one for each group of the stages, ordered by the group.
+// In each group, only the matched stages with the highest priority are chosen between by the weights.
+// The stage named by the NextStageAnnotation is returned for its group if it is in the lifecycle.
+// The rnd is used to choose between the matched stages, the global source is used if it is nil.
+func (s Lifecycle) Match(ctx context.Context, label, annotation labels.Set, data interface{}, rnd *rand.Rand) ([]*LifecycleStage, error) {
+	var next *LifecycleStage
+	if name := annotation[NextStageAnnotation]; name != "" {
+		for _, stage := range s {
+			if stage.name == name {
+				next = stage
+				break
+			}
+		}
+	}
+
 	data, err := expression.ToJSONStandard(data)
 	if err != nil {
 		return nil, err
 	}
-	stages, err := s.match(label, annotation, data)
-	if err != nil {
-		return nil, err
+
+	groups := map[string][]*LifecycleStage{}
+	if next != nil {
+		groups[next.group] = []*LifecycleStage{next}
 	}
-	if len(stages) == 0 {
+	for _, stage := range s {
+		if next != nil && stage.group == next.group {
+			continue
+		}
+		candidates := groups[stage.group]
+		if len(candidates) != 0 && candidates[0].priority > stage.priority {
+			continue
+		}
+		ok, err := stage.match(ctx, label, annotation, data)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if len(candidates) != 0 && candidates[0].priority < stage.priority {
+			candidates = candidates[:0]
+		}
+		groups[stage.group] = append(candidates, stage)
+	}
+	if len(groups) == 0 {
 		return nil, nil
 	}
+
+	names := make([]string, 0, len(groups))
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+
+	out := make([]*LifecycleStage, 0, len(names))
+	for _, group := range names {
+		out = append(out, chooseStage(groups[group], rnd))
+	}
+	return out, nil
+}
+
+// chooseStage chooses one of the stages randomly based on the weights.
+func chooseStage(stages []*LifecycleStage, rnd *rand.Rand) *LifecycleStage {
 	if len(stages) == 1 {
-		return stages[0], nil
+		return stages[0]
 	}
 	totalWeights := 0
 	for _, stage := range stages {
 		totalWeights += stage.weight
 	}
 	if totalWeights == 0 {
-		//nolint:gosec
-		return stages[rand.Intn(len(stages))], nil
+		return stages[randIntn(rnd, len(stages))]
 	}
 
-	//nolint:gosec
-	off := rand.Intn(totalWeights)
+	off := randIntn(rnd, totalWeights)
 	for _, stage := range stages {
 		if stage.weight == 0 {
 			continue
 		}
 		off -= stage.weight
 		if off < 0 {
-			return stage, nil
+			return stage
 		}
 	}
-	return stages[len(stages)-1], nil
+	return stages[len(stages)-1]
 }
 
-// NewLifecycleStage returns a new LifecycleStage.
+// Groups returns the groups of the stages in the lifecycle.
+func (s Lifecycle) Groups() []string {
+	groups := []string{}
+	for _, stage := range s {
+		if !slices.Contains(groups, stage.group) {
+			groups = append(groups, stage.group)
+		}
+	}
+	return groups
+}
+
+// NewLifecycleStage returns a new LifecycleStage,
+// the Now() of the CEL expressions of the stage follows the real clock.
 func NewLifecycleStage(s *internalversion.Stage) (*LifecycleStage, error) {
+	return newLifecycleStage(s, realCELEnvironment)
+}
+
+func newLifecycleStage(s *internalversion.Stage, celEnv celEnvironmentGetter) (*LifecycleStage, error) {
 	stage := &LifecycleStage{
 		name: s.Name,
 	}
@@ -126,33 +274,79 @@ func NewLifecycleStage(s *internalversion.Stage) (*LifecycleStage, error) {
 			stage.matchExpressions = append(stage.matchExpressions, requirement)
 		}
 	}
+	if selector.MatchCEL != nil {
+		env, err := celEnv()
+		if err != nil {
+			return nil, err
+		}
+		for _, src := range selector.MatchCEL {
+			evaluator, err := env.Compile(src)
+			if err != nil {
+				return nil, err
+			}
+			stage.matchCEL = append(stage.matchCEL, evaluator)
+		}
+	}
 
 	stage.next = &s.Spec.Next
-	if delay := s.Spec.Delay; delay != nil {
-		var durationFrom *string
-		if delay.DurationFrom != nil {
-			durationFrom = &delay.DurationFrom.ExpressionFrom
+	for i := range stage.next.Patches {
+		err := validateStagePatch(s.Spec.ResourceRef, &stage.next.Patches[i])
+		if err != nil {
+			return nil, fmt.Errorf("patch %d: %w", i, err)
 		}
+	}
+	if stage.next.Webhook != nil {
+		err := validateStageWebhook(stage.next.Webhook)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if stage.next.Drain != nil && s.Spec.ResourceRef != nodeRef {
+		return nil, fmt.Errorf("drain is only valid for nodes")
+	}
+	if event := stage.next.Event; event != nil {
+		if event.SampleRate != nil {
+			if *event.SampleRate < 0 || *event.SampleRate > 1 {
+				return nil, fmt.Errorf("event sampleRate %v is not between 0 and 1", *event.SampleRate)
+			}
+			stage.eventSampleRate = event.SampleRate
+		}
+		if event.RateLimit != nil {
+			limiter, err := newStageEventLimiter(event.RateLimit)
+			if err != nil {
+				return nil, err
+			}
+			stage.eventLimiter = limiter
+		}
+	}
+
+	if delay := s.Spec.Delay; delay != nil && delay.Distribution != nil {
+		if delay.DurationMilliseconds != nil || delay.DurationFrom != nil ||
+			delay.JitterDurationMilliseconds != nil || delay.JitterDurationFrom != nil {
+			return nil, fmt.Errorf("distribution is exclusive with the other fields of delay")
+		}
+		distribution, err := newDelayDistribution(delay.Distribution)
+		if err != nil {
+			return nil, err
+		}
+		stage.distribution = distribution
+	} else if delay != nil {
 		var delayDuration time.Duration
 		if delay.DurationMilliseconds != nil {
 			delayDuration = time.Duration(*delay.DurationMilliseconds) * time.Millisecond
 		}
-		duration, err := expression.NewDurationFrom(&delayDuration, durationFrom)
+		duration, err := newDurationFrom(celEnv, &delayDuration, delay.DurationFrom)
 		if err != nil {
 			return nil, err
 		}
 		stage.duration = duration
 
 		if delay.JitterDurationMilliseconds != nil || delay.JitterDurationFrom != nil {
-			var jitterDurationFrom *string
-			if delay.JitterDurationFrom != nil {
-				jitterDurationFrom = &delay.JitterDurationFrom.ExpressionFrom
-			}
 			var jitterDuration *time.Duration
 			if delay.JitterDurationMilliseconds != nil {
 				jitterDuration = format.Ptr(time.Duration(*delay.JitterDurationMilliseconds) * time.Millisecond)
 			}
-			jitterDurationGetter, err := expression.NewDurationFrom(jitterDuration, jitterDurationFrom)
+			jitterDurationGetter, err := newDurationFrom(celEnv, jitterDuration, delay.JitterDurationFrom)
 			if err != nil {
 				return nil, err
 			}
@@ -160,12 +354,27 @@ func NewLifecycleStage(s *internalversion.Stage) (*LifecycleStage, error) {
 		}
 	}
 
+	if repeat := s.Spec.Repeat; repeat != nil {
+		stage.maxCount = repeat.MaxCount
+		if repeat.BackoffMultiplier != nil {
+			if *repeat.BackoffMultiplier < 1 {
+				return nil, fmt.Errorf("repeat backoffMultiplier %v is less than 1", *repeat.BackoffMultiplier)
+			}
+			stage.backoffMultiplier = *repeat.BackoffMultiplier
+		}
+		if repeat.MaxDelayMilliseconds != nil {
+			stage.maxDelay = format.Ptr(time.Duration(*repeat.MaxDelayMilliseconds) * time.Millisecond)
+		}
+	}
+
 	if weight := s.Spec.Weight; weight > 1 {
 		stage.weight = weight
 	} else {
 		stage.weight = 0
 	}
 
+	stage.priority = s.Spec.Priority
+	stage.group = s.Spec.Group
 	stage.immediateNextStage = s.Spec.ImmediateNextStage
 
 	return stage, nil
@@ -177,17 +386,28 @@ type LifecycleStage struct {
 	matchLabels      labels.Selector
 	matchAnnotations labels.Selector
 	matchExpressions []*expression.Requirement
+	matchCEL         []*cel.Evaluator
+
+	weight   int
+	priority int
+	group    string
+	next     *internalversion.StageNext
 
-	weight int
-	next   *internalversion.StageNext
+	eventSampleRate *float64
+	eventLimiter    flowcontrol.RateLimiter
 
 	duration       expression.DurationGetter
 	jitterDuration expression.DurationGetter
+	distribution   *delayDistribution
+
+	maxCount          int64
+	backoffMultiplier float64
+	maxDelay          *time.Duration
 
 	immediateNextStage bool
 }
 
-func (s *LifecycleStage) match(label, annotation labels.Set, jsonStandard interface{}) (bool, error) {
+func (s *LifecycleStage) match(ctx context.Context, label, annotation labels.Set, jsonStandard interface{}) (bool, error) {
 	if s.matchLabels != nil {
 		if !s.matchLabels.Matches(label) {
 			return false, nil
@@ -201,7 +421,7 @@ func (s *LifecycleStage) match(label, annotation labels.Set, jsonStandard interf
 
 	if s.matchExpressions != nil {
 		for _, requirement := range s.matchExpressions {
-			ok, err := requirement.Matches(context.Background(), jsonStandard)
+			ok, err := requirement.Matches(ctx, jsonStandard)
 			if err != nil {
 				return false, err
 			}
@@ -210,12 +430,37 @@ func (s *LifecycleStage) match(label, annotation labels.Set, jsonStandard interf
 			}
 		}
 	}
+
+	if s.matchCEL != nil {
+		self, _ := jsonStandard.(map[string]interface{})
+		for _, evaluator := range s.matchCEL {
+			ok, err := evaluator.EvaluateBool(cel.Data{Self: self})
+			if err != nil {
+				// The expression may refer to a field that is not set yet,
+				// such as a key missing in a map, so it does not match.
+				logger := log.FromContext(ctx)
+				logger.Debug("Failed to evaluate the CEL expression",
+					"stage", s.name,
+					"err", err,
+				)
+				return false, nil
+			}
+			if !ok {
+				return false, nil
+			}
+		}
+	}
 	return true, nil
 }
 
 // Delay returns the delay duration of the stage.
 // It's not a constant value, it can be a random value.
-func (s *LifecycleStage) Delay(ctx context.Context, v interface{}, now time.Time) (time.Duration, bool) {
+// The rnd is used to compute the jitter or sample the distribution, the global source is used if it is nil.
+func (s *LifecycleStage) Delay(ctx context.Context, v interface{}, now time.Time, rnd *rand.Rand) (time.Duration, bool) {
+	if s.distribution != nil {
+		return s.distribution.Sample(rnd), true
+	}
+
 	if s.duration == nil {
 		return 0, false
 	}
@@ -234,12 +479,105 @@ func (s *LifecycleStage) Delay(ctx context.Context, v interface{}, now time.Time
 		return duration, true
 	}
 
-	if jitterDuration < duration {
+	if jitterDuration <= duration {
 		return jitterDuration, true
 	}
 
-	//nolint:gosec
-	return duration + time.Duration(rand.Int63n(int64(jitterDuration-duration))), true
+	return duration + time.Duration(randInt63n(rnd, int64(jitterDuration-duration))), true
+}
+
+// celEnvironmentGetter returns the environment of the CEL expressions of the stages,
+// it is created on the first use.
+type celEnvironmentGetter func() (*cel.Environment, error)
+
+// newCELEnvironment returns the getter of the CEL environment whose Now() follows the clock.
+func newCELEnvironment(clk clock.PassiveClock) celEnvironmentGetter {
+	if clk == nil {
+		clk = clock.RealClock{}
+	}
+	return sync.OnceValues(func() (*cel.Environment, error) {
+		return cel.NewEnvironment(cel.NodeEvaluatorConfig{
+			Now: clk.Now,
+		})
+	})
+}
+
+// realCELEnvironment is the CEL environment shared by the stages following the real clock.
+var realCELEnvironment = newCELEnvironment(nil)
+
+// newDurationFrom returns a DurationGetter from the expression or the CEL expression of the source.
+func newDurationFrom(celEnv celEnvironmentGetter, value *time.Duration, src *internalversion.ExpressionFromSource) (expression.DurationGetter, error) {
+	if src == nil {
+		return expression.NewDurationFrom(value, nil)
+	}
+	if src.CEL == "" {
+		return expression.NewDurationFrom(value, &src.ExpressionFrom)
+	}
+	if src.ExpressionFrom != "" {
+		return nil, fmt.Errorf("expressionFrom and cel are mutually exclusive")
+	}
+	env, err := celEnv()
+	if err != nil {
+		return nil, err
+	}
+	evaluator, err := env.Compile(src.CEL)
+	if err != nil {
+		return nil, err
+	}
+	return &celDurationFrom{
+		value:     value,
+		evaluator: evaluator,
+	}, nil
+}
+
+type celDurationFrom struct {
+	value     *time.Duration
+	evaluator *cel.Evaluator
+}
+
+func (d *celDurationFrom) Get(ctx context.Context, v interface{}, now time.Time) (time.Duration, bool) {
+	self, _ := v.(map[string]interface{})
+	du, err := d.evaluator.EvaluateDuration(cel.Data{Self: self}, now)
+	if err != nil {
+		if d.value != nil {
+			return *d.value, true
+		}
+		return 0, false
+	}
+	return du, true
+}
+
+// Backoff returns the delay of the attempt, starting from 1,
+// the delay is multiplied by the backoff multiplier after each attempt and capped by the max delay.
+func (s *LifecycleStage) Backoff(delay time.Duration, attempt int64) time.Duration {
+	if s.backoffMultiplier > 1 && attempt > 1 {
+		backoff := float64(delay) * math.Pow(s.backoffMultiplier, float64(attempt-1))
+		if backoff >= math.MaxInt64 {
+			delay = math.MaxInt64
+		} else {
+			delay = time.Duration(backoff)
+		}
+	}
+	if s.maxDelay != nil && delay > *s.maxDelay {
+		delay = *s.maxDelay
+	}
+	return delay
+}
+
+func randIntn(rnd *rand.Rand, n int) int {
+	if rnd == nil {
+		//nolint:gosec
+		return rand.Intn(n)
+	}
+	return rnd.Intn(n)
+}
+
+func randInt63n(rnd *rand.Rand, n int64) int64 {
+	if rnd == nil {
+		//nolint:gosec
+		return rand.Int63n(n)
+	}
+	return rnd.Int63n(n)
 }
 
 // Next returns the next of the stage.
@@ -252,6 +590,24 @@ func (s *LifecycleStage) Name() string {
 	return s.name
 }
 
+// allowEvent returns whether the event of the stage is recorded this time,
+// the events are sampled first so that the dropped ones do not count towards the rate limit.
+// The rnd is used to sample the events, the global source is used if it is nil.
+func (s *LifecycleStage) allowEvent(rnd *rand.Rand) bool {
+	if s.eventSampleRate != nil && randFloat64(rnd) >= *s.eventSampleRate {
+		return false
+	}
+	if s.eventLimiter != nil && !s.eventLimiter.TryAccept() {
+		return false
+	}
+	return true
+}
+
+// Group returns the group of the stage
+func (s *LifecycleStage) Group() string {
+	return s.group
+}
+
 // ImmediateNextStage returns whether the stage is immediate next stage.
 func (s *LifecycleStage) ImmediateNextStage() bool {
 	return s.immediateNextStage
@@ -0,0 +1,428 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/config/resources"
+	"sigs.k8s.io/kwok/pkg/utils/expression"
+	"sigs.k8s.io/kwok/pkg/utils/format"
+)
+
+func TestLifecycleStageCEL(t *testing.T) {
+	now := time.Now()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "pod0",
+			CreationTimestamp: metav1.NewTime(now.Add(-10 * time.Minute)),
+			Annotations: map[string]string{
+				"delay": "2s",
+			},
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name:         "container0",
+					RestartCount: 5,
+				},
+			},
+		},
+	}
+	data, err := expression.ToJSONStandard(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		selector  internalversion.StageSelector
+		delay     *internalversion.StageDelay
+		wantMatch bool
+		wantDelay time.Duration
+		wantErr   bool
+	}{
+		{
+			name: "match restart count",
+			selector: internalversion.StageSelector{
+				MatchCEL: []string{
+					`self.status.containerStatuses.exists(c, c.restartCount > 3)`,
+				},
+			},
+			wantMatch: true,
+		},
+		{
+			name: "not match restart count",
+			selector: internalversion.StageSelector{
+				MatchCEL: []string{
+					`self.status.containerStatuses.exists(c, c.restartCount > 3)`,
+					`self.status.containerStatuses.exists(c, c.restartCount > 10)`,
+				},
+			},
+			wantMatch: false,
+		},
+		{
+			name: "match created more than 5m ago",
+			selector: internalversion.StageSelector{
+				MatchCEL: []string{
+					`Now() - timestamp(self.metadata.creationTimestamp) > duration("5m")`,
+					`self.SinceSecond() > 300.0`,
+				},
+			},
+			wantMatch: true,
+		},
+		{
+			name: "not match missing key",
+			selector: internalversion.StageSelector{
+				MatchCEL: []string{
+					`self.metadata.labels["app"] == "web"`,
+				},
+			},
+			wantMatch: false,
+		},
+		{
+			name: "invalid cel",
+			selector: internalversion.StageSelector{
+				MatchCEL: []string{
+					`self.`,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "delay from cel",
+			delay: &internalversion.StageDelay{
+				DurationFrom: &internalversion.ExpressionFromSource{
+					CEL: `duration(self.metadata.annotations["delay"])`,
+				},
+			},
+			wantMatch: true,
+			wantDelay: 2 * time.Second,
+		},
+		{
+			name: "delay from cel with default",
+			delay: &internalversion.StageDelay{
+				DurationMilliseconds: format.Ptr[int64](1000),
+				DurationFrom: &internalversion.ExpressionFromSource{
+					CEL: `duration(self.metadata.annotations["missing"])`,
+				},
+			},
+			wantMatch: true,
+			wantDelay: time.Second,
+		},
+		{
+			name: "delay from both expression and cel",
+			delay: &internalversion.StageDelay{
+				DurationFrom: &internalversion.ExpressionFromSource{
+					ExpressionFrom: `.metadata.annotations["delay"]`,
+					CEL:            `duration(self.metadata.annotations["delay"])`,
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stage, err := NewLifecycleStage(&internalversion.Stage{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: internalversion.StageSpec{
+					Selector: &tt.selector,
+					Delay:    tt.delay,
+				},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLifecycleStage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got, err := Lifecycle{stage}.Match(context.Background(), pod.Labels, pod.Annotations, data, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(got) != 0) != tt.wantMatch {
+				t.Fatalf("Match() got = %v, want %v", len(got) != 0, tt.wantMatch)
+			}
+			if !tt.wantMatch {
+				return
+			}
+
+			delay, _ := stage.Delay(context.Background(), data, now, nil)
+			if delay != tt.wantDelay {
+				t.Errorf("Delay() got = %v, want %v", delay, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestNewLifecycleCELClock(t *testing.T) {
+	clk := testingclock.NewFakeClock(time.Now())
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "pod0",
+			CreationTimestamp: metav1.NewTime(clk.Now()),
+		},
+	}
+	data, err := expression.ToJSONStandard(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lifecycle, err := NewLifecycle([]*internalversion.Stage{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test",
+			},
+			Spec: internalversion.StageSpec{
+				Selector: &internalversion.StageSelector{
+					MatchCEL: []string{
+						`Now() - timestamp(self.metadata.creationTimestamp) > duration("5m")`,
+					},
+				},
+			},
+		},
+	}, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := lifecycle.Match(context.Background(), pod.Labels, pod.Annotations, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("want no match before the clock steps, got %d", len(got))
+	}
+
+	clk.Step(10 * time.Minute)
+	got, err = lifecycle.Match(context.Background(), pod.Labels, pod.Annotations, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("want match after the clock steps, got %d", len(got))
+	}
+}
+
+func TestLifecycleMatch(t *testing.T) {
+	newStage := func(name string, priority int, group string, matchLabels map[string]string) *internalversion.Stage {
+		return &internalversion.Stage{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Spec: internalversion.StageSpec{
+				Selector: &internalversion.StageSelector{
+					MatchLabels: matchLabels,
+				},
+				Priority: priority,
+				Group:    group,
+			},
+		}
+	}
+	lifecycle, err := NewLifecycle([]*internalversion.Stage{
+		newStage("generic", 0, "", nil),
+		newStage("specific", 10, "", map[string]string{"app": "special"}),
+		newStage("fallback", -1, "", nil),
+		newStage("label", 0, "labels", nil),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		want        []string
+	}{
+		{
+			name: "generic",
+			want: []string{"generic", "label"},
+		},
+		{
+			name:   "higher priority",
+			labels: map[string]string{"app": "special"},
+			want:   []string{"specific", "label"},
+		},
+		{
+			name:        "next stage annotation",
+			labels:      map[string]string{"app": "special"},
+			annotations: map[string]string{NextStageAnnotation: "fallback"},
+			want:        []string{"fallback", "label"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lifecycle.Match(context.Background(), tt.labels, tt.annotations, map[string]interface{}{}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, 0, len(got))
+			for _, stage := range got {
+				names = append(names, stage.Name())
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("Match() got = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestLifecycleUnresolvedNextStage(t *testing.T) {
+	lifecycle, err := NewLifecycle([]*internalversion.Stage{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "once",
+			},
+			Spec: internalversion.StageSpec{
+				Selector: &internalversion.StageSelector{},
+				Repeat: &internalversion.StageRepeat{
+					MaxCount: 1,
+				},
+			},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		attempts    int64
+		want        string
+		wantOk      bool
+	}{
+		{
+			name: "no annotation",
+		},
+		{
+			name:        "resolved",
+			annotations: map[string]string{NextStageAnnotation: "once"},
+		},
+		{
+			name:        "not found",
+			annotations: map[string]string{NextStageAnnotation: "missing"},
+			want:        "missing",
+			wantOk:      true,
+		},
+		{
+			name:        "played as many times as it can be",
+			annotations: map[string]string{NextStageAnnotation: "once"},
+			attempts:    1,
+			want:        "once",
+			wantOk:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			available := lifecycle.Available(func(stageName string) int64 {
+				return tt.attempts
+			})
+			got, ok := available.UnresolvedNextStage(tt.annotations)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("UnresolvedNextStage() got = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestLifecycleStageCacheStatusUpdate(t *testing.T) {
+	stage := &internalversion.Stage{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test",
+			ResourceVersion: "1",
+		},
+		Spec: internalversion.StageSpec{
+			ResourceRef: internalversion.StageResourceRef{
+				APIGroup: "v1",
+				Kind:     "Pod",
+			},
+			Selector: &internalversion.StageSelector{},
+			Next: internalversion.StageNext{
+				Event: &internalversion.StageEvent{
+					Type:   corev1.EventTypeNormal,
+					Reason: "Test",
+					RateLimit: &internalversion.StageEventRateLimit{
+						QPS:   1,
+						Burst: 1,
+					},
+				},
+			},
+		},
+	}
+	stages := resources.NewMutableGetter([]*internalversion.Stage{stage})
+	cache := newLifecycleStageCache(realCELEnvironment)
+	getter := resources.NewFilter[Lifecycle, []*internalversion.Stage](stages, func(stages []*internalversion.Stage) Lifecycle {
+		lifecycle, err := cache.lifecycle(stages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lifecycle
+	})
+
+	before := getter.Get()
+	if len(before) != 1 {
+		t.Fatalf("want 1 stage, got %d", len(before))
+	}
+	if !before[0].allowEvent(nil) {
+		t.Fatal("want the first event allowed")
+	}
+	taken := map[string]resourceStageJob[string]{
+		"pod0": {
+			Resource: "old",
+			Stage:    before[0],
+			Key:      "pod0",
+			Time:     time.Unix(100, 0),
+		},
+	}
+
+	// The status update only bumps the resource version of the stage
+	updated := stage.DeepCopy()
+	updated.ResourceVersion = "2"
+	stages.Set([]*internalversion.Stage{updated})
+
+	after := getter.Get()
+	if len(after) != 1 || after[0] != before[0] {
+		t.Fatal("want the lifecycle stage reused after the status update")
+	}
+	if after[0].allowEvent(nil) {
+		t.Error("want the event limiter kept after the status update")
+	}
+	job, ok := nextStageJob(taken, "pod0", after[0], "new")
+	if !ok || !job.Time.Equal(time.Unix(100, 0)) {
+		t.Errorf("want the queued job kept after the status update, got %v", job)
+	}
+
+	changed := updated.DeepCopy()
+	changed.Spec.Weight = 2
+	stages.Set([]*internalversion.Stage{changed})
+	if got := getter.Get(); len(got) != 1 || got[0] == before[0] {
+		t.Error("want the lifecycle stage created again after the spec update")
+	}
+}
@@ -20,16 +20,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"sync/atomic"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/clock"
@@ -87,6 +90,7 @@ type NodeController struct {
 	clock                                 clock.Clock
 	typedClient                           kubernetes.Interface
 	nodeCacheGetter                       informer.Getter[*corev1.Node]
+	podCacheGetter                        informer.Getter[*corev1.Pod]
 	nodeIP                                string
 	nodeName                              string
 	nodePort                              int
@@ -101,15 +105,30 @@ type NodeController struct {
 	delayQueue                            queue.DelayingQueue[resourceStageJob[*corev1.Node]]
 	delayQueueMapping                     maps.SyncMap[string, resourceStageJob[*corev1.Node]]
 	recorder                              record.EventRecorder
+	events                                *stageEventRecorder
 	readOnlyFunc                          func(nodeName string) bool
 	enableMetrics                         bool
+	patchMeta                             strategicpatch.LookupPatchMeta
+	onStagePlayedFunc                     func(stageName string, err error)
+	rands                                 *resourceRands
+	attempts                              stageAttempts
+	creator                               *stageResourceCreator
+	webhook                               stageWebhookClient
+	history                               *StageHistory
+	historyAnnotation                     bool
+	pressureEviction                      bool
+	pressureEvictions                     maps.SyncMap[string, context.CancelFunc]
+	drains                                maps.SyncMap[types.UID, context.CancelFunc]
 }
 
 // NodeControllerConfig is the configuration for the NodeController
 type NodeControllerConfig struct {
 	Clock                                 clock.Clock
 	TypedClient                           kubernetes.Interface
+	DynamicClient                         dynamic.Interface
+	RESTMapper                            meta.RESTMapper
 	NodeCacheGetter                       informer.Getter[*corev1.Node]
+	PodCacheGetter                        informer.Getter[*corev1.Pod]
 	OnNodeManagedFunc                     func(nodeName string)
 	DisregardStatusWithAnnotationSelector string
 	DisregardStatusWithLabelSelector      string
@@ -120,8 +139,14 @@ type NodeControllerConfig struct {
 	PlayStageParallelism                  uint
 	FuncMap                               gotpl.FuncMap
 	Recorder                              record.EventRecorder
+	EventRecorderFor                      func(correlator internalversion.StageEventCorrelator) record.EventRecorder
 	ReadOnlyFunc                          func(nodeName string) bool
 	EnableMetrics                         bool
+	OnStagePlayedFunc                     func(stageName string, err error)
+	RandomSeed                            int64
+	StageHistory                          *StageHistory
+	EnableStageHistoryAnnotation          bool
+	EnableNodePressureEviction            bool
 }
 
 // NodeInfo is the collection of necessary node information
@@ -153,6 +178,7 @@ func NewNodeController(conf NodeControllerConfig) (*NodeController, error) {
 		clock:                                 conf.Clock,
 		typedClient:                           conf.TypedClient,
 		nodeCacheGetter:                       conf.NodeCacheGetter,
+		podCacheGetter:                        conf.PodCacheGetter,
 		disregardStatusWithAnnotationSelector: disregardStatusWithAnnotationSelector,
 		disregardStatusWithLabelSelector:      disregardStatusWithLabelSelector,
 		onNodeManagedFunc:                     conf.OnNodeManagedFunc,
@@ -164,8 +190,18 @@ func NewNodeController(conf NodeControllerConfig) (*NodeController, error) {
 		playStageParallelism:                  conf.PlayStageParallelism,
 		preprocessChan:                        make(chan *corev1.Node),
 		recorder:                              conf.Recorder,
+		onStagePlayedFunc:                     conf.OnStagePlayedFunc,
+		rands:                                 newResourceRands(conf.RandomSeed),
+		history:                               conf.StageHistory,
+		historyAnnotation:                     conf.EnableStageHistoryAnnotation,
 		readOnlyFunc:                          conf.ReadOnlyFunc,
 		enableMetrics:                         conf.EnableMetrics,
+		pressureEviction:                      conf.EnableNodePressureEviction,
+	}
+
+	c.patchMeta, err = strategicpatch.NewPatchMetaFromStruct(corev1.Node{})
+	if err != nil {
+		return nil, err
 	}
 
 	funcMap := maps.Merge(gotpl.FuncMap{
@@ -177,6 +213,8 @@ func NewNodeController(conf NodeControllerConfig) (*NodeController, error) {
 		},
 	}, conf.FuncMap)
 	c.renderer = gotpl.NewRenderer(funcMap)
+	c.creator = newStageResourceCreator(conf.DynamicClient, conf.RESTMapper, c.renderer)
+	c.events = newStageEventRecorder(conf.Recorder, conf.EventRecorderFor, c.renderer)
 	return c, nil
 }
 
@@ -239,13 +277,19 @@ loop:
 				node := event.Object
 				if _, has := c.nodesSets.Load(node.Name); has {
 					c.deleteNodeInfo(node)
+					c.rands.Delete(node.UID)
+					c.attempts.Delete(node.UID)
+					if c.history != nil {
+						c.history.Expire(node.UID)
+					}
+					if c.pressureEviction {
+						c.stopPressureEviction(node.Name)
+					}
+					c.stopDrain(node.UID)
 
 					// Cancel delay job
 					key := node.Name
-					resourceJob, ok := c.delayQueueMapping.LoadAndDelete(key)
-					if ok {
-						c.delayQueue.Cancel(resourceJob)
-					}
+					cancelStageJobs(c.delayQueue, &c.delayQueueMapping, key)
 				}
 			}
 		case <-ctx.Done():
@@ -271,6 +315,7 @@ func (c *NodeController) finalizersModify(ctx context.Context, node *corev1.Node
 		"node", node.Name,
 	)
 
+	addPatchSize(ctx, data)
 	result, err := c.typedClient.CoreV1().Nodes().Patch(ctx, node.Name, types.JSONPatchType, data, metav1.PatchOptions{})
 	if err != nil {
 		if apierrors.IsNotFound(err) {
@@ -330,9 +375,28 @@ func (c *NodeController) preprocessWorker(ctx context.Context) {
 func (c *NodeController) preprocess(ctx context.Context, node *corev1.Node) error {
 	key := node.Name
 
-	resourceJob, ok := c.delayQueueMapping.Load(key)
-	if ok && resourceJob.Resource.ResourceVersion == node.ResourceVersion {
-		return nil
+	lifecycle := c.lifecycle.Get()
+	groups := lifecycle.Groups()
+	for _, group := range groups {
+		resourceJob, ok := c.delayQueueMapping.Load(stageJobKey(key, group))
+		if ok && resourceJob.Resource.ResourceVersion == node.ResourceVersion {
+			return nil
+		}
+		if ok && c.historyAnnotation && onlyStageHistoryChanged(resourceJob.Resource, node) {
+			return nil
+		}
+	}
+
+	// The stages are matched again with the new version of the node,
+	// so the delayed jobs of the previous version are canceled,
+	// the job is scheduled again at its due time if the same stage is matched.
+	taken := takeStageJobs(c.delayQueue, &c.delayQueueMapping, key, groups)
+
+	if c.pressureEviction {
+		err := c.syncNodePressure(ctx, node)
+		if err != nil {
+			return err
+		}
 	}
 
 	logger := log.FromContext(ctx)
@@ -345,12 +409,18 @@ func (c *NodeController) preprocess(ctx context.Context, node *corev1.Node) erro
 		return err
 	}
 
-	lifecycle := c.lifecycle.Get()
-	stage, err := lifecycle.Match(node.Labels, node.Annotations, data)
+	lifecycle = lifecycle.Available(func(stageName string) int64 {
+		return c.attempts.Get(node.UID, stageName)
+	})
+	if name, ok := lifecycle.UnresolvedNextStage(node.Annotations); ok {
+		c.removeUnresolvedNextStage(ctx, node, name)
+	}
+	rnd := c.rands.Get(node.UID)
+	stages, err := lifecycle.Match(ctx, node.Labels, node.Annotations, data, rnd)
 	if err != nil {
 		return fmt.Errorf("stage match: %w", err)
 	}
-	if stage == nil {
+	if len(stages) == 0 {
 		logger.Debug("Skip node",
 			"reason", "not match any stages",
 		)
@@ -358,30 +428,62 @@ func (c *NodeController) preprocess(ctx context.Context, node *corev1.Node) erro
 	}
 
 	now := c.clock.Now()
-	delay, _ := stage.Delay(ctx, data, now)
+	for _, stage := range stages {
+		jobKey := stageJobKey(key, stage.Group())
+		item, ok := nextStageJob(taken, jobKey, stage, node)
+		if !ok {
+			delay, _ := stage.Delay(ctx, data, now, rnd)
+			delay = stage.Backoff(delay, c.attempts.Get(node.UID, stage.Name())+1)
+
+			if delay != 0 {
+				stageName := stage.Name()
+				logger.Debug("Delayed play stage",
+					"delay", delay,
+					"stage", stageName,
+				)
+			}
 
-	if delay != 0 {
-		stageName := stage.Name()
-		logger.Debug("Delayed play stage",
-			"delay", delay,
-			"stage", stageName,
-		)
+			item = resourceStageJob[*corev1.Node]{
+				Resource: node,
+				Stage:    stage,
+				Key:      jobKey,
+				Delay:    delay,
+				Time:     now.Add(delay),
+			}
+		}
+		ok = c.delayQueue.AddAfter(item, item.Time.Sub(now))
+		if !ok {
+			logger.Debug("Skip node",
+				"reason", "delayed",
+			)
+		} else {
+			c.delayQueueMapping.Store(jobKey, item)
+		}
 	}
+	return nil
+}
 
-	item := resourceStageJob[*corev1.Node]{
-		Resource: node,
-		Stage:    stage,
-		Key:      key,
+// removeUnresolvedNextStage removes the NextStageAnnotation naming a stage that can't be resolved,
+// otherwise it stays on the node forever, and records a warning event.
+func (c *NodeController) removeUnresolvedNextStage(ctx context.Context, node *corev1.Node, name string) {
+	logger := log.FromContext(ctx)
+	logger.Warn("Remove unresolved next stage",
+		"node", node.Name,
+		"stage", name,
+	)
+	if c.recorder != nil {
+		ref := &corev1.ObjectReference{
+			Kind: "Node",
+			UID:  node.UID,
+			Name: node.Name,
+		}
+		c.recorder.Eventf(ref, corev1.EventTypeWarning, unresolvedNextStageReason,
+			"Stage %q of the %s annotation doesn't exist, is not for the node or has been played as many times as it can be", name, NextStageAnnotation)
 	}
-	ok = c.delayQueue.AddAfter(item, delay)
-	if !ok {
-		logger.Debug("Skip node",
-			"reason", "delayed",
-		)
-	} else {
-		c.delayQueueMapping.Store(key, item)
+	_, err := c.patchResource(ctx, node, types.MergePatchType, removeNextStageAnnotationPatch)
+	if err != nil {
+		logger.Error("Failed to remove next stage annotation", err)
 	}
-	return nil
 }
 
 // playStageWorker receives the resource from the playStageChan and play the stage
@@ -389,12 +491,40 @@ func (c *NodeController) playStageWorker(ctx context.Context) {
 	for ctx.Err() == nil {
 		node := c.delayQueue.GetOrWait()
 		c.delayQueueMapping.Delete(node.Key)
-		c.playStage(ctx, node.Resource, node.Stage)
+		attempt := c.attempts.Add(node.Resource.UID, node.Stage.Name())
+		playCtx, patchSize := withPatchSize(ctx)
+		err := c.playStage(playCtx, node.Resource, node.Stage, attempt)
+		if c.onStagePlayedFunc != nil {
+			c.onStagePlayedFunc(node.Stage.Name(), err)
+		}
+		if c.history != nil {
+			transition := newStageTransition(c.clock.Now(), node.Stage, node.Delay, attempt, patchSize.Load(), err)
+			c.recordStageTransition(ctx, node.Resource, transition)
+		}
+	}
+}
+
+// recordStageTransition records the transition in the history, and in the annotation if enabled
+func (c *NodeController) recordStageTransition(ctx context.Context, node *corev1.Node, transition StageTransition) {
+	transitions := c.history.Record("Node", "", node.Name, node.UID, transition)
+	if !c.historyAnnotation {
+		return
+	}
+
+	logger := log.FromContext(ctx)
+	patch, err := stageHistoryAnnotationPatch(transitions)
+	if err != nil {
+		logger.Error("Failed to record stage history", err)
+		return
+	}
+	_, err = c.patchResource(ctx, node, types.MergePatchType, patch)
+	if err != nil {
+		logger.Error("Failed to record stage history", err)
 	}
 }
 
 // playStage plays the stage
-func (c *NodeController) playStage(ctx context.Context, node *corev1.Node, stage *LifecycleStage) {
+func (c *NodeController) playStage(ctx context.Context, node *corev1.Node, stage *LifecycleStage, attempt int64) error {
 	next := stage.Next()
 	logger := log.FromContext(ctx)
 	logger = logger.With(
@@ -402,48 +532,145 @@ func (c *NodeController) playStage(ctx context.Context, node *corev1.Node, stage
 		"stage", stage.Name(),
 	)
 
-	if next.Event != nil && c.recorder != nil {
-		c.recorder.Event(&corev1.ObjectReference{
+	var webhookResult *StageWebhookResponse
+	if next.Webhook != nil {
+		resp, err := c.webhook.Call(ctx, next.Webhook, stage.Name(), attempt, node)
+		if err != nil {
+			if !ignoreStageWebhookFailure(next.Webhook) {
+				logger.Error("Failed to call webhook", err)
+				return err
+			}
+			logger.Warn("Ignore the failure of webhook",
+				"err", err,
+			)
+		}
+		webhookResult = resp
+	}
+
+	var errs []error
+	if c.recorder != nil {
+		ref := &corev1.ObjectReference{
 			Kind:      "Node",
 			UID:       node.UID,
 			Name:      node.Name,
 			Namespace: "",
-		}, next.Event.Type, next.Event.Reason, next.Event.Message)
+		}
+		if next.Event != nil {
+			err := c.events.Record(stage, c.rands.Get(node.UID), ref, stageTemplateData{resource: node, attempt: attempt})
+			if err != nil {
+				logger.Error("Failed to record event", err)
+				errs = append(errs, err)
+			}
+		}
+		if webhookResult != nil {
+			c.events.RecordWebhook(stage, c.rands.Get(node.UID), ref, webhookResult.Events)
+		}
 	}
 	if next.Finalizers != nil {
 		result, err := c.finalizersModify(ctx, node, next.Finalizers)
 		if err != nil {
 			logger.Error("Failed to finalizers of node", err)
+			errs = append(errs, err)
 		}
 		if result != nil && stage.ImmediateNextStage() {
 			c.preprocessChan <- result
 		}
 	}
-	if next.Delete {
+	if len(next.Create) != 0 {
+		err := c.creator.Create(ctx, metav1.OwnerReference{
+			APIVersion: "v1",
+			Kind:       "Node",
+			Name:       node.Name,
+			UID:        node.UID,
+		}, "", stageTemplateData{resource: node, attempt: attempt}, next.Create)
+		if err != nil {
+			logger.Error("Failed to create resources", err)
+			errs = append(errs, err)
+		}
+	}
+	var result *corev1.Node
+	if next.Drain != nil {
+		drained, err := c.drainNode(ctx, node, next.Drain)
+		if err != nil {
+			logger.Error("Failed to drain node", err)
+			errs = append(errs, err)
+		}
+		if drained != nil {
+			result = drained
+		}
+	}
+	if next.Delete || (webhookResult != nil && webhookResult.Delete) {
 		err := c.deleteResource(ctx, node)
 		if err != nil {
 			logger.Error("Failed to delete node", err)
 		}
-	} else if next.StatusTemplate != "" {
-		patch, err := c.computePatch(node, next.StatusTemplate)
+		return errors.Join(append(errs, err)...)
+	}
+
+	if next.StatusTemplate != "" {
+		patch, err := c.computePatch(node, next.StatusTemplate, attempt)
 		if err != nil {
 			logger.Error("Failed to configure node", err)
-			return
+			return errors.Join(append(errs, err)...)
 		}
 		if patch == nil {
 			logger.Debug("Skip node",
 				"reason", "do not need to modify",
 			)
 		} else {
-			result, err := c.patchResource(ctx, node, patch)
+			result, err = c.patchResource(ctx, node, types.StrategicMergePatchType, patch, "status")
 			if err != nil {
 				logger.Error("Failed to patch node", err)
+				errs = append(errs, err)
 			}
-			if result != nil && stage.ImmediateNextStage() {
-				c.preprocessChan <- result
-			}
 		}
 	}
+	if len(next.Patches) != 0 {
+		latest := node
+		if result != nil {
+			latest = result
+		}
+		patched, err := c.patchResources(ctx, latest, next.Patches, attempt)
+		if err != nil {
+			logger.Error("Failed to patch node", err)
+			errs = append(errs, err)
+		}
+		if patched != nil {
+			result = patched
+		}
+	}
+	if webhookResult != nil && len(webhookResult.Patches) != 0 {
+		latest := node
+		if result != nil {
+			latest = result
+		}
+		patched, err := applyStageWebhookPatches(ctx, latest, webhookResult.Patches, c.patchResource)
+		if err != nil {
+			logger.Error("Failed to patch node", err)
+			errs = append(errs, err)
+		}
+		if patched != nil {
+			result = patched
+		}
+	}
+	if node.Annotations[NextStageAnnotation] == stage.Name() {
+		latest := node
+		if result != nil {
+			latest = result
+		}
+		patched, err := c.patchResource(ctx, latest, types.MergePatchType, removeNextStageAnnotationPatch)
+		if err != nil {
+			logger.Error("Failed to remove next stage annotation", err)
+			errs = append(errs, err)
+		}
+		if patched != nil {
+			result = patched
+		}
+	}
+	if result != nil && stage.ImmediateNextStage() {
+		c.preprocessChan <- result
+	}
+	return errors.Join(errs...)
 }
 
 func (c *NodeController) readOnly(nodeName string) bool {
@@ -453,14 +680,52 @@ func (c *NodeController) readOnly(nodeName string) bool {
 	return c.readOnlyFunc(nodeName)
 }
 
+// patchResources applies the patches to the node in order
+func (c *NodeController) patchResources(ctx context.Context, node *corev1.Node, patches []internalversion.StagePatch, attempt int64) (*corev1.Node, error) {
+	logger := log.FromContext(ctx)
+	logger = logger.With(
+		"node", node.Name,
+	)
+
+	var result *corev1.Node
+	for i := range patches {
+		patch := &patches[i]
+		patchType, data, err := computeStagePatch(c.renderer, node, attempt, c.patchMeta, patch)
+		if err != nil {
+			return result, fmt.Errorf("failed to compute patch %d: %w", i, err)
+		}
+		if data == nil {
+			logger.Debug("Skip node",
+				"reason", "do not need to modify",
+				"subresource", patch.Subresource,
+			)
+			continue
+		}
+		latest, err := c.patchResource(ctx, node, patchType, data, patch.Subresource)
+		if err != nil {
+			return result, err
+		}
+		if latest == nil {
+			return nil, nil
+		}
+		if !isResourceSubresource(patch.Subresource) {
+			continue
+		}
+		node = latest
+		result = latest
+	}
+	return result, nil
+}
+
 // patchResource patches the resource
-func (c *NodeController) patchResource(ctx context.Context, node *corev1.Node, patch []byte) (*corev1.Node, error) {
+func (c *NodeController) patchResource(ctx context.Context, node *corev1.Node, patchType types.PatchType, patch []byte, subresources ...string) (*corev1.Node, error) {
 	logger := log.FromContext(ctx)
 	logger = logger.With(
 		"node", node.Name,
 	)
 
-	result, err := c.typedClient.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	addPatchSize(ctx, patch)
+	result, err := c.typedClient.CoreV1().Nodes().Patch(ctx, node.Name, patchType, patch, metav1.PatchOptions{}, subresources...)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			logger.Warn("Patch node",
@@ -474,8 +739,8 @@ func (c *NodeController) patchResource(ctx context.Context, node *corev1.Node, p
 	return result, nil
 }
 
-func (c *NodeController) computePatch(node *corev1.Node, tpl string) ([]byte, error) {
-	patch, err := c.renderer.ToJSON(tpl, node)
+func (c *NodeController) computePatch(node *corev1.Node, tpl string, attempt int64) ([]byte, error) {
+	patch, err := c.renderer.ToJSON(tpl, stageTemplateData{resource: node, attempt: attempt})
 	if err != nil {
 		return nil, err
 	}
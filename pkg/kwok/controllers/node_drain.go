@@ -0,0 +1,252 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/log"
+	"sigs.k8s.io/kwok/pkg/utils/slices"
+)
+
+// cordonNodePatch is the merge patch to mark the node as unschedulable
+var cordonNodePatch = []byte(`{"spec":{"unschedulable":true}}`)
+
+// drainRetryInterval is the interval to retry the evictions blocked by the PodDisruptionBudgets
+var drainRetryInterval = 5 * time.Second
+
+// defaultDrainTimeout is the time to retry the evictions if the timeout of the drain is not set
+const defaultDrainTimeout = 5 * time.Minute
+
+// drainNode cordons the node and evicts its pods in the background,
+// the result of the evictions is recorded as an event of the node.
+// Only one drain is in flight on the node, it is canceled when the node is deleted.
+func (c *NodeController) drainNode(ctx context.Context, node *corev1.Node, drain *internalversion.StageDrain) (*corev1.Node, error) {
+	var result *corev1.Node
+	if !node.Spec.Unschedulable {
+		patched, err := c.patchResource(ctx, node, types.MergePatchType, cordonNodePatch)
+		if err != nil {
+			return nil, fmt.Errorf("cordon node: %w", err)
+		}
+		result = patched
+	}
+
+	if _, ok := c.drains.Load(node.UID); ok {
+		logger := log.FromContext(ctx)
+		logger.Debug("Skip drain node",
+			"reason", "already draining",
+			"node", node.Name,
+		)
+		return result, nil
+	}
+
+	pods, err := c.listPodsOnNode(ctx, node.Name)
+	if err != nil {
+		return result, fmt.Errorf("list pods on node: %w", err)
+	}
+
+	drainCtx, cancel := context.WithCancel(ctx)
+	c.drains.Store(node.UID, cancel)
+	go func() {
+		defer c.stopDrain(node.UID)
+		c.evictPods(drainCtx, node, pods, drain)
+	}()
+	return result, nil
+}
+
+// stopDrain stops the evictions of the drain on the node
+func (c *NodeController) stopDrain(uid types.UID) {
+	cancel, ok := c.drains.LoadAndDelete(uid)
+	if ok {
+		cancel()
+	}
+}
+
+// listPodsOnNode lists the pods on the node from the pod cache, or from the apiserver if there is no cache.
+func (c *NodeController) listPodsOnNode(ctx context.Context, nodeName string) ([]*corev1.Pod, error) {
+	if c.podCacheGetter != nil {
+		return slices.Filter(c.podCacheGetter.List(), func(pod *corev1.Pod) bool {
+			return pod.Spec.NodeName == nodeName
+		}), nil
+	}
+
+	list, err := c.typedClient.CoreV1().Pods(corev1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]*corev1.Pod, 0, len(list.Items))
+	for i := range list.Items {
+		if list.Items[i].Spec.NodeName == nodeName {
+			pods = append(pods, &list.Items[i])
+		}
+	}
+	return pods, nil
+}
+
+// evictPods evicts the pods through the Eviction API,
+// the evictions blocked by the PodDisruptionBudgets are retried until the timeout.
+func (c *NodeController) evictPods(ctx context.Context, node *corev1.Node, pods []*corev1.Pod, drain *internalversion.StageDrain) {
+	logger := log.FromContext(ctx)
+	logger = logger.With(
+		"node", node.Name,
+	)
+
+	sort.Slice(pods, func(i, j int) bool {
+		return log.KObj(pods[i]).String() < log.KObj(pods[j]).String()
+	})
+
+	var skipped []string
+	pending := make([]*corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		switch {
+		case pod.DeletionTimestamp != nil || isDaemonSetPod(pod) || isMirrorPod(pod):
+		case !drain.DeleteEmptyDirData && hasEmptyDirVolume(pod):
+			skipped = append(skipped, log.KObj(pod).String())
+		default:
+			pending = append(pending, pod)
+		}
+	}
+
+	timeout := defaultDrainTimeout
+	if drain.TimeoutMilliseconds != nil {
+		timeout = time.Duration(*drain.TimeoutMilliseconds) * time.Millisecond
+	}
+	deadline := c.clock.Now().Add(timeout)
+
+	evicted := 0
+	var failed []string
+loop:
+	for {
+		retry := pending[:0]
+		for _, pod := range pending {
+			err := c.evictPod(ctx, pod, drain.GracePeriodSeconds)
+			switch {
+			case err == nil || apierrors.IsNotFound(err):
+				evicted++
+			case apierrors.IsTooManyRequests(err):
+				retry = append(retry, pod)
+			default:
+				logger.Error("Failed to evict pod", err,
+					"pod", log.KObj(pod),
+				)
+				failed = append(failed, log.KObj(pod).String())
+			}
+		}
+		pending = retry
+		if len(pending) == 0 {
+			break loop
+		}
+
+		wait := deadline.Sub(c.clock.Now())
+		timedOut := wait <= drainRetryInterval
+		if !timedOut {
+			wait = drainRetryInterval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.clock.After(wait):
+		}
+		if timedOut {
+			break loop
+		}
+	}
+
+	blocked := make([]string, 0, len(pending))
+	for _, pod := range pending {
+		blocked = append(blocked, log.KObj(pod).String())
+	}
+	logger.Info("Drain node",
+		"evicted", evicted,
+		"blocked", blocked,
+		"skipped", skipped,
+		"failed", failed,
+	)
+
+	if c.recorder == nil {
+		return
+	}
+	ref := &corev1.ObjectReference{
+		Kind: "Node",
+		UID:  node.UID,
+		Name: node.Name,
+	}
+	if len(blocked) == 0 && len(skipped) == 0 && len(failed) == 0 {
+		c.recorder.Eventf(ref, corev1.EventTypeNormal, "NodeDrained", "Evicted %d pods", evicted)
+		return
+	}
+	messages := []string{fmt.Sprintf("Evicted %d pods", evicted)}
+	if len(blocked) != 0 {
+		messages = append(messages, fmt.Sprintf("%d pods blocked by disruption budgets: %s", len(blocked), strings.Join(blocked, ", ")))
+	}
+	if len(skipped) != 0 {
+		messages = append(messages, fmt.Sprintf("%d pods with emptyDir volumes skipped: %s", len(skipped), strings.Join(skipped, ", ")))
+	}
+	if len(failed) != 0 {
+		messages = append(messages, fmt.Sprintf("%d pods failed to evict: %s", len(failed), strings.Join(failed, ", ")))
+	}
+	c.recorder.Event(ref, corev1.EventTypeWarning, "NodeDrainIncomplete", strings.Join(messages, "; "))
+}
+
+// evictPod evicts the pod through the Eviction API
+func (c *NodeController) evictPod(ctx context.Context, pod *corev1.Pod, gracePeriodSeconds *int64) error {
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+	}
+	if gracePeriodSeconds != nil {
+		eviction.DeleteOptions = &metav1.DeleteOptions{
+			GracePeriodSeconds: gracePeriodSeconds,
+		}
+	}
+	return c.typedClient.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+}
+
+func isDaemonSetPod(pod *corev1.Pod) bool {
+	owner := metav1.GetControllerOf(pod)
+	return owner != nil && owner.Kind == "DaemonSet"
+}
+
+func isMirrorPod(pod *corev1.Pod) bool {
+	_, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]
+	return ok
+}
+
+func hasEmptyDirVolume(pod *corev1.Pod) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.EmptyDir != nil {
+			return true
+		}
+	}
+	return false
+}
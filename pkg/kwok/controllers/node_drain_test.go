@@ -0,0 +1,259 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/utils/format"
+)
+
+func TestNodeControllerDrain(t *testing.T) {
+	newPod := func(name, nodeName string, modify func(pod *corev1.Pod)) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+			},
+			Spec: corev1.PodSpec{
+				NodeName: nodeName,
+			},
+		}
+		if modify != nil {
+			modify(pod)
+		}
+		return pod
+	}
+
+	tests := []struct {
+		name            string
+		drain           internalversion.StageDrain
+		blockedAttempts int
+		step            time.Duration
+		wantEvicted     []string
+		wantEvent       string
+	}{
+		{
+			name: "retry blocked eviction",
+			drain: internalversion.StageDrain{
+				GracePeriodSeconds: format.Ptr[int64](0),
+			},
+			blockedAttempts: 1,
+			step:            drainRetryInterval,
+			wantEvicted:     []string{"web-0", "web-1", "web-1"},
+			wantEvent:       "Warning NodeDrainIncomplete Evicted 2 pods; 1 pods with emptyDir volumes skipped: default/cache-0",
+		},
+		{
+			name: "timeout",
+			drain: internalversion.StageDrain{
+				TimeoutMilliseconds: format.Ptr[int64](1000),
+				DeleteEmptyDirData:  true,
+			},
+			blockedAttempts: 10,
+			step:            time.Second,
+			wantEvicted:     []string{"cache-0", "web-0", "web-1"},
+			wantEvent:       "Warning NodeDrainIncomplete Evicted 2 pods; 1 pods blocked by disruption budgets: default/web-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "node0",
+				},
+			}
+			objects := []runtime.Object{
+				node,
+				newPod("web-0", "node0", nil),
+				newPod("web-1", "node0", nil),
+				newPod("cache-0", "node0", func(pod *corev1.Pod) {
+					pod.Spec.Volumes = []corev1.Volume{
+						{
+							Name: "cache",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+					}
+				}),
+				newPod("ds-0", "node0", func(pod *corev1.Pod) {
+					pod.OwnerReferences = []metav1.OwnerReference{
+						{
+							APIVersion: "apps/v1",
+							Kind:       "DaemonSet",
+							Name:       "ds",
+							Controller: format.Ptr(true),
+						},
+					}
+				}),
+				newPod("other-0", "node1", nil),
+			}
+			clientset := fake.NewSimpleClientset(objects...)
+
+			var mut sync.Mutex
+			var evicted []string
+			blocked := 0
+			clientset.PrependReactor("create", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() != "eviction" {
+					return false, nil, nil
+				}
+				eviction := action.(clienttesting.CreateAction).GetObject().(*policyv1.Eviction)
+				if tt.drain.GracePeriodSeconds != nil &&
+					(eviction.DeleteOptions == nil || *eviction.DeleteOptions.GracePeriodSeconds != *tt.drain.GracePeriodSeconds) {
+					t.Errorf("want grace period %d for %s", *tt.drain.GracePeriodSeconds, eviction.Name)
+				}
+
+				mut.Lock()
+				defer mut.Unlock()
+				evicted = append(evicted, eviction.Name)
+				if eviction.Name == "web-1" && blocked < tt.blockedAttempts {
+					blocked++
+					return true, nil, apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+				}
+				return true, nil, nil
+			})
+
+			clk := testingclock.NewFakeClock(time.Now())
+			recorder := record.NewFakeRecorder(10)
+			c := &NodeController{
+				clock:       clk,
+				typedClient: clientset,
+				recorder:    recorder,
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			result, err := c.drainNode(ctx, node, &tt.drain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result == nil || !result.Spec.Unschedulable {
+				t.Fatalf("want node to be cordoned, got %v", result)
+			}
+
+			for !clk.HasWaiters() {
+				time.Sleep(10 * time.Millisecond)
+			}
+			clk.Step(tt.step)
+
+			select {
+			case event := <-recorder.Events:
+				if event != tt.wantEvent {
+					t.Errorf("want event %q, got %q", tt.wantEvent, event)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("timeout waiting for the drain event")
+			}
+
+			mut.Lock()
+			defer mut.Unlock()
+			if !reflect.DeepEqual(evicted, tt.wantEvicted) {
+				t.Errorf("want evicted %v, got %v", tt.wantEvicted, evicted)
+			}
+		})
+	}
+}
+
+func TestNodeControllerDrainInFlight(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node0",
+			UID:  "node0-uid",
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web-0",
+			Namespace: "default",
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "node0",
+		},
+	}
+	clientset := fake.NewSimpleClientset(node, pod)
+
+	var mut sync.Mutex
+	evictions := 0
+	clientset.PrependReactor("create", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		mut.Lock()
+		defer mut.Unlock()
+		evictions++
+		return true, nil, apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+	})
+
+	clk := testingclock.NewFakeClock(time.Now())
+	recorder := record.NewFakeRecorder(10)
+	c := &NodeController{
+		clock:       clk,
+		typedClient: clientset,
+		recorder:    recorder,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	for i := 0; i != 2; i++ {
+		_, err := c.drainNode(ctx, node, &internalversion.StageDrain{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for !clk.HasWaiters() {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if size := c.drains.Size(); size != 1 {
+		t.Fatalf("want 1 drain in flight, got %d", size)
+	}
+
+	// The drain is canceled when the node is deleted.
+	c.stopDrain(node.UID)
+	if size := c.drains.Size(); size != 0 {
+		t.Fatalf("want no drain in flight, got %d", size)
+	}
+	clk.Step(defaultDrainTimeout)
+
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("want no event of the canceled drain, got %q", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	mut.Lock()
+	defer mut.Unlock()
+	if evictions != 1 {
+		t.Errorf("want 1 eviction, got %d", evictions)
+	}
+}
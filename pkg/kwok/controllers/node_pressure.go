@@ -0,0 +1,359 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/kwok/pkg/log"
+)
+
+// nodePressure is a pressure condition of the node, the resource reclaimed under it and its taint
+type nodePressure struct {
+	condition corev1.NodeConditionType
+	resource  corev1.ResourceName
+	taint     string
+}
+
+// nodePressures are the pressure conditions that evict the pods, in the order of the kubelet
+var nodePressures = []nodePressure{
+	{
+		condition: corev1.NodeMemoryPressure,
+		resource:  corev1.ResourceMemory,
+		taint:     corev1.TaintNodeMemoryPressure,
+	},
+	{
+		condition: corev1.NodeDiskPressure,
+		resource:  corev1.ResourceEphemeralStorage,
+		taint:     corev1.TaintNodeDiskPressure,
+	},
+}
+
+// pressureEvictionInterval is the interval between the evictions on a node under pressure,
+// the kubelet evicts at most one pod in each of its eviction monitoring periods.
+var pressureEvictionInterval = 10 * time.Second
+
+// systemCriticalPriority is the priority from which the pods are critical and never evicted by the kubelet
+const systemCriticalPriority = 2000000000
+
+// syncNodePressure taints the node under pressure and starts to evict its pods,
+// the evictions are stopped when the node is no longer under pressure.
+func (c *NodeController) syncNodePressure(ctx context.Context, node *corev1.Node) error {
+	pressures := nodeUnderPressures(node)
+	err := c.syncNodePressureTaints(ctx, node, pressures)
+
+	if len(pressures) == 0 {
+		c.stopPressureEviction(node.Name)
+		return err
+	}
+	if _, ok := c.pressureEvictions.Load(node.Name); ok {
+		return err
+	}
+
+	evictCtx, cancel := context.WithCancel(ctx)
+	c.pressureEvictions.Store(node.Name, cancel)
+	go c.evictPodsUnderPressure(evictCtx, node.Name)
+	return err
+}
+
+// stopPressureEviction stops the evictions on the node
+func (c *NodeController) stopPressureEviction(nodeName string) {
+	cancel, ok := c.pressureEvictions.LoadAndDelete(nodeName)
+	if ok {
+		cancel()
+	}
+}
+
+// nodeUnderPressures returns the pressures whose conditions are true on the node
+func nodeUnderPressures(node *corev1.Node) []nodePressure {
+	var pressures []nodePressure
+	for _, pressure := range nodePressures {
+		for _, cond := range node.Status.Conditions {
+			if cond.Type == pressure.condition && cond.Status == corev1.ConditionTrue {
+				pressures = append(pressures, pressure)
+				break
+			}
+		}
+	}
+	return pressures
+}
+
+// syncNodePressureTaints adds the NoSchedule taints of the pressures to the node, and removes the taints of the other pressures
+func (c *NodeController) syncNodePressureTaints(ctx context.Context, node *corev1.Node, pressures []nodePressure) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		taints, changed := nodePressureTaints(node, pressures)
+		if !changed {
+			return nil
+		}
+
+		// The patch is rejected with a conflict if the node is modified meanwhile,
+		// so the taints added by others are not overwritten, and it is retried with the latest node.
+		patch, err := json.Marshal(map[string]any{
+			"metadata": map[string]any{
+				"resourceVersion": node.ResourceVersion,
+			},
+			"spec": map[string]any{
+				"taints": taints,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = c.patchResource(ctx, node, types.MergePatchType, patch)
+		if apierrors.IsConflict(err) {
+			latest, getErr := c.typedClient.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+			node = latest
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("taint node under pressure: %w", err)
+	}
+	return nil
+}
+
+// nodePressureTaints returns the taints of the node with the NoSchedule taints of the pressures,
+// and whether they are changed.
+func nodePressureTaints(node *corev1.Node, pressures []nodePressure) ([]corev1.Taint, bool) {
+	want := map[string]bool{}
+	for _, pressure := range pressures {
+		want[pressure.taint] = true
+	}
+
+	changed := false
+	taints := make([]corev1.Taint, 0, len(node.Spec.Taints)+len(pressures))
+	for _, taint := range node.Spec.Taints {
+		isPressure := false
+		for _, pressure := range nodePressures {
+			if taint.Key == pressure.taint && taint.Effect == corev1.TaintEffectNoSchedule {
+				isPressure = true
+				break
+			}
+		}
+		if !isPressure {
+			taints = append(taints, taint)
+			continue
+		}
+		if !want[taint.Key] {
+			changed = true
+			continue
+		}
+		delete(want, taint.Key)
+		taints = append(taints, taint)
+	}
+	for _, pressure := range pressures {
+		if !want[pressure.taint] {
+			continue
+		}
+		changed = true
+		taints = append(taints, corev1.Taint{
+			Key:    pressure.taint,
+			Effect: corev1.TaintEffectNoSchedule,
+		})
+	}
+	return taints, changed
+}
+
+// evictPodsUnderPressure evicts one pod at a time from the node while it is under pressure
+func (c *NodeController) evictPodsUnderPressure(ctx context.Context, nodeName string) {
+	logger := log.FromContext(ctx)
+	logger = logger.With(
+		"node", nodeName,
+	)
+
+	for {
+		node, ok := c.nodeCacheGetter.Get(nodeName)
+		if ok {
+			pressures := nodeUnderPressures(node)
+			if len(pressures) != 0 {
+				err := c.evictPodUnderPressure(ctx, node, pressures[0])
+				if err != nil {
+					logger.Error("Failed to evict pod under pressure", err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.clock.After(pressureEvictionInterval):
+		}
+	}
+}
+
+// evictPodUnderPressure moves the first pod in the ranking of the kubelet to Failed with the reason Evicted
+func (c *NodeController) evictPodUnderPressure(ctx context.Context, node *corev1.Node, pressure nodePressure) error {
+	pods, err := c.listPodsOnNode(ctx, node.Name)
+	if err != nil {
+		return fmt.Errorf("list pods on node: %w", err)
+	}
+	victim := pressureEvictionVictim(pods, pressure.resource)
+	if victim == nil {
+		return nil
+	}
+
+	message := fmt.Sprintf("The node was low on resource: %s.", pressure.resource)
+	patch, err := json.Marshal(map[string]any{
+		"status": map[string]any{
+			"phase":   corev1.PodFailed,
+			"reason":  "Evicted",
+			"message": message,
+			"conditions": []corev1.PodCondition{
+				{
+					Type:               corev1.DisruptionTarget,
+					Status:             corev1.ConditionTrue,
+					Reason:             corev1.PodReasonTerminationByKubelet,
+					Message:            message,
+					LastTransitionTime: metav1.NewTime(c.clock.Now()),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.typedClient.CoreV1().Pods(victim.Namespace).Patch(ctx, victim.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	if err != nil {
+		return fmt.Errorf("evict pod %s: %w", log.KObj(victim), err)
+	}
+
+	logger := log.FromContext(ctx)
+	logger.Info("Evict pod under pressure",
+		"pod", log.KObj(victim),
+		"node", node.Name,
+		"condition", pressure.condition,
+	)
+	if c.recorder != nil {
+		ref := &corev1.ObjectReference{
+			Kind:      "Pod",
+			UID:       victim.UID,
+			Name:      victim.Name,
+			Namespace: victim.Namespace,
+		}
+		c.recorder.Event(ref, corev1.EventTypeWarning, "Evicted", message)
+	}
+	return nil
+}
+
+// pressureEvictionVictim returns the first pod to evict in the ranking of the kubelet:
+// the BestEffort pods, then the Burstable pods that may use more than their requests of the resource,
+// then the others, each by priority.
+// The critical pods are never evicted.
+func pressureEvictionVictim(pods []*corev1.Pod, resource corev1.ResourceName) *corev1.Pod {
+	candidates := make([]*corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil ||
+			pod.Status.Phase == corev1.PodSucceeded ||
+			pod.Status.Phase == corev1.PodFailed ||
+			isCriticalPod(pod) {
+			continue
+		}
+		candidates = append(candidates, pod)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ri, rj := pressureEvictionRank(candidates[i], resource), pressureEvictionRank(candidates[j], resource)
+		if ri != rj {
+			return ri < rj
+		}
+		pi, pj := podPriority(candidates[i]), podPriority(candidates[j])
+		if pi != pj {
+			return pi < pj
+		}
+		return log.KObj(candidates[i]).String() < log.KObj(candidates[j]).String()
+	})
+	return candidates[0]
+}
+
+// pressureEvictionRank returns the rank of the pod in the evictions, the lower is evicted first.
+// kwok does not simulate the usage of the pods,
+// so a Burstable pod is considered over its requests if any container may use more than it requests of the resource.
+func pressureEvictionRank(pod *corev1.Pod, resource corev1.ResourceName) int {
+	switch podQOSClass(pod) {
+	case corev1.PodQOSBestEffort:
+		return 0
+	case corev1.PodQOSBurstable:
+		for _, container := range pod.Spec.Containers {
+			limit, ok := container.Resources.Limits[resource]
+			if !ok || limit.Cmp(container.Resources.Requests[resource]) > 0 {
+				return 1
+			}
+		}
+	}
+	return 2
+}
+
+// podQOSClass returns the QoS class of the pod, it is computed if the status does not have it
+func podQOSClass(pod *corev1.Pod) corev1.PodQOSClass {
+	if pod.Status.QOSClass != "" {
+		return pod.Status.QOSClass
+	}
+
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	bestEffort := true
+	guaranteed := true
+	for _, container := range containers {
+		if len(container.Resources.Requests) != 0 || len(container.Resources.Limits) != 0 {
+			bestEffort = false
+		}
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			limit, ok := container.Resources.Limits[name]
+			if !ok {
+				guaranteed = false
+				continue
+			}
+			request, ok := container.Resources.Requests[name]
+			if ok && request.Cmp(limit) != 0 {
+				guaranteed = false
+			}
+		}
+	}
+	switch {
+	case bestEffort:
+		return corev1.PodQOSBestEffort
+	case guaranteed:
+		return corev1.PodQOSGuaranteed
+	}
+	return corev1.PodQOSBurstable
+}
+
+func podPriority(pod *corev1.Pod) int32 {
+	if pod.Spec.Priority == nil {
+		return 0
+	}
+	return *pod.Spec.Priority
+}
+
+func isCriticalPod(pod *corev1.Pod) bool {
+	return isMirrorPod(pod) || podPriority(pod) >= systemCriticalPriority
+}
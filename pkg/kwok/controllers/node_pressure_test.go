@@ -0,0 +1,303 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/kwok/pkg/utils/format"
+)
+
+func newPressurePod(name string, priority int32, requests, limits string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "node0",
+			Priority: format.Ptr(priority),
+			Containers: []corev1.Container{
+				{
+					Name: "main",
+				},
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+	resources := &pod.Spec.Containers[0].Resources
+	if requests != "" {
+		resources.Requests = corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(requests),
+			corev1.ResourceMemory: resource.MustParse(requests + "Gi"),
+		}
+	}
+	if limits != "" {
+		resources.Limits = corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(limits),
+			corev1.ResourceMemory: resource.MustParse(limits + "Gi"),
+		}
+	}
+	return pod
+}
+
+func TestPressureEvictionVictim(t *testing.T) {
+	tests := []struct {
+		name string
+		pods []*corev1.Pod
+		want string
+	}{
+		{
+			name: "best effort first",
+			pods: []*corev1.Pod{
+				newPressurePod("guaranteed", 0, "1", "1"),
+				newPressurePod("burstable", 0, "1", "2"),
+				newPressurePod("best-effort", 100, "", ""),
+			},
+			want: "best-effort",
+		},
+		{
+			name: "burstable over requests by priority",
+			pods: []*corev1.Pod{
+				newPressurePod("guaranteed", 0, "1", "1"),
+				newPressurePod("burstable-high", 100, "1", "2"),
+				newPressurePod("burstable-low", 10, "1", ""),
+			},
+			want: "burstable-low",
+		},
+		{
+			name: "guaranteed by priority",
+			pods: []*corev1.Pod{
+				newPressurePod("guaranteed-high", 100, "1", "1"),
+				newPressurePod("guaranteed-low", 10, "1", "1"),
+			},
+			want: "guaranteed-low",
+		},
+		{
+			name: "skip critical and terminated",
+			pods: []*corev1.Pod{
+				newPressurePod("critical", systemCriticalPriority, "", ""),
+				func() *corev1.Pod {
+					pod := newPressurePod("failed", 0, "", "")
+					pod.Status.Phase = corev1.PodFailed
+					return pod
+				}(),
+				newPressurePod("guaranteed", 0, "1", "1"),
+			},
+			want: "guaranteed",
+		},
+		{
+			name: "no victim",
+			pods: []*corev1.Pod{
+				newPressurePod("critical", systemCriticalPriority, "", ""),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pressureEvictionVictim(tt.pods, corev1.ResourceMemory)
+			name := ""
+			if got != nil {
+				name = got.Name
+			}
+			if name != tt.want {
+				t.Errorf("want victim %q, got %q", tt.want, name)
+			}
+		})
+	}
+}
+
+func TestNodeControllerPressureEviction(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node0",
+		},
+		Spec: corev1.NodeSpec{
+			Taints: []corev1.Taint{
+				{
+					Key:    "dedicated",
+					Effect: corev1.TaintEffectNoSchedule,
+				},
+			},
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{
+					Type:   corev1.NodeMemoryPressure,
+					Status: corev1.ConditionTrue,
+				},
+			},
+		},
+	}
+	clientset := fake.NewSimpleClientset(
+		node,
+		newPressurePod("guaranteed", 0, "1", "1"),
+		newPressurePod("best-effort", 0, "", ""),
+	)
+
+	clk := testingclock.NewFakeClock(time.Now())
+	recorder := record.NewFakeRecorder(10)
+	c := &NodeController{
+		clock:           clk,
+		typedClient:     clientset,
+		nodeCacheGetter: fakeNodeGetter{node},
+		recorder:        recorder,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	err := c.syncNodePressure(ctx, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Spec.Taints) != 2 || got.Spec.Taints[1].Key != corev1.TaintNodeMemoryPressure {
+		t.Errorf("want node tainted with %s, got %v", corev1.TaintNodeMemoryPressure, got.Spec.Taints)
+	}
+
+	wantEvent := "Warning Evicted The node was low on resource: memory."
+	for _, want := range []string{"best-effort", "guaranteed"} {
+		select {
+		case event := <-recorder.Events:
+			if event != wantEvent {
+				t.Errorf("want event %q, got %q", wantEvent, event)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout waiting for the eviction event")
+		}
+
+		pod, err := clientset.CoreV1().Pods("default").Get(ctx, want, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pod.Status.Phase != corev1.PodFailed || pod.Status.Reason != "Evicted" {
+			t.Errorf("want pod %s Failed with reason Evicted, got %s with reason %q", want, pod.Status.Phase, pod.Status.Reason)
+		}
+
+		for !clk.HasWaiters() {
+			time.Sleep(10 * time.Millisecond)
+		}
+		clk.Step(pressureEvictionInterval)
+	}
+
+	node = node.DeepCopy()
+	node.Spec.Taints = got.Spec.Taints
+	node.Status.Conditions[0].Status = corev1.ConditionFalse
+	err = c.syncNodePressure(ctx, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.pressureEvictions.Load(node.Name); ok {
+		t.Error("want evictions stopped")
+	}
+	got, err = clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Spec.Taints) != 1 {
+		t.Errorf("want pressure taint removed, got %v", got.Spec.Taints)
+	}
+}
+
+func TestNodeControllerPressureTaintsConflict(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "node0",
+			ResourceVersion: "1",
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{
+					Type:   corev1.NodeDiskPressure,
+					Status: corev1.ConditionTrue,
+				},
+			},
+		},
+	}
+	clientset := fake.NewSimpleClientset(node)
+
+	// The node is tainted by others before the first patch, so the first patch conflicts.
+	var resourceVersions []string
+	clientset.PrependReactor("patch", "nodes", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		var patch struct {
+			Metadata metav1.ObjectMeta `json:"metadata"`
+		}
+		err := json.Unmarshal(action.(clienttesting.PatchAction).GetPatch(), &patch)
+		if err != nil {
+			return true, nil, err
+		}
+		resourceVersions = append(resourceVersions, patch.Metadata.ResourceVersion)
+		if len(resourceVersions) != 1 {
+			return false, nil, nil
+		}
+
+		latest := node.DeepCopy()
+		latest.ResourceVersion = "2"
+		latest.Spec.Taints = []corev1.Taint{
+			{
+				Key:    "dedicated",
+				Effect: corev1.TaintEffectNoSchedule,
+			},
+		}
+		err = clientset.Tracker().Update(schema.GroupVersionResource{Version: "v1", Resource: "nodes"}, latest, "")
+		if err != nil {
+			return true, nil, err
+		}
+		return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "nodes"}, node.Name, nil)
+	})
+
+	c := &NodeController{
+		typedClient: clientset,
+	}
+	err := c.syncNodePressureTaints(context.Background(), node, nodeUnderPressures(node))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"1", "2"}; !reflect.DeepEqual(resourceVersions, want) {
+		t.Errorf("want patches with resource versions %v, got %v", want, resourceVersions)
+	}
+	got, err := clientset.CoreV1().Nodes().Get(context.Background(), node.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Spec.Taints) != 2 || got.Spec.Taints[0].Key != "dedicated" || got.Spec.Taints[1].Key != corev1.TaintNodeDiskPressure {
+		t.Errorf("want node tainted with dedicated and %s, got %v", corev1.TaintNodeDiskPressure, got.Spec.Taints)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/utils/gotpl"
+)
+
+// stageTemplateData is the data of the stage templates,
+// it is the resource with the attempt of the stage as the top-level "Attempt" field.
+type stageTemplateData struct {
+	resource interface{}
+	attempt  int64
+}
+
+// MarshalJSON implements json.Marshaler
+func (d stageTemplateData) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(d.resource)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]json.RawMessage
+	err = json.Unmarshal(data, &obj)
+	if err != nil {
+		return nil, err
+	}
+	obj["Attempt"], err = json.Marshal(d.attempt)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(obj)
+}
+
+// isResourceSubresource returns whether the patch of the subresource returns the resource itself,
+// e.g. the scale subresource returns an autoscaling/v1 Scale rather than the resource.
+func isResourceSubresource(subresource string) bool {
+	return subresource == "" || subresource == "status"
+}
+
+// stagePatchType returns the patch type of the stage patch, the default is merge patch.
+func stagePatchType(patch *internalversion.StagePatch) (types.PatchType, error) {
+	if patch.Type == nil {
+		return types.MergePatchType, nil
+	}
+	switch *patch.Type {
+	case internalversion.StagePatchTypeJSONPatch:
+		if patch.Root != "" {
+			return "", fmt.Errorf("root is not allowed for %s patch", *patch.Type)
+		}
+		return types.JSONPatchType, nil
+	case internalversion.StagePatchTypeMergePatch:
+		return types.MergePatchType, nil
+	case internalversion.StagePatchTypeStrategicMergePatch:
+		return types.StrategicMergePatchType, nil
+	}
+	return "", fmt.Errorf("unsupported patch type %q", *patch.Type)
+}
+
+// renderStagePatch renders the template of the patch with the resource.
+func renderStagePatch(renderer gotpl.Renderer, resource interface{}, patch *internalversion.StagePatch) (types.PatchType, []byte, error) {
+	patchType, err := stagePatchType(patch)
+	if err != nil {
+		return "", nil, err
+	}
+
+	patchData, err := renderer.ToJSON(patch.Template, resource)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if patch.Root != "" {
+		patchData, err = json.Marshal(map[string]json.RawMessage{
+			patch.Root: patchData,
+		})
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return patchType, patchData, nil
+}
+
+// applyStagePatch applies the patch to the original data.
+func applyStagePatch(original []byte, patchType types.PatchType, patchData []byte, patchMeta strategicpatch.LookupPatchMeta) ([]byte, error) {
+	switch patchType {
+	case types.JSONPatchType:
+		ops, err := jsonpatch.DecodePatch(patchData)
+		if err != nil {
+			return nil, err
+		}
+		return ops.Apply(original)
+	case types.StrategicMergePatchType:
+		if patchMeta == nil {
+			return nil, fmt.Errorf("strategic merge patch is not supported by the resource")
+		}
+		return strategicpatch.StrategicMergePatchUsingLookupPatchMeta(original, patchData, patchMeta)
+	default:
+		return jsonpatch.MergePatch(original, patchData)
+	}
+}
+
+// computeStagePatch renders the template of the patch with the resource and the attempt of the stage,
+// it returns nil data if the patch does not need to modify the resource.
+func computeStagePatch[T any](renderer gotpl.Renderer, resource T, attempt int64, patchMeta strategicpatch.LookupPatchMeta, patch *internalversion.StagePatch) (types.PatchType, []byte, error) {
+	patchType, patchData, err := renderStagePatch(renderer, stageTemplateData{resource: resource, attempt: attempt}, patch)
+	if err != nil {
+		return "", nil, err
+	}
+
+	original, err := json.Marshal(resource)
+	if err != nil {
+		return "", nil, err
+	}
+
+	sum, err := applyStagePatch(original, patchType, patchData, patchMeta)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Round-trip the result to drop the fields that are not part of the resource.
+	var dist T
+	err = json.Unmarshal(sum, &dist)
+	if err != nil {
+		return "", nil, err
+	}
+
+	distData, err := json.Marshal(dist)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if bytes.Equal(original, distData) {
+		return patchType, nil, nil
+	}
+
+	return patchType, patchData, nil
+}
+
+// computeSubresourceStagePatch renders the template of the patch with the resource and the attempt of the stage,
+// and applies it to the original subresource which is not the resource itself, e.g. the scale subresource,
+// it returns nil data if the patch does not need to modify the subresource.
+func computeSubresourceStagePatch(renderer gotpl.Renderer, resource interface{}, attempt int64, original []byte, patch *internalversion.StagePatch) (types.PatchType, []byte, error) {
+	patchType, patchData, err := renderStagePatch(renderer, stageTemplateData{resource: resource, attempt: attempt}, patch)
+	if err != nil {
+		return "", nil, err
+	}
+	if patchType == types.StrategicMergePatchType {
+		return "", nil, fmt.Errorf("strategic merge patch is not supported by the %s subresource", patch.Subresource)
+	}
+
+	sum, err := applyStagePatch(original, patchType, patchData, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Compare the decoded objects, the order of the fields is not kept by the patch.
+	var originalObj, sumObj interface{}
+	err = json.Unmarshal(original, &originalObj)
+	if err != nil {
+		return "", nil, err
+	}
+	err = json.Unmarshal(sum, &sumObj)
+	if err != nil {
+		return "", nil, err
+	}
+	if reflect.DeepEqual(originalObj, sumObj) {
+		return patchType, nil, nil
+	}
+
+	return patchType, patchData, nil
+}
+
+// validateStagePatch validates the patch of the stage on the resource ref,
+// the pods and the nodes can only be patched by themselves or their status.
+func validateStagePatch(ref internalversion.StageResourceRef, patch *internalversion.StagePatch) error {
+	patchType, err := stagePatchType(patch)
+	if err != nil {
+		return err
+	}
+	if isResourceSubresource(patch.Subresource) {
+		return nil
+	}
+	if ref == podRef || ref == nodeRef {
+		return fmt.Errorf("subresource %q is not supported for %s, only status is supported", patch.Subresource, ref.Kind)
+	}
+	if patchType == types.StrategicMergePatchType {
+		return fmt.Errorf("strategic merge patch is not supported by the %s subresource", patch.Subresource)
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/utils/format"
+	"sigs.k8s.io/kwok/pkg/utils/gotpl"
+)
+
+func Test_computeStagePatch(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node0",
+			Labels: map[string]string{
+				"app": "test",
+			},
+		},
+		Spec: corev1.NodeSpec{
+			Taints: []corev1.Taint{
+				{
+					Key:    "a",
+					Effect: corev1.TaintEffectNoSchedule,
+				},
+			},
+		},
+	}
+	patchMeta, err := strategicpatch.NewPatchMetaFromStruct(corev1.Node{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	renderer := gotpl.NewRenderer(defaultFuncMap)
+
+	tests := []struct {
+		name          string
+		patch         internalversion.StagePatch
+		wantPatchType types.PatchType
+		want          string
+		wantErr       bool
+	}{
+		{
+			name: "merge with root",
+			patch: internalversion.StagePatch{
+				Root:     "metadata",
+				Template: `labels: {"foo": "bar"}`,
+			},
+			wantPatchType: types.MergePatchType,
+			want:          `{"metadata":{"labels":{"foo":"bar"}}}`,
+		},
+		{
+			name: "merge without change",
+			patch: internalversion.StagePatch{
+				Root:     "metadata",
+				Template: `labels: {"app": "test"}`,
+			},
+			wantPatchType: types.MergePatchType,
+		},
+		{
+			name: "strategic merge",
+			patch: internalversion.StagePatch{
+				Type: format.Ptr(internalversion.StagePatchTypeStrategicMergePatch),
+				Root: "spec",
+				Template: `
+taints:
+- key: b
+  effect: NoExecute
+`,
+			},
+			wantPatchType: types.StrategicMergePatchType,
+			want:          `{"spec":{"taints":[{"effect":"NoExecute","key":"b"}]}}`,
+		},
+		{
+			name: "strategic merge without change",
+			patch: internalversion.StagePatch{
+				Type: format.Ptr(internalversion.StagePatchTypeStrategicMergePatch),
+				Root: "spec",
+				Template: `
+taints:
+- key: a
+  effect: NoSchedule
+`,
+			},
+			wantPatchType: types.StrategicMergePatchType,
+		},
+		{
+			name: "json",
+			patch: internalversion.StagePatch{
+				Type:     format.Ptr(internalversion.StagePatchTypeJSONPatch),
+				Template: `[{"op": "add", "path": "/spec/unschedulable", "value": true}]`,
+			},
+			wantPatchType: types.JSONPatchType,
+			want:          `[{"op":"add","path":"/spec/unschedulable","value":true}]`,
+		},
+		{
+			name: "json with root",
+			patch: internalversion.StagePatch{
+				Type:     format.Ptr(internalversion.StagePatchTypeJSONPatch),
+				Root:     "spec",
+				Template: `[]`,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported type",
+			patch: internalversion.StagePatch{
+				Type:     format.Ptr(internalversion.StagePatchType("unknown")),
+				Template: `{}`,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPatchType, got, err := computeStagePatch(renderer, node, 1, patchMeta, &tt.patch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("computeStagePatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if gotPatchType != tt.wantPatchType {
+				t.Errorf("computeStagePatch() gotPatchType = %v, want %v", gotPatchType, tt.wantPatchType)
+			}
+			if string(got) != tt.want {
+				t.Errorf("computeStagePatch() got = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_computeSubresourceStagePatch(t *testing.T) {
+	resource := map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Worker",
+		"metadata": map[string]interface{}{
+			"name": "worker0",
+		},
+		"spec": map[string]interface{}{
+			"replicas": 3,
+			"template": map[string]interface{}{},
+		},
+	}
+	scale := []byte(`{"kind":"Scale","apiVersion":"autoscaling/v1","metadata":{"name":"worker0"},"spec":{"replicas":1},"status":{"replicas":1}}`)
+	renderer := gotpl.NewRenderer(defaultFuncMap)
+
+	tests := []struct {
+		name          string
+		patch         internalversion.StagePatch
+		wantPatchType types.PatchType
+		want          string
+		wantErr       bool
+	}{
+		{
+			name: "merge",
+			patch: internalversion.StagePatch{
+				Subresource: "scale",
+				Root:        "spec",
+				Template:    `replicas: {{ .spec.replicas }}`,
+			},
+			wantPatchType: types.MergePatchType,
+			want:          `{"spec":{"replicas":3}}`,
+		},
+		{
+			name: "merge without change",
+			patch: internalversion.StagePatch{
+				Subresource: "scale",
+				Root:        "spec",
+				Template:    `replicas: 1`,
+			},
+			wantPatchType: types.MergePatchType,
+		},
+		{
+			name: "json",
+			patch: internalversion.StagePatch{
+				Subresource: "scale",
+				Type:        format.Ptr(internalversion.StagePatchTypeJSONPatch),
+				Template:    `[{"op": "replace", "path": "/spec/replicas", "value": {{ .spec.replicas }}}]`,
+			},
+			wantPatchType: types.JSONPatchType,
+			want:          `[{"op":"replace","path":"/spec/replicas","value":3}]`,
+		},
+		{
+			name: "json without the path in the subresource",
+			patch: internalversion.StagePatch{
+				Subresource: "scale",
+				Type:        format.Ptr(internalversion.StagePatchTypeJSONPatch),
+				Template:    `[{"op": "replace", "path": "/spec/template/spec", "value": {}}]`,
+			},
+			wantErr: true,
+		},
+		{
+			name: "strategic merge",
+			patch: internalversion.StagePatch{
+				Subresource: "scale",
+				Type:        format.Ptr(internalversion.StagePatchTypeStrategicMergePatch),
+				Root:        "spec",
+				Template:    `replicas: 3`,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPatchType, got, err := computeSubresourceStagePatch(renderer, resource, 1, scale, &tt.patch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("computeSubresourceStagePatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if gotPatchType != tt.wantPatchType {
+				t.Errorf("computeSubresourceStagePatch() gotPatchType = %v, want %v", gotPatchType, tt.wantPatchType)
+			}
+			if string(got) != tt.want {
+				t.Errorf("computeSubresourceStagePatch() got = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateStagePatch(t *testing.T) {
+	crdRef := internalversion.StageResourceRef{
+		APIGroup: "example.com/v1",
+		Kind:     "Worker",
+	}
+	tests := []struct {
+		name    string
+		ref     internalversion.StageResourceRef
+		patch   internalversion.StagePatch
+		wantErr bool
+	}{
+		{
+			name: "pod status",
+			ref:  podRef,
+			patch: internalversion.StagePatch{
+				Subresource: "status",
+			},
+		},
+		{
+			name: "pod other subresource",
+			ref:  podRef,
+			patch: internalversion.StagePatch{
+				Subresource: "ephemeralcontainers",
+			},
+			wantErr: true,
+		},
+		{
+			name: "node other subresource",
+			ref:  nodeRef,
+			patch: internalversion.StagePatch{
+				Subresource: "proxy",
+			},
+			wantErr: true,
+		},
+		{
+			name: "scale",
+			ref:  crdRef,
+			patch: internalversion.StagePatch{
+				Subresource: "scale",
+			},
+		},
+		{
+			name: "scale with strategic merge",
+			ref:  crdRef,
+			patch: internalversion.StagePatch{
+				Subresource: "scale",
+				Type:        format.Ptr(internalversion.StagePatchTypeStrategicMergePatch),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStagePatch(tt.ref, &tt.patch)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateStagePatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
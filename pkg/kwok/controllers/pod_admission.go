@@ -0,0 +1,369 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/kwok/pkg/log"
+)
+
+const (
+	// admissionReasonNodeAffinity is the reason of the kubelet for the pods whose node affinity does not match the node
+	admissionReasonNodeAffinity = "NodeAffinity"
+	// admissionMessageNodeAffinity is the message of the kubelet for the pods whose node affinity does not match the node
+	admissionMessageNodeAffinity = "Predicate NodeAffinity failed"
+)
+
+// podAdmission keeps the running totals of the requests of the pods admitted on each node,
+// and rejects the pods that do not fit the node like the kubelet.
+type podAdmission struct {
+	mut   sync.Mutex
+	nodes map[string]*nodeAdmission
+	pods  map[types.UID]*admittedPod
+}
+
+// nodeAdmission is the running totals of the pods admitted on a node
+type nodeAdmission struct {
+	requested corev1.ResourceList
+	pods      int64
+}
+
+// admittedPod is the pod admitted on a node
+type admittedPod struct {
+	nodeName string
+	requests corev1.ResourceList
+}
+
+// newPodAdmission creates a new podAdmission
+func newPodAdmission() *podAdmission {
+	return &podAdmission{
+		nodes: map[string]*nodeAdmission{},
+		pods:  map[types.UID]*admittedPod{},
+	}
+}
+
+// Admit adds the pod to the running totals of the node, or returns the reason and the message of the kubelet if the pod does not fit the node.
+// The pods that have already left the Pending phase are admitted without the checks,
+// they were admitted before, e.g. by a previous kwok or by a real kubelet.
+func (a *podAdmission) Admit(pod *corev1.Pod, node *corev1.Node) (reason, message string) {
+	key := pod.UID
+
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	if _, ok := a.pods[key]; ok {
+		return "", ""
+	}
+
+	totals, ok := a.nodes[node.Name]
+	if !ok {
+		totals = &nodeAdmission{
+			requested: corev1.ResourceList{},
+		}
+		a.nodes[node.Name] = totals
+	}
+
+	requests := podRequests(pod)
+	if pod.Status.Phase == "" || pod.Status.Phase == corev1.PodPending {
+		reason, message = totals.fit(requests, node.Status.Allocatable)
+		if reason == "" && !podMatchesNode(pod, node) {
+			reason, message = admissionReasonNodeAffinity, admissionMessageNodeAffinity
+		}
+		if reason != "" {
+			return reason, message
+		}
+	}
+
+	for name, quantity := range requests {
+		total := totals.requested[name]
+		total.Add(quantity)
+		totals.requested[name] = total
+	}
+	totals.pods++
+	a.pods[key] = &admittedPod{
+		nodeName: node.Name,
+		requests: requests,
+	}
+	return "", ""
+}
+
+// Release removes the pod from the running totals of its node,
+// the pods are tracked by the UID so that a recreated pod with the same name is not released.
+func (a *podAdmission) Release(pod *corev1.Pod) {
+	key := pod.UID
+
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	admitted, ok := a.pods[key]
+	if !ok {
+		return
+	}
+	delete(a.pods, key)
+
+	totals, ok := a.nodes[admitted.nodeName]
+	if !ok {
+		return
+	}
+	for name, quantity := range admitted.requests {
+		total := totals.requested[name]
+		total.Sub(quantity)
+		totals.requested[name] = total
+	}
+	totals.pods--
+	if totals.pods <= 0 {
+		delete(a.nodes, admitted.nodeName)
+	}
+}
+
+// fit checks the requests against the allocatable of the node in the order of the kubelet,
+// the resources that the node does not report are not checked.
+func (n *nodeAdmission) fit(requests, allocatable corev1.ResourceList) (reason, message string) {
+	if capacity, ok := allocatable[corev1.ResourcePods]; ok && n.pods+1 > capacity.Value() {
+		return insufficientResource(corev1.ResourcePods, 1, n.pods, capacity.Value())
+	}
+
+	names := make([]corev1.ResourceName, 0, len(requests))
+	for name := range requests {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return resourceOrder(names[i]) < resourceOrder(names[j]) ||
+			resourceOrder(names[i]) == resourceOrder(names[j]) && names[i] < names[j]
+	})
+
+	for _, name := range names {
+		capacity, ok := allocatable[name]
+		if !ok {
+			continue
+		}
+		requested := requests[name]
+		used := n.requested[name]
+		if name == corev1.ResourceCPU {
+			if used.MilliValue()+requested.MilliValue() > capacity.MilliValue() {
+				return insufficientResource(name, requested.MilliValue(), used.MilliValue(), capacity.MilliValue())
+			}
+			continue
+		}
+		if used.Value()+requested.Value() > capacity.Value() {
+			return insufficientResource(name, requested.Value(), used.Value(), capacity.Value())
+		}
+	}
+	return "", ""
+}
+
+// resourceOrder returns the order of the resource in the checks of the kubelet
+func resourceOrder(name corev1.ResourceName) int {
+	switch name {
+	case corev1.ResourceCPU:
+		return 0
+	case corev1.ResourceMemory:
+		return 1
+	case corev1.ResourceEphemeralStorage:
+		return 2
+	}
+	return 3
+}
+
+// insufficientResource returns the reason and the message of the kubelet for an insufficient resource
+func insufficientResource(name corev1.ResourceName, requested, used, capacity int64) (reason, message string) {
+	return fmt.Sprintf("OutOf%s", name),
+		fmt.Sprintf("Node didn't have enough resource: %s, requested: %d, used: %d, capacity: %d", name, requested, used, capacity)
+}
+
+// podRequests returns the effective requests of the pod,
+// the init containers run one by one next to the sidecars started before them, and the pod overhead is added.
+func podRequests(pod *corev1.Pod) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		addResourceList(requests, container.Resources.Requests)
+	}
+
+	sidecars := corev1.ResourceList{}
+	initRequests := corev1.ResourceList{}
+	for _, container := range pod.Spec.InitContainers {
+		if isSidecarContainer(&container) {
+			addResourceList(requests, container.Resources.Requests)
+			addResourceList(sidecars, container.Resources.Requests)
+			continue
+		}
+		running := corev1.ResourceList{}
+		addResourceList(running, sidecars)
+		addResourceList(running, container.Resources.Requests)
+		maxResourceList(initRequests, running)
+	}
+	maxResourceList(requests, initRequests)
+
+	addResourceList(requests, pod.Spec.Overhead)
+	return requests
+}
+
+func addResourceList(list, add corev1.ResourceList) {
+	for name, quantity := range add {
+		total, ok := list[name]
+		if !ok {
+			list[name] = quantity.DeepCopy()
+			continue
+		}
+		total.Add(quantity)
+		list[name] = total
+	}
+}
+
+func maxResourceList(list, other corev1.ResourceList) {
+	for name, quantity := range other {
+		current, ok := list[name]
+		if !ok || quantity.Cmp(current) > 0 {
+			list[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+// podMatchesNode returns whether the node selector and the required node affinity of the pod match the node
+func podMatchesNode(pod *corev1.Pod, node *corev1.Node) bool {
+	if len(pod.Spec.NodeSelector) != 0 &&
+		!labels.SelectorFromSet(pod.Spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+
+	affinity := pod.Spec.Affinity
+	if affinity == nil ||
+		affinity.NodeAffinity == nil ||
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return true
+	}
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		if nodeSelectorTermMatches(term, node) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeSelectorTermMatches returns whether all the requirements of the term match the node, an empty term matches no node.
+func nodeSelectorTermMatches(term corev1.NodeSelectorTerm, node *corev1.Node) bool {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+	for _, expr := range term.MatchExpressions {
+		if !nodeSelectorRequirementMatches(expr, labels.Set(node.Labels)) {
+			return false
+		}
+	}
+	for _, expr := range term.MatchFields {
+		// metadata.name is the only field supported by the node affinity
+		if expr.Key != "metadata.name" ||
+			!nodeSelectorRequirementMatches(expr, labels.Set{expr.Key: node.Name}) {
+			return false
+		}
+	}
+	return true
+}
+
+func nodeSelectorRequirementMatches(expr corev1.NodeSelectorRequirement, set labels.Set) bool {
+	var op selection.Operator
+	switch expr.Operator {
+	case corev1.NodeSelectorOpIn:
+		op = selection.In
+	case corev1.NodeSelectorOpNotIn:
+		op = selection.NotIn
+	case corev1.NodeSelectorOpExists:
+		op = selection.Exists
+	case corev1.NodeSelectorOpDoesNotExist:
+		op = selection.DoesNotExist
+	case corev1.NodeSelectorOpGt:
+		op = selection.GreaterThan
+	case corev1.NodeSelectorOpLt:
+		op = selection.LessThan
+	default:
+		return false
+	}
+	requirement, err := labels.NewRequirement(expr.Key, op, expr.Values)
+	if err != nil {
+		return false
+	}
+	return requirement.Matches(set)
+}
+
+// admit admits the pod on its node, the pods that do not fit the node are moved to Failed like the kubelet.
+func (c *PodController) admit(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		c.admission.Release(pod)
+		return true, nil
+	}
+	if pod.DeletionTimestamp != nil || c.nodeCacheGetter == nil {
+		return true, nil
+	}
+	node, ok := c.nodeCacheGetter.Get(pod.Spec.NodeName)
+	if !ok {
+		return true, nil
+	}
+
+	reason, message := c.admission.Admit(pod, node)
+	if reason == "" {
+		return true, nil
+	}
+
+	logger := log.FromContext(ctx)
+	logger.Info("Reject pod",
+		"pod", log.KObj(pod),
+		"node", pod.Spec.NodeName,
+		"reason", reason,
+		"message", message,
+	)
+
+	if c.recorder != nil {
+		ref := &corev1.ObjectReference{
+			Kind:      "Pod",
+			UID:       pod.UID,
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		}
+		c.recorder.Event(ref, corev1.EventTypeWarning, reason, message)
+	}
+
+	patch, err := rejectPodPatch(reason, message)
+	if err != nil {
+		return false, err
+	}
+	_, err = c.patchResource(ctx, pod, types.MergePatchType, patch, "status")
+	if err != nil {
+		return false, fmt.Errorf("reject pod: %w", err)
+	}
+	return false, nil
+}
+
+// rejectPodPatch returns the merge patch of the status of the pod rejected by the kubelet
+func rejectPodPatch(reason, message string) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"status": map[string]any{
+			"phase":   corev1.PodFailed,
+			"reason":  reason,
+			"message": "Pod was rejected: " + message,
+		},
+	})
+}
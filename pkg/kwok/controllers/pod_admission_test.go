@@ -0,0 +1,366 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"sigs.k8s.io/kwok/pkg/utils/format"
+	"sigs.k8s.io/kwok/pkg/utils/informer"
+)
+
+func TestPodAdmission(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node0",
+			Labels: map[string]string{
+				"zone": "a",
+			},
+		},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("2"),
+				corev1.ResourceMemory: resource.MustParse("4Gi"),
+				corev1.ResourcePods:   resource.MustParse("3"),
+			},
+		},
+	}
+	newPod := func(name string, cpu, memory string, modify func(pod *corev1.Pod)) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				UID:       types.UID(name),
+			},
+			Spec: corev1.PodSpec{
+				NodeName: node.Name,
+				Containers: []corev1.Container{
+					{
+						Name: "main",
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU:    resource.MustParse(cpu),
+								corev1.ResourceMemory: resource.MustParse(memory),
+							},
+						},
+					},
+				},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+			},
+		}
+		if modify != nil {
+			modify(pod)
+		}
+		return pod
+	}
+
+	type step struct {
+		pod         *corev1.Pod
+		release     bool
+		wantReason  string
+		wantMessage string
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "out of cpu",
+			steps: []step{
+				{pod: newPod("pod0", "1500m", "1Gi", nil)},
+				{
+					pod:         newPod("pod1", "1", "1Gi", nil),
+					wantReason:  "OutOfcpu",
+					wantMessage: "Node didn't have enough resource: cpu, requested: 1000, used: 1500, capacity: 2000",
+				},
+				{pod: newPod("pod0", "1500m", "1Gi", nil), release: true},
+				{pod: newPod("pod1", "1", "1Gi", nil)},
+			},
+		},
+		{
+			name: "recreated pod with the same name",
+			steps: []step{
+				{pod: newPod("pod0", "1500m", "1Gi", nil)},
+				{pod: newPod("pod0", "1500m", "1Gi", func(pod *corev1.Pod) {
+					pod.UID = "pod0-recreated"
+				}), release: true},
+				{
+					pod:         newPod("pod1", "1", "1Gi", nil),
+					wantReason:  "OutOfcpu",
+					wantMessage: "Node didn't have enough resource: cpu, requested: 1000, used: 1500, capacity: 2000",
+				},
+			},
+		},
+		{
+			name: "out of memory with init containers",
+			steps: []step{
+				{pod: newPod("pod0", "100m", "1Gi", nil)},
+				{
+					pod: newPod("pod1", "100m", "1Gi", func(pod *corev1.Pod) {
+						pod.Spec.InitContainers = []corev1.Container{
+							{
+								Name:          "sidecar",
+								RestartPolicy: format.Ptr(corev1.ContainerRestartPolicyAlways),
+								Resources: corev1.ResourceRequirements{
+									Requests: corev1.ResourceList{
+										corev1.ResourceMemory: resource.MustParse("1Gi"),
+									},
+								},
+							},
+							{
+								Name: "init",
+								Resources: corev1.ResourceRequirements{
+									Requests: corev1.ResourceList{
+										corev1.ResourceMemory: resource.MustParse("2560Mi"),
+									},
+								},
+							},
+						}
+					}),
+					wantReason:  "OutOfmemory",
+					wantMessage: "Node didn't have enough resource: memory, requested: 3758096384, used: 1073741824, capacity: 4294967296",
+				},
+			},
+		},
+		{
+			name: "out of pods",
+			steps: []step{
+				{pod: newPod("pod0", "0", "0", nil)},
+				{pod: newPod("pod1", "0", "0", nil)},
+				{pod: newPod("pod2", "0", "0", nil)},
+				{
+					pod:         newPod("pod3", "0", "0", nil),
+					wantReason:  "OutOfpods",
+					wantMessage: "Node didn't have enough resource: pods, requested: 1, used: 3, capacity: 3",
+				},
+			},
+		},
+		{
+			name: "running pods are not checked",
+			steps: []step{
+				{pod: newPod("pod0", "2", "1Gi", nil)},
+				{pod: newPod("pod1", "2", "1Gi", func(pod *corev1.Pod) {
+					pod.Status.Phase = corev1.PodRunning
+				})},
+				{
+					pod:         newPod("pod2", "1m", "1Gi", nil),
+					wantReason:  "OutOfcpu",
+					wantMessage: "Node didn't have enough resource: cpu, requested: 1, used: 4000, capacity: 2000",
+				},
+			},
+		},
+		{
+			name: "node affinity",
+			steps: []step{
+				{pod: newPod("pod0", "0", "0", func(pod *corev1.Pod) {
+					pod.Spec.NodeSelector = map[string]string{"zone": "a"}
+				})},
+				{
+					pod: newPod("pod1", "0", "0", func(pod *corev1.Pod) {
+						pod.Spec.NodeSelector = map[string]string{"zone": "b"}
+					}),
+					wantReason:  "NodeAffinity",
+					wantMessage: "Predicate NodeAffinity failed",
+				},
+				{
+					pod: newPod("pod2", "0", "0", func(pod *corev1.Pod) {
+						pod.Spec.Affinity = &corev1.Affinity{
+							NodeAffinity: &corev1.NodeAffinity{
+								RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+									NodeSelectorTerms: []corev1.NodeSelectorTerm{
+										{
+											MatchFields: []corev1.NodeSelectorRequirement{
+												{
+													Key:      "metadata.name",
+													Operator: corev1.NodeSelectorOpNotIn,
+													Values:   []string{"node0"},
+												},
+											},
+										},
+									},
+								},
+							},
+						}
+					}),
+					wantReason:  "NodeAffinity",
+					wantMessage: "Predicate NodeAffinity failed",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admission := newPodAdmission()
+			for _, step := range tt.steps {
+				if step.release {
+					admission.Release(step.pod)
+					continue
+				}
+				reason, message := admission.Admit(step.pod, node)
+				if reason != step.wantReason {
+					t.Errorf("%s: want reason %q, got %q", step.pod.Name, step.wantReason, reason)
+				}
+				if message != step.wantMessage {
+					t.Errorf("%s: want message %q, got %q", step.pod.Name, step.wantMessage, message)
+				}
+			}
+		})
+	}
+}
+
+func TestPodControllerAdmit(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node0",
+		},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourcePods: resource.MustParse("0"),
+			},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod0",
+			Namespace: "default",
+		},
+		Spec: corev1.PodSpec{
+			NodeName: node.Name,
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodPending,
+		},
+	}
+	clientset := fake.NewSimpleClientset(pod)
+	recorder := record.NewFakeRecorder(1)
+	c := &PodController{
+		typedClient:     clientset,
+		nodeCacheGetter: fakeNodeGetter{node},
+		recorder:        recorder,
+		admission:       newPodAdmission(),
+	}
+
+	admitted, err := c.admit(context.Background(), pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admitted {
+		t.Fatal("want pod to be rejected")
+	}
+
+	got, err := clientset.CoreV1().Pods(pod.Namespace).Get(context.Background(), pod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.Phase != corev1.PodFailed || got.Status.Reason != "OutOfpods" {
+		t.Errorf("want pod Failed with reason OutOfpods, got %s with reason %q", got.Status.Phase, got.Status.Reason)
+	}
+	wantMessage := "Pod was rejected: Node didn't have enough resource: pods, requested: 1, used: 0, capacity: 0"
+	if got.Status.Message != wantMessage {
+		t.Errorf("want message %q, got %q", wantMessage, got.Status.Message)
+	}
+
+	wantEvent := "Warning OutOfpods Node didn't have enough resource: pods, requested: 1, used: 0, capacity: 0"
+	if event := <-recorder.Events; event != wantEvent {
+		t.Errorf("want event %q, got %q", wantEvent, event)
+	}
+}
+
+func TestPodControllerDeletedUnmanaged(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node0",
+		},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourcePods: resource.MustParse("1"),
+			},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod0",
+			Namespace: "default",
+			UID:       "uid0",
+		},
+		Spec: corev1.PodSpec{
+			NodeName: node.Name,
+		},
+	}
+	c := &PodController{
+		admission: newPodAdmission(),
+		nodeGetFunc: func(nodeName string) (*NodeInfo, bool) {
+			// The node is already gone
+			return nil, false
+		},
+	}
+	if reason, _ := c.admission.Admit(pod, node); reason != "" {
+		t.Fatalf("want pod admitted, got %s", reason)
+	}
+
+	proberCtx, stopProber := context.WithCancel(context.Background())
+	c.probers.Store(pod.UID, stopProber)
+	terminatorCtx, stopTerminator := context.WithCancel(context.Background())
+	c.terminators.Store(pod.UID, stopTerminator)
+
+	events := make(chan informer.Event[*corev1.Pod], 1)
+	events <- informer.Event[*corev1.Pod]{Type: informer.Deleted, Object: pod}
+	close(events)
+	c.watchResources(context.Background(), events)
+
+	other := pod.DeepCopy()
+	other.Name = "pod1"
+	other.UID = "uid1"
+	if reason, _ := c.admission.Admit(other, node); reason != "" {
+		t.Errorf("want the deleted pod released from the node, got %s", reason)
+	}
+	if proberCtx.Err() == nil {
+		t.Error("want the prober of the deleted pod stopped")
+	}
+	if terminatorCtx.Err() == nil {
+		t.Error("want the terminator of the deleted pod stopped")
+	}
+}
+
+type fakeNodeGetter []*corev1.Node
+
+func (g fakeNodeGetter) Get(name string) (*corev1.Node, bool) {
+	for _, node := range g {
+		if node.Name == name {
+			return node, true
+		}
+	}
+	return nil, false
+}
+
+func (g fakeNodeGetter) GetWithNamespace(name, _ string) (*corev1.Node, bool) {
+	return g.Get(name)
+}
+
+func (g fakeNodeGetter) List() []*corev1.Node {
+	return g
+}
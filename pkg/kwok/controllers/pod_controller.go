@@ -20,14 +20,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/clock"
@@ -68,8 +71,21 @@ type PodController struct {
 	delayQueue                            queue.DelayingQueue[resourceStageJob[*corev1.Pod]]
 	delayQueueMapping                     maps.SyncMap[string, resourceStageJob[*corev1.Pod]]
 	recorder                              record.EventRecorder
+	events                                *stageEventRecorder
 	readOnlyFunc                          func(nodeName string) bool
 	enableMetrics                         bool
+	patchMeta                             strategicpatch.LookupPatchMeta
+	onStagePlayedFunc                     func(stageName string, err error)
+	rands                                 *resourceRands
+	attempts                              stageAttempts
+	creator                               *stageResourceCreator
+	webhook                               stageWebhookClient
+	history                               *StageHistory
+	historyAnnotation                     bool
+	admission                             *podAdmission
+	probeSimulation                       bool
+	probers                               maps.SyncMap[types.UID, context.CancelFunc]
+	terminators                           maps.SyncMap[types.UID, context.CancelFunc]
 }
 
 // PodInfo is the collection of necessary pod information
@@ -81,6 +97,8 @@ type PodControllerConfig struct {
 	Clock                                 clock.Clock
 	EnableCNI                             bool
 	TypedClient                           kubernetes.Interface
+	DynamicClient                         dynamic.Interface
+	RESTMapper                            meta.RESTMapper
 	NodeCacheGetter                       informer.Getter[*corev1.Node]
 	DisregardStatusWithAnnotationSelector string
 	DisregardStatusWithLabelSelector      string
@@ -92,8 +110,15 @@ type PodControllerConfig struct {
 	PlayStageParallelism                  uint
 	FuncMap                               gotpl.FuncMap
 	Recorder                              record.EventRecorder
+	EventRecorderFor                      func(correlator internalversion.StageEventCorrelator) record.EventRecorder
 	ReadOnlyFunc                          func(nodeName string) bool
 	EnableMetrics                         bool
+	OnStagePlayedFunc                     func(stageName string, err error)
+	RandomSeed                            int64
+	StageHistory                          *StageHistory
+	EnableStageHistoryAnnotation          bool
+	EnablePodAdmission                    bool
+	EnableProbeSimulation                 bool
 }
 
 // NewPodController creates a new fake pods controller
@@ -131,9 +156,22 @@ func NewPodController(conf PodControllerConfig) (*PodController, error) {
 		playStageParallelism:                  conf.PlayStageParallelism,
 		preprocessChan:                        make(chan *corev1.Pod),
 		recorder:                              conf.Recorder,
+		onStagePlayedFunc:                     conf.OnStagePlayedFunc,
+		rands:                                 newResourceRands(conf.RandomSeed),
+		history:                               conf.StageHistory,
+		historyAnnotation:                     conf.EnableStageHistoryAnnotation,
 		readOnlyFunc:                          conf.ReadOnlyFunc,
 		enableMetrics:                         conf.EnableMetrics,
+		probeSimulation:                       conf.EnableProbeSimulation,
 	}
+	if conf.EnablePodAdmission {
+		c.admission = newPodAdmission()
+	}
+	c.patchMeta, err = strategicpatch.NewPatchMetaFromStruct(corev1.Pod{})
+	if err != nil {
+		return nil, err
+	}
+
 	funcMap := maps.Merge(gotpl.FuncMap{
 		"NodeIP":     c.funcNodeIP,
 		"PodIP":      c.funcPodIP,
@@ -141,6 +179,8 @@ func NewPodController(conf PodControllerConfig) (*PodController, error) {
 		"PodIPWith":  c.funcPodIPWith,
 	}, conf.FuncMap)
 	c.renderer = gotpl.NewRenderer(funcMap)
+	c.creator = newStageResourceCreator(conf.DynamicClient, conf.RESTMapper, c.renderer)
+	c.events = newStageEventRecorder(conf.Recorder, conf.EventRecorderFor, c.renderer)
 	return c, nil
 }
 
@@ -172,6 +212,7 @@ func (c *PodController) finalizersModify(ctx context.Context, pod *corev1.Pod, f
 		"node", pod.Spec.NodeName,
 	)
 
+	addPatchSize(ctx, data)
 	result, err := c.typedClient.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.JSONPatchType, data, metav1.PatchOptions{})
 	if err != nil {
 		if apierrors.IsNotFound(err) {
@@ -233,8 +274,46 @@ func (c *PodController) preprocessWorker(ctx context.Context) {
 func (c *PodController) preprocess(ctx context.Context, pod *corev1.Pod) error {
 	key := log.KObj(pod).String()
 
-	resourceJob, ok := c.delayQueueMapping.Load(key)
-	if ok && resourceJob.Resource.ResourceVersion == pod.ResourceVersion {
+	lifecycle := c.lifecycle.Get()
+	groups := lifecycle.Groups()
+	for _, group := range groups {
+		resourceJob, ok := c.delayQueueMapping.Load(stageJobKey(key, group))
+		if ok && resourceJob.Resource.ResourceVersion == pod.ResourceVersion {
+			return nil
+		}
+		if ok && c.historyAnnotation && onlyStageHistoryChanged(resourceJob.Resource, pod) {
+			return nil
+		}
+	}
+
+	// The stages are matched again with the new version of the pod,
+	// so the delayed jobs of the previous version are canceled,
+	// the job is scheduled again at its due time if the same stage is matched.
+	taken := takeStageJobs(c.delayQueue, &c.delayQueueMapping, key, groups)
+
+	if c.admission != nil {
+		admitted, err := c.admit(ctx, pod)
+		if err != nil {
+			return err
+		}
+		if !admitted {
+			return nil
+		}
+	}
+
+	if c.probeSimulation {
+		err := c.syncProber(ctx, pod)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The stages of the deleted pod are played after its containers are terminated.
+	terminating, err := c.syncTerminator(ctx, pod)
+	if err != nil {
+		return err
+	}
+	if terminating {
 		return nil
 	}
 
@@ -249,12 +328,18 @@ func (c *PodController) preprocess(ctx context.Context, pod *corev1.Pod) error {
 		return err
 	}
 
-	lifecycle := c.lifecycle.Get()
-	stage, err := lifecycle.Match(pod.Labels, pod.Annotations, data)
+	lifecycle = lifecycle.Available(func(stageName string) int64 {
+		return c.attempts.Get(pod.UID, stageName)
+	})
+	if name, ok := lifecycle.UnresolvedNextStage(pod.Annotations); ok {
+		c.removeUnresolvedNextStage(ctx, pod, name)
+	}
+	rnd := c.rands.Get(pod.UID)
+	stages, err := lifecycle.Match(ctx, pod.Labels, pod.Annotations, data, rnd)
 	if err != nil {
 		return fmt.Errorf("stage match: %w", err)
 	}
-	if stage == nil {
+	if len(stages) == 0 {
 		logger.Debug("Skip pod",
 			"reason", "not match any stages",
 		)
@@ -262,31 +347,63 @@ func (c *PodController) preprocess(ctx context.Context, pod *corev1.Pod) error {
 	}
 
 	now := c.clock.Now()
-	delay, _ := stage.Delay(ctx, data, now)
+	for _, stage := range stages {
+		jobKey := stageJobKey(key, stage.Group())
+		item, ok := nextStageJob(taken, jobKey, stage, pod)
+		if !ok {
+			delay, _ := stage.Delay(ctx, data, now, rnd)
+			delay = stage.Backoff(delay, c.attempts.Get(pod.UID, stage.Name())+1)
+
+			if delay != 0 {
+				stageName := stage.Name()
+				logger.Debug("Delayed play stage",
+					"delay", delay,
+					"stage", stageName,
+				)
+			}
 
-	if delay != 0 {
-		stageName := stage.Name()
-		logger.Debug("Delayed play stage",
-			"delay", delay,
-			"stage", stageName,
-		)
+			item = resourceStageJob[*corev1.Pod]{
+				Resource: pod,
+				Stage:    stage,
+				Key:      jobKey,
+				Delay:    delay,
+				Time:     now.Add(delay),
+			}
+		}
+		ok = c.delayQueue.AddAfter(item, item.Time.Sub(now))
+		if !ok {
+			logger.Debug("Skip pod",
+				"reason", "delayed",
+			)
+		} else {
+			c.delayQueueMapping.Store(jobKey, item)
+		}
 	}
+	return nil
+}
 
-	item := resourceStageJob[*corev1.Pod]{
-		Resource: pod,
-		Stage:    stage,
-		Key:      key,
+// removeUnresolvedNextStage removes the NextStageAnnotation naming a stage that can't be resolved,
+// otherwise it stays on the pod forever, and records a warning event.
+func (c *PodController) removeUnresolvedNextStage(ctx context.Context, pod *corev1.Pod, name string) {
+	logger := log.FromContext(ctx)
+	logger.Warn("Remove unresolved next stage",
+		"pod", log.KObj(pod),
+		"stage", name,
+	)
+	if c.recorder != nil {
+		ref := &corev1.ObjectReference{
+			Kind:      "Pod",
+			UID:       pod.UID,
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		}
+		c.recorder.Eventf(ref, corev1.EventTypeWarning, unresolvedNextStageReason,
+			"Stage %q of the %s annotation doesn't exist, is not for the pod or has been played as many times as it can be", name, NextStageAnnotation)
 	}
-	ok = c.delayQueue.AddAfter(item, delay)
-	if !ok {
-		logger.Debug("Skip pod",
-			"reason", "delayed",
-		)
-	} else {
-		c.delayQueueMapping.Store(key, item)
+	_, err := c.patchResource(ctx, pod, types.MergePatchType, removeNextStageAnnotationPatch)
+	if err != nil {
+		logger.Error("Failed to remove next stage annotation", err)
 	}
-
-	return nil
 }
 
 // playStageWorker receives the resource from the playStageChan and play the stage
@@ -294,12 +411,40 @@ func (c *PodController) playStageWorker(ctx context.Context) {
 	for ctx.Err() == nil {
 		pod := c.delayQueue.GetOrWait()
 		c.delayQueueMapping.Delete(pod.Key)
-		c.playStage(ctx, pod.Resource, pod.Stage)
+		attempt := c.attempts.Add(pod.Resource.UID, pod.Stage.Name())
+		playCtx, patchSize := withPatchSize(ctx)
+		err := c.playStage(playCtx, pod.Resource, pod.Stage, attempt)
+		if c.onStagePlayedFunc != nil {
+			c.onStagePlayedFunc(pod.Stage.Name(), err)
+		}
+		if c.history != nil {
+			transition := newStageTransition(c.clock.Now(), pod.Stage, pod.Delay, attempt, patchSize.Load(), err)
+			c.recordStageTransition(ctx, pod.Resource, transition)
+		}
+	}
+}
+
+// recordStageTransition records the transition in the history, and in the annotation if enabled
+func (c *PodController) recordStageTransition(ctx context.Context, pod *corev1.Pod, transition StageTransition) {
+	transitions := c.history.Record("Pod", pod.Namespace, pod.Name, pod.UID, transition)
+	if !c.historyAnnotation {
+		return
+	}
+
+	logger := log.FromContext(ctx)
+	patch, err := stageHistoryAnnotationPatch(transitions)
+	if err != nil {
+		logger.Error("Failed to record stage history", err)
+		return
+	}
+	_, err = c.patchResource(ctx, pod, types.MergePatchType, patch)
+	if err != nil {
+		logger.Error("Failed to record stage history", err)
 	}
 }
 
 // playStage plays the stage
-func (c *PodController) playStage(ctx context.Context, pod *corev1.Pod, stage *LifecycleStage) {
+func (c *PodController) playStage(ctx context.Context, pod *corev1.Pod, stage *LifecycleStage, attempt int64) error {
 	next := stage.Next()
 	logger := log.FromContext(ctx)
 	logger = logger.With(
@@ -308,48 +453,135 @@ func (c *PodController) playStage(ctx context.Context, pod *corev1.Pod, stage *L
 		"stage", stage.Name(),
 	)
 
-	if next.Event != nil && c.recorder != nil {
-		c.recorder.Event(&corev1.ObjectReference{
+	var webhookResult *StageWebhookResponse
+	if next.Webhook != nil {
+		resp, err := c.webhook.Call(ctx, next.Webhook, stage.Name(), attempt, pod)
+		if err != nil {
+			if !ignoreStageWebhookFailure(next.Webhook) {
+				logger.Error("Failed to call webhook", err)
+				return err
+			}
+			logger.Warn("Ignore the failure of webhook",
+				"err", err,
+			)
+		}
+		webhookResult = resp
+	}
+
+	var errs []error
+	if c.recorder != nil {
+		ref := &corev1.ObjectReference{
 			Kind:      "Pod",
 			UID:       pod.UID,
 			Name:      pod.Name,
 			Namespace: pod.Namespace,
-		}, next.Event.Type, next.Event.Reason, next.Event.Message)
+		}
+		if next.Event != nil {
+			err := c.events.Record(stage, c.rands.Get(pod.UID), ref, stageTemplateData{resource: pod, attempt: attempt})
+			if err != nil {
+				logger.Error("Failed to record event", err)
+				errs = append(errs, err)
+			}
+		}
+		if webhookResult != nil {
+			c.events.RecordWebhook(stage, c.rands.Get(pod.UID), ref, webhookResult.Events)
+		}
 	}
 	if next.Finalizers != nil {
 		result, err := c.finalizersModify(ctx, pod, next.Finalizers)
 		if err != nil {
 			logger.Error("Failed to finalizers", err)
+			errs = append(errs, err)
 		}
 		if result != nil && stage.ImmediateNextStage() {
 			c.preprocessChan <- result
 		}
 	}
-	if next.Delete {
+	if len(next.Create) != 0 {
+		err := c.creator.Create(ctx, metav1.OwnerReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Name:       pod.Name,
+			UID:        pod.UID,
+		}, pod.Namespace, stageTemplateData{resource: pod, attempt: attempt}, next.Create)
+		if err != nil {
+			logger.Error("Failed to create resources", err)
+			errs = append(errs, err)
+		}
+	}
+	if next.Delete || (webhookResult != nil && webhookResult.Delete) {
 		err := c.deleteResource(ctx, pod)
 		if err != nil {
 			logger.Error("Failed to delete pod", err)
 		}
-	} else if next.StatusTemplate != "" {
-		patch, err := c.configureResource(pod, next.StatusTemplate)
+		return errors.Join(append(errs, err)...)
+	}
+
+	var result *corev1.Pod
+	if next.StatusTemplate != "" {
+		patch, err := c.configureResource(pod, next.StatusTemplate, attempt)
 		if err != nil {
 			logger.Error("Failed to configure pod", err)
-			return
+			return errors.Join(append(errs, err)...)
 		}
 		if patch == nil {
 			logger.Debug("Skip pod",
 				"reason", "do not need to modify",
 			)
 		} else {
-			result, err := c.patchResource(ctx, pod, patch)
+			result, err = c.patchResource(ctx, pod, types.StrategicMergePatchType, patch, "status")
 			if err != nil {
 				logger.Error("Failed to patch pod", err)
+				errs = append(errs, err)
 			}
-			if result != nil && stage.ImmediateNextStage() {
-				c.preprocessChan <- result
-			}
 		}
 	}
+	if len(next.Patches) != 0 {
+		latest := pod
+		if result != nil {
+			latest = result
+		}
+		patched, err := c.patchResources(ctx, latest, next.Patches, attempt)
+		if err != nil {
+			logger.Error("Failed to patch pod", err)
+			errs = append(errs, err)
+		}
+		if patched != nil {
+			result = patched
+		}
+	}
+	if webhookResult != nil && len(webhookResult.Patches) != 0 {
+		latest := pod
+		if result != nil {
+			latest = result
+		}
+		patched, err := applyStageWebhookPatches(ctx, latest, webhookResult.Patches, c.patchResource)
+		if err != nil {
+			logger.Error("Failed to patch pod", err)
+			errs = append(errs, err)
+		}
+		if patched != nil {
+			result = patched
+		}
+	}
+	if pod.Annotations[NextStageAnnotation] == stage.Name() {
+		latest := pod
+		if result != nil {
+			latest = result
+		}
+		patched, err := c.patchResource(ctx, latest, types.MergePatchType, removeNextStageAnnotationPatch)
+		if err != nil {
+			logger.Error("Failed to remove next stage annotation", err)
+			errs = append(errs, err)
+		}
+		if patched != nil {
+			result = patched
+		}
+	}
+	if result != nil && stage.ImmediateNextStage() {
+		c.preprocessChan <- result
+	}
+	return errors.Join(errs...)
 }
 
 func (c *PodController) readOnly(nodeName string) bool {
@@ -359,15 +591,54 @@ func (c *PodController) readOnly(nodeName string) bool {
 	return c.readOnlyFunc(nodeName)
 }
 
+// patchResources applies the patches to the pod in order
+func (c *PodController) patchResources(ctx context.Context, pod *corev1.Pod, patches []internalversion.StagePatch, attempt int64) (*corev1.Pod, error) {
+	logger := log.FromContext(ctx)
+	logger = logger.With(
+		"pod", log.KObj(pod),
+		"node", pod.Spec.NodeName,
+	)
+
+	var result *corev1.Pod
+	for i := range patches {
+		patch := &patches[i]
+		patchType, data, err := computeStagePatch(c.renderer, pod, attempt, c.patchMeta, patch)
+		if err != nil {
+			return result, fmt.Errorf("failed to compute patch %d: %w", i, err)
+		}
+		if data == nil {
+			logger.Debug("Skip pod",
+				"reason", "do not need to modify",
+				"subresource", patch.Subresource,
+			)
+			continue
+		}
+		latest, err := c.patchResource(ctx, pod, patchType, data, patch.Subresource)
+		if err != nil {
+			return result, err
+		}
+		if latest == nil {
+			return nil, nil
+		}
+		if !isResourceSubresource(patch.Subresource) {
+			continue
+		}
+		pod = latest
+		result = latest
+	}
+	return result, nil
+}
+
 // patchResource patches the resource
-func (c *PodController) patchResource(ctx context.Context, pod *corev1.Pod, patch []byte) (*corev1.Pod, error) {
+func (c *PodController) patchResource(ctx context.Context, pod *corev1.Pod, patchType types.PatchType, patch []byte, subresources ...string) (*corev1.Pod, error) {
 	logger := log.FromContext(ctx)
 	logger = logger.With(
 		"pod", log.KObj(pod),
 		"node", pod.Spec.NodeName,
 	)
 
-	result, err := c.typedClient.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	addPatchSize(ctx, patch)
+	result, err := c.typedClient.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, patchType, patch, metav1.PatchOptions{}, subresources...)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			logger.Warn("Patch pod",
@@ -450,16 +721,25 @@ loop:
 				if c.enableMetrics {
 					c.deletePodInfo(pod)
 				}
+				// The states tracked by the UID of the pod are released even if the pod is no longer managed,
+				// e.g. its node is gone, otherwise they are leaked.
+				if c.admission != nil {
+					c.admission.Release(pod)
+				}
+				c.stopProber(pod.UID)
+				c.stopTerminator(pod.UID)
+				if c.history != nil {
+					c.history.Expire(pod.UID)
+				}
 				if c.need(pod) {
 					// Recycling PodIP
 					c.recyclingPodIP(ctx, pod)
+					c.rands.Delete(pod.UID)
+					c.attempts.Delete(pod.UID)
 
 					// Cancel delay job
 					key := log.KObj(pod).String()
-					resourceJob, ok := c.delayQueueMapping.LoadAndDelete(key)
-					if ok {
-						c.delayQueue.Cancel(resourceJob)
-					}
+					cancelStageJobs(c.delayQueue, &c.delayQueueMapping, key)
 				}
 			}
 		case <-ctx.Done():
@@ -526,7 +806,7 @@ func (c *PodController) recyclingPodIP(ctx context.Context, pod *corev1.Pod) {
 	}
 }
 
-func (c *PodController) configureResource(pod *corev1.Pod, template string) ([]byte, error) {
+func (c *PodController) configureResource(pod *corev1.Pod, template string, attempt int64) ([]byte, error) {
 	if !c.enableCNI {
 		// Mark the pod IP that existed before the kubelet was started
 		if _, has := c.nodeGetFunc(pod.Spec.NodeName); has {
@@ -546,7 +826,7 @@ func (c *PodController) configureResource(pod *corev1.Pod, template string) ([]b
 		}
 	}
 
-	patch, err := c.computePatch(pod, template)
+	patch, err := c.computePatch(pod, template, attempt)
 	if err != nil {
 		return nil, err
 	}
@@ -559,8 +839,8 @@ func (c *PodController) configureResource(pod *corev1.Pod, template string) ([]b
 	})
 }
 
-func (c *PodController) computePatch(pod *corev1.Pod, tpl string) ([]byte, error) {
-	patch, err := c.renderer.ToJSON(tpl, pod)
+func (c *PodController) computePatch(pod *corev1.Pod, tpl string, attempt int64) ([]byte, error) {
+	patch, err := c.renderer.ToJSON(tpl, stageTemplateData{resource: pod, attempt: attempt})
 	if err != nil {
 		return nil, err
 	}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -29,6 +30,7 @@ import (
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 
 	podfast "sigs.k8s.io/kwok/kustomize/stage/pod/fast"
 	"sigs.k8s.io/kwok/pkg/apis/internalversion"
@@ -190,7 +192,7 @@ func TestPodController(t *testing.T) {
 		t.Fatal(fmt.Errorf("failed to watch nodes: %w", err))
 	}
 
-	lifecycle, _ := NewLifecycle(podStages)
+	lifecycle, _ := NewLifecycle(podStages, nil)
 	annotationSelector, _ := labels.Parse("fake=custom")
 	pods, err := NewPodController(PodControllerConfig{
 		TypedClient:                           clientset,
@@ -369,3 +371,40 @@ func TestPodController(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestPodControllerRemoveUnresolvedNextStage(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod0",
+			Namespace: "default",
+			Annotations: map[string]string{
+				NextStageAnnotation: "missing",
+			},
+		},
+	}
+	clientset := fake.NewSimpleClientset(pod)
+	recorder := record.NewFakeRecorder(1)
+	c := &PodController{
+		typedClient: clientset,
+		recorder:    recorder,
+	}
+
+	ctx := context.Background()
+	c.removeUnresolvedNextStage(ctx, pod, "missing")
+
+	got, err := clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Annotations[NextStageAnnotation]; ok {
+		t.Errorf("want annotation %s removed", NextStageAnnotation)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, "Warning "+unresolvedNextStageReason+" ") {
+			t.Errorf("want warning event %s, got %q", unresolvedNextStageReason, event)
+		}
+	default:
+		t.Error("want warning event recorded")
+	}
+}
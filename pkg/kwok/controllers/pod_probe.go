@@ -0,0 +1,579 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+
+	"sigs.k8s.io/kwok/pkg/log"
+	"sigs.k8s.io/kwok/pkg/utils/format"
+)
+
+// ProbeResultsAnnotation is the annotation that scripts the results of the probes of the containers of the pod,
+// e.g. {"app":{"readiness":"failure*3,success"}} fails the readiness probe of the app container 3 times and then succeeds.
+// The last result of a script is repeated, and the probes without a script always succeed.
+const ProbeResultsAnnotation = "kwok.x-k8s.io/probe-results"
+
+// probeType is the type of the probe of a container
+type probeType string
+
+const (
+	probeTypeStartup   probeType = "startup"
+	probeTypeReadiness probeType = "readiness"
+	probeTypeLiveness  probeType = "liveness"
+)
+
+// probeScriptStep is a result repeated a number of times in a probe script
+type probeScriptStep struct {
+	success bool
+	times   int
+}
+
+// probeScript is the scripted results of a probe
+type probeScript struct {
+	steps []probeScriptStep
+	step  int
+	count int
+}
+
+// parseProbeScript parses a comma separated list of results, each of them is success or failure,
+// optionally followed by *N to repeat it N times.
+func parseProbeScript(script string) (*probeScript, error) {
+	s := &probeScript{}
+	for _, item := range strings.Split(script, ",") {
+		item = strings.TrimSpace(item)
+		result, times, ok := strings.Cut(item, "*")
+		step := probeScriptStep{
+			times: 1,
+		}
+		switch strings.TrimSpace(result) {
+		case "success":
+			step.success = true
+		case "failure":
+			step.success = false
+		default:
+			return nil, fmt.Errorf("unknown probe result %q, want success or failure", result)
+		}
+		if ok {
+			n, err := strconv.Atoi(strings.TrimSpace(times))
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid times %q of probe result %q", times, result)
+			}
+			step.times = n
+		}
+		s.steps = append(s.steps, step)
+	}
+	return s, nil
+}
+
+// next returns the next result of the script
+func (s *probeScript) next() bool {
+	if s == nil || len(s.steps) == 0 {
+		return true
+	}
+	step := s.steps[s.step]
+	if s.step == len(s.steps)-1 {
+		return step.success
+	}
+	s.count++
+	if s.count >= step.times {
+		s.step++
+		s.count = 0
+	}
+	return step.success
+}
+
+// parseProbeResults parses the ProbeResultsAnnotation of the pod
+func parseProbeResults(pod *corev1.Pod) (map[string]map[probeType]*probeScript, error) {
+	value, ok := pod.Annotations[ProbeResultsAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	raw := map[string]map[probeType]string{}
+	err := json.Unmarshal([]byte(value), &raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse annotation %s: %w", ProbeResultsAnnotation, err)
+	}
+	results := make(map[string]map[probeType]*probeScript, len(raw))
+	for container, probes := range raw {
+		results[container] = make(map[probeType]*probeScript, len(probes))
+		for typ, script := range probes {
+			switch typ {
+			case probeTypeStartup, probeTypeReadiness, probeTypeLiveness:
+			default:
+				return nil, fmt.Errorf("parse annotation %s: unknown probe %q of container %q", ProbeResultsAnnotation, typ, container)
+			}
+			s, err := parseProbeScript(script)
+			if err != nil {
+				return nil, fmt.Errorf("parse annotation %s: %s probe of container %q: %w", ProbeResultsAnnotation, typ, container, err)
+			}
+			results[container][typ] = s
+		}
+	}
+	return results, nil
+}
+
+// probeRunner runs a probe of a container
+type probeRunner struct {
+	typ              probeType
+	initialDelay     time.Duration
+	period           time.Duration
+	successThreshold int32
+	failureThreshold int32
+	script           *probeScript
+	next             time.Time
+	successes        int32
+	failures         int32
+}
+
+func newProbeRunner(typ probeType, probe *corev1.Probe, script *probeScript) *probeRunner {
+	r := &probeRunner{
+		typ:              typ,
+		initialDelay:     time.Duration(probe.InitialDelaySeconds) * time.Second,
+		period:           time.Duration(probe.PeriodSeconds) * time.Second,
+		successThreshold: probe.SuccessThreshold,
+		failureThreshold: probe.FailureThreshold,
+		script:           script,
+	}
+	// The defaults of the apiserver, in case the probe is not defaulted
+	if r.period <= 0 {
+		r.period = 10 * time.Second
+	}
+	if r.successThreshold <= 0 || typ != probeTypeReadiness {
+		r.successThreshold = 1
+	}
+	if r.failureThreshold <= 0 {
+		r.failureThreshold = 3
+	}
+	return r
+}
+
+// reset resets the probe for a container started at the time
+func (r *probeRunner) reset(startedAt time.Time) {
+	r.next = startedAt.Add(r.initialDelay)
+	r.successes = 0
+	r.failures = 0
+}
+
+// containerProber simulates the probes of a container like the kubelet
+type containerProber struct {
+	name           string
+	status         corev1.ContainerStatus
+	startedAt      time.Time
+	started        bool
+	ready          bool
+	restartCount   int32
+	lastTerminated *corev1.ContainerStateTerminated
+	restarted      bool
+	startup        *probeRunner
+	readiness      *probeRunner
+	liveness       *probeRunner
+}
+
+// podEvent is an event recorded on the pod
+type podEvent struct {
+	eventType string
+	reason    string
+	message   string
+}
+
+// podProber simulates the probes of the containers of a running pod
+type podProber struct {
+	containers      []*containerProber
+	ready           bool
+	readyTransition time.Time
+}
+
+// hasProbes returns whether any container of the pod has a probe
+func hasProbes(pod *corev1.Pod) bool {
+	for _, container := range pod.Spec.Containers {
+		if container.StartupProbe != nil || container.ReadinessProbe != nil || container.LivenessProbe != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// newPodProber creates a podProber from the statuses of the running containers of the pod
+func newPodProber(pod *corev1.Pod, now time.Time) (*podProber, error) {
+	scripts, err := parseProbeResults(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &podProber{
+		readyTransition: now,
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			p.ready = cond.Status == corev1.ConditionTrue
+			if !cond.LastTransitionTime.IsZero() {
+				p.readyTransition = cond.LastTransitionTime.Time
+			}
+		}
+	}
+	for _, container := range pod.Spec.Containers {
+		cp := &containerProber{
+			name:      container.Name,
+			startedAt: now,
+			status: corev1.ContainerStatus{
+				Name:  container.Name,
+				Image: container.Image,
+			},
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name != container.Name {
+				continue
+			}
+			cp.status = *status.DeepCopy()
+			cp.restartCount = status.RestartCount
+			if status.State.Running != nil && !status.State.Running.StartedAt.IsZero() {
+				cp.startedAt = status.State.Running.StartedAt.Time
+			}
+		}
+		if container.StartupProbe != nil {
+			cp.startup = newProbeRunner(probeTypeStartup, container.StartupProbe, scripts[container.Name][probeTypeStartup])
+		}
+		if container.ReadinessProbe != nil {
+			cp.readiness = newProbeRunner(probeTypeReadiness, container.ReadinessProbe, scripts[container.Name][probeTypeReadiness])
+		}
+		if container.LivenessProbe != nil {
+			cp.liveness = newProbeRunner(probeTypeLiveness, container.LivenessProbe, scripts[container.Name][probeTypeLiveness])
+		}
+		cp.start(cp.startedAt)
+		p.containers = append(p.containers, cp)
+	}
+	return p, nil
+}
+
+// start starts the container at the time, it is not started until its startup probe succeeds,
+// and not ready until its readiness probe succeeds.
+func (c *containerProber) start(now time.Time) {
+	c.startedAt = now
+	c.started = c.startup == nil
+	c.ready = c.started && c.readiness == nil
+	for _, r := range c.runners() {
+		r.reset(now)
+	}
+}
+
+func (c *containerProber) runners() []*probeRunner {
+	runners := make([]*probeRunner, 0, 3)
+	for _, r := range []*probeRunner{c.startup, c.readiness, c.liveness} {
+		if r != nil {
+			runners = append(runners, r)
+		}
+	}
+	return runners
+}
+
+// active returns whether the probe runs, the readiness and liveness probes wait for the startup probe
+func (c *containerProber) active(r *probeRunner) bool {
+	if r.typ == probeTypeStartup {
+		return !c.started
+	}
+	return c.started
+}
+
+// restart restarts the container killed for its failed probe
+func (c *containerProber) restart(now time.Time) {
+	c.lastTerminated = &corev1.ContainerStateTerminated{
+		ExitCode:   137,
+		Reason:     "Error",
+		StartedAt:  metav1.NewTime(c.startedAt),
+		FinishedAt: metav1.NewTime(now),
+	}
+	c.restartCount++
+	c.restarted = true
+	c.start(now)
+	// The restarted container is not probed at the same time it is killed.
+	for _, r := range c.runners() {
+		if !r.next.After(now) {
+			r.next = now.Add(r.period)
+		}
+	}
+}
+
+// step runs the probes due at the time, and returns whether the statuses are changed and the events of the probes
+func (p *podProber) step(now time.Time) (changed bool, events []podEvent) {
+	for _, c := range p.containers {
+		started, ready, restartCount := c.started, c.ready, c.restartCount
+		for _, r := range c.runners() {
+			if !c.active(r) || now.Before(r.next) {
+				continue
+			}
+			r.next = now.Add(r.period)
+
+			if r.script.next() {
+				r.successes++
+				r.failures = 0
+			} else {
+				r.failures++
+				r.successes = 0
+				events = append(events, podEvent{
+					eventType: corev1.EventTypeWarning,
+					reason:    "Unhealthy",
+					message:   fmt.Sprintf("%s probe failed", probeTypeTitle(r.typ)),
+				})
+			}
+
+			switch r.typ {
+			case probeTypeStartup:
+				if r.successes >= r.successThreshold {
+					c.started = true
+					c.ready = c.readiness == nil
+				}
+			case probeTypeReadiness:
+				if r.successes >= r.successThreshold {
+					c.ready = true
+				} else if r.failures >= r.failureThreshold {
+					c.ready = false
+				}
+			}
+			if r.typ != probeTypeReadiness && r.failures >= r.failureThreshold {
+				events = append(events, podEvent{
+					eventType: corev1.EventTypeNormal,
+					reason:    "Killing",
+					message:   fmt.Sprintf("Container %s failed %s probe, will be restarted", c.name, r.typ),
+				})
+				c.restart(now)
+				break
+			}
+		}
+		if started != c.started || ready != c.ready || restartCount != c.restartCount {
+			changed = true
+		}
+	}
+
+	ready := true
+	for _, c := range p.containers {
+		if !c.ready {
+			ready = false
+		}
+	}
+	if ready != p.ready {
+		p.ready = ready
+		p.readyTransition = now
+		changed = true
+	}
+	return changed, events
+}
+
+// nextTime returns the time of the next probe, or zero if there is no probe to run
+func (p *podProber) nextTime() time.Time {
+	var next time.Time
+	for _, c := range p.containers {
+		for _, r := range c.runners() {
+			if !c.active(r) {
+				continue
+			}
+			if next.IsZero() || r.next.Before(next) {
+				next = r.next
+			}
+		}
+	}
+	return next
+}
+
+// statusPatch returns the strategic merge patch of the statuses of the containers and the readiness of the pod,
+// only the fields simulated by the probes are changed on the current statuses of the containers,
+// so that the changes of the stages and the terminator meanwhile are kept.
+// The containerStatuses have no merge key so the whole statuses of the containers are patched,
+// and the patch is rejected with a conflict if the pod is modified after the current version.
+func (p *podProber) statusPatch(current *corev1.Pod) ([]byte, error) {
+	statuses := make([]corev1.ContainerStatus, 0, len(current.Status.ContainerStatuses))
+	for _, status := range current.Status.ContainerStatuses {
+		status := *status.DeepCopy()
+		for _, c := range p.containers {
+			if c.name != status.Name || status.State.Terminated != nil {
+				continue
+			}
+			status.Ready = c.ready
+			status.Started = format.Ptr(c.started)
+			status.RestartCount = c.restartCount
+			if c.restarted && status.State.Running != nil {
+				status.State.Running = &corev1.ContainerStateRunning{
+					StartedAt: metav1.NewTime(c.startedAt),
+				}
+				status.LastTerminationState = corev1.ContainerState{
+					Terminated: c.lastTerminated,
+				}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	conditionStatus := corev1.ConditionFalse
+	if p.ready {
+		conditionStatus = corev1.ConditionTrue
+	}
+	conditions := make([]corev1.PodCondition, 0, 2)
+	for _, typ := range []corev1.PodConditionType{corev1.PodReady, corev1.ContainersReady} {
+		conditions = append(conditions, corev1.PodCondition{
+			Type:               typ,
+			Status:             conditionStatus,
+			LastTransitionTime: metav1.NewTime(p.readyTransition),
+		})
+	}
+
+	return json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"resourceVersion": current.ResourceVersion,
+		},
+		"status": map[string]any{
+			"containerStatuses": statuses,
+			"conditions":        conditions,
+		},
+	})
+}
+
+func probeTypeTitle(typ probeType) string {
+	switch typ {
+	case probeTypeStartup:
+		return "Startup"
+	case probeTypeReadiness:
+		return "Readiness"
+	}
+	return "Liveness"
+}
+
+// syncProber starts to simulate the probes of the running pod, and stops it when the pod is no longer running
+func (c *PodController) syncProber(ctx context.Context, pod *corev1.Pod) error {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+		c.stopProber(pod.UID)
+		return nil
+	}
+	if _, ok := c.probers.Load(pod.UID); ok {
+		return nil
+	}
+	if !hasProbes(pod) {
+		return nil
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Running == nil {
+			return nil
+		}
+	}
+
+	prober, err := newPodProber(pod, c.clock.Now())
+	if err != nil {
+		return err
+	}
+	proberCtx, cancel := context.WithCancel(ctx)
+	c.probers.Store(pod.UID, cancel)
+	go c.runProber(proberCtx, pod, prober)
+	return nil
+}
+
+// stopProber stops to simulate the probes of the pod
+func (c *PodController) stopProber(uid types.UID) {
+	cancel, ok := c.probers.LoadAndDelete(uid)
+	if ok {
+		cancel()
+	}
+}
+
+// runProber runs the probes of the pod and patches the statuses of its containers on changes
+func (c *PodController) runProber(ctx context.Context, pod *corev1.Pod, prober *podProber) {
+	logger := log.FromContext(ctx)
+	logger = logger.With(
+		"pod", log.KObj(pod),
+		"node", pod.Spec.NodeName,
+	)
+	ref := &corev1.ObjectReference{
+		Kind:      "Pod",
+		UID:       pod.UID,
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+	}
+
+	// The stages may have marked all the containers as ready, so the initial statuses are always patched.
+	changed := true
+	for {
+		now := c.clock.Now()
+		stepChanged, events := prober.step(now)
+		changed = changed || stepChanged
+		if c.recorder != nil {
+			for _, event := range events {
+				c.recorder.Event(ref, event.eventType, event.reason, event.message)
+			}
+		}
+		if changed {
+			running, err := c.patchProbeStatus(ctx, pod, prober)
+			if err != nil {
+				logger.Error("Failed to patch probe status", err)
+			}
+			if !running {
+				logger.Debug("Stop prober",
+					"reason", "pod is deleting or no longer running",
+				)
+				c.stopProber(pod.UID)
+				return
+			}
+			changed = false
+		}
+
+		var wait <-chan time.Time
+		if next := prober.nextTime(); !next.IsZero() {
+			wait = c.clock.After(next.Sub(now))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-wait:
+		}
+	}
+}
+
+// patchProbeStatus patches the statuses of the probes onto the current version of the pod,
+// it returns false if the pod is deleting or no longer running, then the probes are no longer simulated.
+func (c *PodController) patchProbeStatus(ctx context.Context, pod *corev1.Pod, prober *podProber) (bool, error) {
+	running := true
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := c.typedClient.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				running = false
+				return nil
+			}
+			return err
+		}
+		if current.UID != pod.UID || current.DeletionTimestamp != nil || current.Status.Phase != corev1.PodRunning {
+			running = false
+			return nil
+		}
+
+		patch, err := prober.statusPatch(current)
+		if err != nil {
+			return err
+		}
+		_, err = c.patchResource(ctx, current, types.StrategicMergePatchType, patch, "status")
+		return err
+	})
+	return running, err
+}
@@ -0,0 +1,420 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/kwok/pkg/utils/format"
+)
+
+func TestParseProbeScript(t *testing.T) {
+	tests := []struct {
+		script  string
+		want    []bool
+		wantErr bool
+	}{
+		{
+			script: "success",
+			want:   []bool{true, true, true},
+		},
+		{
+			script: "failure*3,success",
+			want:   []bool{false, false, false, true, true},
+		},
+		{
+			script: "success, failure*2, success*2, failure",
+			want:   []bool{true, false, false, true, true, false, false},
+		},
+		{
+			script:  "succeed",
+			wantErr: true,
+		},
+		{
+			script:  "failure*0",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			s, err := parseProbeScript(tt.script)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseProbeScript() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := make([]bool, 0, len(tt.want))
+			for range tt.want {
+				got = append(got, s.next())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want results %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPodProber(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type step struct {
+		seconds          int
+		wantStarted      bool
+		wantReady        bool
+		wantRestartCount int32
+		wantEvents       []string
+	}
+	tests := []struct {
+		name      string
+		container corev1.Container
+		results   string
+		steps     []step
+	}{
+		{
+			name: "readiness",
+			container: corev1.Container{
+				Name: "app",
+				ReadinessProbe: &corev1.Probe{
+					InitialDelaySeconds: 5,
+					PeriodSeconds:       10,
+					SuccessThreshold:    2,
+				},
+			},
+			results: `{"app":{"readiness":"failure*2,success*2,failure*3,success"}}`,
+			steps: []step{
+				{seconds: 0, wantStarted: true},
+				{seconds: 5, wantStarted: true, wantEvents: []string{"Unhealthy"}},
+				{seconds: 15, wantStarted: true, wantEvents: []string{"Unhealthy"}},
+				{seconds: 25, wantStarted: true},
+				{seconds: 35, wantStarted: true, wantReady: true},
+				{seconds: 45, wantStarted: true, wantReady: true, wantEvents: []string{"Unhealthy"}},
+				{seconds: 55, wantStarted: true, wantReady: true, wantEvents: []string{"Unhealthy"}},
+				{seconds: 65, wantStarted: true, wantEvents: []string{"Unhealthy"}},
+			},
+		},
+		{
+			name: "liveness",
+			container: corev1.Container{
+				Name: "app",
+				LivenessProbe: &corev1.Probe{
+					PeriodSeconds:    10,
+					FailureThreshold: 2,
+				},
+			},
+			results: `{"app":{"liveness":"failure*2,success"}}`,
+			steps: []step{
+				{seconds: 0, wantStarted: true, wantReady: true, wantEvents: []string{"Unhealthy"}},
+				{seconds: 10, wantStarted: true, wantReady: true, wantRestartCount: 1, wantEvents: []string{"Unhealthy", "Killing"}},
+				{seconds: 20, wantStarted: true, wantReady: true, wantRestartCount: 1},
+			},
+		},
+		{
+			name: "startup",
+			container: corev1.Container{
+				Name: "app",
+				StartupProbe: &corev1.Probe{
+					PeriodSeconds: 5,
+				},
+				ReadinessProbe: &corev1.Probe{
+					InitialDelaySeconds: 20,
+					PeriodSeconds:       10,
+				},
+			},
+			results: `{"app":{"startup":"failure*2,success"}}`,
+			steps: []step{
+				{seconds: 0, wantEvents: []string{"Unhealthy"}},
+				{seconds: 5, wantEvents: []string{"Unhealthy"}},
+				{seconds: 10, wantStarted: true},
+				{seconds: 15, wantStarted: true},
+				{seconds: 20, wantStarted: true, wantReady: true},
+			},
+		},
+		{
+			name: "startup failure",
+			container: corev1.Container{
+				Name: "app",
+				StartupProbe: &corev1.Probe{
+					PeriodSeconds:    5,
+					FailureThreshold: 1,
+				},
+			},
+			results: `{"app":{"startup":"failure,success"}}`,
+			steps: []step{
+				{seconds: 0, wantRestartCount: 1, wantEvents: []string{"Unhealthy", "Killing"}},
+				{seconds: 5, wantStarted: true, wantReady: true, wantRestartCount: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "pod0",
+					Namespace: "default",
+					Annotations: map[string]string{
+						ProbeResultsAnnotation: tt.results,
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{tt.container},
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodRunning,
+					ContainerStatuses: []corev1.ContainerStatus{
+						{
+							Name: tt.container.Name,
+							State: corev1.ContainerState{
+								Running: &corev1.ContainerStateRunning{
+									StartedAt: metav1.NewTime(start),
+								},
+							},
+						},
+					},
+				},
+			}
+			prober, err := newPodProber(pod, start)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, step := range tt.steps {
+				_, events := prober.step(start.Add(time.Duration(step.seconds) * time.Second))
+				var reasons []string
+				for _, event := range events {
+					reasons = append(reasons, event.reason)
+				}
+				if !reflect.DeepEqual(reasons, step.wantEvents) {
+					t.Errorf("at %ds: want events %v, got %v", step.seconds, step.wantEvents, reasons)
+				}
+
+				c := prober.containers[0]
+				if c.started != step.wantStarted || c.ready != step.wantReady || c.restartCount != step.wantRestartCount {
+					t.Errorf("at %ds: want started=%v ready=%v restartCount=%d, got started=%v ready=%v restartCount=%d",
+						step.seconds, step.wantStarted, step.wantReady, step.wantRestartCount, c.started, c.ready, c.restartCount)
+				}
+				if prober.ready != step.wantReady {
+					t.Errorf("at %ds: want pod ready %v, got %v", step.seconds, step.wantReady, prober.ready)
+				}
+			}
+		})
+	}
+}
+
+func TestPodControllerProber(t *testing.T) {
+	clk := testingclock.NewFakeClock(time.Now())
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod0",
+			Namespace: "default",
+			UID:       "uid0",
+			Annotations: map[string]string{
+				ProbeResultsAnnotation: `{"app":{"readiness":"failure,success"}}`,
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "app",
+					ReadinessProbe: &corev1.Probe{
+						PeriodSeconds: 10,
+					},
+				},
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			Conditions: []corev1.PodCondition{
+				{
+					Type:   corev1.PodReady,
+					Status: corev1.ConditionTrue,
+				},
+			},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name:    "app",
+					Image:   "busybox",
+					Ready:   true,
+					Started: format.Ptr(true),
+					State: corev1.ContainerState{
+						Running: &corev1.ContainerStateRunning{
+							StartedAt: metav1.NewTime(clk.Now()),
+						},
+					},
+				},
+			},
+		},
+	}
+	clientset := fake.NewSimpleClientset(pod)
+	c := &PodController{
+		clock:       clk,
+		typedClient: clientset,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	err := c.syncProber(ctx, pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, wantReady := range []bool{false, true} {
+		for !clk.HasWaiters() {
+			time.Sleep(10 * time.Millisecond)
+		}
+		got, err := clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status.ContainerStatuses[0].State.Running == nil || got.Status.ContainerStatuses[0].Image != "busybox" {
+			t.Errorf("want container running with image busybox kept, got %v", got.Status.ContainerStatuses[0])
+		}
+		if got.Status.ContainerStatuses[0].Ready != wantReady {
+			t.Errorf("want container ready %v, got %v", wantReady, got.Status.ContainerStatuses[0].Ready)
+		}
+		if ready := got.Status.Conditions[0].Status == corev1.ConditionTrue; ready != wantReady {
+			t.Errorf("want pod ready %v, got %v", wantReady, ready)
+		}
+		clk.Step(10 * time.Second)
+	}
+
+	pod.Status.Phase = corev1.PodSucceeded
+	err = c.syncProber(ctx, pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.probers.Load(pod.UID); ok {
+		t.Error("want prober stopped")
+	}
+}
+
+func TestPodControllerProberCurrentStatus(t *testing.T) {
+	clk := testingclock.NewFakeClock(time.Now())
+	running := corev1.ContainerState{
+		Running: &corev1.ContainerStateRunning{
+			StartedAt: metav1.NewTime(clk.Now()),
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod0",
+			Namespace: "default",
+			UID:       "uid0",
+			Annotations: map[string]string{
+				ProbeResultsAnnotation: `{"app":{"readiness":"failure,success,failure"}}`,
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "app",
+					ReadinessProbe: &corev1.Probe{
+						PeriodSeconds:    10,
+						FailureThreshold: 1,
+					},
+				},
+				{
+					Name: "sidecar",
+				},
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", Ready: true, State: running},
+				{Name: "sidecar", Ready: true, State: running},
+			},
+		},
+	}
+	clientset := fake.NewSimpleClientset(pod)
+	c := &PodController{
+		clock:       clk,
+		typedClient: clientset,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	err := c.syncProber(ctx, pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for !clk.HasWaiters() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The sidecar is terminated by others meanwhile
+	current, err := clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.Status.ContainerStatuses[1].Ready = false
+	current.Status.ContainerStatuses[1].State = corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{
+			ExitCode: 143,
+		},
+	}
+	_, err = clientset.CoreV1().Pods(pod.Namespace).UpdateStatus(ctx, current, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clk.Step(10 * time.Second)
+	for !clk.HasWaiters() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	got, err := clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Status.ContainerStatuses[0].Ready {
+		t.Error("want app ready after the readiness probe succeeds")
+	}
+	if got.Status.ContainerStatuses[1].State.Terminated == nil {
+		t.Errorf("want sidecar terminated kept, got %v", got.Status.ContainerStatuses[1].State)
+	}
+
+	// The prober stops instead of patching the deleting pod
+	got.DeletionTimestamp = format.Ptr(metav1.NewTime(clk.Now()))
+	_, err = clientset.CoreV1().Pods(pod.Namespace).Update(ctx, got, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk.Step(10 * time.Second)
+	for {
+		if _, ok := c.probers.Load(pod.UID); !ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	got, err = clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Status.ContainerStatuses[0].Ready {
+		t.Error("want the deleting pod not patched by the prober")
+	}
+}
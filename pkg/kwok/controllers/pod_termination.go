@@ -0,0 +1,428 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/kwok/pkg/log"
+	"sigs.k8s.io/kwok/pkg/utils/format"
+)
+
+// TerminationAnnotation is the annotation that scripts the termination of the containers of the deleted pod,
+// e.g. {"app":{"preStop":"5s","shutdown":"10s","exitCode":143}} runs the preStop hook of the app container for 5 seconds,
+// then the container exits with the code 143 10 seconds after the SIGTERM.
+// The containers without a script exit with the code 0 as soon as they are stopped.
+const TerminationAnnotation = "kwok.x-k8s.io/termination"
+
+// defaultTerminationGracePeriod is the grace period of the pods without terminationGracePeriodSeconds
+const defaultTerminationGracePeriod = 30 * time.Second
+
+// killedExitCode is the exit code of the containers killed at the end of the grace period
+const killedExitCode = 137
+
+// terminationScript is the scripted termination of a container
+type terminationScript struct {
+	// PreStop is the duration of the preStop hook, it is ignored if the container has no preStop hook.
+	PreStop metav1.Duration `json:"preStop,omitempty"`
+	// Shutdown is the duration from the SIGTERM to the exit of the container.
+	Shutdown metav1.Duration `json:"shutdown,omitempty"`
+	// ExitCode is the exit code of the container if it exits within the grace period.
+	ExitCode int32 `json:"exitCode,omitempty"`
+	// Overrun is the duration that the container keeps running after the grace period before it is killed.
+	Overrun metav1.Duration `json:"overrun,omitempty"`
+}
+
+// parseTerminationScripts parses the TerminationAnnotation of the pod
+func parseTerminationScripts(pod *corev1.Pod) (map[string]terminationScript, error) {
+	value, ok := pod.Annotations[TerminationAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	scripts := map[string]terminationScript{}
+	err := json.Unmarshal([]byte(value), &scripts)
+	if err != nil {
+		return nil, fmt.Errorf("parse annotation %s: %w", TerminationAnnotation, err)
+	}
+	for container, script := range scripts {
+		if script.PreStop.Duration < 0 || script.Shutdown.Duration < 0 || script.Overrun.Duration < 0 {
+			return nil, fmt.Errorf("parse annotation %s: negative duration of container %q", TerminationAnnotation, container)
+		}
+	}
+	return scripts, nil
+}
+
+// terminationGracePeriod returns the grace period of the deleted pod
+func terminationGracePeriod(pod *corev1.Pod) time.Duration {
+	if pod.DeletionGracePeriodSeconds != nil {
+		return time.Duration(*pod.DeletionGracePeriodSeconds) * time.Second
+	}
+	if pod.Spec.TerminationGracePeriodSeconds != nil {
+		return time.Duration(*pod.Spec.TerminationGracePeriodSeconds) * time.Second
+	}
+	return defaultTerminationGracePeriod
+}
+
+// hasRunningContainers returns whether any container of the pod is running
+func hasRunningContainers(pod *corev1.Pod) bool {
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.State.Running != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containerTerminator terminates a running container
+type containerTerminator struct {
+	status         *corev1.ContainerStatus
+	stopAt         time.Time
+	exitAt         time.Time
+	exitCode       int32
+	preStopOverrun bool
+	overrun        bool
+	stopping       bool
+	exited         bool
+}
+
+// podTerminator terminates the containers of a deleted pod like the kubelet,
+// the main containers and the regular init containers are stopped at once,
+// then the sidecars are stopped one at a time in reverse order.
+type podTerminator struct {
+	containers            []*containerTerminator
+	initContainerStatuses []corev1.ContainerStatus
+	containerStatuses     []corev1.ContainerStatus
+	readyTransition       time.Time
+}
+
+// newPodTerminator creates a podTerminator from the statuses of the running containers of the deleted pod,
+// the grace period starts at the deletion of the pod, i.e. before its deletionTimestamp by the grace period.
+func newPodTerminator(pod *corev1.Pod) (*podTerminator, error) {
+	scripts, err := parseTerminationScripts(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := pod.DeletionTimestamp.Time
+	start := deadline.Add(-terminationGracePeriod(pod))
+
+	p := &podTerminator{
+		initContainerStatuses: append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+		containerStatuses:     append([]corev1.ContainerStatus{}, pod.Status.ContainerStatuses...),
+	}
+
+	newContainer := func(spec *corev1.Container, status *corev1.ContainerStatus, stopAt time.Time) *containerTerminator {
+		script := scripts[spec.Name]
+		c := &containerTerminator{
+			status: status,
+			stopAt: stopAt,
+		}
+
+		var preStop time.Duration
+		if spec.Lifecycle != nil && spec.Lifecycle.PreStop != nil {
+			preStop = script.PreStop.Duration
+		}
+		c.exitAt = stopAt.Add(preStop + script.Shutdown.Duration)
+		if c.exitAt.After(deadline) {
+			c.preStopOverrun = stopAt.Add(preStop).After(deadline)
+			c.overrun = script.Overrun.Duration > 0
+			c.exitAt = deadline
+			if stopAt.After(deadline) {
+				c.exitAt = stopAt
+			}
+			c.exitAt = c.exitAt.Add(script.Overrun.Duration)
+			c.exitCode = killedExitCode
+		} else {
+			c.exitCode = script.ExitCode
+		}
+		return c
+	}
+
+	initContainers := map[string]*corev1.Container{}
+	for i := range pod.Spec.InitContainers {
+		initContainers[pod.Spec.InitContainers[i].Name] = &pod.Spec.InitContainers[i]
+	}
+	containers := map[string]*corev1.Container{}
+	for i := range pod.Spec.Containers {
+		containers[pod.Spec.Containers[i].Name] = &pod.Spec.Containers[i]
+	}
+
+	end := start
+	var sidecars []*corev1.ContainerStatus
+	for i := range p.initContainerStatuses {
+		status := &p.initContainerStatuses[i]
+		spec, ok := initContainers[status.Name]
+		if !ok || status.State.Running == nil {
+			continue
+		}
+		if isSidecarContainer(spec) {
+			sidecars = append(sidecars, status)
+			continue
+		}
+		c := newContainer(spec, status, start)
+		p.containers = append(p.containers, c)
+		if c.exitAt.After(end) {
+			end = c.exitAt
+		}
+	}
+	for i := range p.containerStatuses {
+		status := &p.containerStatuses[i]
+		spec, ok := containers[status.Name]
+		if !ok || status.State.Running == nil {
+			continue
+		}
+		c := newContainer(spec, status, start)
+		p.containers = append(p.containers, c)
+		if c.exitAt.After(end) {
+			end = c.exitAt
+		}
+	}
+	for i := len(sidecars) - 1; i >= 0; i-- {
+		c := newContainer(initContainers[sidecars[i].Name], sidecars[i], end)
+		p.containers = append(p.containers, c)
+		end = c.exitAt
+	}
+	return p, nil
+}
+
+// isSidecarContainer returns whether the init container is a sidecar that keeps running
+func isSidecarContainer(container *corev1.Container) bool {
+	return container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways
+}
+
+// step stops and exits the containers due at the time,
+// it returns whether the statuses of the containers changed and the events to record.
+func (p *podTerminator) step(now time.Time) (changed bool, events []podEvent) {
+	for _, c := range p.containers {
+		if !c.stopping && !now.Before(c.stopAt) {
+			c.stopping = true
+			events = append(events, podEvent{
+				eventType: corev1.EventTypeNormal,
+				reason:    "Killing",
+				message:   fmt.Sprintf("Stopping container %s", c.status.Name),
+			})
+		}
+		if c.exited || now.Before(c.exitAt) {
+			continue
+		}
+		c.exited = true
+		changed = true
+		if p.readyTransition.IsZero() {
+			p.readyTransition = c.exitAt
+		}
+
+		if c.preStopOverrun {
+			events = append(events, podEvent{
+				eventType: corev1.EventTypeWarning,
+				reason:    "FailedPreStopHook",
+				message:   fmt.Sprintf("PreStop hook for container %s did not complete within the grace period", c.status.Name),
+			})
+		}
+		if c.overrun {
+			events = append(events, podEvent{
+				eventType: corev1.EventTypeWarning,
+				reason:    "ExceededGracePeriod",
+				message:   "Container runtime did not kill the pod within specified grace period.",
+			})
+		}
+
+		reason := "Completed"
+		if c.exitCode != 0 {
+			reason = "Error"
+		}
+		terminated := &corev1.ContainerStateTerminated{
+			ExitCode:   c.exitCode,
+			Reason:     reason,
+			FinishedAt: metav1.NewTime(c.exitAt),
+		}
+		if c.status.State.Running != nil {
+			terminated.StartedAt = c.status.State.Running.StartedAt
+		}
+		c.status.State = corev1.ContainerState{
+			Terminated: terminated,
+		}
+		c.status.Ready = false
+		c.status.Started = format.Ptr(false)
+	}
+	return changed, events
+}
+
+// done returns whether all the containers exited
+func (p *podTerminator) done() bool {
+	for _, c := range p.containers {
+		if !c.exited {
+			return false
+		}
+	}
+	return true
+}
+
+// nextTime returns the time of the next stop or exit of the containers, or zero if all the containers exited
+func (p *podTerminator) nextTime() time.Time {
+	var next time.Time
+	for _, c := range p.containers {
+		var t time.Time
+		switch {
+		case !c.stopping:
+			t = c.stopAt
+		case !c.exited:
+			t = c.exitAt
+		default:
+			continue
+		}
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	return next
+}
+
+// phase returns the terminal phase of the pod, it is Succeeded if all its main containers exited with the code 0
+func (p *podTerminator) phase() corev1.PodPhase {
+	for _, status := range p.containerStatuses {
+		if status.State.Terminated == nil || status.State.Terminated.ExitCode != 0 {
+			return corev1.PodFailed
+		}
+	}
+	return corev1.PodSucceeded
+}
+
+// statusPatch returns the strategic merge patch of the statuses of the containers,
+// the pod is not ready once a container exits, and is in its terminal phase once all the containers exited.
+func (p *podTerminator) statusPatch() ([]byte, error) {
+	conditions := make([]corev1.PodCondition, 0, 2)
+	for _, typ := range []corev1.PodConditionType{corev1.PodReady, corev1.ContainersReady} {
+		conditions = append(conditions, corev1.PodCondition{
+			Type:               typ,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: metav1.NewTime(p.readyTransition),
+		})
+	}
+
+	status := map[string]any{
+		"containerStatuses": p.containerStatuses,
+		"conditions":        conditions,
+	}
+	if len(p.initContainerStatuses) != 0 {
+		status["initContainerStatuses"] = p.initContainerStatuses
+	}
+	if p.done() {
+		status["phase"] = p.phase()
+	}
+	return json.Marshal(map[string]any{
+		"status": status,
+	})
+}
+
+// syncTerminator starts to terminate the containers of the deleted pod,
+// it returns whether the containers of the pod are being terminated.
+func (c *PodController) syncTerminator(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	if pod.DeletionTimestamp == nil {
+		c.stopTerminator(pod.UID)
+		return false, nil
+	}
+	if _, ok := c.terminators.Load(pod.UID); ok {
+		return true, nil
+	}
+	if !hasRunningContainers(pod) {
+		return false, nil
+	}
+
+	terminator, err := newPodTerminator(pod)
+	if err != nil {
+		return false, err
+	}
+	if len(terminator.containers) == 0 {
+		return false, nil
+	}
+	terminatorCtx, cancel := context.WithCancel(ctx)
+	c.terminators.Store(pod.UID, cancel)
+	go c.runTerminator(terminatorCtx, pod, terminator)
+	return true, nil
+}
+
+// stopTerminator stops to terminate the containers of the pod
+func (c *PodController) stopTerminator(uid types.UID) {
+	cancel, ok := c.terminators.LoadAndDelete(uid)
+	if ok {
+		cancel()
+	}
+}
+
+// runTerminator terminates the containers of the pod and patches their statuses on changes
+func (c *PodController) runTerminator(ctx context.Context, pod *corev1.Pod, terminator *podTerminator) {
+	logger := log.FromContext(ctx)
+	logger = logger.With(
+		"pod", log.KObj(pod),
+		"node", pod.Spec.NodeName,
+	)
+	ref := &corev1.ObjectReference{
+		Kind:      "Pod",
+		UID:       pod.UID,
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+	}
+
+	for {
+		now := c.clock.Now()
+		changed, events := terminator.step(now)
+		if c.recorder != nil {
+			for _, event := range events {
+				c.recorder.Event(ref, event.eventType, event.reason, event.message)
+			}
+		}
+
+		done := terminator.done()
+		if done {
+			// The terminator is removed before the last patch,
+			// so that the stages are played on the update of the pod.
+			cancel, ok := c.terminators.LoadAndDelete(pod.UID)
+			if ok {
+				defer cancel()
+			}
+		}
+		if changed {
+			patch, err := terminator.statusPatch()
+			if err != nil {
+				logger.Error("Failed to compute termination status", err)
+			} else {
+				_, err = c.patchResource(ctx, pod, types.StrategicMergePatchType, patch, "status")
+				if err != nil {
+					logger.Error("Failed to patch termination status", err)
+				}
+			}
+		}
+		if done {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.clock.After(terminator.nextTime().Sub(now)):
+		}
+	}
+}
@@ -0,0 +1,305 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/kwok/pkg/utils/format"
+)
+
+func newTerminatingPod(start time.Time, grace int64, script string, initContainers, containers []corev1.Container) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:                       "pod0",
+			Namespace:                  "default",
+			UID:                        "uid0",
+			DeletionTimestamp:          format.Ptr(metav1.NewTime(start.Add(time.Duration(grace) * time.Second))),
+			DeletionGracePeriodSeconds: format.Ptr(grace),
+		},
+		Spec: corev1.PodSpec{
+			InitContainers: initContainers,
+			Containers:     containers,
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+	if script != "" {
+		pod.Annotations = map[string]string{
+			TerminationAnnotation: script,
+		}
+	}
+	running := corev1.ContainerState{
+		Running: &corev1.ContainerStateRunning{
+			StartedAt: metav1.NewTime(start.Add(-time.Hour)),
+		},
+	}
+	for _, container := range initContainers {
+		pod.Status.InitContainerStatuses = append(pod.Status.InitContainerStatuses, corev1.ContainerStatus{
+			Name:  container.Name,
+			Ready: true,
+			State: running,
+		})
+	}
+	for _, container := range containers {
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+			Name:  container.Name,
+			Ready: true,
+			State: running,
+		})
+	}
+	return pod
+}
+
+func TestPodTerminator(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	preStop := &corev1.Lifecycle{
+		PreStop: &corev1.LifecycleHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"sleep", "5"},
+			},
+		},
+	}
+	sidecar := func(name string) corev1.Container {
+		return corev1.Container{
+			Name:          name,
+			RestartPolicy: format.Ptr(corev1.ContainerRestartPolicyAlways),
+		}
+	}
+
+	type exit struct {
+		name     string
+		seconds  int
+		exitCode int32
+	}
+	tests := []struct {
+		name           string
+		grace          int64
+		script         string
+		initContainers []corev1.Container
+		containers     []corev1.Container
+		want           []exit
+		wantEvents     []string
+		wantPhase      corev1.PodPhase
+	}{
+		{
+			name:       "without script",
+			grace:      30,
+			containers: []corev1.Container{{Name: "app"}},
+			want: []exit{
+				{name: "app", seconds: 0, exitCode: 0},
+			},
+			wantEvents: []string{"Killing"},
+			wantPhase:  corev1.PodSucceeded,
+		},
+		{
+			name:   "within grace period",
+			grace:  30,
+			script: `{"app":{"preStop":"5s","shutdown":"10s","exitCode":143},"other":{"preStop":"5s","shutdown":"2s"}}`,
+			containers: []corev1.Container{
+				{Name: "app", Lifecycle: preStop},
+				{Name: "other"},
+			},
+			want: []exit{
+				{name: "app", seconds: 15, exitCode: 143},
+				{name: "other", seconds: 2, exitCode: 0},
+			},
+			wantEvents: []string{"Killing", "Killing"},
+			wantPhase:  corev1.PodFailed,
+		},
+		{
+			name:       "killed at the end of grace period",
+			grace:      30,
+			script:     `{"app":{"preStop":"40s"}}`,
+			containers: []corev1.Container{{Name: "app", Lifecycle: preStop}},
+			want: []exit{
+				{name: "app", seconds: 30, exitCode: 137},
+			},
+			wantEvents: []string{"Killing", "FailedPreStopHook"},
+			wantPhase:  corev1.PodFailed,
+		},
+		{
+			name:       "overrun grace period",
+			grace:      10,
+			script:     `{"app":{"shutdown":"20s","overrun":"5s"}}`,
+			containers: []corev1.Container{{Name: "app"}},
+			want: []exit{
+				{name: "app", seconds: 15, exitCode: 137},
+			},
+			wantEvents: []string{"Killing", "ExceededGracePeriod"},
+			wantPhase:  corev1.PodFailed,
+		},
+		{
+			name:   "sidecars in reverse order",
+			grace:  30,
+			script: `{"app":{"shutdown":"5s"},"sidecar0":{"shutdown":"10s"},"sidecar1":{"shutdown":"10s"}}`,
+			initContainers: []corev1.Container{
+				sidecar("sidecar0"),
+				sidecar("sidecar1"),
+			},
+			containers: []corev1.Container{{Name: "app"}},
+			want: []exit{
+				{name: "app", seconds: 5, exitCode: 0},
+				{name: "sidecar1", seconds: 15, exitCode: 0},
+				{name: "sidecar0", seconds: 25, exitCode: 0},
+			},
+			wantEvents: []string{"Killing", "Killing", "Killing"},
+			wantPhase:  corev1.PodSucceeded,
+		},
+		{
+			name:   "sidecar killed at the end of grace period",
+			grace:  30,
+			script: `{"app":{"shutdown":"25s"},"sidecar0":{"shutdown":"10s"}}`,
+			initContainers: []corev1.Container{
+				sidecar("sidecar0"),
+			},
+			containers: []corev1.Container{{Name: "app"}},
+			want: []exit{
+				{name: "app", seconds: 25, exitCode: 0},
+				{name: "sidecar0", seconds: 30, exitCode: 137},
+			},
+			wantEvents: []string{"Killing", "Killing"},
+			wantPhase:  corev1.PodSucceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newTerminatingPod(start, tt.grace, tt.script, tt.initContainers, tt.containers)
+			terminator, err := newPodTerminator(pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []exit
+			var gotEvents []string
+			now := start
+			for !terminator.done() {
+				_, events := terminator.step(now)
+				for _, event := range events {
+					gotEvents = append(gotEvents, event.reason)
+				}
+				for _, c := range terminator.containers {
+					terminated := c.status.State.Terminated
+					if terminated == nil || !terminated.FinishedAt.Time.Equal(now) {
+						continue
+					}
+					got = append(got, exit{
+						name:     c.status.Name,
+						seconds:  int(now.Sub(start) / time.Second),
+						exitCode: terminated.ExitCode,
+					})
+				}
+				if next := terminator.nextTime(); !next.IsZero() {
+					now = next
+				}
+			}
+
+			sortExits := func(exits []exit) []exit {
+				sort.Slice(exits, func(i, j int) bool {
+					return exits[i].name < exits[j].name
+				})
+				return exits
+			}
+			if !reflect.DeepEqual(sortExits(got), sortExits(tt.want)) {
+				t.Errorf("want exits %v, got %v", tt.want, got)
+			}
+			if !reflect.DeepEqual(gotEvents, tt.wantEvents) {
+				t.Errorf("want events %v, got %v", tt.wantEvents, gotEvents)
+			}
+			if phase := terminator.phase(); phase != tt.wantPhase {
+				t.Errorf("want phase %s, got %s", tt.wantPhase, phase)
+			}
+		})
+	}
+}
+
+func TestPodControllerTerminator(t *testing.T) {
+	clk := testingclock.NewFakeClock(time.Now().Truncate(time.Second))
+	pod := newTerminatingPod(clk.Now(), 30, `{"app":{"shutdown":"10s","exitCode":143}}`, nil, []corev1.Container{{Name: "app"}})
+	clientset := fake.NewSimpleClientset(pod)
+	recorder := record.NewFakeRecorder(10)
+	c := &PodController{
+		clock:       clk,
+		typedClient: clientset,
+		recorder:    recorder,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	terminating, err := c.syncTerminator(ctx, pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !terminating {
+		t.Fatal("want pod terminating")
+	}
+
+	for !clk.HasWaiters() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	clk.Step(10 * time.Second)
+	for {
+		if _, ok := c.terminators.Load(pod.UID); !ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	wantEvent := "Normal Killing Stopping container app"
+	if event := <-recorder.Events; event != wantEvent {
+		t.Errorf("want event %q, got %q", wantEvent, event)
+	}
+
+	var got *corev1.Pod
+	for got == nil || got.Status.Phase == corev1.PodRunning {
+		got, err = clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got.Status.Phase != corev1.PodFailed {
+		t.Errorf("want phase Failed, got %s", got.Status.Phase)
+	}
+	terminated := got.Status.ContainerStatuses[0].State.Terminated
+	if terminated == nil || terminated.ExitCode != 143 || terminated.Reason != "Error" {
+		t.Fatalf("want container terminated with exit code 143, got %v", got.Status.ContainerStatuses[0].State)
+	}
+	if want := clk.Now(); !terminated.FinishedAt.Time.Equal(want) {
+		t.Errorf("want finished at %s, got %s", want, terminated.FinishedAt)
+	}
+
+	terminating, err = c.syncTerminator(ctx, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if terminating {
+		t.Error("want stages played after the containers are terminated")
+	}
+}
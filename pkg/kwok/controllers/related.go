@@ -0,0 +1,226 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/utils/clock"
+
+	"sigs.k8s.io/kwok/pkg/utils/gotpl"
+	"sigs.k8s.io/kwok/pkg/utils/informer"
+	"sigs.k8s.io/kwok/pkg/utils/maps"
+)
+
+const (
+	// relatedObjectTTL is how long the objects got by the dynamic client are cached for the templates.
+	relatedObjectTTL = 5 * time.Second
+	// relatedObjectTimeout is the timeout to get an object by the dynamic client.
+	relatedObjectTimeout = 10 * time.Second
+)
+
+// relatedObjectGetter gets the objects related to a resource for the templates,
+// from the informer caches of the controller if possible, otherwise from a small TTL cache over the dynamic client.
+type relatedObjectGetter struct {
+	clock           clock.Clock
+	dynamicClient   dynamic.Interface
+	restMapper      meta.RESTMapper
+	nodeCacheGetter informer.Getter[*corev1.Node]
+	podCacheGetter  informer.Getter[*corev1.Pod]
+
+	cache     maps.SyncMap[relatedObjectKey, relatedObjectEntry]
+	sweepMut  sync.Mutex
+	lastSweep time.Time
+}
+
+type relatedObjectKey struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+}
+
+type relatedObjectEntry struct {
+	Object  map[string]interface{}
+	Expires time.Time
+}
+
+// funcMap returns the template functions to get the related objects
+func (g *relatedObjectGetter) funcMap() gotpl.FuncMap {
+	return gotpl.FuncMap{
+		"Get":   g.Get,
+		"Owner": g.Owner,
+	}
+}
+
+// Get returns the object by `Get "<apiVersion>" "<kind>" "<name>"` for cluster-scoped resources,
+// or `Get "<apiVersion>" "<kind>" "<namespace>" "<name>"` for namespaced resources.
+// An empty object is returned if it is not found.
+func (g *relatedObjectGetter) Get(apiVersion, kind string, args ...string) (map[string]interface{}, error) {
+	key := relatedObjectKey{
+		APIVersion: apiVersion,
+		Kind:       kind,
+	}
+	switch len(args) {
+	case 1:
+		key.Name = args[0]
+	case 2:
+		key.Namespace, key.Name = args[0], args[1]
+	default:
+		return nil, fmt.Errorf("want the name, or the namespace and the name of %s %s, got %d arguments", apiVersion, kind, len(args))
+	}
+	if key.Name == "" {
+		return map[string]interface{}{}, nil
+	}
+
+	if obj, ok := g.getFromInformer(key); ok {
+		return obj, nil
+	}
+
+	now := g.clock.Now()
+	if entry, ok := g.cache.Load(key); ok && now.Before(entry.Expires) {
+		return entry.Object, nil
+	}
+
+	obj, err := g.getFromClient(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s %q: %w", apiVersion, kind, key.Name, err)
+	}
+	g.sweep(now)
+	g.cache.Store(key, relatedObjectEntry{
+		Object:  obj,
+		Expires: now.Add(relatedObjectTTL),
+	})
+	return obj, nil
+}
+
+// Owner returns the controller owner of the object, or the first owner if there is no controller.
+// An empty object is returned if it has no owner or the owner is not found.
+func (g *relatedObjectGetter) Owner(obj interface{}) (map[string]interface{}, error) {
+	data, ok := obj.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("want an object to get the owner, got %T", obj)
+	}
+	u := unstructured.Unstructured{Object: data}
+	refs := u.GetOwnerReferences()
+	if len(refs) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	owner := refs[0]
+	if ref := metav1.GetControllerOfNoCopy(&u); ref != nil {
+		owner = *ref
+	}
+	return g.Get(owner.APIVersion, owner.Kind, u.GetNamespace(), owner.Name)
+}
+
+func (g *relatedObjectGetter) getFromInformer(key relatedObjectKey) (map[string]interface{}, bool) {
+	if key.APIVersion != "v1" {
+		return nil, false
+	}
+
+	var obj runtime.Object
+	switch key.Kind {
+	case "Node":
+		if g.nodeCacheGetter == nil {
+			return nil, false
+		}
+		node, ok := g.nodeCacheGetter.Get(key.Name)
+		if !ok {
+			return nil, false
+		}
+		obj = node
+	case "Pod":
+		if g.podCacheGetter == nil {
+			return nil, false
+		}
+		pod, ok := g.podCacheGetter.GetWithNamespace(key.Name, key.Namespace)
+		if !ok {
+			return nil, false
+		}
+		obj = pod
+	default:
+		return nil, false
+	}
+
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, false
+	}
+	data["apiVersion"] = key.APIVersion
+	data["kind"] = key.Kind
+	return data, true
+}
+
+func (g *relatedObjectGetter) getFromClient(key relatedObjectKey) (map[string]interface{}, error) {
+	if g.dynamicClient == nil || g.restMapper == nil {
+		return nil, fmt.Errorf("dynamic client is not available")
+	}
+	gv, err := schema.ParseGroupVersion(key.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := g.restMapper.RESTMapping(gv.WithKind(key.Kind).GroupKind(), gv.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	var cli dynamic.ResourceInterface = g.dynamicClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if key.Namespace == "" {
+			return nil, fmt.Errorf("namespace is required")
+		}
+		cli = g.dynamicClient.Resource(mapping.Resource).Namespace(key.Namespace)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), relatedObjectTimeout)
+	defer cancel()
+	obj, err := cli.Get(ctx, key.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return map[string]interface{}{}, nil
+		}
+		return nil, err
+	}
+	return obj.Object, nil
+}
+
+// sweep deletes the expired objects at most once per TTL
+func (g *relatedObjectGetter) sweep(now time.Time) {
+	g.sweepMut.Lock()
+	defer g.sweepMut.Unlock()
+	if now.Sub(g.lastSweep) < relatedObjectTTL {
+		return
+	}
+	g.lastSweep = now
+	g.cache.Range(func(key relatedObjectKey, entry relatedObjectEntry) bool {
+		if !now.Before(entry.Expires) {
+			g.cache.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/kwok/pkg/utils/format"
+	"sigs.k8s.io/kwok/pkg/utils/gotpl"
+	"sigs.k8s.io/kwok/pkg/utils/maps"
+)
+
+func TestRelatedObjectGetter(t *testing.T) {
+	scheme := runtime.NewScheme()
+	err := corev1.AddToScheme(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = appsv1.AddToScheme(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &corev1.Node{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Node"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node0",
+			Labels: map[string]string{
+				"topology.kubernetes.io/zone": "zone-a",
+			},
+		},
+	}
+	rs := &appsv1.ReplicaSet{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "ReplicaSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "rs0",
+			Namespace: "default",
+			Annotations: map[string]string{
+				"deployment.kubernetes.io/revision": "3",
+			},
+		},
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme, node, rs)
+
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(corev1.SchemeGroupVersion.WithKind("Node"), meta.RESTScopeRoot)
+	restMapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	restMapper.Add(appsv1.SchemeGroupVersion.WithKind("ReplicaSet"), meta.RESTScopeNamespace)
+
+	clock := clocktesting.NewFakeClock(time.Now())
+	related := &relatedObjectGetter{
+		clock:         clock,
+		dynamicClient: dynamicClient,
+		restMapper:    restMapper,
+	}
+	renderer := gotpl.NewRenderer(maps.Merge(defaultFuncMap, related.funcMap()))
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod0",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: "apps/v1",
+					Kind:       "ReplicaSet",
+					Name:       "rs0",
+					Controller: format.Ptr(true),
+				},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "node0",
+		},
+	}
+
+	const tpl = `
+zone: {{ (Get "v1" "Node" .spec.nodeName).metadata.labels | dig "topology.kubernetes.io/zone" "" | Quote }}
+revision: {{ (Owner .).metadata.annotations | dig "deployment.kubernetes.io/revision" "" | Quote }}
+missing: {{ (Get "v1" "ConfigMap" .metadata.namespace "not-found") | len }}
+`
+	render := func() string {
+		t.Helper()
+		out, err := renderer.ToJSON(tpl, stageTemplateData{resource: pod, attempt: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+
+	want := `{"missing":0,"revision":"3","zone":"zone-a"}`
+	if got := render(); got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+
+	// The node is cached until the TTL expires.
+	node.Labels["topology.kubernetes.io/zone"] = "zone-b"
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dynamicClient.Tracker().Update(corev1.SchemeGroupVersion.WithResource("nodes"), &unstructured.Unstructured{Object: data}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := render(); got != want {
+		t.Fatalf("want cached %s, got %s", want, got)
+	}
+	clock.Step(relatedObjectTTL)
+	want = `{"missing":0,"revision":"3","zone":"zone-b"}`
+	if got := render(); got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+
+	_, err = related.Get("v1", "ConfigMap", "cm0")
+	if err == nil {
+		t.Fatal("want error for namespaced object without namespace")
+	}
+}
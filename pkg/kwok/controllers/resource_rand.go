@@ -0,0 +1,98 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/kwok/pkg/utils/maps"
+)
+
+// resourceRands holds a random source for each resource, derived from the seed and the UID of the resource,
+// so the path of a resource through the stages does not depend on the other resources.
+type resourceRands struct {
+	seed  int64
+	rands maps.SyncMap[types.UID, *rand.Rand]
+}
+
+// newResourceRands returns a new resourceRands, it returns nil if the seed is 0
+func newResourceRands(seed int64) *resourceRands {
+	if seed == 0 {
+		return nil
+	}
+	return &resourceRands{
+		seed: seed,
+	}
+}
+
+// Get returns the random source of the resource, or nil to use the global source.
+// The random source is safe for concurrent use, as the stages of the resource are matched and played by different workers.
+func (r *resourceRands) Get(uid types.UID) *rand.Rand {
+	if r == nil {
+		return nil
+	}
+	rnd, ok := r.rands.Load(uid)
+	if ok {
+		return rnd
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(uid))
+	//nolint:gosec
+	rnd = rand.New(&lockedSource{src: rand.NewSource(r.seed ^ int64(h.Sum64())).(rand.Source64)})
+	rnd, _ = r.rands.LoadOrStore(uid, rnd)
+	return rnd
+}
+
+// Delete deletes the random source of the resource
+func (r *resourceRands) Delete(uid types.UID) {
+	if r == nil {
+		return
+	}
+	r.rands.Delete(uid)
+}
+
+// lockedSource is a random source safe for concurrent use
+type lockedSource struct {
+	mut sync.Mutex
+	src rand.Source64
+}
+
+// Int63 implements rand.Source
+func (s *lockedSource) Int63() int64 {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.src.Int63()
+}
+
+// Uint64 implements rand.Source64
+func (s *lockedSource) Uint64() uint64 {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.src.Uint64()
+}
+
+// Seed implements rand.Source
+func (s *lockedSource) Seed(seed int64) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.src.Seed(seed)
+}
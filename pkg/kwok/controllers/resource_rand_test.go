@@ -0,0 +1,46 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+)
+
+func TestResourceRands(t *testing.T) {
+	if rnd := newResourceRands(0).Get("uid0"); rnd != nil {
+		t.Fatalf("want nil random source without seed")
+	}
+
+	first := newResourceRands(1)
+	second := newResourceRands(1)
+
+	// Interleave the resources in different orders
+	want := []int64{first.Get("uid0").Int63(), first.Get("uid1").Int63(), first.Get("uid0").Int63()}
+	got1 := second.Get("uid1").Int63()
+	got0 := []int64{second.Get("uid0").Int63(), second.Get("uid0").Int63()}
+	if want[0] != got0[0] || want[2] != got0[1] || want[1] != got1 {
+		t.Errorf("want the same sequence for each resource, got %v and %v, %v", want, got0, got1)
+	}
+	if want[0] == want[1] {
+		t.Errorf("want different sequences for different resources")
+	}
+
+	first.Delete("uid0")
+	if got := first.Get("uid0").Int63(); got != want[0] {
+		t.Errorf("want the sequence restarted after delete, got %v, want %v", got, want[0])
+	}
+}
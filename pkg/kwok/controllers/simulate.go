@@ -0,0 +1,484 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/utils/expression"
+	"sigs.k8s.io/kwok/pkg/utils/format"
+	"sigs.k8s.io/kwok/pkg/utils/gotpl"
+	"sigs.k8s.io/kwok/pkg/utils/maps"
+)
+
+// SimulatorConfig is the configuration for the Simulator
+type SimulatorConfig struct {
+	Lifecycle Lifecycle
+	FuncMap   gotpl.FuncMap
+	NodeIP    string
+	NodeName  string
+	NodePort  int
+	CIDR      string
+	Seed      int64
+	StartTime time.Time
+	MaxSteps  int
+}
+
+// Simulator plays the stages of a resource offline, without talking to the apiserver.
+type Simulator struct {
+	lifecycle Lifecycle
+	renderer  gotpl.Renderer
+	rand      *rand.Rand
+	start     time.Time
+	now       time.Time
+	maxSteps  int
+	nodeIP    string
+	nodeName  string
+	nodePort  int
+	ipPool    *ipPool
+}
+
+// SimulateStep is a stage played by the Simulator.
+type SimulateStep struct {
+	// Step is the sequence number of the step, starting from 1.
+	Step int `json:"step"`
+	// Stage is the name of the matched stage.
+	Stage string `json:"stage"`
+	// Attempt is the number of times the stage has been played, including this one.
+	Attempt int64 `json:"attempt"`
+	// Delay is the delay of the stage.
+	Delay metav1.Duration `json:"delay"`
+	// Elapsed is the simulated time elapsed since the start.
+	Elapsed metav1.Duration `json:"elapsed"`
+	// Event is the event that would be sent.
+	Event *SimulateEvent `json:"event,omitempty"`
+	// Patches are the rendered patches that would be sent.
+	Patches []SimulatePatch `json:"patches,omitempty"`
+	// Creates are the rendered resources that would be created.
+	Creates []*unstructured.Unstructured `json:"creates,omitempty"`
+	// Webhook means the webhook would be called, its response is not simulated.
+	Webhook bool `json:"webhook,omitempty"`
+	// Drain means the node would be cordoned and its pods would be evicted, the evictions are not simulated.
+	Drain bool `json:"drain,omitempty"`
+	// Delete means the resource would be deleted.
+	Delete bool `json:"delete,omitempty"`
+	// Resource is the resource after the stage is played.
+	Resource *unstructured.Unstructured `json:"resource,omitempty"`
+}
+
+// SimulateEvent is an event that would be sent by a stage.
+type SimulateEvent struct {
+	Type    string `json:"type"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// SimulatePatch is a patch that would be sent by a stage.
+type SimulatePatch struct {
+	Subresource string          `json:"subresource,omitempty"`
+	Type        types.PatchType `json:"type"`
+	Patch       json.RawMessage `json:"patch"`
+}
+
+// NewSimulator returns a new Simulator.
+func NewSimulator(conf SimulatorConfig) (*Simulator, error) {
+	s := &Simulator{
+		lifecycle: conf.Lifecycle,
+		//nolint:gosec
+		rand:     rand.New(rand.NewSource(conf.Seed)),
+		start:    conf.StartTime,
+		now:      conf.StartTime,
+		maxSteps: conf.MaxSteps,
+		nodeIP:   conf.NodeIP,
+		nodeName: conf.NodeName,
+		nodePort: conf.NodePort,
+	}
+	if s.start.IsZero() {
+		s.start = time.Now()
+		s.now = s.start
+	}
+	if conf.CIDR != "" {
+		ipnet, err := parseCIDR(conf.CIDR)
+		if err != nil {
+			return nil, err
+		}
+		s.ipPool = newIPPool(ipnet)
+	}
+
+	funcMap := maps.Merge(defaultFuncMap, conf.FuncMap, gotpl.FuncMap{
+		"Now":        s.funcNow,
+		"NodeIP":     s.funcNodeIP,
+		"NodeIPWith": s.funcNodeIPWith,
+		"NodeName":   s.funcNodeName,
+		"NodePort":   s.funcNodePort,
+		"PodIP":      s.funcPodIP,
+		"PodIPWith":  s.funcPodIPWith,
+		"NodeConditions": func() interface{} {
+			return nodeConditionsData
+		},
+		// The related objects are not available offline.
+		"Get": func(apiVersion, kind string, args ...string) map[string]interface{} {
+			return map[string]interface{}{}
+		},
+		"Owner": func(obj interface{}) map[string]interface{} {
+			return map[string]interface{}{}
+		},
+	})
+	s.renderer = gotpl.NewRenderer(funcMap)
+	return s, nil
+}
+
+// Simulate plays the stages of the resource until no stage matches,
+// the resource is deleted or not modified, or the max steps is reached.
+func (s *Simulator) Simulate(ctx context.Context, resource *unstructured.Unstructured, visit func(step *SimulateStep) error) error {
+	gvk := resource.GroupVersionKind()
+
+	// Use the typed object if it is known, so that the templates see the same data as the controllers.
+	var newTyped func() (interface{}, error)
+	var patchMeta strategicpatch.LookupPatchMeta
+	if typed, err := scheme.Scheme.New(gvk); err == nil {
+		patchMeta, err = strategicpatch.NewPatchMetaFromStruct(typed)
+		if err != nil {
+			return err
+		}
+		newTyped = func() (interface{}, error) {
+			return scheme.Scheme.New(gvk)
+		}
+	}
+
+	current, err := s.normalize(resource.Object, newTyped)
+	if err != nil {
+		return err
+	}
+
+	attempts := map[string]int64{}
+	var pending []simulateJob
+	for step := 1; s.maxSteps <= 0 || step <= s.maxSteps; step++ {
+		obj := &unstructured.Unstructured{}
+		err = obj.UnmarshalJSON(current)
+		if err != nil {
+			return err
+		}
+
+		data, err := expression.ToJSONStandard(obj.Object)
+		if err != nil {
+			return err
+		}
+
+		// The stages are only matched again when the resource is modified,
+		// the stages of the other groups matched before are still delayed.
+		if pending == nil {
+			lifecycle := s.lifecycle.Available(func(stageName string) int64 {
+				return attempts[stageName]
+			})
+			stages, err := lifecycle.Match(ctx, obj.GetLabels(), obj.GetAnnotations(), data, s.rand)
+			if err != nil {
+				return fmt.Errorf("stage match: %w", err)
+			}
+			for _, stage := range stages {
+				delay, _ := stage.Delay(ctx, data, s.now, s.rand)
+				delay = stage.Backoff(delay, attempts[stage.Name()]+1)
+				pending = append(pending, simulateJob{stage: stage, delay: delay, readyAt: s.now.Add(delay)})
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		// Play the stage of the group that is ready first.
+		next := 0
+		for i, job := range pending {
+			if job.readyAt.Before(pending[next].readyAt) {
+				next = i
+			}
+		}
+		stage := pending[next].stage
+		delay := pending[next].delay
+		s.now = pending[next].readyAt
+		pending = append(pending[:next], pending[next+1:]...)
+
+		attempt := attempts[stage.Name()] + 1
+		attempts[stage.Name()] = attempt
+
+		result := &SimulateStep{
+			Step:    step,
+			Stage:   stage.Name(),
+			Attempt: attempt,
+			Delay:   metav1.Duration{Duration: delay},
+			Elapsed: metav1.Duration{Duration: s.now.Sub(s.start)},
+		}
+
+		latest, err := s.playStage(current, stage, attempt, patchMeta, newTyped, result)
+		if err != nil {
+			return fmt.Errorf("play stage %q: %w", stage.Name(), err)
+		}
+
+		if !result.Delete {
+			result.Resource = &unstructured.Unstructured{}
+			err = result.Resource.UnmarshalJSON(latest)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = visit(result)
+		if err != nil {
+			return err
+		}
+
+		if result.Delete {
+			return nil
+		}
+		// The controllers are only triggered again when the resource is modified.
+		if !bytes.Equal(current, latest) {
+			current = latest
+			pending = nil
+		} else if len(pending) == 0 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// simulateJob is a stage delayed to be played in the simulation.
+type simulateJob struct {
+	stage   *LifecycleStage
+	delay   time.Duration
+	readyAt time.Time
+}
+
+func (s *Simulator) playStage(current []byte, stage *LifecycleStage, attempt int64, patchMeta strategicpatch.LookupPatchMeta, newTyped func() (interface{}, error), result *SimulateStep) ([]byte, error) {
+	next := stage.Next()
+	result.Webhook = next.Webhook != nil
+
+	u := unstructured.Unstructured{}
+	err := u.UnmarshalJSON(current)
+	if err != nil {
+		return nil, err
+	}
+
+	// The sampling and the rate limit of the event are not simulated.
+	if next.Event != nil {
+		reason, message, err := renderStageEvent(s.renderer, stageTemplateData{resource: u.Object, attempt: attempt}, next.Event)
+		if err != nil {
+			return nil, err
+		}
+		result.Event = &SimulateEvent{
+			Type:    next.Event.Type,
+			Reason:  reason,
+			Message: message,
+		}
+	}
+	if next.Finalizers != nil {
+		ops := finalizersModify(u.GetFinalizers(), next.Finalizers)
+		if len(ops) != 0 {
+			data, err := json.Marshal(ops)
+			if err != nil {
+				return nil, err
+			}
+			current, err = s.apply(current, "", types.JSONPatchType, data, patchMeta, newTyped, result)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(next.Create) != 0 {
+		owner := metav1.OwnerReference{
+			APIVersion: u.GetAPIVersion(),
+			Kind:       u.GetKind(),
+			Name:       u.GetName(),
+			UID:        u.GetUID(),
+		}
+		data := stageTemplateData{resource: u.Object, attempt: attempt}
+		for i := range next.Create {
+			obj, _, err := renderStageCreate(s.renderer, nil, owner, u.GetNamespace(), data, &next.Create[i])
+			if err != nil {
+				return nil, fmt.Errorf("create %d: %w", i, err)
+			}
+			result.Creates = append(result.Creates, obj)
+		}
+	}
+
+	if next.Drain != nil {
+		result.Drain = true
+		current, err = s.apply(current, "", types.MergePatchType, cordonNodePatch, patchMeta, newTyped, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if next.Delete {
+		err = u.UnmarshalJSON(current)
+		if err != nil {
+			return nil, err
+		}
+		// The apiserver only marks the resource as deleting while it still has finalizers.
+		if len(u.GetFinalizers()) == 0 {
+			result.Delete = true
+			return current, nil
+		}
+		if u.GetDeletionTimestamp() == nil {
+			u.SetDeletionTimestamp(&metav1.Time{Time: s.now})
+		}
+		return s.normalize(u.Object, newTyped)
+	}
+
+	if next.StatusTemplate != "" {
+		patch := internalversion.StagePatch{
+			Subresource: "status",
+			Root:        "status",
+			Template:    next.StatusTemplate,
+		}
+		if patchMeta != nil {
+			patch.Type = format.Ptr(internalversion.StagePatchTypeStrategicMergePatch)
+		}
+		current, err = s.renderAndApply(current, &patch, attempt, patchMeta, newTyped, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range next.Patches {
+		current, err = s.renderAndApply(current, &next.Patches[i], attempt, patchMeta, newTyped, result)
+		if err != nil {
+			return nil, fmt.Errorf("patch %d: %w", i, err)
+		}
+	}
+
+	if u.GetAnnotations()[NextStageAnnotation] == stage.Name() {
+		current, err = s.apply(current, "", types.MergePatchType, removeNextStageAnnotationPatch, patchMeta, newTyped, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+func (s *Simulator) renderAndApply(current []byte, patch *internalversion.StagePatch, attempt int64, patchMeta strategicpatch.LookupPatchMeta, newTyped func() (interface{}, error), result *SimulateStep) ([]byte, error) {
+	var obj map[string]interface{}
+	err := json.Unmarshal(current, &obj)
+	if err != nil {
+		return nil, err
+	}
+	patchType, data, err := renderStagePatch(s.renderer, stageTemplateData{resource: obj, attempt: attempt}, patch)
+	if err != nil {
+		return nil, err
+	}
+	if !isResourceSubresource(patch.Subresource) {
+		// The subresource is not the resource itself, the patch is recorded without being applied.
+		result.Patches = append(result.Patches, SimulatePatch{
+			Subresource: patch.Subresource,
+			Type:        patchType,
+			Patch:       data,
+		})
+		return current, nil
+	}
+	return s.apply(current, patch.Subresource, patchType, data, patchMeta, newTyped, result)
+}
+
+func (s *Simulator) apply(current []byte, subresource string, patchType types.PatchType, data []byte, patchMeta strategicpatch.LookupPatchMeta, newTyped func() (interface{}, error), result *SimulateStep) ([]byte, error) {
+	sum, err := applyStagePatch(current, patchType, data, patchMeta)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]interface{}
+	err = json.Unmarshal(sum, &obj)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := s.normalize(obj, newTyped)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(current, latest) {
+		return current, nil
+	}
+	result.Patches = append(result.Patches, SimulatePatch{
+		Subresource: subresource,
+		Type:        patchType,
+		Patch:       data,
+	})
+	return latest, nil
+}
+
+// normalize round-trips the object through the typed object if it is known,
+// to drop the fields that are not part of the resource.
+func (s *Simulator) normalize(obj map[string]interface{}, newTyped func() (interface{}, error)) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	if newTyped == nil {
+		return data, nil
+	}
+	typed, err := newTyped()
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, typed)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(typed)
+}
+
+func (s *Simulator) funcNow() string {
+	return s.now.Format(time.RFC3339Nano)
+}
+
+func (s *Simulator) funcNodeIP() string {
+	return s.nodeIP
+}
+
+func (s *Simulator) funcNodeIPWith(nodeName string) string {
+	return s.nodeIP
+}
+
+func (s *Simulator) funcNodeName() string {
+	return s.nodeName
+}
+
+func (s *Simulator) funcNodePort() int {
+	return s.nodePort
+}
+
+func (s *Simulator) funcPodIP() string {
+	if s.ipPool == nil {
+		return s.nodeIP
+	}
+	return s.ipPool.Get()
+}
+
+func (s *Simulator) funcPodIPWith(nodeName string, hostNetwork bool, uid, name, namespace string) string {
+	if hostNetwork {
+		return s.funcNodeIPWith(nodeName)
+	}
+	return s.funcPodIP()
+}
@@ -0,0 +1,547 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	podfast "sigs.k8s.io/kwok/kustomize/stage/pod/fast"
+	podgeneral "sigs.k8s.io/kwok/kustomize/stage/pod/general"
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/config"
+	"sigs.k8s.io/kwok/pkg/utils/slices"
+)
+
+func TestSimulator(t *testing.T) {
+	podStages, err := slices.MapWithError([]string{
+		podfast.DefaultPodReady,
+		podfast.DefaultPodComplete,
+		podfast.DefaultPodDelete,
+	}, config.UnmarshalWithType[*internalversion.Stage, string])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	podGeneralStages, err := slices.MapWithError([]string{
+		podgeneral.DefaultPodCreate,
+		podgeneral.DefaultPodInitContainerRunning,
+		podgeneral.DefaultPodInitContainerCompleted,
+		podgeneral.DefaultPodInitialized,
+		podgeneral.DefaultPodReady,
+		podgeneral.DefaultPodComplete,
+		podgeneral.DefaultPodSidecarContainerTerminated,
+		podgeneral.DefaultPodRemoveFinalizer,
+		podgeneral.DefaultPodDelete,
+	}, config.UnmarshalWithType[*internalversion.Stage, string])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tickStage, err := config.UnmarshalWithType[*internalversion.Stage](`
+apiVersion: kwok.x-k8s.io/v1alpha1
+kind: Stage
+metadata:
+  name: tick
+spec:
+  resourceRef:
+    apiGroup: v1
+    kind: ConfigMap
+  selector: {}
+  delay:
+    durationMilliseconds: 1000
+  next:
+    patches:
+    - root: data
+      template: 'now: {{ Now | Quote }}'
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restartStage, err := config.UnmarshalWithType[*internalversion.Stage](`
+apiVersion: kwok.x-k8s.io/v1alpha1
+kind: Stage
+metadata:
+  name: restart
+spec:
+  resourceRef:
+    apiGroup: v1
+    kind: ConfigMap
+  selector: {}
+  delay:
+    durationMilliseconds: 1000
+  repeat:
+    maxCount: 4
+    backoffMultiplier: 2
+    maxDelayMilliseconds: 5000
+  next:
+    patches:
+    - root: data
+      template: 'attempt: {{ .Attempt | Quote }}'
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startTime := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		stages     []*internalversion.Stage
+		resource   string
+		maxSteps   int
+		wantStages []string
+		wantDelete bool
+		check      func(t *testing.T, steps []*SimulateStep)
+	}{
+		{
+			name:   "pod complete",
+			stages: podStages,
+			resource: `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: pod0
+  namespace: default
+  ownerReferences:
+  - apiVersion: batch/v1
+    kind: Job
+    name: job0
+    uid: job0
+spec:
+  nodeName: node0
+  containers:
+  - name: container0
+    image: busybox
+`,
+			wantStages: []string{"pod-ready", "pod-complete"},
+			check: func(t *testing.T, steps []*SimulateStep) {
+				phase, _, _ := unstructured.NestedString(steps[1].Resource.Object, "status", "phase")
+				if phase != "Succeeded" {
+					t.Errorf("want phase Succeeded, got %q", phase)
+				}
+				podIP, _, _ := unstructured.NestedString(steps[1].Resource.Object, "status", "podIP")
+				if podIP != "10.0.0.1" {
+					t.Errorf("want podIP 10.0.0.1, got %q", podIP)
+				}
+			},
+		},
+		{
+			name:   "pod next stage annotation",
+			stages: podStages,
+			resource: `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: pod0
+  namespace: default
+  annotations:
+    kwok.x-k8s.io/next-stage: pod-complete
+spec:
+  nodeName: node0
+  containers:
+  - name: container0
+    image: busybox
+status:
+  phase: Running
+  containerStatuses:
+  - name: container0
+    image: busybox
+    ready: true
+`,
+			// The pod-ready matches the pod as well, it is played after the annotation is removed.
+			wantStages: []string{"pod-complete", "pod-ready"},
+			check: func(t *testing.T, steps []*SimulateStep) {
+				phase, _, _ := unstructured.NestedString(steps[0].Resource.Object, "status", "phase")
+				if phase != "Succeeded" {
+					t.Errorf("want phase Succeeded, got %q", phase)
+				}
+				if _, ok := steps[0].Resource.GetAnnotations()[NextStageAnnotation]; ok {
+					t.Errorf("want annotation %s removed", NextStageAnnotation)
+				}
+			},
+		},
+		{
+			name:   "pod delete",
+			stages: podStages,
+			resource: `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: pod0
+  namespace: default
+  deletionTimestamp: "2023-01-01T00:00:00Z"
+  finalizers:
+  - kwok.x-k8s.io/fake
+spec:
+  nodeName: node0
+  containers:
+  - name: container0
+    image: busybox
+`,
+			wantStages: []string{"pod-delete"},
+			wantDelete: true,
+		},
+		{
+			name:   "pod general with init containers and sidecars",
+			stages: podGeneralStages,
+			resource: `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: pod0
+  namespace: default
+  annotations:
+    kwok.x-k8s.io/pod-init-container-running-delay: 10s
+  ownerReferences:
+  - apiVersion: batch/v1
+    kind: Job
+    name: job0
+    uid: job0
+spec:
+  nodeName: node0
+  initContainers:
+  - name: init0
+    image: busybox
+  - name: sidecar0
+    image: busybox
+    restartPolicy: Always
+  - name: sidecar1
+    image: busybox
+    restartPolicy: Always
+  - name: init1
+    image: busybox
+  containers:
+  - name: container0
+    image: busybox
+`,
+			wantStages: []string{
+				"pod-create",
+				"pod-init-container-running",
+				"pod-init-container-completed",
+				"pod-init-container-running",
+				"pod-init-container-running",
+				"pod-init-container-running",
+				"pod-init-container-completed",
+				"pod-initialized",
+				"pod-ready",
+				"pod-complete",
+				"pod-sidecar-container-terminated",
+				"pod-sidecar-container-terminated",
+			},
+			check: func(t *testing.T, steps []*SimulateStep) {
+				for _, step := range steps {
+					if step.Stage == "pod-init-container-running" && step.Delay.Duration != 10*time.Second {
+						t.Errorf("step %d: want delay 10s, got %s", step.Step, step.Delay.Duration)
+					}
+				}
+
+				// The main container is started after all the init containers, while the sidecars keep running.
+				statuses, _, _ := unstructured.NestedSlice(steps[8].Resource.Object, "status", "initContainerStatuses")
+				wantStates := []string{"terminated", "running", "running", "terminated"}
+				if len(statuses) != len(wantStates) {
+					t.Fatalf("want %d init container statuses, got %d", len(wantStates), len(statuses))
+				}
+				for i, status := range statuses {
+					state, _, _ := unstructured.NestedMap(status.(map[string]interface{}), "state")
+					if _, ok := state[wantStates[i]]; !ok {
+						t.Errorf("want init container %d %s, got %v", i, wantStates[i], state)
+					}
+				}
+				phase, _, _ := unstructured.NestedString(steps[9].Resource.Object, "status", "phase")
+				if phase != "Running" {
+					t.Errorf("want phase Running while the sidecars are running, got %q", phase)
+				}
+
+				// The sidecars are stopped in reverse order.
+				statuses, _, _ = unstructured.NestedSlice(steps[10].Resource.Object, "status", "initContainerStatuses")
+				if _, ok, _ := unstructured.NestedMap(statuses[2].(map[string]interface{}), "state", "terminated"); !ok {
+					t.Errorf("want sidecar1 terminated first, got %v", statuses[2])
+				}
+				if _, ok, _ := unstructured.NestedMap(statuses[1].(map[string]interface{}), "state", "running"); !ok {
+					t.Errorf("want sidecar0 running, got %v", statuses[1])
+				}
+				phase, _, _ = unstructured.NestedString(steps[11].Resource.Object, "status", "phase")
+				if phase != "Succeeded" {
+					t.Errorf("want phase Succeeded, got %q", phase)
+				}
+			},
+		},
+		{
+			name:   "pod general delete waits for running containers",
+			stages: podGeneralStages,
+			resource: `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: pod0
+  namespace: default
+  deletionTimestamp: "2023-01-01T00:00:00Z"
+  finalizers:
+  - kwok.x-k8s.io/fake
+spec:
+  nodeName: node0
+  initContainers:
+  - name: sidecar0
+    image: busybox
+    restartPolicy: Always
+  containers:
+  - name: container0
+    image: busybox
+status:
+  phase: Running
+  podIP: 10.0.0.1
+  initContainerStatuses:
+  - name: sidecar0
+    image: busybox
+    ready: true
+    started: true
+    state:
+      running:
+        startedAt: "2023-01-01T00:00:00Z"
+  containerStatuses:
+  - name: container0
+    image: busybox
+    ready: true
+    started: true
+    state:
+      running:
+        startedAt: "2023-01-01T00:00:00Z"
+`,
+		},
+		{
+			name:   "pod general delete with terminated containers",
+			stages: podGeneralStages,
+			resource: `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: pod0
+  namespace: default
+  deletionTimestamp: "2023-01-01T00:00:00Z"
+  finalizers:
+  - kwok.x-k8s.io/fake
+spec:
+  nodeName: node0
+  initContainers:
+  - name: sidecar0
+    image: busybox
+    restartPolicy: Always
+  containers:
+  - name: container0
+    image: busybox
+status:
+  phase: Running
+  podIP: 10.0.0.1
+  initContainerStatuses:
+  - name: sidecar0
+    image: busybox
+    ready: false
+    started: false
+    state:
+      terminated:
+        exitCode: 0
+        reason: Completed
+        startedAt: "2023-01-01T00:00:00Z"
+        finishedAt: "2023-01-01T00:00:01Z"
+  containerStatuses:
+  - name: container0
+    image: busybox
+    ready: false
+    started: false
+    state:
+      terminated:
+        exitCode: 0
+        reason: Completed
+        startedAt: "2023-01-01T00:00:00Z"
+        finishedAt: "2023-01-01T00:00:01Z"
+`,
+			wantStages: []string{
+				"pod-remove-finalizer",
+				"pod-delete",
+			},
+			wantDelete: true,
+		},
+		{
+			name:   "max steps",
+			stages: []*internalversion.Stage{tickStage},
+			resource: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm0
+  namespace: default
+`,
+			maxSteps:   3,
+			wantStages: []string{"tick", "tick", "tick"},
+			check: func(t *testing.T, steps []*SimulateStep) {
+				now, _, _ := unstructured.NestedString(steps[2].Resource.Object, "data", "now")
+				if want := startTime.Add(3 * time.Second).Format(time.RFC3339Nano); now != want {
+					t.Errorf("want now %q, got %q", want, now)
+				}
+				if steps[2].Elapsed.Duration != 3*time.Second {
+					t.Errorf("want elapsed 3s, got %s", steps[2].Elapsed.Duration)
+				}
+			},
+		},
+		{
+			name:   "repeat with backoff",
+			stages: []*internalversion.Stage{restartStage},
+			resource: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm0
+  namespace: default
+`,
+			wantStages: []string{"restart", "restart", "restart", "restart"},
+			check: func(t *testing.T, steps []*SimulateStep) {
+				wantDelays := []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+				for i, step := range steps {
+					if step.Delay.Duration != wantDelays[i] {
+						t.Errorf("step %d: want delay %s, got %s", step.Step, wantDelays[i], step.Delay.Duration)
+					}
+					attempt, _, _ := unstructured.NestedString(step.Resource.Object, "data", "attempt")
+					if want := strconv.Itoa(i + 1); attempt != want {
+						t.Errorf("step %d: want attempt %s, got %q", step.Step, want, attempt)
+					}
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lifecycle, err := NewLifecycle(tt.stages, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			simulator, err := NewSimulator(SimulatorConfig{
+				Lifecycle: lifecycle,
+				NodeIP:    defaultNodeIP,
+				NodeName:  "node0",
+				StartTime: startTime,
+				MaxSteps:  tt.maxSteps,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resource := &unstructured.Unstructured{}
+			err = yaml.Unmarshal([]byte(tt.resource), &resource.Object)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var steps []*SimulateStep
+			err = simulator.Simulate(context.Background(), resource, func(step *SimulateStep) error {
+				steps = append(steps, step)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotStages := slices.Map(steps, func(step *SimulateStep) string {
+				return step.Stage
+			})
+			if len(gotStages) != len(tt.wantStages) || len(gotStages) != 0 && !reflect.DeepEqual(gotStages, tt.wantStages) {
+				t.Fatalf("want stages %v, got %v", tt.wantStages, gotStages)
+			}
+			if len(steps) != 0 {
+				if got := steps[len(steps)-1].Delete; got != tt.wantDelete {
+					t.Errorf("want delete %v, got %v", tt.wantDelete, got)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, steps)
+			}
+		})
+	}
+}
+
+func TestSimulatorSeed(t *testing.T) {
+	stages, err := slices.MapWithError([]string{"a", "b", "c"}, func(name string) (*internalversion.Stage, error) {
+		return config.UnmarshalWithType[*internalversion.Stage](`
+apiVersion: kwok.x-k8s.io/v1alpha1
+kind: Stage
+metadata:
+  name: ` + name + `
+spec:
+  resourceRef:
+    apiGroup: v1
+    kind: ConfigMap
+  selector: {}
+  weight: 2
+  delay:
+    durationMilliseconds: 1000
+    jitterDurationMilliseconds: 5000
+  next:
+    patches:
+    - root: data
+      template: '` + name + `: {{ Now | Quote }}'
+`)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lifecycle, err := NewLifecycle(stages, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	simulate := func(seed int64) []string {
+		simulator, err := NewSimulator(SimulatorConfig{
+			Lifecycle: lifecycle,
+			Seed:      seed,
+			StartTime: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			MaxSteps:  20,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resource := &unstructured.Unstructured{}
+		resource.SetAPIVersion("v1")
+		resource.SetKind("ConfigMap")
+		resource.SetName("cm0")
+
+		var got []string
+		err = simulator.Simulate(context.Background(), resource, func(step *SimulateStep) error {
+			got = append(got, step.Stage+"/"+step.Delay.Duration.String())
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	first := simulate(1)
+	if len(first) != 20 {
+		t.Fatalf("want 20 steps, got %d", len(first))
+	}
+	second := simulate(1)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("want the same steps with the same seed, got %v and %v", first, second)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/kwok/pkg/utils/maps"
+)
+
+// stageAttempts counts the times each stage has been played on each resource
+type stageAttempts struct {
+	resources maps.SyncMap[types.UID, *resourceAttempts]
+}
+
+type resourceAttempts struct {
+	mut    sync.Mutex
+	stages map[string]int64
+}
+
+// Get returns the times the stage has been played on the resource
+func (a *stageAttempts) Get(uid types.UID, stageName string) int64 {
+	r, ok := a.resources.Load(uid)
+	if !ok {
+		return 0
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.stages[stageName]
+}
+
+// Add increases the times the stage has been played on the resource and returns the attempt
+func (a *stageAttempts) Add(uid types.UID, stageName string) int64 {
+	r, ok := a.resources.Load(uid)
+	if !ok {
+		r, _ = a.resources.LoadOrStore(uid, &resourceAttempts{
+			stages: map[string]int64{},
+		})
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.stages[stageName]++
+	return r.stages[stageName]
+}
+
+// Delete deletes the attempts of the resource
+func (a *stageAttempts) Delete(uid types.UID) {
+	a.resources.Delete(uid)
+}
@@ -20,10 +20,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
@@ -59,12 +61,21 @@ type StageController struct {
 	delayQueue                            queue.DelayingQueue[resourceStageJob[*unstructured.Unstructured]]
 	delayQueueMapping                     maps.SyncMap[string, resourceStageJob[*unstructured.Unstructured]]
 	recorder                              record.EventRecorder
+	events                                *stageEventRecorder
+	onStagePlayedFunc                     func(stageName string, err error)
+	rands                                 *resourceRands
+	attempts                              stageAttempts
+	creator                               *stageResourceCreator
+	webhook                               stageWebhookClient
+	history                               *StageHistory
+	historyAnnotation                     bool
 }
 
 // StageControllerConfig is the configuration for the StageController
 type StageControllerConfig struct {
 	Clock                                 clock.Clock
 	DynamicClient                         dynamic.Interface
+	RESTMapper                            meta.RESTMapper
 	Schema                                strategicpatch.LookupPatchMeta
 	GVR                                   schema.GroupVersionResource
 	DisregardStatusWithAnnotationSelector string
@@ -73,6 +84,11 @@ type StageControllerConfig struct {
 	PlayStageParallelism                  uint
 	FuncMap                               gotpl.FuncMap
 	Recorder                              record.EventRecorder
+	EventRecorderFor                      func(correlator internalversion.StageEventCorrelator) record.EventRecorder
+	OnStagePlayedFunc                     func(stageName string, err error)
+	RandomSeed                            int64
+	StageHistory                          *StageHistory
+	EnableStageHistoryAnnotation          bool
 }
 
 // NewStageController creates a new fake resources controller
@@ -107,9 +123,15 @@ func NewStageController(conf StageControllerConfig) (*StageController, error) {
 		playStageParallelism:                  conf.PlayStageParallelism,
 		preprocessChan:                        make(chan *unstructured.Unstructured),
 		recorder:                              conf.Recorder,
+		onStagePlayedFunc:                     conf.OnStagePlayedFunc,
+		rands:                                 newResourceRands(conf.RandomSeed),
+		history:                               conf.StageHistory,
+		historyAnnotation:                     conf.EnableStageHistoryAnnotation,
 	}
 
 	c.renderer = gotpl.NewRenderer(conf.FuncMap)
+	c.creator = newStageResourceCreator(conf.DynamicClient, conf.RESTMapper, c.renderer)
+	c.events = newStageEventRecorder(conf.Recorder, conf.EventRecorderFor, c.renderer)
 	return c, nil
 }
 
@@ -145,6 +167,7 @@ func (c *StageController) finalizersModify(ctx context.Context, resource *unstru
 	if ns := resource.GetNamespace(); ns != "" {
 		cli = nri.Namespace(ns)
 	}
+	addPatchSize(ctx, data)
 	result, err := cli.Patch(ctx, resource.GetName(), types.JSONPatchType, data, metav1.PatchOptions{})
 	if err != nil {
 		if apierrors.IsNotFound(err) {
@@ -209,11 +232,23 @@ func (c *StageController) preprocessWorker(ctx context.Context) {
 func (c *StageController) preprocess(ctx context.Context, resource *unstructured.Unstructured) error {
 	key := log.KObj(resource).String()
 
-	resourceJob, ok := c.delayQueueMapping.Load(key)
-	if ok && resourceJob.Resource.GetResourceVersion() == resource.GetResourceVersion() {
-		return nil
+	lifecycle := c.lifecycle.Get()
+	groups := lifecycle.Groups()
+	for _, group := range groups {
+		resourceJob, ok := c.delayQueueMapping.Load(stageJobKey(key, group))
+		if ok && resourceJob.Resource.GetResourceVersion() == resource.GetResourceVersion() {
+			return nil
+		}
+		if ok && c.historyAnnotation && onlyStageHistoryChanged(resourceJob.Resource, resource) {
+			return nil
+		}
 	}
 
+	// The stages are matched again with the new version of the resource,
+	// so the delayed jobs of the previous version are canceled,
+	// the job is scheduled again at its due time if the same stage is matched.
+	taken := takeStageJobs(c.delayQueue, &c.delayQueueMapping, key, groups)
+
 	logger := log.FromContext(ctx)
 	logger = logger.With(
 		"resource", key,
@@ -224,12 +259,18 @@ func (c *StageController) preprocess(ctx context.Context, resource *unstructured
 		return err
 	}
 
-	lifecycle := c.lifecycle.Get()
-	stage, err := lifecycle.Match(resource.GetLabels(), resource.GetAnnotations(), data)
+	lifecycle = lifecycle.Available(func(stageName string) int64 {
+		return c.attempts.Get(resource.GetUID(), stageName)
+	})
+	if name, ok := lifecycle.UnresolvedNextStage(resource.GetAnnotations()); ok {
+		c.removeUnresolvedNextStage(ctx, resource, name)
+	}
+	rnd := c.rands.Get(resource.GetUID())
+	stages, err := lifecycle.Match(ctx, resource.GetLabels(), resource.GetAnnotations(), data, rnd)
 	if err != nil {
 		return fmt.Errorf("stage match: %w", err)
 	}
-	if stage == nil {
+	if len(stages) == 0 {
 		logger.Debug("Skip resource",
 			"reason", "not match any stages",
 		)
@@ -237,44 +278,107 @@ func (c *StageController) preprocess(ctx context.Context, resource *unstructured
 	}
 
 	now := c.clock.Now()
-	delay, _ := stage.Delay(ctx, data, now)
+	for _, stage := range stages {
+		jobKey := stageJobKey(key, stage.Group())
+		item, ok := nextStageJob(taken, jobKey, stage, resource)
+		if !ok {
+			delay, _ := stage.Delay(ctx, data, now, rnd)
+			delay = stage.Backoff(delay, c.attempts.Get(resource.GetUID(), stage.Name())+1)
+
+			if delay != 0 {
+				stageName := stage.Name()
+				logger.Debug("Delayed play stage",
+					"delay", delay,
+					"stage", stageName,
+				)
+			}
 
-	if delay != 0 {
-		stageName := stage.Name()
-		logger.Debug("Delayed play stage",
-			"delay", delay,
-			"stage", stageName,
-		)
+			item = resourceStageJob[*unstructured.Unstructured]{
+				Resource: resource,
+				Stage:    stage,
+				Key:      jobKey,
+				Delay:    delay,
+				Time:     now.Add(delay),
+			}
+		}
+		ok = c.delayQueue.AddAfter(item, item.Time.Sub(now))
+		if !ok {
+			logger.Debug("Skip resource",
+				"reason", "delayed",
+			)
+		} else {
+			c.delayQueueMapping.Store(jobKey, item)
+		}
 	}
+	return nil
+}
 
-	item := resourceStageJob[*unstructured.Unstructured]{
-		Resource: resource,
-		Stage:    stage,
-		Key:      key,
+// removeUnresolvedNextStage removes the NextStageAnnotation naming a stage that can't be resolved,
+// otherwise it stays on the resource forever, and records a warning event.
+func (c *StageController) removeUnresolvedNextStage(ctx context.Context, resource *unstructured.Unstructured, name string) {
+	logger := log.FromContext(ctx)
+	logger.Warn("Remove unresolved next stage",
+		"resource", log.KObj(resource),
+		"stage", name,
+	)
+	if c.recorder != nil {
+		ref := &corev1.ObjectReference{
+			Kind:      "Stage",
+			UID:       resource.GetUID(),
+			Name:      resource.GetName(),
+			Namespace: resource.GetNamespace(),
+		}
+		c.recorder.Eventf(ref, corev1.EventTypeWarning, unresolvedNextStageReason,
+			"Stage %q of the %s annotation doesn't exist, is not for the resource or has been played as many times as it can be", name, NextStageAnnotation)
 	}
-	ok = c.delayQueue.AddAfter(item, delay)
-	if !ok {
-		logger.Debug("Skip resource",
-			"reason", "delayed",
-		)
-	} else {
-		c.delayQueueMapping.Store(key, item)
+	_, err := c.patchResource(ctx, resource, types.MergePatchType, removeNextStageAnnotationPatch)
+	if err != nil {
+		logger.Error("Failed to remove next stage annotation", err)
 	}
-
-	return nil
 }
 
 // playStageWorker receives the resource from the playStageChan and play the stage
 func (c *StageController) playStageWorker(ctx context.Context) {
 	for ctx.Err() == nil {
-		resource := c.delayQueue.GetOrWait()
+		resource, ok := c.delayQueue.GetOrWaitWithDone(ctx.Done())
+		if !ok {
+			return
+		}
 		c.delayQueueMapping.Delete(resource.Key)
-		c.playStage(ctx, resource.Resource, resource.Stage)
+		attempt := c.attempts.Add(resource.Resource.GetUID(), resource.Stage.Name())
+		playCtx, patchSize := withPatchSize(ctx)
+		err := c.playStage(playCtx, resource.Resource, resource.Stage, attempt)
+		if c.onStagePlayedFunc != nil {
+			c.onStagePlayedFunc(resource.Stage.Name(), err)
+		}
+		if c.history != nil {
+			transition := newStageTransition(c.clock.Now(), resource.Stage, resource.Delay, attempt, patchSize.Load(), err)
+			c.recordStageTransition(ctx, resource.Resource, transition)
+		}
+	}
+}
+
+// recordStageTransition records the transition in the history, and in the annotation if enabled
+func (c *StageController) recordStageTransition(ctx context.Context, resource *unstructured.Unstructured, transition StageTransition) {
+	transitions := c.history.Record(resource.GetKind(), resource.GetNamespace(), resource.GetName(), resource.GetUID(), transition)
+	if !c.historyAnnotation {
+		return
+	}
+
+	logger := log.FromContext(ctx)
+	patch, err := stageHistoryAnnotationPatch(transitions)
+	if err != nil {
+		logger.Error("Failed to record stage history", err)
+		return
+	}
+	_, err = c.patchResource(ctx, resource, types.MergePatchType, patch)
+	if err != nil {
+		logger.Error("Failed to record stage history", err)
 	}
 }
 
 // playStage plays the stage
-func (c *StageController) playStage(ctx context.Context, resource *unstructured.Unstructured, stage *LifecycleStage) {
+func (c *StageController) playStage(ctx context.Context, resource *unstructured.Unstructured, stage *LifecycleStage, attempt int64) error {
 	next := stage.Next()
 	logger := log.FromContext(ctx)
 	logger = logger.With(
@@ -282,52 +386,198 @@ func (c *StageController) playStage(ctx context.Context, resource *unstructured.
 		"stage", stage.Name(),
 	)
 
-	if next.Event != nil && c.recorder != nil {
-		c.recorder.Event(&corev1.ObjectReference{
+	var webhookResult *StageWebhookResponse
+	if next.Webhook != nil {
+		resp, err := c.webhook.Call(ctx, next.Webhook, stage.Name(), attempt, resource.Object)
+		if err != nil {
+			if !ignoreStageWebhookFailure(next.Webhook) {
+				logger.Error("Failed to call webhook", err)
+				return err
+			}
+			logger.Warn("Ignore the failure of webhook",
+				"err", err,
+			)
+		}
+		webhookResult = resp
+	}
+
+	var errs []error
+	if c.recorder != nil {
+		ref := &corev1.ObjectReference{
 			Kind:      "Stage",
 			UID:       resource.GetUID(),
 			Name:      resource.GetName(),
 			Namespace: resource.GetNamespace(),
-		}, next.Event.Type, next.Event.Reason, next.Event.Message)
+		}
+		if next.Event != nil {
+			err := c.events.Record(stage, c.rands.Get(resource.GetUID()), ref, stageTemplateData{resource: resource.Object, attempt: attempt})
+			if err != nil {
+				logger.Error("Failed to record event", err)
+				errs = append(errs, err)
+			}
+		}
+		if webhookResult != nil {
+			c.events.RecordWebhook(stage, c.rands.Get(resource.GetUID()), ref, webhookResult.Events)
+		}
 	}
 	if next.Finalizers != nil {
 		result, err := c.finalizersModify(ctx, resource, next.Finalizers)
 		if err != nil {
 			logger.Error("Failed to finalizers", err)
+			errs = append(errs, err)
 		}
 		if result != nil && stage.ImmediateNextStage() {
 			c.preprocessChan <- result
 		}
 	}
-	if next.Delete {
+	if len(next.Create) != 0 {
+		err := c.creator.Create(ctx, metav1.OwnerReference{
+			APIVersion: resource.GetAPIVersion(),
+			Kind:       resource.GetKind(),
+			Name:       resource.GetName(),
+			UID:        resource.GetUID(),
+		}, resource.GetNamespace(), stageTemplateData{resource: resource.Object, attempt: attempt}, next.Create)
+		if err != nil {
+			logger.Error("Failed to create resources", err)
+			errs = append(errs, err)
+		}
+	}
+	if next.Delete || (webhookResult != nil && webhookResult.Delete) {
 		err := c.deleteResource(ctx, resource)
 		if err != nil {
 			logger.Error("Failed to delete resource", err)
 		}
-	} else if next.StatusTemplate != "" {
-		patch, err := c.configureResource(resource, next.StatusTemplate)
+		return errors.Join(append(errs, err)...)
+	}
+
+	var result *unstructured.Unstructured
+	if next.StatusTemplate != "" {
+		patch, err := c.configureResource(resource, next.StatusTemplate, attempt)
 		if err != nil {
 			logger.Error("Failed to configure resource", err)
-			return
+			return errors.Join(append(errs, err)...)
 		}
 		if patch == nil {
 			logger.Debug("Skip resource",
 				"reason", "do not need to modify",
 			)
 		} else {
-			result, err := c.patchResource(ctx, resource, patch)
+			result, err = c.patchResource(ctx, resource, types.MergePatchType, patch, "status")
 			if err != nil {
 				logger.Error("Failed to patch resource", err)
+				errs = append(errs, err)
 			}
-			if result != nil && stage.ImmediateNextStage() {
-				c.preprocessChan <- result
-			}
 		}
 	}
+	if len(next.Patches) != 0 {
+		latest := resource
+		if result != nil {
+			latest = result
+		}
+		patched, err := c.patchResources(ctx, latest, next.Patches, attempt)
+		if err != nil {
+			logger.Error("Failed to patch resource", err)
+			errs = append(errs, err)
+		}
+		if patched != nil {
+			result = patched
+		}
+	}
+	if webhookResult != nil && len(webhookResult.Patches) != 0 {
+		latest := resource
+		if result != nil {
+			latest = result
+		}
+		patched, err := applyStageWebhookPatches(ctx, latest, webhookResult.Patches, c.patchResource)
+		if err != nil {
+			logger.Error("Failed to patch resource", err)
+			errs = append(errs, err)
+		}
+		if patched != nil {
+			result = patched
+		}
+	}
+	if resource.GetAnnotations()[NextStageAnnotation] == stage.Name() {
+		latest := resource
+		if result != nil {
+			latest = result
+		}
+		patched, err := c.patchResource(ctx, latest, types.MergePatchType, removeNextStageAnnotationPatch)
+		if err != nil {
+			logger.Error("Failed to remove next stage annotation", err)
+			errs = append(errs, err)
+		}
+		if patched != nil {
+			result = patched
+		}
+	}
+	if result != nil && stage.ImmediateNextStage() {
+		c.preprocessChan <- result
+	}
+	return errors.Join(errs...)
+}
+
+// patchResources applies the patches to the resource in order
+func (c *StageController) patchResources(ctx context.Context, resource *unstructured.Unstructured, patches []internalversion.StagePatch, attempt int64) (*unstructured.Unstructured, error) {
+	logger := log.FromContext(ctx)
+	logger = logger.With(
+		"resource", log.KObj(resource),
+	)
+
+	var result *unstructured.Unstructured
+	for i := range patches {
+		patch := &patches[i]
+		patchType, data, err := c.computeStagePatch(ctx, resource, attempt, patch)
+		if err != nil {
+			return result, fmt.Errorf("failed to compute patch %d: %w", i, err)
+		}
+		if data == nil {
+			logger.Debug("Skip resource",
+				"reason", "do not need to modify",
+				"subresource", patch.Subresource,
+			)
+			continue
+		}
+		latest, err := c.patchResource(ctx, resource, patchType, data, patch.Subresource)
+		if err != nil {
+			return result, err
+		}
+		if latest == nil {
+			return nil, nil
+		}
+		if !isResourceSubresource(patch.Subresource) {
+			continue
+		}
+		resource = latest
+		result = latest
+	}
+	return result, nil
+}
+
+// computeStagePatch computes the patch of the resource, or of the subresource which is not the resource itself
+func (c *StageController) computeStagePatch(ctx context.Context, resource *unstructured.Unstructured, attempt int64, patch *internalversion.StagePatch) (types.PatchType, []byte, error) {
+	if isResourceSubresource(patch.Subresource) {
+		return computeStagePatch(c.renderer, resource.Object, attempt, c.schema, patch)
+	}
+
+	nri := c.dynamicClient.Resource(c.gvr)
+	var cli dynamic.ResourceInterface = nri
+	if ns := resource.GetNamespace(); ns != "" {
+		cli = nri.Namespace(ns)
+	}
+	subresource, err := cli.Get(ctx, resource.GetName(), metav1.GetOptions{}, patch.Subresource)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get %s subresource: %w", patch.Subresource, err)
+	}
+	original, err := subresource.MarshalJSON()
+	if err != nil {
+		return "", nil, err
+	}
+	return computeSubresourceStagePatch(c.renderer, resource.Object, attempt, original, patch)
 }
 
 // patchResource patches the resource
-func (c *StageController) patchResource(ctx context.Context, resource *unstructured.Unstructured, patch []byte) (*unstructured.Unstructured, error) {
+func (c *StageController) patchResource(ctx context.Context, resource *unstructured.Unstructured, patchType types.PatchType, patch []byte, subresources ...string) (*unstructured.Unstructured, error) {
 	logger := log.FromContext(ctx)
 	logger = logger.With(
 		"resource", log.KObj(resource),
@@ -338,7 +588,8 @@ func (c *StageController) patchResource(ctx context.Context, resource *unstructu
 	if ns := resource.GetNamespace(); ns != "" {
 		cli = nri.Namespace(ns)
 	}
-	result, err := cli.Patch(ctx, resource.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	addPatchSize(ctx, patch)
+	result, err := cli.Patch(ctx, resource.GetName(), patchType, patch, metav1.PatchOptions{}, subresources...)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			logger.Warn("Patch resource",
@@ -393,13 +644,16 @@ loop:
 
 			case informer.Deleted:
 				resource := event.Object
+				if c.history != nil {
+					c.history.Expire(resource.GetUID())
+				}
 				if c.need(resource) {
+					c.rands.Delete(resource.GetUID())
+					c.attempts.Delete(resource.GetUID())
+
 					// Cancel delay job
 					key := log.KObj(resource).String()
-					resourceJob, ok := c.delayQueueMapping.LoadAndDelete(key)
-					if ok {
-						c.delayQueue.Cancel(resourceJob)
-					}
+					cancelStageJobs(c.delayQueue, &c.delayQueueMapping, key)
 				}
 			}
 		case <-ctx.Done():
@@ -409,8 +663,8 @@ loop:
 	logger.Info("Stop watch resources")
 }
 
-func (c *StageController) configureResource(resource *unstructured.Unstructured, template string) ([]byte, error) {
-	patch, err := c.computePatch(resource, template)
+func (c *StageController) configureResource(resource *unstructured.Unstructured, template string, attempt int64) ([]byte, error) {
+	patch, err := c.computePatch(resource, template, attempt)
 	if err != nil {
 		return nil, err
 	}
@@ -423,8 +677,8 @@ func (c *StageController) configureResource(resource *unstructured.Unstructured,
 	})
 }
 
-func (c *StageController) computePatch(resource *unstructured.Unstructured, tpl string) ([]byte, error) {
-	patchData, err := c.renderer.ToJSON(tpl, resource.Object)
+func (c *StageController) computePatch(resource *unstructured.Unstructured, tpl string, attempt int64) ([]byte, error) {
+	patchData, err := c.renderer.ToJSON(tpl, stageTemplateData{resource: resource.Object, attempt: attempt})
 	if err != nil {
 		return nil, err
 	}
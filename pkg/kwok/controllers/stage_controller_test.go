@@ -27,8 +27,10 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
 
 	"sigs.k8s.io/kwok/pkg/apis/internalversion"
 	"sigs.k8s.io/kwok/pkg/config/resources"
@@ -73,7 +75,7 @@ func TestStageController(t *testing.T) {
 				},
 			},
 		},
-	})
+	}, nil)
 	patchMeta, _ := strategicpatch.NewPatchMetaFromStruct(corev1.PersistentVolume{})
 	controller, err := NewStageController(StageControllerConfig{
 		PlayStageParallelism: 1,
@@ -124,3 +126,107 @@ func TestStageController(t *testing.T) {
 		t.Fatalf("expected phase %q, got %q", corev1.VolumeAvailable, got.Status.Phase)
 	}
 }
+
+func TestStageControllerPatchResourcesWithScale(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	deployment := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":      "deploy0",
+				"namespace": "default",
+			},
+			"spec": map[string]interface{}{
+				"replicas": int64(1),
+			},
+		},
+	}
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			gvr: "DeploymentList",
+		},
+		deployment,
+	)
+	newScale := func(replicas int64) *unstructured.Unstructured {
+		return &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "autoscaling/v1",
+				"kind":       "Scale",
+				"metadata": map[string]interface{}{
+					"name":      "deploy0",
+					"namespace": "default",
+				},
+				"spec": map[string]interface{}{
+					"replicas": replicas,
+				},
+			},
+		}
+	}
+	client.PrependReactor("get", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		return true, newScale(1), nil
+	})
+	client.PrependReactor("patch", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		return true, newScale(3), nil
+	})
+
+	controller, err := NewStageController(StageControllerConfig{
+		PlayStageParallelism: 1,
+		GVR:                  gvr,
+		DynamicClient:        client,
+		Lifecycle:            resources.NewStaticGetter(Lifecycle{}),
+		FuncMap:              defaultFuncMap,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := controller.patchResources(context.Background(), deployment, []internalversion.StagePatch{
+		{
+			Subresource: "scale",
+			Root:        "spec",
+			Template:    `replicas: 3`,
+		},
+		{
+			Root:     "metadata",
+			Template: `labels: {"scaled-kind": {{ .kind | Quote }}}`,
+		},
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The metadata patch is rendered with the deployment rather than the Scale returned by the scale subresource.
+	if got.GetKind() != "Deployment" || got.GetLabels()["scaled-kind"] != "Deployment" {
+		t.Fatalf("want the patched deployment, got %s %v", got.GetKind(), got.Object)
+	}
+
+	// The scale patch is computed against the scale subresource rather than the deployment.
+	actions := client.Actions()
+	if len(actions) != 3 ||
+		actions[0].GetVerb() != "get" || actions[0].GetSubresource() != "scale" ||
+		actions[1].GetVerb() != "patch" || actions[1].GetSubresource() != "scale" ||
+		actions[2].GetVerb() != "patch" || actions[2].GetSubresource() != "" {
+		t.Fatalf("want the scale patch and the metadata patch on the deployment, got %v", actions)
+	}
+
+	client.ClearActions()
+	_, err = controller.patchResources(context.Background(), deployment, []internalversion.StagePatch{
+		{
+			Subresource: "scale",
+			Root:        "spec",
+			Template:    `replicas: 1`,
+		},
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actions := client.Actions(); len(actions) != 1 || actions[0].GetVerb() != "get" {
+		t.Fatalf("want no patch when the scale is unchanged, got %v", actions)
+	}
+}
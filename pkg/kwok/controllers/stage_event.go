@@ -0,0 +1,131 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/utils/gotpl"
+)
+
+// stageEventRecorder records the events of the stages
+type stageEventRecorder struct {
+	recorder    record.EventRecorder
+	recorderFor func(correlator internalversion.StageEventCorrelator) record.EventRecorder
+	renderer    gotpl.Renderer
+}
+
+// newStageEventRecorder creates a new stageEventRecorder,
+// the recorderFor returns the recorder of the events with a correlator, the recorder is used if it is nil.
+func newStageEventRecorder(recorder record.EventRecorder, recorderFor func(correlator internalversion.StageEventCorrelator) record.EventRecorder, renderer gotpl.Renderer) *stageEventRecorder {
+	return &stageEventRecorder{
+		recorder:    recorder,
+		recorderFor: recorderFor,
+		renderer:    renderer,
+	}
+}
+
+// Record renders and records the event of the stage, unless it is not sampled or over the rate limit of the stage.
+// The rnd is used to sample the event, the global source is used if it is nil.
+func (r *stageEventRecorder) Record(stage *LifecycleStage, rnd *rand.Rand, ref *corev1.ObjectReference, data stageTemplateData) error {
+	event := stage.Next().Event
+	if event == nil || !stage.allowEvent(rnd) {
+		return nil
+	}
+
+	reason, message, err := renderStageEvent(r.renderer, data, event)
+	if err != nil {
+		return err
+	}
+
+	r.recorderOf(event).Event(ref, event.Type, reason, message)
+	return nil
+}
+
+// RecordWebhook records the events returned by the webhook of the stage,
+// they are sampled, rate limited and correlated the same as the event of the stage.
+// The rnd is used to sample the events, the global source is used if it is nil.
+func (r *stageEventRecorder) RecordWebhook(stage *LifecycleStage, rnd *rand.Rand, ref *corev1.ObjectReference, events []StageWebhookEvent) {
+	recorder := r.recorderOf(stage.Next().Event)
+	for _, event := range events {
+		if !stage.allowEvent(rnd) {
+			continue
+		}
+		recorder.Event(ref, event.Type, event.Reason, event.Message)
+	}
+}
+
+// recorderOf returns the recorder of the event, the event with a correlator has its own recorder.
+func (r *stageEventRecorder) recorderOf(event *internalversion.StageEvent) record.EventRecorder {
+	if event != nil && event.Correlator != nil && r.recorderFor != nil {
+		return r.recorderFor(*event.Correlator)
+	}
+	return r.recorder
+}
+
+// renderStageEvent renders the reason and the message of the event
+func renderStageEvent(renderer gotpl.Renderer, data stageTemplateData, event *internalversion.StageEvent) (reason, message string, err error) {
+	reason, err = renderStageEventText(renderer, data, event.Reason)
+	if err != nil {
+		return "", "", fmt.Errorf("render event reason: %w", err)
+	}
+	message, err = renderStageEventText(renderer, data, event.Message)
+	if err != nil {
+		return "", "", fmt.Errorf("render event message: %w", err)
+	}
+	return reason, message, nil
+}
+
+func renderStageEventText(renderer gotpl.Renderer, data stageTemplateData, text string) (string, error) {
+	// Most of the events are static, skip the rendering for them.
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	out, err := renderer.ToText(text, data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// newStageEventLimiter returns the rate limiter of the events of the stage
+func newStageEventLimiter(rateLimit *internalversion.StageEventRateLimit) (flowcontrol.RateLimiter, error) {
+	if rateLimit.QPS < 0 {
+		return nil, fmt.Errorf("event rateLimit qps %v is less than 0", rateLimit.QPS)
+	}
+	if rateLimit.Burst < 1 {
+		return nil, fmt.Errorf("event rateLimit burst %d is less than 1", rateLimit.Burst)
+	}
+	return flowcontrol.NewTokenBucketRateLimiter(float32(rateLimit.QPS), rateLimit.Burst), nil
+}
+
+// correlatorOptions returns the options of the event correlator
+func correlatorOptions(correlator internalversion.StageEventCorrelator) record.CorrelatorOptions {
+	return record.CorrelatorOptions{
+		MaxEvents:            correlator.MaxEvents,
+		MaxIntervalInSeconds: correlator.MaxIntervalSeconds,
+		BurstSize:            correlator.BurstSize,
+		QPS:                  float32(correlator.QPS),
+	}
+}
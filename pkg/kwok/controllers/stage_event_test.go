@@ -0,0 +1,284 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/utils/format"
+	"sigs.k8s.io/kwok/pkg/utils/gotpl"
+)
+
+func TestStageEventRecorder(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod0",
+			Namespace: "default",
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "node0",
+		},
+	}
+	ref := &corev1.ObjectReference{
+		Kind:      "Pod",
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+	}
+
+	tests := []struct {
+		name           string
+		event          internalversion.StageEvent
+		plays          int
+		seed           int64
+		want           []string
+		wantCorrelated bool
+	}{
+		{
+			name: "templated",
+			event: internalversion.StageEvent{
+				Type:    corev1.EventTypeWarning,
+				Reason:  "BackOff",
+				Message: `Back-off restarting {{ .metadata.name }} on {{ .spec.nodeName }}, attempt {{ .Attempt }}`,
+			},
+			plays: 2,
+			want: []string{
+				"Warning BackOff Back-off restarting pod0 on node0, attempt 1",
+				"Warning BackOff Back-off restarting pod0 on node0, attempt 2",
+			},
+		},
+		{
+			name: "included template",
+			event: internalversion.StageEvent{
+				Type:    corev1.EventTypeNormal,
+				Reason:  "Scheduled",
+				Message: `{{- define "node" }}{{ .spec.nodeName }}{{ end -}}` + "\n" + `Assigned {{ .metadata.name }} to {{ include "node" . }}`,
+			},
+			plays: 1,
+			want: []string{
+				"Normal Scheduled Assigned pod0 to node0",
+			},
+		},
+		{
+			name: "not sampled",
+			event: internalversion.StageEvent{
+				Type:       corev1.EventTypeNormal,
+				Reason:     "Started",
+				SampleRate: format.Ptr(0.0),
+			},
+			plays: 3,
+		},
+		{
+			name: "sampled by the random source of the resource",
+			event: internalversion.StageEvent{
+				Type:       corev1.EventTypeNormal,
+				Reason:     "Started",
+				Message:    `attempt {{ .Attempt }}`,
+				SampleRate: format.Ptr(0.5),
+			},
+			plays: 5,
+			seed:  1,
+			want: []string{
+				"Normal Started attempt 4",
+				"Normal Started attempt 5",
+			},
+		},
+		{
+			name: "rate limit",
+			event: internalversion.StageEvent{
+				Type:   corev1.EventTypeNormal,
+				Reason: "Started",
+				RateLimit: &internalversion.StageEventRateLimit{
+					QPS:   0.001,
+					Burst: 2,
+				},
+			},
+			plays: 5,
+			want: []string{
+				"Normal Started ",
+				"Normal Started ",
+			},
+		},
+		{
+			name: "correlator",
+			event: internalversion.StageEvent{
+				Type:   corev1.EventTypeNormal,
+				Reason: "Started",
+				Correlator: &internalversion.StageEventCorrelator{
+					MaxEvents: 5,
+				},
+			},
+			plays: 1,
+			want: []string{
+				"Normal Started ",
+			},
+			wantCorrelated: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stage, err := NewLifecycleStage(&internalversion.Stage{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "pod-event",
+				},
+				Spec: internalversion.StageSpec{
+					Selector: &internalversion.StageSelector{},
+					Next: internalversion.StageNext{
+						Event: &tt.event,
+					},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := record.NewFakeRecorder(10)
+			correlated := record.NewFakeRecorder(10)
+			events := newStageEventRecorder(recorder, func(correlator internalversion.StageEventCorrelator) record.EventRecorder {
+				if correlator != *tt.event.Correlator {
+					t.Errorf("want correlator %v, got %v", *tt.event.Correlator, correlator)
+				}
+				return correlated
+			}, gotpl.NewRenderer(nil))
+
+			var rnd *rand.Rand
+			if tt.seed != 0 {
+				//nolint:gosec
+				rnd = rand.New(rand.NewSource(tt.seed))
+			}
+			for i := 1; i <= tt.plays; i++ {
+				err = events.Record(stage, rnd, ref, stageTemplateData{resource: pod, attempt: int64(i)})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want := recorder
+			if tt.wantCorrelated {
+				want = correlated
+			}
+			close(want.Events)
+			var got []string
+			for event := range want.Events {
+				got = append(got, event)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want events %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStageEventRecorderWebhook(t *testing.T) {
+	ref := &corev1.ObjectReference{
+		Kind:      "Pod",
+		Name:      "pod0",
+		Namespace: "default",
+	}
+	webhookEvents := []StageWebhookEvent{
+		{Type: corev1.EventTypeNormal, Reason: "Pulled", Message: "first"},
+		{Type: corev1.EventTypeNormal, Reason: "Pulled", Message: "second"},
+		{Type: corev1.EventTypeNormal, Reason: "Pulled", Message: "third"},
+	}
+
+	tests := []struct {
+		name           string
+		event          *internalversion.StageEvent
+		want           []string
+		wantCorrelated bool
+	}{
+		{
+			name: "without event",
+			want: []string{
+				"Normal Pulled first",
+				"Normal Pulled second",
+				"Normal Pulled third",
+			},
+		},
+		{
+			name: "not sampled",
+			event: &internalversion.StageEvent{
+				Type:       corev1.EventTypeNormal,
+				Reason:     "Started",
+				SampleRate: format.Ptr(0.0),
+			},
+		},
+		{
+			name: "rate limit and correlator",
+			event: &internalversion.StageEvent{
+				Type:   corev1.EventTypeNormal,
+				Reason: "Started",
+				RateLimit: &internalversion.StageEventRateLimit{
+					QPS:   0.001,
+					Burst: 2,
+				},
+				Correlator: &internalversion.StageEventCorrelator{
+					MaxEvents: 5,
+				},
+			},
+			want: []string{
+				"Normal Pulled first",
+				"Normal Pulled second",
+			},
+			wantCorrelated: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stage, err := NewLifecycleStage(&internalversion.Stage{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "pod-webhook-event",
+				},
+				Spec: internalversion.StageSpec{
+					Selector: &internalversion.StageSelector{},
+					Next: internalversion.StageNext{
+						Event: tt.event,
+					},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := record.NewFakeRecorder(10)
+			correlated := record.NewFakeRecorder(10)
+			events := newStageEventRecorder(recorder, func(correlator internalversion.StageEventCorrelator) record.EventRecorder {
+				return correlated
+			}, gotpl.NewRenderer(nil))
+			events.RecordWebhook(stage, nil, ref, webhookEvents)
+
+			want := recorder
+			if tt.wantCorrelated {
+				want = correlated
+			}
+			close(want.Events)
+			var got []string
+			for event := range want.Events {
+				got = append(got, event)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want events %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+
+	"sigs.k8s.io/kwok/pkg/utils/maps"
+)
+
+const (
+	// StageHistoryAnnotation is the annotation that records the recent stage transitions of the resource,
+	// it is only set if enabled.
+	StageHistoryAnnotation = "kwok.x-k8s.io/stage-history"
+
+	// stageHistorySize is the number of the transitions kept for each resource.
+	stageHistorySize = 16
+
+	// stageHistoryTTL is how long the transitions of a deleted resource are kept.
+	stageHistoryTTL = 10 * time.Minute
+)
+
+// StageTransition is a record of a stage played on a resource
+type StageTransition struct {
+	// Stage is the name of the stage.
+	Stage string `json:"stage"`
+	// Time is the time the stage was played.
+	Time time.Time `json:"time"`
+	// DelayMilliseconds is the delay chosen before playing the stage.
+	DelayMilliseconds int64 `json:"delayMilliseconds"`
+	// Attempt is the times the stage has been played on the resource, starting from 1.
+	Attempt int64 `json:"attempt"`
+	// Outcome is Succeeded or Failed.
+	Outcome string `json:"outcome"`
+	// Error is the error if the stage failed.
+	Error string `json:"error,omitempty"`
+	// PatchSize is the total size in bytes of the patches sent for the stage.
+	PatchSize int64 `json:"patchSize"`
+}
+
+// newStageTransition returns the record of the stage played on a resource
+func newStageTransition(now time.Time, stage *LifecycleStage, delay time.Duration, attempt int64, patchSize int64, err error) StageTransition {
+	t := StageTransition{
+		Stage:             stage.Name(),
+		Time:              now,
+		DelayMilliseconds: delay.Milliseconds(),
+		Attempt:           attempt,
+		Outcome:           "Succeeded",
+		PatchSize:         patchSize,
+	}
+	if err != nil {
+		t.Outcome = "Failed"
+		t.Error = err.Error()
+	}
+	return t
+}
+
+// StageHistory keeps the recent stage transitions of each resource,
+// they are tracked by the UID of the resource, so a recreated resource with the same name starts a new history,
+// and kept for the TTL after the resource is deleted, so the transitions of a deleted resource can still be looked up.
+type StageHistory struct {
+	clock     clock.PassiveClock
+	ttl       time.Duration
+	resources maps.SyncMap[types.UID, *stageTransitionRing]
+
+	mut      sync.Mutex
+	names    map[stageHistoryKey]types.UID
+	expiring []expiringStageHistory
+}
+
+// newStageHistory returns a new StageHistory which keeps the transitions of a deleted resource for the ttl
+func newStageHistory(clk clock.PassiveClock, ttl time.Duration) *StageHistory {
+	return &StageHistory{
+		clock: clk,
+		ttl:   ttl,
+		names: map[stageHistoryKey]types.UID{},
+	}
+}
+
+type stageHistoryKey struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func newStageHistoryKey(kind, namespace, name string) stageHistoryKey {
+	return stageHistoryKey{
+		Kind:      strings.ToLower(kind),
+		Namespace: namespace,
+		Name:      name,
+	}
+}
+
+// expiringStageHistory is the transitions of a deleted resource to be forgotten at the expiration
+type expiringStageHistory struct {
+	uid      types.UID
+	expireAt time.Time
+}
+
+// stageTransitionRing is a ring buffer of the transitions of a resource
+type stageTransitionRing struct {
+	key   stageHistoryKey
+	mut   sync.Mutex
+	items []StageTransition
+	next  int
+}
+
+func (r *stageTransitionRing) add(t StageTransition) {
+	if len(r.items) < stageHistorySize {
+		r.items = append(r.items, t)
+		return
+	}
+	r.items[r.next] = t
+	r.next = (r.next + 1) % stageHistorySize
+}
+
+func (r *stageTransitionRing) list() []StageTransition {
+	out := make([]StageTransition, 0, len(r.items))
+	out = append(out, r.items[r.next:]...)
+	out = append(out, r.items[:r.next]...)
+	return out
+}
+
+// Record adds the transition of the resource and returns the recent transitions from the oldest
+func (h *StageHistory) Record(kind, namespace, name string, uid types.UID, t StageTransition) []StageTransition {
+	key := newStageHistoryKey(kind, namespace, name)
+	r, ok := h.resources.Load(uid)
+	if !ok {
+		r, _ = h.resources.LoadOrStore(uid, &stageTransitionRing{key: key})
+	}
+
+	h.mut.Lock()
+	h.expire()
+	h.names[key] = uid
+	h.mut.Unlock()
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.add(t)
+	return r.list()
+}
+
+// Get returns the recent transitions of the latest resource with the name from the oldest
+func (h *StageHistory) Get(kind, namespace, name string) ([]StageTransition, bool) {
+	h.mut.Lock()
+	h.expire()
+	uid, ok := h.names[newStageHistoryKey(kind, namespace, name)]
+	h.mut.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	r, ok := h.resources.Load(uid)
+	if !ok {
+		return nil, false
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.list(), true
+}
+
+// Expire forgets the transitions of the deleted resource after the TTL
+func (h *StageHistory) Expire(uid types.UID) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.expire()
+	if _, ok := h.resources.Load(uid); !ok {
+		return
+	}
+	h.expiring = append(h.expiring, expiringStageHistory{
+		uid:      uid,
+		expireAt: h.clock.Now().Add(h.ttl),
+	})
+}
+
+// expire forgets the transitions which have expired, the mut must be held.
+func (h *StageHistory) expire() {
+	now := h.clock.Now()
+	i := 0
+	for ; i < len(h.expiring) && !h.expiring[i].expireAt.After(now); i++ {
+		uid := h.expiring[i].uid
+		r, ok := h.resources.LoadAndDelete(uid)
+		if ok && h.names[r.key] == uid {
+			delete(h.names, r.key)
+		}
+	}
+	if i != 0 {
+		h.expiring = append(h.expiring[:0], h.expiring[i:]...)
+	}
+}
+
+// stageHistoryAnnotationPatch returns the merge patch that sets the transitions in the annotation compactly,
+// e.g. "pod-ready@2006-01-02T15:04:05Z,pod-complete@2006-01-02T15:05:05Z!"
+// where a trailing "!" marks a failed transition.
+func stageHistoryAnnotationPatch(transitions []StageTransition) ([]byte, error) {
+	items := make([]string, 0, len(transitions))
+	for _, t := range transitions {
+		item := t.Stage + "@" + t.Time.UTC().Format(time.RFC3339)
+		if t.Error != "" {
+			item += "!"
+		}
+		items = append(items, item)
+	}
+	patch := map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{
+				StageHistoryAnnotation: strings.Join(items, ","),
+			},
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal stage history annotation: %w", err)
+	}
+	return data, nil
+}
+
+// historyObject is a resource which the stage history annotation is set on
+type historyObject interface {
+	runtime.Object
+	metav1.Object
+}
+
+// onlyStageHistoryChanged returns whether the resource is only changed in the stage history annotation,
+// which is set after the stage is played, so the stages are not matched again for it.
+func onlyStageHistoryChanged[T historyObject](old, latest T) bool {
+	oldAnnotations := old.GetAnnotations()
+	latestAnnotations := latest.GetAnnotations()
+	if oldAnnotations[StageHistoryAnnotation] == latestAnnotations[StageHistoryAnnotation] {
+		return false
+	}
+
+	strip := func(obj T) runtime.Object {
+		obj = obj.DeepCopyObject().(T)
+		obj.SetResourceVersion("")
+		obj.SetManagedFields(nil)
+		annotations := obj.GetAnnotations()
+		delete(annotations, StageHistoryAnnotation)
+		if len(annotations) == 0 {
+			obj.SetAnnotations(nil)
+		}
+		return obj
+	}
+	return apiequality.Semantic.DeepEqual(strip(old), strip(latest))
+}
+
+type patchSizeKey struct{}
+
+// withPatchSize returns a context that counts the size of the patches sent with it
+func withPatchSize(ctx context.Context) (context.Context, *atomic.Int64) {
+	size := &atomic.Int64{}
+	return context.WithValue(ctx, patchSizeKey{}, size), size
+}
+
+// addPatchSize adds the size of a patch to the counter of the context if any
+func addPatchSize(ctx context.Context, patch []byte) {
+	size, ok := ctx.Value(patchSizeKey{}).(*atomic.Int64)
+	if !ok {
+		return
+	}
+	size.Add(int64(len(patch)))
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/clock"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+func TestStageHistory(t *testing.T) {
+	stage := &LifecycleStage{name: "pod-ready"}
+
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := newStageHistory(clock.RealClock{}, stageHistoryTTL)
+
+	want := []StageTransition{}
+	for i := 0; i < stageHistorySize+2; i++ {
+		var err error
+		if i%2 == 1 {
+			err = errors.New("conflict")
+		}
+		transition := newStageTransition(now.Add(time.Duration(i)*time.Second), stage, time.Duration(i)*time.Millisecond, int64(i+1), int64(i*10), err)
+		got := history.Record("Pod", "default", "pod0", "uid0", transition)
+		want = append(want, transition)
+		if len(want) > stageHistorySize {
+			want = want[1:]
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("Record() %d mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+
+	got, ok := history.Get("pod", "default", "pod0")
+	if !ok {
+		t.Fatal("Get() not found")
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Get() mismatch (-want +got):\n%s", diff)
+	}
+	if got[0].Outcome != "Succeeded" || got[1].Outcome != "Failed" || got[1].Error != "conflict" {
+		t.Fatalf("unexpected outcome %#v %#v", got[0], got[1])
+	}
+
+	patch, err := stageHistoryAnnotationPatch(got[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPatch := fmt.Sprintf(`{"metadata":{"annotations":{%q:"pod-ready@2023-01-01T00:00:02Z,pod-ready@2023-01-01T00:00:03Z!"}}}`, StageHistoryAnnotation)
+	if string(patch) != wantPatch {
+		t.Fatalf("want patch %s, got %s", wantPatch, patch)
+	}
+}
+
+func TestStageHistoryExpire(t *testing.T) {
+	stage := &LifecycleStage{name: "pod-ready"}
+	clk := testingclock.NewFakePassiveClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	history := newStageHistory(clk, time.Minute)
+
+	old := newStageTransition(clk.Now(), stage, 0, 1, 0, nil)
+	history.Record("Pod", "default", "pod0", "uid0", old)
+	history.Expire("uid0")
+
+	clk.SetTime(clk.Now().Add(30 * time.Second))
+	got, ok := history.Get("Pod", "default", "pod0")
+	if !ok {
+		t.Fatal("Get() not found before the expiration of the deleted pod")
+	}
+	if diff := cmp.Diff([]StageTransition{old}, got); diff != "" {
+		t.Fatalf("Get() mismatch (-want +got):\n%s", diff)
+	}
+
+	// The pod is recreated with the same name before the expiration of the deleted one.
+	recreated := newStageTransition(clk.Now(), stage, 0, 1, 0, nil)
+	got = history.Record("Pod", "default", "pod0", "uid1", recreated)
+	if diff := cmp.Diff([]StageTransition{recreated}, got); diff != "" {
+		t.Fatalf("Record() of the recreated pod mismatch (-want +got):\n%s", diff)
+	}
+
+	clk.SetTime(clk.Now().Add(30 * time.Second))
+	got, ok = history.Get("Pod", "default", "pod0")
+	if !ok {
+		t.Fatal("Get() not found after the expiration of the deleted pod")
+	}
+	if diff := cmp.Diff([]StageTransition{recreated}, got); diff != "" {
+		t.Fatalf("Get() mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := history.resources.Load("uid0"); ok {
+		t.Error("want the transitions of the deleted pod forgotten after the expiration")
+	}
+
+	history.Expire("uid1")
+	clk.SetTime(clk.Now().Add(time.Minute))
+	if _, ok := history.Get("Pod", "default", "pod0"); ok {
+		t.Fatal("Get() found after the expiration")
+	}
+}
+
+func TestPatchSize(t *testing.T) {
+	addPatchSize(context.Background(), []byte("ignored"))
+
+	ctx, size := withPatchSize(context.Background())
+	addPatchSize(ctx, []byte(`{"a":1}`))
+	addPatchSize(ctx, []byte(`{}`))
+	if got := size.Load(); got != 9 {
+		t.Fatalf("want patch size 9, got %d", got)
+	}
+}
+
+func TestOnlyStageHistoryChanged(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "pod0",
+			Namespace:       "default",
+			ResourceVersion: "1",
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+	withHistory := func(pod *corev1.Pod, resourceVersion, history string) *corev1.Pod {
+		pod = pod.DeepCopy()
+		pod.ResourceVersion = resourceVersion
+		pod.Annotations = map[string]string{
+			StageHistoryAnnotation: history,
+		}
+		return pod
+	}
+
+	tests := []struct {
+		name   string
+		old    *corev1.Pod
+		latest *corev1.Pod
+		want   bool
+	}{
+		{
+			name:   "history added",
+			old:    pod,
+			latest: withHistory(pod, "2", "pod-ready@2023-01-01T00:00:00Z"),
+			want:   true,
+		},
+		{
+			name:   "history updated",
+			old:    withHistory(pod, "2", "pod-ready@2023-01-01T00:00:00Z"),
+			latest: withHistory(pod, "3", "pod-ready@2023-01-01T00:00:00Z,pod-complete@2023-01-01T00:01:00Z"),
+			want:   true,
+		},
+		{
+			name:   "history not changed",
+			old:    pod,
+			latest: withHistory(pod, "2", ""),
+			want:   false,
+		},
+		{
+			name: "status changed",
+			old:  pod,
+			latest: func() *corev1.Pod {
+				latest := withHistory(pod, "2", "pod-complete@2023-01-01T00:01:00Z")
+				latest.Status.Phase = corev1.PodSucceeded
+				return latest
+			}(),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := onlyStageHistoryChanged(tt.old, tt.latest); got != tt.want {
+				t.Errorf("onlyStageHistoryChanged() = %v, want %v", got, tt.want)
+			}
+
+			old := &unstructured.Unstructured{}
+			latest := &unstructured.Unstructured{}
+			var err error
+			old.Object, err = runtime.DefaultUnstructuredConverter.ToUnstructured(tt.old)
+			if err != nil {
+				t.Fatal(err)
+			}
+			latest.Object, err = runtime.DefaultUnstructuredConverter.ToUnstructured(tt.latest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := onlyStageHistoryChanged(old, latest); got != tt.want {
+				t.Errorf("onlyStageHistoryChanged() of unstructured = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
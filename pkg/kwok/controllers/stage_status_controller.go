@@ -0,0 +1,212 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/apis/v1alpha1"
+	"sigs.k8s.io/kwok/pkg/client/clientset/versioned"
+	"sigs.k8s.io/kwok/pkg/config/resources"
+	"sigs.k8s.io/kwok/pkg/log"
+	"sigs.k8s.io/kwok/pkg/utils/maps"
+)
+
+// StageStatusController is responsible for writing the status of the stages
+type StageStatusController struct {
+	clock           clock.Clock
+	typedKwokClient versioned.Interface
+	stageGetter     resources.Getter[[]*internalversion.Stage]
+	templateGetter  resources.Getter[[]*internalversion.StageTemplate]
+	syncPeriod      time.Duration
+
+	counters maps.SyncMap[string, *stageCounter]
+
+	// statuses is the latest status which the StageStatusController written
+	statuses map[string]*v1alpha1.StageStatus
+}
+
+// StageStatusControllerConfig is the configuration for StageStatusController
+type StageStatusControllerConfig struct {
+	Clock           clock.Clock
+	TypedKwokClient versioned.Interface
+	StageGetter     resources.Getter[[]*internalversion.Stage]
+	// StageTemplateGetter is the getter of the templates included by the stages, the stages are validated after they are resolved.
+	StageTemplateGetter resources.Getter[[]*internalversion.StageTemplate]
+	SyncPeriod          time.Duration
+}
+
+type stageCounter struct {
+	applied atomic.Int64
+	failed  atomic.Int64
+}
+
+// NewStageStatusController constructs and returns a StageStatusController
+func NewStageStatusController(conf StageStatusControllerConfig) (*StageStatusController, error) {
+	if conf.Clock == nil {
+		conf.Clock = clock.RealClock{}
+	}
+	if conf.SyncPeriod <= 0 {
+		conf.SyncPeriod = 10 * time.Second
+	}
+
+	c := &StageStatusController{
+		clock:           conf.Clock,
+		typedKwokClient: conf.TypedKwokClient,
+		stageGetter:     conf.StageGetter,
+		templateGetter:  conf.StageTemplateGetter,
+		syncPeriod:      conf.SyncPeriod,
+		statuses:        map[string]*v1alpha1.StageStatus{},
+	}
+	return c, nil
+}
+
+// Start starts the StageStatusController
+func (c *StageStatusController) Start(ctx context.Context) error {
+	go c.syncWorker(ctx)
+	return nil
+}
+
+// Record records the result of the stage played
+func (c *StageStatusController) Record(stageName string, err error) {
+	counter, ok := c.counters.Load(stageName)
+	if !ok {
+		counter, _ = c.counters.LoadOrStore(stageName, &stageCounter{})
+	}
+	if err != nil {
+		counter.failed.Add(1)
+	} else {
+		counter.applied.Add(1)
+	}
+}
+
+func (c *StageStatusController) syncWorker(ctx context.Context) {
+	logger := log.FromContext(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Stop sync stage status")
+			return
+		case <-c.clock.After(c.syncPeriod):
+		}
+		c.sync(ctx)
+	}
+}
+
+func (c *StageStatusController) sync(ctx context.Context) {
+	logger := log.FromContext(ctx)
+
+	stages := c.stageGetter.Get()
+	var templates []*internalversion.StageTemplate
+	if c.templateGetter != nil {
+		templates = c.templateGetter.Get()
+	}
+	resolved, resolveErrs := internalversion.ResolveStagesWithErrors(stages, templates)
+	resolvedStages := make(map[string]*internalversion.Stage, len(resolved))
+	for _, stage := range resolved {
+		resolvedStages[stage.Name] = stage
+	}
+
+	exists := make(map[string]struct{}, len(stages))
+	for _, stage := range stages {
+		exists[stage.Name] = struct{}{}
+
+		status := c.computeStatus(stage.Name, resolvedStages[stage.Name], resolveErrs[stage.Name])
+		if reflect.DeepEqual(c.statuses[stage.Name], status) {
+			continue
+		}
+
+		err := c.patchStatus(ctx, stage.Name, status)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			logger.Error("Failed to patch stage status", err,
+				"stage", stage.Name,
+			)
+			continue
+		}
+		c.statuses[stage.Name] = status
+	}
+
+	for name := range c.statuses {
+		if _, ok := exists[name]; !ok {
+			delete(c.statuses, name)
+			c.counters.Delete(name)
+		}
+	}
+}
+
+// computeStatus computes the status of the stage, the stage is compiled after it is resolved,
+// so that the stages that failed to be resolved, or inherit invalid fields, are not valid.
+func (c *StageStatusController) computeStatus(name string, resolved *internalversion.Stage, resolveErr error) *v1alpha1.StageStatus {
+	status := &v1alpha1.StageStatus{}
+
+	valid := v1alpha1.Condition{
+		Type:   v1alpha1.StageConditionValid,
+		Status: v1alpha1.ConditionTrue,
+		Reason: "Compiled",
+	}
+	if resolveErr != nil {
+		valid.Status = v1alpha1.ConditionFalse
+		valid.Reason = "ResolveFailed"
+		valid.Message = resolveErr.Error()
+	} else if _, err := NewLifecycleStage(resolved); err != nil {
+		valid.Status = v1alpha1.ConditionFalse
+		valid.Reason = "CompileFailed"
+		valid.Message = err.Error()
+	}
+
+	// Keep the transition time if the condition is not changed
+	valid.LastTransitionTime = metav1.NewTime(c.clock.Now())
+	if latest, ok := c.statuses[name]; ok {
+		for _, cond := range latest.Conditions {
+			if cond.Type == valid.Type && cond.Status == valid.Status {
+				valid.LastTransitionTime = cond.LastTransitionTime
+				break
+			}
+		}
+	}
+	status.Conditions = append(status.Conditions, valid)
+
+	if counter, ok := c.counters.Load(name); ok {
+		status.Applied = counter.applied.Load()
+		status.Failed = counter.failed.Load()
+	}
+	return status
+}
+
+func (c *StageStatusController) patchStatus(ctx context.Context, name string, status *v1alpha1.StageStatus) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"status": status,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.typedKwokClient.KwokV1alpha1().Stages().Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{}, "status")
+	return err
+}
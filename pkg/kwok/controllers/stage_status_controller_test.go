@@ -0,0 +1,170 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/apis/v1alpha1"
+	"sigs.k8s.io/kwok/pkg/client/clientset/versioned/fake"
+	"sigs.k8s.io/kwok/pkg/config/resources"
+)
+
+func TestStageStatusController(t *testing.T) {
+	stages := []*internalversion.Stage{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "valid",
+			},
+			Spec: internalversion.StageSpec{
+				Selector: &internalversion.StageSelector{
+					MatchExpressions: []internalversion.SelectorRequirement{
+						{
+							Key:      ".status.phase",
+							Operator: internalversion.SelectorOpDoesNotExist,
+						},
+					},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "invalid",
+			},
+			Spec: internalversion.StageSpec{
+				Selector: &internalversion.StageSelector{
+					MatchExpressions: []internalversion.SelectorRequirement{
+						{
+							Key:      ".status.[",
+							Operator: internalversion.SelectorOpDoesNotExist,
+						},
+					},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "inherit-invalid",
+			},
+			Spec: internalversion.StageSpec{
+				Extends: "invalid",
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "circular",
+			},
+			Spec: internalversion.StageSpec{
+				Extends: "circular",
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "missing-include",
+			},
+			Spec: internalversion.StageSpec{
+				Next: internalversion.StageNext{
+					StatusTemplate: `{{ include "missing" . }}`,
+				},
+			},
+		},
+	}
+
+	client := fake.NewSimpleClientset(
+		&v1alpha1.Stage{ObjectMeta: metav1.ObjectMeta{Name: "valid"}},
+		&v1alpha1.Stage{ObjectMeta: metav1.ObjectMeta{Name: "invalid"}},
+		&v1alpha1.Stage{ObjectMeta: metav1.ObjectMeta{Name: "inherit-invalid"}},
+		&v1alpha1.Stage{ObjectMeta: metav1.ObjectMeta{Name: "circular"}},
+		&v1alpha1.Stage{ObjectMeta: metav1.ObjectMeta{Name: "missing-include"}},
+	)
+	c, err := NewStageStatusController(StageStatusControllerConfig{
+		TypedKwokClient: client,
+		StageGetter:     resources.NewStaticGetter(stages),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Record("valid", nil)
+	c.Record("valid", nil)
+	c.Record("valid", fmt.Errorf("failed"))
+
+	ctx := context.Background()
+	c.sync(ctx)
+
+	tests := []struct {
+		name        string
+		wantStatus  v1alpha1.ConditionStatus
+		wantReason  string
+		wantApplied int64
+		wantFailed  int64
+	}{
+		{
+			name:        "valid",
+			wantStatus:  v1alpha1.ConditionTrue,
+			wantReason:  "Compiled",
+			wantApplied: 2,
+			wantFailed:  1,
+		},
+		{
+			name:       "invalid",
+			wantStatus: v1alpha1.ConditionFalse,
+			wantReason: "CompileFailed",
+		},
+		{
+			name:       "inherit-invalid",
+			wantStatus: v1alpha1.ConditionFalse,
+			wantReason: "CompileFailed",
+		},
+		{
+			name:       "circular",
+			wantStatus: v1alpha1.ConditionFalse,
+			wantReason: "ResolveFailed",
+		},
+		{
+			name:       "missing-include",
+			wantStatus: v1alpha1.ConditionFalse,
+			wantReason: "ResolveFailed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stage, err := client.KwokV1alpha1().Stages().Get(ctx, tt.name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stage.Status.Conditions) != 1 {
+				t.Fatalf("want 1 condition, got %d", len(stage.Status.Conditions))
+			}
+			cond := stage.Status.Conditions[0]
+			if cond.Type != v1alpha1.StageConditionValid || cond.Status != tt.wantStatus || cond.Reason != tt.wantReason {
+				t.Errorf("want condition %s=%s reason %s, got %s=%s reason %s", v1alpha1.StageConditionValid, tt.wantStatus, tt.wantReason, cond.Type, cond.Status, cond.Reason)
+			}
+			if tt.wantStatus == v1alpha1.ConditionFalse && cond.Message == "" {
+				t.Errorf("want message of the error")
+			}
+			if stage.Status.Applied != tt.wantApplied || stage.Status.Failed != tt.wantFailed {
+				t.Errorf("want applied %d failed %d, got applied %d failed %d", tt.wantApplied, tt.wantFailed, stage.Status.Applied, stage.Status.Failed)
+			}
+		})
+	}
+}
@@ -18,11 +18,15 @@ package controllers
 
 import (
 	"net"
+	"strings"
 	"sync"
+	"time"
 
 	"k8s.io/apimachinery/pkg/labels"
 
+	"sigs.k8s.io/kwok/pkg/utils/maps"
 	utilsnet "sigs.k8s.io/kwok/pkg/utils/net"
+	"sigs.k8s.io/kwok/pkg/utils/queue"
 )
 
 func parseCIDR(s string) (*net.IPNet, error) {
@@ -112,4 +116,61 @@ type resourceStageJob[T any] struct {
 	Resource T
 	Stage    *LifecycleStage
 	Key      string
+	Delay    time.Duration
+	// Time is when the job is due to be played.
+	Time time.Time
+}
+
+// stageJobKey returns the key of the job of the stage group on the resource,
+// the stages of different groups are played on the same resource independently.
+func stageJobKey(key, group string) string {
+	if group == "" {
+		return key
+	}
+	return key + "#" + group
+}
+
+// takeStageJobs cancels the delayed jobs of the stage groups on the resource,
+// and returns the jobs which are canceled before being played by their keys.
+func takeStageJobs[T comparable](q queue.DelayingQueue[resourceStageJob[T]], mapping *maps.SyncMap[string, resourceStageJob[T]], key string, groups []string) map[string]resourceStageJob[T] {
+	var jobs map[string]resourceStageJob[T]
+	for _, group := range groups {
+		jobKey := stageJobKey(key, group)
+		resourceJob, ok := mapping.LoadAndDelete(jobKey)
+		if !ok || !q.Cancel(resourceJob) {
+			continue
+		}
+		if jobs == nil {
+			jobs = map[string]resourceStageJob[T]{}
+		}
+		jobs[jobKey] = resourceJob
+	}
+	return jobs
+}
+
+// nextStageJob returns the job of the stage on the new version of the resource.
+// The job of the same stage taken from the queue keeps its due time,
+// so that the delay of the stage is not sampled again on every update of the resource.
+func nextStageJob[T any](taken map[string]resourceStageJob[T], jobKey string, stage *LifecycleStage, resource T) (resourceStageJob[T], bool) {
+	resourceJob, ok := taken[jobKey]
+	if !ok || resourceJob.Stage != stage {
+		return resourceStageJob[T]{}, false
+	}
+	resourceJob.Resource = resource
+	return resourceJob, true
+}
+
+// cancelStageJobs cancels all the delayed jobs on the resource,
+// including the jobs of the groups which are no longer in the lifecycle.
+func cancelStageJobs[T comparable](q queue.DelayingQueue[resourceStageJob[T]], mapping *maps.SyncMap[string, resourceStageJob[T]], key string) {
+	prefix := key + "#"
+	mapping.Range(func(jobKey string, resourceJob resourceStageJob[T]) bool {
+		if jobKey != key && !strings.HasPrefix(jobKey, prefix) {
+			return true
+		}
+		if _, ok := mapping.LoadAndDelete(jobKey); ok {
+			q.Cancel(resourceJob)
+		}
+		return true
+	})
 }
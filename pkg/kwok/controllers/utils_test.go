@@ -19,7 +19,14 @@ package controllers
 import (
 	"net"
 	"reflect"
+	"sort"
 	"testing"
+	"time"
+
+	testingclock "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/kwok/pkg/utils/maps"
+	"sigs.k8s.io/kwok/pkg/utils/queue"
 )
 
 func Test_parseCIDR(t *testing.T) {
@@ -131,3 +138,51 @@ func Test_ipPool_new(t *testing.T) {
 		})
 	}
 }
+
+func Test_stageJobs(t *testing.T) {
+	now := time.Now()
+	clk := testingclock.NewFakeClock(now)
+	stage := &LifecycleStage{name: "stage"}
+	otherStage := &LifecycleStage{name: "other"}
+
+	q := queue.NewDelayingQueue[resourceStageJob[string]](clk)
+	mapping := maps.SyncMap[string, resourceStageJob[string]]{}
+	for _, jobKey := range []string{"default/pod0", "default/pod0#a", "default/pod0#b", "default/pod01"} {
+		job := resourceStageJob[string]{
+			Resource: "v1",
+			Stage:    stage,
+			Key:      jobKey,
+			Delay:    time.Minute,
+			Time:     now.Add(time.Minute),
+		}
+		q.AddAfter(job, time.Minute)
+		mapping.Store(jobKey, job)
+	}
+
+	taken := takeStageJobs(q, &mapping, "default/pod0", []string{"", "a"})
+	if len(taken) != 2 {
+		t.Fatalf("want 2 jobs taken, got %d", len(taken))
+	}
+
+	job, ok := nextStageJob(taken, "default/pod0", stage, "v2")
+	if !ok {
+		t.Fatal("want the job of the same stage kept")
+	}
+	if job.Resource != "v2" || !job.Time.Equal(now.Add(time.Minute)) {
+		t.Errorf("want job of v2 due at %s, got %s due at %s", now.Add(time.Minute), job.Resource, job.Time)
+	}
+	if _, ok := nextStageJob(taken, "default/pod0#a", otherStage, "v2"); ok {
+		t.Error("want the job of the other stage not kept")
+	}
+
+	// The group b is no longer in the lifecycle
+	cancelStageJobs(q, &mapping, "default/pod0")
+	keys := mapping.Keys()
+	sort.Strings(keys)
+	if want := []string{"default/pod01"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("want jobs %v left, got %v", want, keys)
+	}
+	if q.Cancel(resourceStageJob[string]{Resource: "v1", Stage: stage, Key: "default/pod0#b", Delay: time.Minute, Time: now.Add(time.Minute)}) {
+		t.Error("want the job of the removed group canceled")
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/utils/maps"
+)
+
+// defaultStageWebhookTimeout is the timeout of the webhook if it is not set
+const defaultStageWebhookTimeout = 10 * time.Second
+
+// maxStageWebhookResponseSize is the max size of the body responded by the webhook,
+// the larger response fails the call rather than being read into the memory.
+const maxStageWebhookResponseSize = 3 * 1024 * 1024
+
+// StageWebhookRequest is the body POSTed to the webhook of the stage
+type StageWebhookRequest struct {
+	// Stage is the name of the stage.
+	Stage string `json:"stage"`
+	// Attempt is the number of times the stage has been played on the resource, including this one.
+	Attempt int64 `json:"attempt"`
+	// Object is the resource which the stage is played on.
+	Object interface{} `json:"object"`
+}
+
+// StageWebhookResponse is the body responded by the webhook of the stage
+type StageWebhookResponse struct {
+	// Patches are applied to the resource in order.
+	Patches []StageWebhookPatch `json:"patches,omitempty"`
+	// Events are sent for the resource.
+	Events []StageWebhookEvent `json:"events,omitempty"`
+	// Delete means the resource will be deleted.
+	Delete bool `json:"delete,omitempty"`
+}
+
+// StageWebhookPatch is a patch responded by the webhook
+type StageWebhookPatch struct {
+	// Subresource indicates the name of the subresource that will be patched.
+	Subresource string `json:"subresource,omitempty"`
+	// Type indicates the type of the patch, one of json, merge (default) and strategic.
+	Type *internalversion.StagePatchType `json:"type,omitempty"`
+	// Patch is the patch sent to the resource.
+	Patch json.RawMessage `json:"patch"`
+}
+
+// StageWebhookEvent is an event responded by the webhook
+type StageWebhookEvent struct {
+	Type    string `json:"type"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// validateStageWebhook checks the url and the CA bundle of the webhook
+func validateStageWebhook(webhook *internalversion.StageWebhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil {
+		return fmt.Errorf("webhook url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("webhook url %q must be http or https", webhook.URL)
+	}
+	if webhook.TimeoutMilliseconds != nil && *webhook.TimeoutMilliseconds < 1 {
+		return fmt.Errorf("webhook timeoutMilliseconds must be at least 1, got %d", *webhook.TimeoutMilliseconds)
+	}
+	if len(webhook.CABundle) != 0 && !x509.NewCertPool().AppendCertsFromPEM(webhook.CABundle) {
+		return fmt.Errorf("webhook caBundle has no valid certificate")
+	}
+	if webhook.FailurePolicy != nil {
+		switch *webhook.FailurePolicy {
+		case internalversion.StageWebhookFailurePolicyFail, internalversion.StageWebhookFailurePolicyIgnore:
+		default:
+			return fmt.Errorf("unsupported webhook failurePolicy %q", *webhook.FailurePolicy)
+		}
+	}
+	return nil
+}
+
+// ignoreStageWebhookFailure returns true if the failures of the webhook are ignored
+func ignoreStageWebhookFailure(webhook *internalversion.StageWebhook) bool {
+	return webhook.FailurePolicy != nil && *webhook.FailurePolicy == internalversion.StageWebhookFailurePolicyIgnore
+}
+
+// stageWebhookClient calls the webhooks of the stages
+type stageWebhookClient struct {
+	// clients are the http clients for each CA bundle
+	clients maps.SyncMap[string, *http.Client]
+}
+
+func (c *stageWebhookClient) httpClient(caBundle []byte) (*http.Client, error) {
+	client, ok := c.clients.Load(string(caBundle))
+	if ok {
+		return client, nil
+	}
+
+	if len(caBundle) == 0 {
+		client = &http.Client{}
+	} else {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("webhook caBundle has no valid certificate")
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+		client = &http.Client{
+			Transport: transport,
+		}
+	}
+	client, _ = c.clients.LoadOrStore(string(caBundle), client)
+	return client, nil
+}
+
+// Call posts the resource to the webhook and returns its response
+func (c *stageWebhookClient) Call(ctx context.Context, webhook *internalversion.StageWebhook, stageName string, attempt int64, resource interface{}) (*StageWebhookResponse, error) {
+	client, err := c.httpClient(webhook.CABundle)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(StageWebhookRequest{
+		Stage:   stageName,
+		Attempt: attempt,
+		Object:  resource,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := defaultStageWebhookTimeout
+	if webhook.TimeoutMilliseconds != nil {
+		timeout = time.Duration(*webhook.TimeoutMilliseconds) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	// Read one more byte to tell whether the response is over the max size
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxStageWebhookResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxStageWebhookResponseSize {
+		return nil, fmt.Errorf("webhook response is larger than %d bytes", maxStageWebhookResponseSize)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("webhook responded %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+
+	result := &StageWebhookResponse{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return result, nil
+	}
+	err = json.Unmarshal(data, result)
+	if err != nil {
+		return nil, fmt.Errorf("webhook response: %w", err)
+	}
+	for i, patch := range result.Patches {
+		if len(patch.Patch) == 0 {
+			return nil, fmt.Errorf("webhook response: patch %d is empty", i)
+		}
+	}
+	return result, nil
+}
+
+// applyStageWebhookPatches applies the patches responded by the webhook in order,
+// it returns the latest resource, or nil if no patch is applied.
+func applyStageWebhookPatches[T any](ctx context.Context, resource T, patches []StageWebhookPatch,
+	patchResource func(ctx context.Context, resource T, patchType types.PatchType, patch []byte, subresources ...string) (T, error)) (T, error) {
+	var result T
+	for i := range patches {
+		patch := &patches[i]
+		patchType, err := stagePatchType(&internalversion.StagePatch{Type: patch.Type})
+		if err != nil {
+			return result, fmt.Errorf("webhook patch %d: %w", i, err)
+		}
+		latest, err := patchResource(ctx, resource, patchType, patch.Patch, patch.Subresource)
+		if err != nil {
+			return result, fmt.Errorf("webhook patch %d: %w", i, err)
+		}
+		if !isResourceSubresource(patch.Subresource) {
+			continue
+		}
+		result = latest
+	}
+	return result, nil
+}
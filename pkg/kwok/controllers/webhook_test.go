@@ -0,0 +1,301 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/utils/format"
+)
+
+func TestStageWebhookClient(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Stage   string     `json:"stage"`
+			Attempt int64      `json:"attempt"`
+			Object  corev1.Pod `json:"object"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch req.Object.Name {
+		case "slow":
+			time.Sleep(time.Second)
+		case "broken":
+			http.Error(w, "out of quota", http.StatusInternalServerError)
+			return
+		case "empty":
+			return
+		case "large":
+			_, _ = w.Write(bytes.Repeat([]byte(" "), maxStageWebhookResponseSize+1))
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(StageWebhookResponse{
+			Patches: []StageWebhookPatch{
+				{
+					Subresource: "status",
+					Patch:       json.RawMessage(`{"status":{"phase":"Running"}}`),
+				},
+			},
+			Events: []StageWebhookEvent{
+				{
+					Type:    corev1.EventTypeNormal,
+					Reason:  req.Stage,
+					Message: req.Object.Name,
+				},
+			},
+			Delete: req.Attempt > 1,
+		})
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+	caBundle := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: tlsServer.Certificate().Raw,
+	})
+
+	tests := []struct {
+		name    string
+		webhook internalversion.StageWebhook
+		pod     string
+		attempt int64
+		want    *StageWebhookResponse
+		wantErr bool
+	}{
+		{
+			name: "http",
+			webhook: internalversion.StageWebhook{
+				URL: server.URL,
+			},
+			pod:     "pod0",
+			attempt: 1,
+			want: &StageWebhookResponse{
+				Patches: []StageWebhookPatch{
+					{
+						Subresource: "status",
+						Patch:       json.RawMessage(`{"status":{"phase":"Running"}}`),
+					},
+				},
+				Events: []StageWebhookEvent{
+					{
+						Type:    corev1.EventTypeNormal,
+						Reason:  "boot",
+						Message: "pod0",
+					},
+				},
+			},
+		},
+		{
+			name: "https with ca bundle",
+			webhook: internalversion.StageWebhook{
+				URL:      tlsServer.URL,
+				CABundle: caBundle,
+			},
+			pod:     "pod0",
+			attempt: 2,
+			want: &StageWebhookResponse{
+				Patches: []StageWebhookPatch{
+					{
+						Subresource: "status",
+						Patch:       json.RawMessage(`{"status":{"phase":"Running"}}`),
+					},
+				},
+				Events: []StageWebhookEvent{
+					{
+						Type:    corev1.EventTypeNormal,
+						Reason:  "boot",
+						Message: "pod0",
+					},
+				},
+				Delete: true,
+			},
+		},
+		{
+			name: "https without ca bundle",
+			webhook: internalversion.StageWebhook{
+				URL: tlsServer.URL,
+			},
+			pod:     "pod0",
+			wantErr: true,
+		},
+		{
+			name: "empty response",
+			webhook: internalversion.StageWebhook{
+				URL: server.URL,
+			},
+			pod:  "empty",
+			want: &StageWebhookResponse{},
+		},
+		{
+			name: "too large response",
+			webhook: internalversion.StageWebhook{
+				URL: server.URL,
+			},
+			pod:     "large",
+			wantErr: true,
+		},
+		{
+			name: "error status",
+			webhook: internalversion.StageWebhook{
+				URL: server.URL,
+			},
+			pod:     "broken",
+			wantErr: true,
+		},
+		{
+			name: "timeout",
+			webhook: internalversion.StageWebhook{
+				URL:                 server.URL,
+				TimeoutMilliseconds: format.Ptr[int64](100),
+			},
+			pod:     "slow",
+			wantErr: true,
+		},
+	}
+
+	client := &stageWebhookClient{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      tt.pod,
+					Namespace: "default",
+				},
+			}
+			got, err := client.Call(context.Background(), &tt.webhook, "boot", tt.attempt, pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Call() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Call() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyStageWebhookPatches(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "pod0",
+		},
+	}
+
+	var got []string
+	patchResource := func(ctx context.Context, pod *corev1.Pod, patchType types.PatchType, patch []byte, subresources ...string) (*corev1.Pod, error) {
+		got = append(got, string(patchType)+" "+subresources[0]+" "+string(patch))
+		return pod, nil
+	}
+
+	result, err := applyStageWebhookPatches(context.Background(), pod, []StageWebhookPatch{
+		{
+			Patch: json.RawMessage(`{"metadata":{"labels":{"a":"b"}}}`),
+		},
+		{
+			Subresource: "status",
+			Type:        format.Ptr(internalversion.StagePatchTypeJSONPatch),
+			Patch:       json.RawMessage(`[{"op":"add","path":"/status/phase","value":"Running"}]`),
+		},
+	}, patchResource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != pod {
+		t.Errorf("want the patched pod, got %v", result)
+	}
+	want := []string{
+		string(types.MergePatchType) + `  {"metadata":{"labels":{"a":"b"}}}`,
+		string(types.JSONPatchType) + ` status [{"op":"add","path":"/status/phase","value":"Running"}]`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want patches %q, got %q", want, got)
+	}
+}
+
+func TestNewLifecycleStageWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook internalversion.StageWebhook
+		wantErr bool
+	}{
+		{
+			name: "default timeout",
+			webhook: internalversion.StageWebhook{
+				URL: "http://127.0.0.1:8080/next",
+			},
+		},
+		{
+			name: "timeout",
+			webhook: internalversion.StageWebhook{
+				URL:                 "http://127.0.0.1:8080/next",
+				TimeoutMilliseconds: format.Ptr[int64](1),
+			},
+		},
+		{
+			name: "zero timeout",
+			webhook: internalversion.StageWebhook{
+				URL:                 "http://127.0.0.1:8080/next",
+				TimeoutMilliseconds: format.Ptr[int64](0),
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported scheme",
+			webhook: internalversion.StageWebhook{
+				URL: "ftp://127.0.0.1/next",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLifecycleStage(&internalversion.Stage{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: internalversion.StageSpec{
+					Selector: &internalversion.StageSelector{},
+					Next: internalversion.StageNext{
+						Webhook: &tt.webhook,
+					},
+				},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewLifecycleStage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/wzshiming/easycel"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // NodeEvaluatorConfig holds configuration for a cel program
@@ -119,6 +120,7 @@ func (e *Environment) init() error {
 		"node":      corev1.Node{},
 		"pod":       corev1.Pod{},
 		"container": corev1.Container{},
+		"self":      map[string]any{},
 	}
 
 	funcs := map[string][]any{}
@@ -135,18 +137,26 @@ func (e *Environment) init() error {
 		sinceSecondName            = "SinceSecond"
 		unixSecondName             = "UnixSecond"
 	)
+	now := timeNow
 	if e.conf.Now != nil {
-		funcs[nowOldName] = append(funcs[nowOldName], e.conf.Now)
-		funcs[nowName] = append(funcs[nowName], e.conf.Now)
-	} else {
-		funcs[nowOldName] = append(funcs[nowOldName], timeNow)
-		funcs[nowName] = append(funcs[nowName], timeNow)
+		now = e.conf.Now
 	}
+	funcs[nowOldName] = append(funcs[nowOldName], now)
+	funcs[nowName] = append(funcs[nowName], now)
 
 	funcs[mathRandName] = append(funcs[mathRandName], mathRand)
 
-	methods[sinceSecondName] = append(methods[sinceSecondName], sinceSecond[*corev1.Node], sinceSecond[*corev1.Pod])
-	funcs[sinceSecondName] = append(funcs[sinceSecondName], sinceSecond[*corev1.Node], sinceSecond[*corev1.Pod])
+	sinceSecondByNode := func(node *corev1.Node) float64 {
+		return sinceSecond(node, now())
+	}
+	sinceSecondByPod := func(pod *corev1.Pod) float64 {
+		return sinceSecond(pod, now())
+	}
+	sinceSecondBySelf := func(self map[string]any) float64 {
+		return sinceSecondUnstructured(self, now())
+	}
+	methods[sinceSecondName] = append(methods[sinceSecondName], sinceSecondByNode, sinceSecondByPod, sinceSecondBySelf)
+	funcs[sinceSecondName] = append(funcs[sinceSecondName], sinceSecondByNode, sinceSecondByPod, sinceSecondBySelf)
 
 	methods[unixSecondName] = append(methods[unixSecondName], unixSecond)
 	funcs[unixSecondName] = append(funcs[unixSecondName], unixSecond)
@@ -244,8 +254,8 @@ type Evaluator struct {
 	program  cel.Program
 }
 
-func resultUniqueKey(node *corev1.Node, pod *corev1.Pod, container *corev1.Container) string {
-	tmp := make([]string, 0, 5)
+func resultUniqueKey(node *corev1.Node, pod *corev1.Pod, container *corev1.Container, self map[string]any) string {
+	tmp := make([]string, 0, 7)
 	if node != nil {
 		tmp = append(tmp, string(node.UID), node.ResourceVersion)
 	}
@@ -255,6 +265,10 @@ func resultUniqueKey(node *corev1.Node, pod *corev1.Pod, container *corev1.Conta
 	if container != nil {
 		tmp = append(tmp, container.Name)
 	}
+	if self != nil {
+		u := unstructured.Unstructured{Object: self}
+		tmp = append(tmp, string(u.GetUID()), u.GetResourceVersion())
+	}
 	return strings.Join(tmp, "/")
 }
 
@@ -269,7 +283,7 @@ func (e *Evaluator) evaluate(data Data) (ref.Val, error) {
 			e.cacheVer = *e.latestCacheVer
 		}
 
-		key = resultUniqueKey(data.Node, data.Pod, data.Container)
+		key = resultUniqueKey(data.Node, data.Pod, data.Container, data.Self)
 		if val, ok := e.cache[key]; ok {
 			return val, nil
 		}
@@ -278,6 +292,7 @@ func (e *Evaluator) evaluate(data Data) (ref.Val, error) {
 		"node":      data.Node,
 		"pod":       data.Pod,
 		"container": data.Container,
+		"self":      data.Self,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to evaluate metric expression: %w", err)
@@ -328,9 +343,55 @@ func (e *Evaluator) EvaluateString(data Data) (string, error) {
 	return string(v), nil
 }
 
+// EvaluateBool evaluates a cel program and returns a bool
+func (e *Evaluator) EvaluateBool(data Data) (bool, error) {
+	refVal, err := e.evaluate(data)
+	if err != nil {
+		return false, err
+	}
+
+	v, ok := refVal.(types.Bool)
+	if !ok {
+		return false, fmt.Errorf("unsupported bool type: %T", refVal)
+	}
+	return bool(v), nil
+}
+
+// EvaluateDuration evaluates a cel program and returns a time.Duration.
+// If the value is a timestamp, the duration is the time from now to the timestamp.
+// If the value is a string, it is parsed as a RFC3339 timestamp or a duration.
+func (e *Evaluator) EvaluateDuration(data Data, now time.Time) (time.Duration, error) {
+	refVal, err := e.evaluate(data)
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := refVal.(type) {
+	case types.Duration:
+		return v.Duration, nil
+	case types.Timestamp:
+		return v.Time.Sub(now), nil
+	case types.String:
+		t, err := time.Parse(time.RFC3339Nano, string(v))
+		if err == nil {
+			return t.Sub(now), nil
+		}
+		d, err := time.ParseDuration(string(v))
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse duration %q: %w", string(v), err)
+		}
+		return d, nil
+	default:
+		return 0, fmt.Errorf("unsupported duration type: %T", refVal)
+	}
+}
+
 // Data is a data structure that is passed to the cel program
 type Data struct {
 	Node      *corev1.Node
 	Pod       *corev1.Pod
 	Container *corev1.Container
+
+	// Self is the resource in the JSON standard form, it is used by the stages.
+	Self map[string]any
 }
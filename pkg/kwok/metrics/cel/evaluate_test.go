@@ -62,3 +62,53 @@ func TestNodeEvaluation(t *testing.T) {
 		t.Errorf("expected %v, got %v", 17280, actual)
 	}
 }
+
+func TestSelfEvaluation(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	env, err := NewEnvironment(NodeEvaluatorConfig{
+		Now: func() time.Time {
+			return now
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to instantiate Evaluator: %v", err)
+	}
+
+	self := map[string]any{
+		"metadata": map[string]any{
+			"creationTimestamp": now.Add(-time.Hour).Format(time.RFC3339),
+		},
+		"status": map[string]any{
+			"restartCount": float64(5),
+		},
+	}
+
+	eval, err := env.Compile("self.SinceSecond() >= 3600.0 && self.status.restartCount > 3")
+	if err != nil {
+		t.Fatalf("failed to compile expression: %v", err)
+	}
+	actual, err := eval.EvaluateBool(Data{
+		Self: self,
+	})
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	if !actual {
+		t.Errorf("expected true, got false")
+	}
+
+	eval, err = env.Compile(`timestamp(self.metadata.creationTimestamp) + duration("2h")`)
+	if err != nil {
+		t.Fatalf("failed to compile expression: %v", err)
+	}
+	duration, err := eval.EvaluateDuration(Data{
+		Self: self,
+	}, now)
+	if err != nil {
+		t.Fatalf("evaluation failed: %v", err)
+	}
+	if duration != time.Hour {
+		t.Errorf("expected %v, got %v", time.Hour, duration)
+	}
+}
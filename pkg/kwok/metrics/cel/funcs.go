@@ -21,6 +21,7 @@ import (
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func timeNow() time.Time {
@@ -35,8 +36,13 @@ type sinceResource interface {
 	GetCreationTimestamp() metav1.Time
 }
 
-func sinceSecond[T sinceResource](t T) float64 {
-	return time.Since(t.GetCreationTimestamp().Time).Seconds()
+func sinceSecond[T sinceResource](t T, now time.Time) float64 {
+	return now.Sub(t.GetCreationTimestamp().Time).Seconds()
+}
+
+func sinceSecondUnstructured(self map[string]any, now time.Time) float64 {
+	u := unstructured.Unstructured{Object: self}
+	return now.Sub(u.GetCreationTimestamp().Time).Seconds()
 }
 
 func mathRand() float64 {
@@ -26,7 +26,7 @@ var disableHandler = getHandlerForDisabledEndpoint("Debug endpoints are disabled
 func (s *Server) InstallDebuggingDisabledHandlers() {
 	paths := []string{
 		"/run/", "/exec/", "/attach/", "/portForward/", "/containerLogs/",
-		"/runningpods/", pprofBasePath, "/logs/"}
+		"/runningpods/", pprofBasePath, "/logs/", "/debug/stages/"}
 	for _, p := range paths {
 		s.restfulCont.Handle(p, disableHandler)
 	}
@@ -99,4 +99,16 @@ func (s *Server) InstallDebuggingHandlers() {
 		To(s.getContainerLogs).
 		Operation("getContainerLogs"))
 	s.restfulCont.Add(ws)
+
+	ws = new(restful.WebService)
+	ws.
+		Path("/debug/stages").
+		Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("/{kind}/{namespace}/{name}").
+		To(s.getStageTransitions).
+		Operation("getStageTransitions"))
+	ws.Route(ws.GET("/{kind}/{name}").
+		To(s.getStageTransitions).
+		Operation("getStageTransitions"))
+	s.restfulCont.Add(ws)
 }
@@ -0,0 +1,38 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+// getStageTransitions handles the request of the recent stage transitions of a resource
+func (s *Server) getStageTransitions(req *restful.Request, resp *restful.Response) {
+	kind := req.PathParameter("kind")
+	namespace := req.PathParameter("namespace")
+	name := req.PathParameter("name")
+
+	transitions, ok := s.dataSource.StageTransitions(kind, namespace, name)
+	if !ok {
+		_ = resp.WriteError(http.StatusNotFound, fmt.Errorf("no stage transitions of %s %s/%s", kind, namespace, name))
+		return
+	}
+	_ = resp.WriteAsJson(transitions)
+}
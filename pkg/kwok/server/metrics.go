@@ -43,6 +43,7 @@ func (s *Server) InstallMetrics(ctx context.Context) error {
 	env, err := cel.NewEnvironment(cel.NodeEvaluatorConfig{
 		EnableEvaluatorCache:   true,
 		EnableResultCache:      true,
+		Now:                    s.clock.Now,
 		StartedContainersTotal: s.dataSource.StartedContainersTotal,
 	})
 	if err != nil {
@@ -28,11 +28,13 @@ import (
 	"github.com/wzshiming/cmux/pattern"
 	corev1 "k8s.io/api/core/v1"
 	remotecommandconsts "k8s.io/apimachinery/pkg/util/remotecommand"
+	"k8s.io/utils/clock"
 
 	"sigs.k8s.io/kwok/pkg/apis/internalversion"
 	"sigs.k8s.io/kwok/pkg/apis/v1alpha1"
 	"sigs.k8s.io/kwok/pkg/client/clientset/versioned"
 	"sigs.k8s.io/kwok/pkg/config/resources"
+	"sigs.k8s.io/kwok/pkg/kwok/controllers"
 	"sigs.k8s.io/kwok/pkg/kwok/metrics"
 	"sigs.k8s.io/kwok/pkg/log"
 	"sigs.k8s.io/kwok/pkg/utils/informer"
@@ -47,6 +49,7 @@ const (
 
 // Server is a server that can serve HTTP/HTTPS requests.
 type Server struct {
+	clock           clock.Clock
 	typedKwokClient versioned.Interface
 
 	enableCRDs []string
@@ -79,10 +82,12 @@ type DataSource interface {
 	metrics.DataSource
 	ListNodes() []string
 	StartedContainersTotal(nodeName string) int64
+	StageTransitions(kind, namespace, name string) ([]controllers.StageTransition, bool)
 }
 
 // Config holds configurations needed by the server handlers.
 type Config struct {
+	Clock           clock.Clock
 	TypedKwokClient versioned.Interface
 	EnableCRDs      []string
 
@@ -105,7 +110,12 @@ type Config struct {
 func NewServer(conf Config) (*Server, error) {
 	container := restful.NewContainer()
 
+	if conf.Clock == nil {
+		conf.Clock = clock.RealClock{}
+	}
+
 	s := &Server{
+		clock:                 conf.Clock,
 		typedKwokClient:       conf.TypedKwokClient,
 		enableCRDs:            conf.EnableCRDs,
 		restfulCont:           container,
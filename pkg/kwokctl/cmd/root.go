@@ -33,6 +33,7 @@ import (
 	"sigs.k8s.io/kwok/pkg/kwokctl/cmd/logs"
 	"sigs.k8s.io/kwok/pkg/kwokctl/cmd/scale"
 	"sigs.k8s.io/kwok/pkg/kwokctl/cmd/snapshot"
+	"sigs.k8s.io/kwok/pkg/kwokctl/cmd/stage"
 	"sigs.k8s.io/kwok/pkg/kwokctl/cmd/start"
 	"sigs.k8s.io/kwok/pkg/kwokctl/cmd/stop"
 	"sigs.k8s.io/kwok/pkg/kwokctl/dryrun"
@@ -69,6 +70,7 @@ func NewCommand(ctx context.Context) *cobra.Command {
 		logs.NewCommand(ctx),
 		scale.NewCommand(ctx),
 		snapshot.NewCommand(ctx),
+		stage.NewCommand(ctx),
 		export.NewCommand(ctx),
 	)
 	return cmd
@@ -0,0 +1,167 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package simulate is the simulate of the stages of a resource offline
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/config"
+	"sigs.k8s.io/kwok/pkg/kwok/controllers"
+	"sigs.k8s.io/kwok/pkg/utils/slices"
+	utilsyaml "sigs.k8s.io/kwok/pkg/utils/yaml"
+)
+
+type flagpole struct {
+	Resource  string
+	Stages    []string
+	Seed      int64
+	MaxSteps  int
+	StartTime string
+	NodeIP    string
+	NodeName  string
+	NodePort  int
+	CIDR      string
+}
+
+// NewCommand returns a new cobra.Command for stage simulating.
+func NewCommand(ctx context.Context) *cobra.Command {
+	conf := config.GetKwokConfiguration(ctx)
+	flags := &flagpole{
+		NodeIP:   conf.Options.NodeIP,
+		NodeName: conf.Options.NodeName,
+		NodePort: conf.Options.NodePort,
+		CIDR:     conf.Options.CIDR,
+	}
+
+	cmd := &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "simulate",
+		Short: "Simulate the stages of a resource offline",
+		Long: "Simulate the stages of a resource offline, print the matched stage, the delay, " +
+			"the rendered patches and the resulting resource of each step, " +
+			"until no stage matches, the resource is deleted or not modified, or the max steps is reached. " +
+			"The stages are loaded from --stage, or from --config if it is not specified.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runE(cmd.Context(), cmd.OutOrStdout(), flags)
+		},
+	}
+	cmd.Flags().StringVar(&flags.Resource, "resource", "", "Path to the manifest of the resource, - for stdin")
+	cmd.Flags().StringSliceVar(&flags.Stages, "stage", nil, "Path to the stages")
+	cmd.Flags().Int64Var(&flags.Seed, "seed", 0, "Seed of the random source, makes the weighted choice and jitter reproducible")
+	cmd.Flags().IntVar(&flags.MaxSteps, "max-steps", 100, "Maximum number of steps, 0 means unlimited")
+	cmd.Flags().StringVar(&flags.StartTime, "start-time", "", "Start time of the simulated clock in RFC3339 format, defaults to the current time")
+	cmd.Flags().StringVar(&flags.NodeIP, "node-ip", flags.NodeIP, "IP of the node")
+	cmd.Flags().StringVar(&flags.NodeName, "node-name", flags.NodeName, "Name of the node")
+	cmd.Flags().IntVar(&flags.NodePort, "node-port", flags.NodePort, "Port of the node")
+	cmd.Flags().StringVar(&flags.CIDR, "cidr", flags.CIDR, "CIDR of the pod ip")
+	return cmd
+}
+
+func runE(ctx context.Context, w io.Writer, flags *flagpole) error {
+	if flags.Resource == "" {
+		return fmt.Errorf("resource is required")
+	}
+
+	var startTime time.Time
+	if flags.StartTime != "" {
+		t, err := time.Parse(time.RFC3339, flags.StartTime)
+		if err != nil {
+			return fmt.Errorf("invalid start time: %w", err)
+		}
+		startTime = t
+	}
+
+	stages, err := loadStages(ctx, flags.Stages)
+	if err != nil {
+		return err
+	}
+	if len(stages) == 0 {
+		return fmt.Errorf("no stages found")
+	}
+
+	var r io.Reader
+	if flags.Resource == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(flags.Resource)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		r = f
+	}
+
+	decoder := utilsyaml.NewDecoder(r)
+	return decoder.DecodeToUnstructured(func(obj *unstructured.Unstructured) error {
+		ref := internalversion.StageResourceRef{
+			APIGroup: obj.GetAPIVersion(),
+			Kind:     obj.GetKind(),
+		}
+		lifecycle, err := controllers.NewLifecycle(slices.Filter(stages, func(stage *internalversion.Stage) bool {
+			return stage.Spec.ResourceRef == ref
+		}), nil)
+		if err != nil {
+			return err
+		}
+
+		simulator, err := controllers.NewSimulator(controllers.SimulatorConfig{
+			Lifecycle: lifecycle,
+			NodeIP:    flags.NodeIP,
+			NodeName:  flags.NodeName,
+			NodePort:  flags.NodePort,
+			CIDR:      flags.CIDR,
+			Seed:      flags.Seed,
+			StartTime: startTime,
+			MaxSteps:  flags.MaxSteps,
+		})
+		if err != nil {
+			return err
+		}
+
+		return simulator.Simulate(ctx, obj, func(step *controllers.SimulateStep) error {
+			data, err := yaml.Marshal(step)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "---\n%s", data)
+			return err
+		})
+	})
+}
+
+func loadStages(ctx context.Context, paths []string) ([]*internalversion.Stage, error) {
+	if len(paths) == 0 {
+		return config.FilterWithTypeFromContext[*internalversion.Stage](ctx), nil
+	}
+	objs, err := config.Load(ctx, paths...)
+	if err != nil {
+		return nil, err
+	}
+	return config.FilterWithType[*internalversion.Stage](objs), nil
+}
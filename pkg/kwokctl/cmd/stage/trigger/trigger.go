@@ -0,0 +1,150 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package trigger contains a command to trigger a stage on a resource in a cluster.
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+
+	"sigs.k8s.io/kwok/pkg/config"
+	"sigs.k8s.io/kwok/pkg/kwok/controllers"
+	"sigs.k8s.io/kwok/pkg/kwokctl/dryrun"
+	"sigs.k8s.io/kwok/pkg/kwokctl/runtime"
+	"sigs.k8s.io/kwok/pkg/log"
+	"sigs.k8s.io/kwok/pkg/utils/client"
+)
+
+type flagpole struct {
+	Name string
+
+	Namespace string
+	Stage     string
+}
+
+// NewCommand returns a new cobra.Command for stage triggering.
+func NewCommand(ctx context.Context) *cobra.Command {
+	flags := &flagpole{}
+
+	cmd := &cobra.Command{
+		Args:  cobra.ExactArgs(1),
+		Use:   "trigger <kind>/<name>",
+		Short: "Trigger a stage on a resource in cluster",
+		Long: "Trigger a stage on a resource in cluster by the " + controllers.NextStageAnnotation + " annotation, " +
+			"the stage is played next regardless of its selector, and the annotation is removed after that.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flags.Name = config.DefaultCluster
+			return runE(cmd.Context(), flags, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&flags.Stage, "stage", flags.Stage, "Name of the stage to trigger")
+	cmd.Flags().StringVarP(&flags.Namespace, "namespace", "n", flags.Namespace, "Namespace of the resource, defaults to default for the namespaced resources")
+	return cmd
+}
+
+func runE(ctx context.Context, flags *flagpole, arg string) error {
+	if flags.Stage == "" {
+		return fmt.Errorf("stage is required")
+	}
+	kind, resourceName, ok := strings.Cut(arg, "/")
+	if !ok || kind == "" || resourceName == "" {
+		return fmt.Errorf("resource %q is not in the form <kind>/<name>", arg)
+	}
+
+	name := config.ClusterName(flags.Name)
+	workdir := path.Join(config.ClustersDir, flags.Name)
+
+	logger := log.FromContext(ctx)
+	logger = logger.With("cluster", flags.Name)
+	ctx = log.NewContext(ctx, logger)
+
+	rt, err := runtime.DefaultRegistry.Load(ctx, name, workdir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			logger.Warn("Cluster is not exists")
+		}
+		return err
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				controllers.NextStageAnnotation: flags.Stage,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if dryrun.DryRun {
+		dryrun.PrintMessage("# Trigger stage %s on %s", flags.Stage, arg)
+		dryrun.PrintMessage("# Patch: %s", patch)
+		return nil
+	}
+
+	kubeconfigPath := rt.GetWorkdirPath(runtime.InHostKubeconfigName)
+	clientset, err := client.NewClientset("", kubeconfigPath)
+	if err != nil {
+		return err
+	}
+	restMapper, err := clientset.ToRESTMapper()
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := clientset.ToDynamicClient()
+	if err != nil {
+		return err
+	}
+
+	mapping, err := client.MappingFor(restMapper, kind)
+	if err != nil {
+		return err
+	}
+
+	var ri dynamic.ResourceInterface
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace := flags.Namespace
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+		ri = dynamicClient.Resource(mapping.Resource).Namespace(namespace)
+	} else {
+		ri = dynamicClient.Resource(mapping.Resource)
+	}
+
+	_, err = ri.Patch(ctx, resourceName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	logger.Info("Triggered stage",
+		"stage", flags.Stage,
+		"resource", arg,
+	)
+	return nil
+}
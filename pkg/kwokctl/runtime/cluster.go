@@ -206,6 +206,11 @@ func (c *Cluster) Save(ctx context.Context) error {
 		}
 	}
 
+	if !slices.Contains(conf.Options.EnableCRDs, v1alpha1.StageTemplateKind) {
+		stages := config.FilterWithTypeFromContext[*internalversion.StageTemplate](ctx)
+		objs = appendIntoInternalObjects(objs, stages...)
+	}
+
 	if !slices.Contains(conf.Options.EnableCRDs, v1alpha1.MetricKind) {
 		stages := config.FilterWithTypeFromContext[*internalversion.Metric](ctx)
 		objs = appendIntoInternalObjects(objs, stages...)
@@ -563,6 +568,7 @@ func (c *Cluster) InitCRDs(ctx context.Context) error {
 
 var crdDefines = map[string][]byte{
 	v1alpha1.StageKind:              crd.Stage,
+	v1alpha1.StageTemplateKind:      crd.StageTemplate,
 	v1alpha1.AttachKind:             crd.Attach,
 	v1alpha1.ClusterAttachKind:      crd.ClusterAttach,
 	v1alpha1.ExecKind:               crd.Exec,
@@ -0,0 +1,161 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// Clock is an alias of clock.Clock
+type Clock = clock.Clock
+
+// scaledClock is a clock which runs faster or slower than the base clock
+type scaledClock struct {
+	base  clock.Clock
+	scale float64
+	start time.Time
+}
+
+// NewScaledClock returns a clock which runs scale times as fast as the base clock, starting from the current time.
+// The durations passed to the clock are in the scaled time, and waited for duration/scale on the base clock.
+// The base clock is returned if the scale is 0 or 1.
+func NewScaledClock(base clock.Clock, scale float64) Clock {
+	if scale == 0 || scale == 1 {
+		return base
+	}
+	return &scaledClock{
+		base:  base,
+		scale: scale,
+		start: base.Now(),
+	}
+}
+
+// Now returns the scaled current time.
+func (c *scaledClock) Now() time.Time {
+	return c.toScaled(c.base.Now())
+}
+
+// Since returns the scaled time elapsed since t.
+func (c *scaledClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// After waits for the scaled duration and then sends the scaled current time on the returned channel.
+func (c *scaledClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer returns a new Timer which fires after the scaled duration.
+func (c *scaledClock) NewTimer(d time.Duration) clock.Timer {
+	t := &scaledTimer{
+		clock: c,
+		timer: c.base.NewTimer(c.toBase(d)),
+		c:     make(chan time.Time, 1),
+	}
+	t.forward()
+	return t
+}
+
+// Sleep sleeps for the scaled duration.
+func (c *scaledClock) Sleep(d time.Duration) {
+	c.base.Sleep(c.toBase(d))
+}
+
+// Tick returns the channel of a ticker which ticks every scaled duration with the scaled time.
+// Like time.Tick, the ticker is never stopped.
+func (c *scaledClock) Tick(d time.Duration) <-chan time.Time {
+	base := c.base.Tick(c.toBase(d))
+	if base == nil {
+		return nil
+	}
+	ch := make(chan time.Time, 1)
+	go func() {
+		for now := range base {
+			// Drop the ticks for the slow receivers like time.Ticker
+			select {
+			case ch <- c.toScaled(now):
+			default:
+			}
+		}
+	}()
+	return ch
+}
+
+func (c *scaledClock) toScaled(t time.Time) time.Time {
+	return c.start.Add(time.Duration(float64(t.Sub(c.start)) * c.scale))
+}
+
+func (c *scaledClock) toBase(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / c.scale)
+}
+
+type scaledTimer struct {
+	clock *scaledClock
+	timer clock.Timer
+	c     chan time.Time
+
+	mut  sync.Mutex
+	stop chan struct{}
+}
+
+// forward converts the time fired by the base timer to the scaled time, until the timer is stopped
+func (t *scaledTimer) forward() {
+	stop := make(chan struct{})
+	t.stop = stop
+	go func() {
+		select {
+		case now := <-t.timer.C():
+			select {
+			case t.c <- t.clock.toScaled(now):
+			default:
+			}
+		case <-stop:
+		}
+	}()
+}
+
+func (t *scaledTimer) stopForward() {
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+}
+
+func (t *scaledTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *scaledTimer) Stop() bool {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	active := t.timer.Stop()
+	t.stopForward()
+	return active
+}
+
+func (t *scaledTimer) Reset(d time.Duration) bool {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	active := t.timer.Stop()
+	t.stopForward()
+	t.timer.Reset(t.clock.toBase(d))
+	t.forward()
+	return active
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clock
+
+import (
+	"testing"
+	"time"
+
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestScaledClock(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	base := clocktesting.NewFakeClock(start)
+
+	if got := NewScaledClock(base, 1); got != base {
+		t.Fatalf("want the base clock with scale 1")
+	}
+
+	c := NewScaledClock(base, 10)
+	after := c.After(10 * time.Second)
+	timer := c.NewTimer(20 * time.Second)
+
+	base.Step(time.Second)
+	if got, want := c.Now(), start.Add(10*time.Second); !got.Equal(want) {
+		t.Errorf("want now %v, got %v", want, got)
+	}
+	if got := c.Since(start); got != 10*time.Second {
+		t.Errorf("want since 10s, got %v", got)
+	}
+
+	select {
+	case got := <-after:
+		if want := start.Add(10 * time.Second); !got.Equal(want) {
+			t.Errorf("want after fired at %v, got %v", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("want after fired")
+	}
+
+	if !timer.Stop() {
+		t.Fatalf("want timer active")
+	}
+	timer.Reset(5 * time.Second)
+	base.Step(time.Second)
+	select {
+	case got := <-timer.C():
+		if want := start.Add(20 * time.Second); !got.Equal(want) {
+			t.Errorf("want timer fired at %v, got %v", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("want timer fired")
+	}
+
+	tick := c.Tick(10 * time.Second)
+	for !base.HasWaiters() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	base.Step(time.Second)
+	select {
+	case got := <-tick:
+		if want := start.Add(30 * time.Second); !got.Equal(want) {
+			t.Errorf("want tick at %v, got %v", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("want ticked")
+	}
+}
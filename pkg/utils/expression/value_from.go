@@ -55,7 +55,8 @@ func (d *durationFrom) Get(ctx context.Context, v interface{}, now time.Time) (t
 	if err != nil {
 		return 0, false
 	}
-	if len(out) == 0 {
+	// Fall back to the value if the expression has no result, e.g. a missing annotation.
+	if len(out) == 0 || out[0] == nil {
 		if d.value != nil {
 			return *d.value, true
 		}
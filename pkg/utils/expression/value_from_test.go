@@ -72,6 +72,30 @@ func TestDurationFrom_Get(t *testing.T) {
 			want:   1 * time.Second,
 			wantOk: true,
 		},
+		{
+			args: args{
+				value: format.Ptr(time.Duration(2)),
+				src:   format.Ptr(`.metadata.annotations["delay"]`),
+				v:     corev1.Pod{},
+			},
+			want:   2,
+			wantOk: true,
+		},
+		{
+			args: args{
+				value: format.Ptr(time.Duration(2)),
+				src:   format.Ptr(`.metadata.annotations["delay"]`),
+				v: corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Annotations: map[string]string{
+							"delay": "3s",
+						},
+					},
+				},
+			},
+			want:   3 * time.Second,
+			wantOk: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -17,10 +17,34 @@ limitations under the License.
 package gotpl
 
 import (
+	"bytes"
+	"fmt"
+	"text/template"
+
 	"github.com/Masterminds/sprig/v3"
 )
 
 var (
 	// genericFuncs is generic template functions.
-	genericFuncs = sprig.TxtFuncMap()
+	genericFuncs = func() template.FuncMap {
+		funcs := sprig.TxtFuncMap()
+		// include is a placeholder to make the parser happy, it is replaced by includeFunc after parsing.
+		funcs["include"] = func(name string, data interface{}) (string, error) {
+			return "", fmt.Errorf("include %q is not supported", name)
+		}
+		return funcs
+	}()
 )
+
+// includeFunc returns a function that executes the named template defined in temp
+// and returns the result as a string, so that it can be used in pipelines.
+func includeFunc(temp *template.Template) func(name string, data interface{}) (string, error) {
+	return func(name string, data interface{}) (string, error) {
+		buf := bytes.NewBuffer(nil)
+		err := temp.ExecuteTemplate(buf, name, data)
+		if err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+}
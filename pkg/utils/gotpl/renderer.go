@@ -68,6 +68,9 @@ func (r *renderer) render(buf *bytes.Buffer, text string, original interface{})
 		if err != nil {
 			return err
 		}
+		temp = temp.Funcs(template.FuncMap{
+			"include": includeFunc(temp),
+		})
 		r.cache.Store(text, temp)
 	}
 
@@ -76,6 +76,12 @@ func TestRenderToJSON(t *testing.T) {
 			templText: `{"foo":{{ list Foo .k | join "-" }}}`,
 			expected:  `{"foo":"bar-v1"}`,
 		},
+		{
+			name:      "with include",
+			original:  map[string]interface{}{"k": "v1"},
+			templText: `{{- define "kv" }}{{ .k }}-{{ . | len }}{{ end -}}` + "\n" + `{"foo":{{ include "kv" . | upper | quote }}}`,
+			expected:  `{"foo":"V1-1"}`,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
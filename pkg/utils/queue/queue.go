@@ -29,6 +29,8 @@ type Queue[T any] interface {
 	Get() (T, bool)
 	// GetOrWait returns an item from the queue or waits until an item is added.
 	GetOrWait() T
+	// GetOrWaitWithDone returns an item from the queue or waits until an item is added or the done is closed.
+	GetOrWaitWithDone(done <-chan struct{}) (T, bool)
 	// Len returns the number of items in the queue.
 	Len() int
 }
@@ -91,6 +93,26 @@ func (q *queue[T]) GetOrWait() T {
 	panic("unreachable")
 }
 
+func (q *queue[T]) GetOrWaitWithDone(done <-chan struct{}) (T, bool) {
+	t, ok := q.Get()
+	if ok {
+		return t, true
+	}
+
+	// Wait for an item to be added or done.
+	for {
+		select {
+		case <-done:
+			return t, false
+		case <-q.signal:
+			t, ok = q.Get()
+			if ok {
+				return t, true
+			}
+		}
+	}
+}
+
 func (q *queue[T]) Len() int {
 	q.mut.Lock()
 	defer q.mut.Unlock()
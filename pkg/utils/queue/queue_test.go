@@ -76,3 +76,32 @@ func TestBlock(t *testing.T) {
 		// expected
 	}
 }
+
+func TestBlockWithDone(t *testing.T) {
+	q := NewQueue[string]()
+
+	stop := make(chan struct{})
+	done := make(chan bool)
+	go func() {
+		_, ok := q.GetOrWaitWithDone(stop)
+		done <- ok
+	}()
+
+	select {
+	case <-time.After(100 * time.Millisecond):
+		// expected
+	case <-done:
+		t.Fatal("should block when queue is empty")
+	}
+
+	close(stop)
+
+	select {
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("should not block when done is closed")
+	case ok := <-done:
+		if ok {
+			t.Fatal("should not get an item when done is closed")
+		}
+	}
+}